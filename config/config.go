@@ -19,6 +19,7 @@ import (
 	"github.com/zalando/skipper"
 	"github.com/zalando/skipper/dataclients/kubernetes"
 	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/loadbalancer"
 	"github.com/zalando/skipper/net"
 	"github.com/zalando/skipper/proxy"
 	routesrv "github.com/zalando/skipper/routesrv"
@@ -40,12 +41,21 @@ type Config struct {
 	DevMode                         bool           `yaml:"dev-mode"`
 	SupportListener                 string         `yaml:"support-listener"`
 	DebugListener                   string         `yaml:"debug-listener"`
+	RoutingTraceSecret              string         `yaml:"routing-trace-secret"`
+	RoutingTraceAllowCIDRList       *listFlag      `yaml:"routing-trace-allow-cidrs"`
+	RoutingTraceAllowCIDRs          net.IPNets     `yaml:"-"`
+	ProxyProtocolTrustedCIDRList    *listFlag      `yaml:"proxy-protocol-trusted-cidrs"`
+	ProxyProtocolTrustedCIDRs       net.IPNets     `yaml:"-"`
+	EnableConnect                   bool           `yaml:"enable-connect"`
+	ConnectAllowlist                *listFlag      `yaml:"connect-allowlist"`
 	CertPathTLS                     string         `yaml:"tls-cert"`
 	KeyPathTLS                      string         `yaml:"tls-key"`
 	StatusChecks                    *listFlag      `yaml:"status-checks"`
 	PrintVersion                    bool           `yaml:"version"`
 	MaxLoopbacks                    int            `yaml:"max-loopbacks"`
 	DefaultHTTPStatus               int            `yaml:"default-http-status"`
+	MaxRequestBodySize              int64          `yaml:"max-request-body-size"`
+	ErrorPageTemplateDir            string         `yaml:"error-page-template-dir"`
 	PluginDir                       string         `yaml:"plugindir"`
 	LoadBalancerHealthCheckInterval time.Duration  `yaml:"lb-healthcheck-interval"`
 	ReverseSourcePredicate          bool           `yaml:"reverse-source-predicate"`
@@ -63,6 +73,13 @@ type Config struct {
 	DataclientPlugins               *pluginFlag    `yaml:"dataclient-plugin"`
 	MultiPlugins                    *pluginFlag    `yaml:"multi-plugin"`
 	CompressEncodings               *listFlag      `yaml:"compress-encodings"`
+	ResponseCacheMaxSize            int64          `yaml:"response-cache-max-size"`
+	OutlierDetection                bool           `yaml:"outlier-detection"`
+	OutlierConsecutiveFailures      int            `yaml:"outlier-consecutive-failures"`
+	OutlierLatencyThreshold         time.Duration  `yaml:"outlier-latency-threshold"`
+	OutlierBaseEjectionTime         time.Duration  `yaml:"outlier-base-ejection-time"`
+	OutlierMaxEjectionTime          time.Duration  `yaml:"outlier-max-ejection-time"`
+	OutlierMaxEjectionPercent       int            `yaml:"outlier-max-ejection-percent"`
 
 	// logging, metrics, profiling, tracing:
 	EnablePrometheusMetrics             bool      `yaml:"enable-prometheus-metrics"`
@@ -131,6 +148,8 @@ type Config struct {
 	CloneRoute                *routeChangerConfig  `yaml:"clone-route"`
 	SourcePollTimeout         int64                `yaml:"source-poll-timeout"`
 	WaitFirstRouteLoad        bool                 `yaml:"wait-first-route-load"`
+	RoutingHistorySize        int                  `yaml:"routing-history-size"`
+	EnableRouteValidation     bool                 `yaml:"enable-route-validation"`
 
 	// Forwarded headers
 	ForwardedHeadersList            *listFlag            `yaml:"forwarded-headers"`
@@ -223,6 +242,9 @@ type Config struct {
 	IdleTimeoutServer            time.Duration `yaml:"idle-timeout-server"`
 	MaxHeaderBytes               int           `yaml:"max-header-bytes"`
 	EnableConnMetricsServer      bool          `yaml:"enable-connection-metrics"`
+	EnableHTTP3                  bool          `yaml:"enable-http3"`
+	HTTP3Address                 string        `yaml:"http3-address"`
+	TLSPassthroughAddress        string        `yaml:"tls-passthrough-address"`
 	TimeoutBackend               time.Duration `yaml:"timeout-backend"`
 	KeepaliveBackend             time.Duration `yaml:"keepalive-backend"`
 	EnableDualstackBackend       bool          `yaml:"enable-dualstack-backend"`
@@ -231,6 +253,7 @@ type Config struct {
 	ExpectContinueTimeoutBackend time.Duration `yaml:"expect-continue-timeout-backend"`
 	MaxIdleConnsBackend          int           `yaml:"max-idle-connection-backend"`
 	DisableHTTPKeepalives        bool          `yaml:"disable-http-keepalives"`
+	RetryBudget                  float64       `yaml:"retry-budget"`
 
 	// swarm:
 	EnableSwarm bool `yaml:"enable-swarm"`
@@ -263,6 +286,8 @@ const (
 
 	// environment keys:
 	redisPasswordEnv = "SWARM_REDIS_PASSWORD"
+
+	routingTraceSecretEnv = "ROUTING_TRACE_SECRET"
 )
 
 func NewConfig() *Config {
@@ -283,6 +308,9 @@ func NewConfig() *Config {
 	cfg.RoutesURLs = commaListFlag()
 	cfg.ForwardedHeadersList = commaListFlag()
 	cfg.ForwardedHeadersExcludeCIDRList = commaListFlag()
+	cfg.RoutingTraceAllowCIDRList = commaListFlag()
+	cfg.ProxyProtocolTrustedCIDRList = commaListFlag()
+	cfg.ConnectAllowlist = commaListFlag()
 	cfg.CompressEncodings = commaListFlag("gzip", "deflate", "br")
 
 	flag.StringVar(&cfg.ConfigFile, "config-file", "", "if provided the flags will be loaded/overwritten by the values on the file (yaml)")
@@ -299,12 +327,16 @@ func NewConfig() *Config {
 	flag.BoolVar(&cfg.DevMode, "dev-mode", false, "enables developer time behavior, like ubuffered routing updates")
 	flag.StringVar(&cfg.SupportListener, "support-listener", ":9911", "network address used for exposing the /metrics endpoint. An empty value disables support endpoint.")
 	flag.StringVar(&cfg.DebugListener, "debug-listener", "", "when this address is set, skipper starts an additional listener returning the original and transformed requests")
+	flag.StringVar(&cfg.RoutingTraceSecret, "routing-trace-secret", "", "when set, the responses to the requests with the X-Skipper-Routing-Trace header matching the secret contain the routing decisions of the proxy.\nUse "+routingTraceSecretEnv+" environment variable or 'routing-trace-secret' key in config file to set the secret")
+	flag.Var(cfg.RoutingTraceAllowCIDRList, "routing-trace-allow-cidrs", "comma separated list of CIDRs, the requests from these addresses with the X-Skipper-Routing-Trace header receive the routing decisions of the proxy in the response")
 	flag.StringVar(&cfg.CertPathTLS, "tls-cert", "", "the path on the local filesystem to the certificate file(s) (including any intermediates), multiple may be given comma separated")
 	flag.StringVar(&cfg.KeyPathTLS, "tls-key", "", "the path on the local filesystem to the certificate's private key file(s), multiple keys may be given comma separated - the order must match the certs")
 	flag.Var(cfg.StatusChecks, "status-checks", "experimental URLs to check before reporting healthy on startup")
 	flag.BoolVar(&cfg.PrintVersion, "version", false, "print Skipper version")
 	flag.IntVar(&cfg.MaxLoopbacks, "max-loopbacks", proxy.DefaultMaxLoopbacks, "maximum number of loopbacks for an incoming request, set to -1 to disable loopbacks")
 	flag.IntVar(&cfg.DefaultHTTPStatus, "default-http-status", http.StatusNotFound, "default HTTP status used when no route is found for a request")
+	flag.Int64Var(&cfg.MaxRequestBodySize, "max-request-body-size", 0, "maximum size of the request bodies in bytes, larger requests are rejected with 413, 0 means no limit")
+	flag.StringVar(&cfg.ErrorPageTemplateDir, "error-page-template-dir", "", "directory of the error page templates, used by the errorPage filters, and for the errors of the proxy by the name of the status code (503.html), the status class (5xx.html) or default.html")
 	flag.StringVar(&cfg.PluginDir, "plugindir", "", "set the directory to load plugins from, default is ./")
 	flag.DurationVar(&cfg.LoadBalancerHealthCheckInterval, "lb-healthcheck-interval", 0, "use to set the health checker interval to check healthiness of former dead or unhealthy routes")
 	flag.BoolVar(&cfg.ReverseSourcePredicate, "reverse-source-predicate", false, "reverse the order of finding the client IP from X-Forwarded-For header")
@@ -322,6 +354,13 @@ func NewConfig() *Config {
 	flag.Var(cfg.DataclientPlugins, "dataclient-plugin", "set a custom dataclient plugins to load, a comma separated list of name and arguments")
 	flag.Var(cfg.MultiPlugins, "multi-plugin", "set a custom multitype plugins to load, a comma separated list of name and arguments")
 	flag.Var(cfg.CompressEncodings, "compress-encodings", "set encodings supported for compression, the order defines priority when Accept-Header has equal quality values, see RFC 7231 section 5.3.1")
+	flag.Int64Var(&cfg.ResponseCacheMaxSize, "response-cache-max-size", 0, "sets the size limit in bytes of the response cache shared by the cache filters, 0 means the default of 64MB")
+	flag.BoolVar(&cfg.OutlierDetection, "outlier-detection", false, "enables the passive outlier detection, that ejects the failing endpoints of the load balanced routes")
+	flag.IntVar(&cfg.OutlierConsecutiveFailures, "outlier-consecutive-failures", loadbalancer.DefaultOutlierConsecutiveFailures, "number of consecutive failed requests after which an endpoint is ejected")
+	flag.DurationVar(&cfg.OutlierLatencyThreshold, "outlier-latency-threshold", 0, "when greater than 0, the backend requests taking longer count as failures for the outlier detection")
+	flag.DurationVar(&cfg.OutlierBaseEjectionTime, "outlier-base-ejection-time", loadbalancer.DefaultOutlierBaseEjectionTime, "duration of the first ejection of an endpoint, doubled on every subsequent ejection")
+	flag.DurationVar(&cfg.OutlierMaxEjectionTime, "outlier-max-ejection-time", loadbalancer.DefaultOutlierMaxEjectionTime, "maximum duration of the ejection of an endpoint")
+	flag.IntVar(&cfg.OutlierMaxEjectionPercent, "outlier-max-ejection-percent", loadbalancer.DefaultOutlierMaxEjectionPercent, "maximum percentage of the ejected endpoints of a route, at least one endpoint can be always ejected")
 
 	// logging, metrics, tracing:
 	flag.BoolVar(&cfg.EnablePrometheusMetrics, "enable-prometheus-metrics", false, "*Deprecated*: use metrics-flavour. Switch to Prometheus metrics format to expose metrics")
@@ -388,6 +427,8 @@ func NewConfig() *Config {
 	flag.Var(cfg.EditRoute, "edit-route", "match and edit filters and predicates of all routes")
 	flag.Var(cfg.CloneRoute, "clone-route", "clone all matching routes and replace filters and predicates of all matched routes")
 	flag.BoolVar(&cfg.WaitFirstRouteLoad, "wait-first-route-load", false, "prevent starting the listener before the first batch of routes were loaded")
+	flag.IntVar(&cfg.RoutingHistorySize, "routing-history-size", 0, "number of the applied routing tables kept in the routing history, enables the routing history endpoints of the support listener when greater than 0")
+	flag.BoolVar(&cfg.EnableRouteValidation, "enable-route-validation", false, "enables the /routes/validate endpoint of the support listener, validating the posted routes without applying them. The validation creates the filters of the posted routes, and the resources allocated by them, e.g. HTTP clients or goroutines, are never released, enable it only when the support listener is not reachable by untrusted clients")
 
 	// Forwarded headers
 	flag.Var(cfg.ForwardedHeadersList, "forwarded-headers", "comma separated list of headers to add to the incoming request before routing\n"+
@@ -471,12 +512,18 @@ func NewConfig() *Config {
 	flag.DurationVar(&cfg.BackendFlushInterval, "backend-flush-interval", 20*time.Millisecond, "flush interval for upgraded proxy connections")
 	flag.BoolVar(&cfg.ExperimentalUpgrade, "experimental-upgrade", false, "enable experimental feature to handle upgrade protocol requests")
 	flag.BoolVar(&cfg.ExperimentalUpgradeAudit, "experimental-upgrade-audit", false, "enable audit logging of the request line and the messages during the experimental web socket upgrades")
+	flag.BoolVar(&cfg.EnableConnect, "enable-connect", false, "enables the forward proxy mode for the CONNECT requests, routed by the requested host:port")
+	flag.Var(cfg.ConnectAllowlist, "connect-allowlist", "comma separated list of host:port destinations allowed for the CONNECT tunnels, the host can start with *. or be *, and the port can be *, when empty, all tunnels are rejected")
 	flag.DurationVar(&cfg.ReadTimeoutServer, "read-timeout-server", 5*time.Minute, "set ReadTimeout for http server connections")
 	flag.DurationVar(&cfg.ReadHeaderTimeoutServer, "read-header-timeout-server", 60*time.Second, "set ReadHeaderTimeout for http server connections")
 	flag.DurationVar(&cfg.WriteTimeoutServer, "write-timeout-server", 60*time.Second, "set WriteTimeout for http server connections")
 	flag.DurationVar(&cfg.IdleTimeoutServer, "idle-timeout-server", 60*time.Second, "set IdleTimeout for http server connections")
 	flag.IntVar(&cfg.MaxHeaderBytes, "max-header-bytes", http.DefaultMaxHeaderBytes, "set MaxHeaderBytes for http server connections")
 	flag.BoolVar(&cfg.EnableConnMetricsServer, "enable-connection-metrics", false, "enables connection metrics for http server connections")
+	flag.BoolVar(&cfg.EnableHTTP3, "enable-http3", false, "enables the HTTP/3 (QUIC) listener, requires TLS, and advertises it with the Alt-Svc header on the TCP listener")
+	flag.StringVar(&cfg.HTTP3Address, "http3-address", "", "UDP address of the HTTP/3 listener, defaults to the address of the TCP listener")
+	flag.StringVar(&cfg.TLSPassthroughAddress, "tls-passthrough-address", "", "TCP address of the TLS passthrough listener, that forwards the TLS connections by SNI, without terminating them, to the tcp:// backends of the routes with the SNI predicate")
+	flag.Var(cfg.ProxyProtocolTrustedCIDRList, "proxy-protocol-trusted-cidrs", "comma separated list of CIDRs, when set, the connections from these addresses can start with a PROXY protocol (v1 or v2) header, containing the address of the client")
 	flag.DurationVar(&cfg.TimeoutBackend, "timeout-backend", 60*time.Second, "sets the TCP client connection timeout for backend connections")
 	flag.DurationVar(&cfg.KeepaliveBackend, "keepalive-backend", 30*time.Second, "sets the keepalive for backend connections")
 	flag.BoolVar(&cfg.EnableDualstackBackend, "enable-dualstack-backend", true, "enables DualStack for backend connections")
@@ -485,6 +532,7 @@ func NewConfig() *Config {
 	flag.DurationVar(&cfg.ExpectContinueTimeoutBackend, "expect-continue-timeout-backend", 30*time.Second, "sets the HTTP expect continue timeout for backend connections")
 	flag.IntVar(&cfg.MaxIdleConnsBackend, "max-idle-connection-backend", 0, "sets the maximum idle connections for all backend connections")
 	flag.BoolVar(&cfg.DisableHTTPKeepalives, "disable-http-keepalives", false, "forces backend to always create a new connection")
+	flag.Float64Var(&cfg.RetryBudget, "retry-budget", proxy.DefaultRetryBudget, "sets the maximum ratio of the retries to the requests of the routes using the retry filter, negative value disables the budget")
 
 	// Swarm:
 	flag.BoolVar(&cfg.EnableSwarm, "enable-swarm", false, "enable swarm communication between nodes in a skipper fleet")
@@ -589,6 +637,16 @@ func (c *Config) Parse() error {
 		return err
 	}
 
+	c.RoutingTraceAllowCIDRs, err = net.ParseCIDRs(c.RoutingTraceAllowCIDRList.values)
+	if err != nil {
+		return fmt.Errorf("invalid routing trace allow CIDRs: %v", err)
+	}
+
+	c.ProxyProtocolTrustedCIDRs, err = net.ParseCIDRs(c.ProxyProtocolTrustedCIDRList.values)
+	if err != nil {
+		return fmt.Errorf("invalid PROXY protocol trusted CIDRs: %v", err)
+	}
+
 	if c.NormalizeHost || c.KubernetesIngress {
 		c.HostPatch = net.HostPatch{
 			ToLower:           true,
@@ -659,10 +717,14 @@ func (c *Config) ToOptions() skipper.Options {
 		DevMode:                         c.DevMode,
 		SupportListener:                 c.SupportListener,
 		DebugListener:                   c.DebugListener,
+		RoutingTraceSecret:              c.RoutingTraceSecret,
+		RoutingTraceAllowCIDRs:          c.RoutingTraceAllowCIDRs,
 		CertPathTLS:                     c.CertPathTLS,
 		KeyPathTLS:                      c.KeyPathTLS,
 		MaxLoopbacks:                    c.MaxLoopbacks,
 		DefaultHTTPStatus:               c.DefaultHTTPStatus,
+		MaxRequestBodySize:              c.MaxRequestBodySize,
+		ErrorPageTemplateDir:            c.ErrorPageTemplateDir,
 		LoadBalancerHealthCheckInterval: c.LoadBalancerHealthCheckInterval,
 		ReverseSourcePredicate:          c.ReverseSourcePredicate,
 		MaxAuditBody:                    c.MaxAuditBody,
@@ -678,6 +740,13 @@ func (c *Config) ToOptions() skipper.Options {
 		Plugins:                         c.MultiPlugins.values,
 		PluginDirs:                      []string{skipper.DefaultPluginDir},
 		CompressEncodings:               c.CompressEncodings.values,
+		ResponseCacheMaxSize:            c.ResponseCacheMaxSize,
+		OutlierDetection:                c.OutlierDetection,
+		OutlierConsecutiveFailures:      c.OutlierConsecutiveFailures,
+		OutlierLatencyThreshold:         c.OutlierLatencyThreshold,
+		OutlierBaseEjectionTime:         c.OutlierBaseEjectionTime,
+		OutlierMaxEjectionTime:          c.OutlierMaxEjectionTime,
+		OutlierMaxEjectionPercent:       c.OutlierMaxEjectionPercent,
 
 		// logging, metrics, profiling, tracing:
 		EnablePrometheusMetrics:             c.EnablePrometheusMetrics,
@@ -739,10 +808,12 @@ func (c *Config) ToOptions() skipper.Options {
 			Prepend: c.PrependFilters.filters,
 			Append:  c.AppendFilters.filters,
 		},
-		CloneRoute:         eskip.NewClone(c.CloneRoute.Reg, c.CloneRoute.Repl),
-		EditRoute:          eskip.NewEditor(c.EditRoute.Reg, c.EditRoute.Repl),
-		SourcePollTimeout:  time.Duration(c.SourcePollTimeout) * time.Millisecond,
-		WaitFirstRouteLoad: c.WaitFirstRouteLoad,
+		CloneRoute:            eskip.NewClone(c.CloneRoute.Reg, c.CloneRoute.Repl),
+		EditRoute:             eskip.NewEditor(c.EditRoute.Reg, c.EditRoute.Repl),
+		SourcePollTimeout:     time.Duration(c.SourcePollTimeout) * time.Millisecond,
+		WaitFirstRouteLoad:    c.WaitFirstRouteLoad,
+		RoutingHistorySize:    c.RoutingHistorySize,
+		EnableRouteValidation: c.EnableRouteValidation,
 
 		// Kubernetes:
 		Kubernetes:                         c.KubernetesIngress,
@@ -806,12 +877,18 @@ func (c *Config) ToOptions() skipper.Options {
 		BackendFlushInterval:         c.BackendFlushInterval,
 		ExperimentalUpgrade:          c.ExperimentalUpgrade,
 		ExperimentalUpgradeAudit:     c.ExperimentalUpgradeAudit,
+		EnableConnect:                c.EnableConnect,
+		ConnectAllowlist:             c.ConnectAllowlist.values,
 		ReadTimeoutServer:            c.ReadTimeoutServer,
 		ReadHeaderTimeoutServer:      c.ReadHeaderTimeoutServer,
 		WriteTimeoutServer:           c.WriteTimeoutServer,
 		IdleTimeoutServer:            c.IdleTimeoutServer,
 		MaxHeaderBytes:               c.MaxHeaderBytes,
 		EnableConnMetricsServer:      c.EnableConnMetricsServer,
+		EnableHTTP3:                  c.EnableHTTP3,
+		HTTP3Address:                 c.HTTP3Address,
+		ProxyProtocolTrustedCIDRs:    c.ProxyProtocolTrustedCIDRs,
+		TLSPassthroughAddress:        c.TLSPassthroughAddress,
 		TimeoutBackend:               c.TimeoutBackend,
 		KeepAliveBackend:             c.KeepaliveBackend,
 		DualStackBackend:             c.EnableDualstackBackend,
@@ -820,6 +897,7 @@ func (c *Config) ToOptions() skipper.Options {
 		ExpectContinueTimeoutBackend: c.ExpectContinueTimeoutBackend,
 		MaxIdleConnsBackend:          c.MaxIdleConnsBackend,
 		DisableHTTPKeepalives:        c.DisableHTTPKeepalives,
+		RetryBudget:                  c.RetryBudget,
 
 		// swarm:
 		EnableSwarm: c.EnableSwarm,
@@ -981,6 +1059,10 @@ func (c *Config) parseEnv() {
 	if c.SwarmRedisPassword == "" {
 		c.SwarmRedisPassword = os.Getenv(redisPasswordEnv)
 	}
+
+	if c.RoutingTraceSecret == "" {
+		c.RoutingTraceSecret = os.Getenv(routingTraceSecretEnv)
+	}
 }
 
 func checkDeprecated(configKeys map[string]interface{}, options ...string) {
@@ -98,6 +98,10 @@ func Test_NewConfig(t *testing.T) {
 				DataclientPlugins:                       newPluginFlag(),
 				MultiPlugins:                            newPluginFlag(),
 				CompressEncodings:                       commaListFlag("gzip", "deflate", "br"),
+				OutlierConsecutiveFailures:              5,
+				OutlierBaseEjectionTime:                 30 * time.Second,
+				OutlierMaxEjectionTime:                  300 * time.Second,
+				OutlierMaxEjectionPercent:               10,
 				OpenTracing:                             "noop",
 				OpenTracingInitialSpan:                  "ingress",
 				OpentracingLogFilterLifecycleEvents:     true,
@@ -145,6 +149,7 @@ func Test_NewConfig(t *testing.T) {
 				TlsHandshakeTimeoutBackend:              1 * time.Minute,
 				ResponseHeaderTimeoutBackend:            1 * time.Minute,
 				ExpectContinueTimeoutBackend:            30 * time.Second,
+				RetryBudget:                             0.2,
 				ServeMethodMetric:                       true,
 				ServeStatusCodeMetric:                   true,
 				SwarmRedisURLs:                          commaListFlag(),
@@ -165,6 +170,9 @@ func Test_NewConfig(t *testing.T) {
 				RoutesURLs:                              commaListFlag(),
 				ForwardedHeadersList:                    commaListFlag(),
 				ForwardedHeadersExcludeCIDRList:         commaListFlag(),
+				RoutingTraceAllowCIDRList:               commaListFlag(),
+				ProxyProtocolTrustedCIDRList:            commaListFlag(),
+				ConnectAllowlist:                        commaListFlag(),
 				ClusterRatelimitMaxGroupShards:          1,
 				RefusePayload:                           multiFlag{"foo", "bar", "baz"},
 			},
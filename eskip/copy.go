@@ -1,9 +1,17 @@
 package eskip
 
 func copyArgs(a []interface{}) []interface{} {
-	// we don't need deep copy of the items for the supported values
+	// we don't need deep copy of the items for the supported values,
+	// except for the nested predicate groups
 	c := make([]interface{}, len(a))
-	copy(c, a)
+	for i, ai := range a {
+		if g, ok := ai.([]*Predicate); ok {
+			c[i] = CopyPredicates(g)
+		} else {
+			c[i] = ai
+		}
+	}
+
 	return c
 }
 
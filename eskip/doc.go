@@ -115,6 +115,22 @@ responsibility of the implementation to validate them.
 (See the documentation of the routing package.)
 
 
+Combining Predicates
+
+The predicates of a route are combined by '&&'. The Or and Not
+predicates accept groups of predicates as arguments, where a group is
+one or more predicates combined by '&&', optionally enclosed in
+parentheses:
+
+	Or(Host("^www[.]example[.]org$"), Method("POST") && Header("X-Beta", "true"))
+
+	Not((Path("/health") && Method("GET")))
+
+The groups are represented by the []*Predicate argument values of the
+Or and Not predicates. The tree predicates, Path and PathSubtree, when
+used inside a group, are not indexed by the routing table.
+
+
 Filters
 
 Filters are used to augment the incoming requests and the outgoing
@@ -256,7 +272,9 @@ Parsing
 Parsing a routing table or a route expression happens with the
 eskip.Parse function. In case of grammar error, it returns an error with
 the approximate position of the invalid syntax element, otherwise it
-returns a list of structured, in-memory route definitions.
+returns a list of structured, in-memory route definitions. The
+eskip.ParseWithPositions function returns the positions of the route
+definitions in the document, too.
 
 The eskip parser does not validate the routes against all semantic rules,
 e.g., whether a filter or a custom predicate implementation is available.
@@ -273,6 +291,9 @@ eskip.String method.
 JSON
 
 Both serializing and parsing is possible via the standard json.Marshal and
-json.Unmarshal functions.
+json.Unmarshal functions. The predicate groups are represented in JSON
+as arrays of predicate objects. When parsing, only the non-empty arrays
+of named predicate objects are decoded as groups, and the empty array
+only in the arguments of the Or and Not predicates.
 */
 package eskip
@@ -1,6 +1,9 @@
 package eskip
 
-import "sort"
+import (
+	"reflect"
+	"sort"
+)
 
 // used for sorting:
 func compareRouteID(r []*Route) func(int, int) bool {
@@ -26,13 +29,55 @@ func hasDuplicateID(r []*Route) bool {
 	return false
 }
 
+// the arguments received from the data clients can have non-comparable
+// types, too, e.g. maps and slices from JSON
+func eqArg(left, right interface{}) bool {
+	if left == nil || right == nil {
+		return left == right
+	}
+
+	t := reflect.TypeOf(left)
+	if t != reflect.TypeOf(right) {
+		return false
+	}
+
+	if t.Comparable() {
+		return left == right
+	}
+
+	return reflect.DeepEqual(left, right)
+}
+
 func eqArgs(left, right []interface{}) bool {
 	if len(left) != len(right) {
 		return false
 	}
 
 	for i := range left {
-		if left[i] != right[i] {
+		lg, lok := left[i].([]*Predicate)
+		rg, rok := right[i].([]*Predicate)
+		switch {
+		case lok && rok:
+			if !eqPredicates(lg, rg) {
+				return false
+			}
+		case lok || rok:
+			return false
+		case !eqArg(left[i], right[i]):
+			return false
+		}
+	}
+
+	return true
+}
+
+func eqPredicates(left, right []*Predicate) bool {
+	if len(left) != len(right) {
+		return false
+	}
+
+	for i := range left {
+		if left[i].Name != right[i].Name || !eqArgs(left[i].Args, right[i].Args) {
 			return false
 		}
 	}
@@ -69,17 +114,10 @@ func eq2(left, right *Route) bool {
 		return false
 	}
 
-	if len(lc.Predicates) != len(rc.Predicates) {
+	if !eqPredicates(lc.Predicates, rc.Predicates) {
 		return false
 	}
 
-	for i := range lc.Predicates {
-		lp, rp := lc.Predicates[i], rc.Predicates[i]
-		if lp.Name != rp.Name || !eqArgs(lp.Args, rp.Args) {
-			return false
-		}
-	}
-
 	if len(lc.Filters) != len(rc.Filters) {
 		return false
 	}
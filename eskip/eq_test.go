@@ -57,6 +57,25 @@ func TestEq(t *testing.T) {
 			{Predicates: []*Predicate{{Args: []interface{}{1, 2}}}},
 			{Predicates: []*Predicate{{Args: []interface{}{1, 3}}}},
 		},
+	}, {
+		title: "eq non-comparable args",
+		routes: []*Route{
+			{Filters: []*Filter{{Args: []interface{}{map[string]interface{}{"foo": []interface{}{"bar"}}}}}},
+			{Filters: []*Filter{{Args: []interface{}{map[string]interface{}{"foo": []interface{}{"bar"}}}}}},
+		},
+		expect: true,
+	}, {
+		title: "non-eq non-comparable args",
+		routes: []*Route{
+			{Filters: []*Filter{{Args: []interface{}{map[string]interface{}{"foo": "bar"}}}}},
+			{Filters: []*Filter{{Args: []interface{}{map[string]interface{}{"foo": "baz"}}}}},
+		},
+	}, {
+		title: "non-eq arg types",
+		routes: []*Route{
+			{Filters: []*Filter{{Args: []interface{}{map[string]interface{}{}}}}},
+			{Filters: []*Filter{{Args: []interface{}{"foo"}}}},
+		},
 	}, {
 		title:  "non-eq filter count",
 		routes: []*Route{{Filters: []*Filter{{}, {}}}, {Filters: []*Filter{{}}}},
@@ -247,7 +247,9 @@ type Predicate struct {
 	// The arguments of the predicate as defined in the
 	// route definition. The arguments can be of type
 	// float64 or string (string for both strings and
-	// regular expressions).
+	// regular expressions), or []*Predicate for the
+	// predicate groups combined by '&&', used by the
+	// Or and Not predicates.
 	Args []interface{} `json:"args"`
 }
 
@@ -357,11 +359,11 @@ func (f *Filter) Copy() *Filter {
 	return &c
 }
 
-// Copy copies a predicate to a new filter instance. The argument values are copied in a shallow way.
+// Copy copies a predicate to a new filter instance. The argument values are copied in a shallow way,
+// except for the nested predicate groups, which are copied deep.
 func (p *Predicate) Copy() *Predicate {
 	c := *p
-	c.Args = make([]interface{}, len(p.Args))
-	copy(c.Args, p.Args)
+	c.Args = copyArgs(p.Args)
 	return &c
 }
 
@@ -667,17 +669,28 @@ func ParsePredicates(p string) ([]*Predicate, error) {
 		return nil, err
 	}
 
-	var ps []*Predicate
-	for i := range r.matchers {
-		if r.matchers[i].name != "*" {
+	ps := matchersToPredicates(r.matchers)
+	if len(ps) == 0 {
+		return nil, nil
+	}
+
+	return ps, nil
+}
+
+// converts the parsed matchers to predicates, used for the nested
+// predicate groups, skipping the '*' matchers.
+func matchersToPredicates(m []*matcher) []*Predicate {
+	ps := make([]*Predicate, 0, len(m))
+	for i := range m {
+		if m[i].name != "*" {
 			ps = append(ps, &Predicate{
-				Name: r.matchers[i].name,
-				Args: r.matchers[i].args,
+				Name: m[i].name,
+				Args: m[i].args,
 			})
 		}
 	}
 
-	return ps, nil
+	return ps
 }
 
 const randomIdLength = 16
@@ -64,6 +64,60 @@ func (p *Predicate) MarshalJSON() ([]byte, error) {
 	return marshalJSONNoEscape(&jsonNameArgs{Name: p.Name, Args: p.Args})
 }
 
+// isPredicateGroup tells whether a decoded array argument is a group of
+// predicates. Only the Or and Not predicates accept the empty group,
+// the '*' in the eskip format.
+func isPredicateGroup(name string, g []*Predicate) bool {
+	if len(g) == 0 {
+		return name == "Or" || name == "Not"
+	}
+
+	for _, p := range g {
+		if p == nil || p.Name == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// UnmarshalJSON decodes a predicate. The non-empty arrays of named
+// predicate objects in the arguments are decoded as nested predicate
+// groups, any other value is decoded as a plain argument.
+func (p *Predicate) UnmarshalJSON(b []byte) error {
+	var jp struct {
+		Name string            `json:"name"`
+		Args []json.RawMessage `json:"args"`
+	}
+
+	if err := json.Unmarshal(b, &jp); err != nil {
+		return err
+	}
+
+	p.Name = jp.Name
+	p.Args = nil
+	if jp.Args == nil {
+		return nil
+	}
+
+	p.Args = make([]interface{}, len(jp.Args))
+	for i, raw := range jp.Args {
+		if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+			var g []*Predicate
+			if err := json.Unmarshal(raw, &g); err == nil && isPredicateGroup(jp.Name, g) {
+				p.Args[i] = g
+				continue
+			}
+		}
+
+		if err := json.Unmarshal(raw, &p.Args[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (r *Route) MarshalJSON() ([]byte, error) {
 	return marshalJSONNoEscape(newJSONRoute(r))
 }
@@ -29,6 +29,13 @@ type eskipLex struct {
 	err           error
 	initialLength int
 	routes        []*parsedRoute
+
+	// offsets of the first token, the last symbol, the route IDs and the
+	// syntax error, used to report the positions in the parsed code
+	firstOffset  int
+	symbolOffset int
+	routeOffsets []int
+	errOffset    int
 }
 
 type fixedScanner string
@@ -98,7 +105,8 @@ func (fs fixedScanner) scan(code string) (t token, rest string, err error) {
 func newLexer(code string) *eskipLex {
 	return &eskipLex{
 		code:          code,
-		initialLength: len(code)}
+		initialLength: len(code),
+		firstOffset:   -1}
 }
 
 func isWhitespace(c byte) bool  { return unicode.IsSpace(rune(c)) }
@@ -352,6 +360,7 @@ func (l *eskipLex) next() (t token, err error) {
 		return
 	}
 
+	offset := l.initialLength - len(l.code)
 	t, l.code, err = s.scan(l.code)
 	if err == void {
 		return l.next()
@@ -359,6 +368,13 @@ func (l *eskipLex) next() (t token, err error) {
 
 	if err == nil {
 		l.lastToken = &t
+		if l.firstOffset < 0 {
+			l.firstOffset = offset
+		}
+
+		if t.id == symbol {
+			l.symbolOffset = offset
+		}
 	}
 
 	return
@@ -380,6 +396,7 @@ func (l *eskipLex) Lex(lval *eskipSymType) int {
 }
 
 func (l *eskipLex) Error(err string) {
+	l.errOffset = l.initialLength - len(l.code)
 	l.err = fmt.Errorf(
 		"parse failed after token %v, last route id: %v, position %d: %s",
 		l.lastToken, l.lastRouteID, l.initialLength-len(l.code), err)
@@ -90,7 +90,7 @@ const eskipEofCode = 1
 const eskipErrCode = 2
 const eskipInitialStackSize = 16
 
-//line parser.y:287
+//line parser.y:317
 
 //line yacctab:1
 var eskipExca = [...]int{
@@ -101,62 +101,69 @@ var eskipExca = [...]int{
 
 const eskipPrivate = 57344
 
-const eskipLast = 62
+const eskipLast = 77
 
 var eskipAct = [...]int{
-	34, 40, 32, 31, 24, 17, 20, 21, 22, 25,
-	27, 26, 19, 48, 36, 9, 37, 25, 41, 9,
-	16, 25, 25, 3, 10, 7, 14, 42, 29, 43,
-	4, 55, 8, 45, 44, 49, 45, 30, 28, 19,
-	50, 15, 13, 47, 46, 38, 23, 51, 52, 39,
-	53, 42, 54, 12, 35, 11, 33, 18, 5, 6,
-	2, 1,
+	33, 37, 43, 5, 32, 52, 24, 17, 39, 16,
+	40, 25, 44, 19, 9, 25, 9, 25, 34, 20,
+	21, 22, 25, 27, 26, 9, 3, 29, 45, 8,
+	39, 35, 40, 7, 10, 14, 46, 25, 29, 49,
+	30, 53, 61, 19, 62, 54, 28, 56, 51, 50,
+	4, 12, 34, 57, 58, 59, 45, 60, 47, 41,
+	48, 15, 13, 63, 12, 12, 11, 23, 42, 38,
+	36, 55, 31, 18, 6, 2, 1,
 }
 
 var eskipPact = [...]int{
-	14, -1000, 11, -1000, -1000, 49, 34, -1000, 15, -1000,
-	2, -8, 10, 10, 4, -1000, -1000, -1000, 39, -1000,
-	-1000, -1000, -1000, -1000, -1000, -1000, 0, 18, -1000, 15,
-	-1000, 27, -1000, -1000, -1000, -1000, -1000, -1000, -8, -7,
-	26, 31, -1000, 4, -1000, 4, -1000, -1000, -1000, 5,
-	5, 24, -1000, -1000, 26, -1000,
+	11, -1000, 21, -1000, -1000, 60, 54, -1000, 24, -1000,
+	-9, 5, 9, 9, 20, -1000, -1000, -1000, 53, -1000,
+	-1000, -1000, -1000, -1000, -1000, -1000, -6, 25, -1000, 24,
+	-1000, 51, -1000, -1000, 61, 9, -1000, -1000, -1000, -1000,
+	-1000, 5, -15, 32, 36, -1000, -2, -1000, 20, 47,
+	-1000, -1000, -1000, 0, 0, 35, -1000, -1000, -1000, -1000,
+	32, -1000, -2, -1000,
 }
 
 var eskipPgo = [...]int{
-	0, 61, 60, 23, 30, 59, 58, 5, 57, 25,
-	3, 4, 2, 56, 0, 54, 1, 49, 46,
+	0, 76, 75, 26, 50, 74, 3, 7, 73, 33,
+	72, 4, 0, 6, 71, 70, 1, 69, 2, 68,
+	67,
 }
 
 var eskipR1 = [...]int{
 	0, 1, 1, 2, 2, 2, 2, 4, 5, 3,
-	3, 6, 6, 9, 9, 8, 8, 11, 10, 10,
-	10, 12, 12, 12, 16, 16, 17, 17, 18, 7,
-	7, 7, 7, 7, 13, 14, 15,
+	3, 6, 6, 9, 9, 10, 10, 10, 11, 11,
+	11, 8, 8, 13, 14, 14, 14, 12, 12, 12,
+	18, 18, 19, 19, 20, 7, 7, 7, 7, 7,
+	15, 16, 17,
 }
 
 var eskipR2 = [...]int{
 	0, 1, 1, 0, 1, 3, 2, 3, 1, 3,
-	5, 1, 3, 1, 4, 1, 3, 4, 0, 1,
-	3, 1, 1, 1, 1, 3, 1, 3, 3, 1,
-	1, 1, 1, 1, 1, 1, 1,
+	5, 1, 3, 1, 4, 0, 1, 3, 1, 1,
+	3, 1, 3, 4, 0, 1, 3, 1, 1, 1,
+	1, 3, 1, 3, 3, 1, 1, 1, 1, 1,
+	1, 1, 1,
 }
 
 var eskipChk = [...]int{
 	-1000, -1, -2, -3, -4, -6, -5, -9, 18, 5,
-	13, 6, 4, 8, 11, -4, 18, -7, -8, -14,
-	14, 15, 16, -18, -11, 17, 19, 18, -9, 18,
-	-3, -10, -12, -13, -14, -15, 10, 12, 6, -17,
-	-16, 18, -14, 11, 7, 9, -7, -11, 20, 9,
-	9, -10, -12, -14, -16, 7,
+	13, 6, 4, 8, 11, -4, 18, -7, -8, -16,
+	14, 15, 16, -20, -13, 17, 19, 18, -9, 18,
+	-3, -10, -11, -12, -6, 11, -15, -16, -17, 10,
+	12, 6, -19, -18, 18, -16, 11, 7, 9, -6,
+	-7, -13, 20, 9, 9, -14, -12, -11, 7, -16,
+	-18, 7, 9, -12,
 }
 
 var eskipDef = [...]int{
 	3, -2, 1, 2, 4, 0, 0, 11, 8, 13,
-	6, 0, 0, 0, 18, 5, 8, 9, 0, 29,
-	30, 31, 32, 33, 15, 35, 0, 0, 12, 0,
-	7, 0, 19, 21, 22, 23, 34, 36, 0, 0,
-	26, 0, 24, 18, 14, 0, 10, 16, 28, 0,
-	0, 0, 20, 25, 27, 17,
+	6, 0, 0, 0, 15, 5, 8, 9, 0, 35,
+	36, 37, 38, 39, 21, 41, 0, 0, 12, 0,
+	7, 0, 16, 18, 19, 0, 27, 28, 29, 40,
+	42, 0, 0, 32, 0, 30, 24, 14, 0, 0,
+	10, 22, 34, 0, 0, 0, 25, 17, 20, 31,
+	33, 23, 0, 26,
 }
 
 var eskipTok1 = [...]int{
@@ -555,10 +562,14 @@ eskipdefault:
 		{
 			eskipVAL.token = eskipDollar[1].token
 			eskiplex.(*eskipLex).lastRouteID = eskipDollar[1].token
+
+			// the lookahead token is the colon, so the last symbol is the ID
+			l := eskiplex.(*eskipLex)
+			l.routeOffsets = append(l.routeOffsets, l.symbolOffset)
 		}
 	case 9:
 		eskipDollar = eskipS[eskippt-3 : eskippt+1]
-//line parser.y:113
+//line parser.y:117
 		{
 			eskipVAL.route = &parsedRoute{
 				matchers:    eskipDollar[1].matchers,
@@ -575,7 +586,7 @@ eskipdefault:
 		}
 	case 10:
 		eskipDollar = eskipS[eskippt-5 : eskippt+1]
-//line parser.y:128
+//line parser.y:132
 		{
 			eskipVAL.route = &parsedRoute{
 				matchers:    eskipDollar[1].matchers,
@@ -594,119 +605,152 @@ eskipdefault:
 		}
 	case 11:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:146
+//line parser.y:150
 		{
 			eskipVAL.matchers = []*matcher{eskipDollar[1].matcher}
 		}
 	case 12:
 		eskipDollar = eskipS[eskippt-3 : eskippt+1]
-//line parser.y:150
+//line parser.y:154
 		{
 			eskipVAL.matchers = eskipDollar[1].matchers
 			eskipVAL.matchers = append(eskipVAL.matchers, eskipDollar[3].matcher)
 		}
 	case 13:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:156
+//line parser.y:160
 		{
 			eskipVAL.matcher = &matcher{"*", nil}
 		}
 	case 14:
 		eskipDollar = eskipS[eskippt-4 : eskippt+1]
-//line parser.y:160
+//line parser.y:164
 		{
 			eskipVAL.matcher = &matcher{eskipDollar[1].token, eskipDollar[3].args}
 			eskipDollar[3].args = nil
 		}
-	case 15:
+	case 16:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:166
+//line parser.y:171
+		{
+			eskipVAL.args = []interface{}{eskipDollar[1].arg}
+		}
+	case 17:
+		eskipDollar = eskipS[eskippt-3 : eskippt+1]
+//line parser.y:175
+		{
+			eskipVAL.args = eskipDollar[1].args
+			eskipVAL.args = append(eskipVAL.args, eskipDollar[3].arg)
+		}
+	case 18:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:181
+		{
+			eskipVAL.arg = eskipDollar[1].arg
+		}
+	case 19:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:185
+		{
+			eskipVAL.arg = matchersToPredicates(eskipDollar[1].matchers)
+			eskipDollar[1].matchers = nil
+		}
+	case 20:
+		eskipDollar = eskipS[eskippt-3 : eskippt+1]
+//line parser.y:190
+		{
+			eskipVAL.arg = matchersToPredicates(eskipDollar[2].matchers)
+			eskipDollar[2].matchers = nil
+		}
+	case 21:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:196
 		{
 			eskipVAL.filters = []*Filter{eskipDollar[1].filter}
 		}
-	case 16:
+	case 22:
 		eskipDollar = eskipS[eskippt-3 : eskippt+1]
-//line parser.y:170
+//line parser.y:200
 		{
 			eskipVAL.filters = eskipDollar[1].filters
 			eskipVAL.filters = append(eskipVAL.filters, eskipDollar[3].filter)
 		}
-	case 17:
+	case 23:
 		eskipDollar = eskipS[eskippt-4 : eskippt+1]
-//line parser.y:176
+//line parser.y:206
 		{
 			eskipVAL.filter = &Filter{
 				Name: eskipDollar[1].token,
 				Args: eskipDollar[3].args}
 			eskipDollar[3].args = nil
 		}
-	case 19:
+	case 25:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:185
+//line parser.y:215
 		{
 			eskipVAL.args = []interface{}{eskipDollar[1].arg}
 		}
-	case 20:
+	case 26:
 		eskipDollar = eskipS[eskippt-3 : eskippt+1]
-//line parser.y:189
+//line parser.y:219
 		{
 			eskipVAL.args = eskipDollar[1].args
 			eskipVAL.args = append(eskipVAL.args, eskipDollar[3].arg)
 		}
-	case 21:
+	case 27:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:195
+//line parser.y:225
 		{
 			eskipVAL.arg = eskipDollar[1].numval
 		}
-	case 22:
+	case 28:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:199
+//line parser.y:229
 		{
 			eskipVAL.arg = eskipDollar[1].stringval
 		}
-	case 23:
+	case 29:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:203
+//line parser.y:233
 		{
 			eskipVAL.arg = eskipDollar[1].regexpval
 		}
-	case 24:
+	case 30:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:208
+//line parser.y:238
 		{
 			eskipVAL.stringvals = []string{eskipDollar[1].stringval}
 		}
-	case 25:
+	case 31:
 		eskipDollar = eskipS[eskippt-3 : eskippt+1]
-//line parser.y:212
+//line parser.y:242
 		{
 			eskipVAL.stringvals = eskipDollar[1].stringvals
 			eskipVAL.stringvals = append(eskipVAL.stringvals, eskipDollar[3].stringval)
 		}
-	case 26:
+	case 32:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:218
+//line parser.y:248
 		{
 			eskipVAL.lbEndpoints = eskipDollar[1].stringvals
 		}
-	case 27:
+	case 33:
 		eskipDollar = eskipS[eskippt-3 : eskippt+1]
-//line parser.y:222
+//line parser.y:252
 		{
 			eskipVAL.lbAlgorithm = eskipDollar[1].token
 			eskipVAL.lbEndpoints = eskipDollar[3].stringvals
 		}
-	case 28:
+	case 34:
 		eskipDollar = eskipS[eskippt-3 : eskippt+1]
-//line parser.y:228
+//line parser.y:258
 		{
 			eskipVAL.lbAlgorithm = eskipDollar[2].lbAlgorithm
 			eskipVAL.lbEndpoints = eskipDollar[2].lbEndpoints
 		}
-	case 29:
+	case 35:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:234
+//line parser.y:264
 		{
 			eskipVAL.backend = eskipDollar[1].stringval
 			eskipVAL.shunt = false
@@ -714,36 +758,36 @@ eskipdefault:
 			eskipVAL.dynamic = false
 			eskipVAL.lbBackend = false
 		}
-	case 30:
+	case 36:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:242
+//line parser.y:272
 		{
 			eskipVAL.shunt = true
 			eskipVAL.loopback = false
 			eskipVAL.dynamic = false
 			eskipVAL.lbBackend = false
 		}
-	case 31:
+	case 37:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:249
+//line parser.y:279
 		{
 			eskipVAL.shunt = false
 			eskipVAL.loopback = true
 			eskipVAL.dynamic = false
 			eskipVAL.lbBackend = false
 		}
-	case 32:
+	case 38:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:256
+//line parser.y:286
 		{
 			eskipVAL.shunt = false
 			eskipVAL.loopback = false
 			eskipVAL.dynamic = true
 			eskipVAL.lbBackend = false
 		}
-	case 33:
+	case 39:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:263
+//line parser.y:293
 		{
 			eskipVAL.shunt = false
 			eskipVAL.loopback = false
@@ -752,21 +796,21 @@ eskipdefault:
 			eskipVAL.lbAlgorithm = eskipDollar[1].lbAlgorithm
 			eskipVAL.lbEndpoints = eskipDollar[1].lbEndpoints
 		}
-	case 34:
+	case 40:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:273
+//line parser.y:303
 		{
 			eskipVAL.numval = convertNumber(eskipDollar[1].token)
 		}
-	case 35:
+	case 41:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:278
+//line parser.y:308
 		{
 			eskipVAL.stringval = eskipDollar[1].token
 		}
-	case 36:
+	case 42:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:283
+//line parser.y:313
 		{
 			eskipVAL.regexpval = eskipDollar[1].token
 		}
@@ -107,6 +107,10 @@ routeid:
 	symbol {
 		$$.token = $1.token
 		eskiplex.(*eskipLex).lastRouteID = $1.token
+
+		// the lookahead token is the colon, so the last symbol is the ID
+		l := eskiplex.(*eskipLex)
+		l.routeOffsets = append(l.routeOffsets, l.symbolOffset)
 	}
 
 route:
@@ -157,11 +161,37 @@ matcher:
 		$$.matcher = &matcher{"*", nil}
 	}
 	|
-	symbol openparen args closeparen {
+	symbol openparen matcherargs closeparen {
 		$$.matcher = &matcher{$1.token, $3.args}
 		$3.args = nil
 	}
 
+matcherargs:
+	|
+	matcherarg {
+		$$.args = []interface{}{$1.arg}
+	}
+	|
+	matcherargs comma matcherarg {
+		$$.args = $1.args
+		$$.args = append($$.args, $3.arg)
+	}
+
+matcherarg:
+	arg {
+		$$.arg = $1.arg
+	}
+	|
+	frontend {
+		$$.arg = matchersToPredicates($1.matchers)
+		$1.matchers = nil
+	}
+	|
+	openparen frontend closeparen {
+		$$.arg = matchersToPredicates($2.matchers)
+		$2.matchers = nil
+	}
+
 filters:
 	filter {
 		$$.filters = []*Filter{$1.filter}
@@ -0,0 +1,129 @@
+package eskip
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// Position is the location of a route definition, or of a parsing error,
+// in an eskip document or in a JSON array of routes. Line and Column start
+// from 1, and Column is counted in bytes.
+type Position struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// PositionError is returned by ParseWithPositions and
+// ParseJSONWithPositions, when the parsing fails. It contains the
+// approximate position of the failure.
+type PositionError struct {
+	Position Position
+	Err      error
+}
+
+var errInvalidJSONRoutes = errors.New("invalid JSON routes, expected an array")
+
+func (err *PositionError) Error() string { return err.Err.Error() }
+func (err *PositionError) Unwrap() error { return err.Err }
+
+func newPosition(code []byte, offset int) Position {
+	if offset > len(code) {
+		offset = len(code)
+	}
+
+	return Position{
+		Offset: offset,
+		Line:   bytes.Count(code[:offset], []byte{newlineChar}) + 1,
+		Column: offset - bytes.LastIndexByte(code[:offset], newlineChar),
+	}
+}
+
+// ParseWithPositions parses a route expression or a routing document, the
+// same way as Parse, and returns the positions of the route definitions,
+// in the same order as the routes. In case of an error, it returns a
+// *PositionError.
+func ParseWithPositions(code string) ([]*Route, []Position, error) {
+	l := newLexer(code)
+	eskipParse(l)
+	if l.err != nil {
+		return nil, nil, &PositionError{Position: newPosition([]byte(code), l.errOffset), Err: l.err}
+	}
+
+	offsets := l.routeOffsets
+	if len(l.routes) == 1 && len(offsets) == 0 {
+		// a single route expression without an ID
+		offsets = []int{l.firstOffset}
+	}
+
+	routes := make([]*Route, len(l.routes))
+	positions := make([]Position, len(l.routes))
+	for i, r := range l.routes {
+		positions[i] = newPosition([]byte(code), offsets[i])
+		rd, err := newRouteDefinition(r)
+		if err != nil {
+			return nil, nil, &PositionError{Position: positions[i], Err: err}
+		}
+
+		routes[i] = rd
+	}
+
+	return routes, positions, nil
+}
+
+// skips the whitespace and the separating comma before the next array
+// element
+func nextJSONElement(data []byte, offset int) int {
+	for offset < len(data) && (isWhitespace(data[offset]) || data[offset] == ',') {
+		offset++
+	}
+
+	return offset
+}
+
+// ParseJSONWithPositions parses a JSON array of routes, and returns the
+// positions of the routes, in the same order as the routes. In case of an
+// error, it returns a *PositionError.
+func ParseJSONWithPositions(data []byte) ([]*Route, []Position, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	positionError := func(offset int, err error) error {
+		var serr *json.SyntaxError
+		if errors.As(err, &serr) {
+			offset = int(serr.Offset)
+		}
+
+		return &PositionError{Position: newPosition(data, offset), Err: err}
+	}
+
+	t, err := dec.Token()
+	if err != nil {
+		return nil, nil, positionError(0, err)
+	}
+
+	if t != json.Delim('[') {
+		return nil, nil, positionError(nextJSONElement(data, 0), errInvalidJSONRoutes)
+	}
+
+	var (
+		routes    []*Route
+		positions []Position
+	)
+
+	for dec.More() {
+		offset := nextJSONElement(data, int(dec.InputOffset()))
+		var r Route
+		if err := dec.Decode(&r); err != nil {
+			return nil, nil, positionError(offset, err)
+		}
+
+		routes = append(routes, &r)
+		positions = append(positions, newPosition(data, offset))
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, positionError(int(dec.InputOffset()), err)
+	}
+
+	return routes, positions, nil
+}
@@ -0,0 +1,154 @@
+package eskip
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseWithPositions(t *testing.T) {
+	for _, test := range []struct {
+		title     string
+		code      string
+		ids       []string
+		positions []Position
+		errorPos  *Position
+	}{{
+		title: "empty",
+	}, {
+		title:     "single route expression",
+		code:      "\n  Path(\"/foo\") -> <shunt>",
+		ids:       []string{""},
+		positions: []Position{{Offset: 3, Line: 2, Column: 3}},
+	}, {
+		title: "routing document",
+		code: `// comment
+foo: Path("/foo") -> <shunt>;
+	bar:
+		Path("/bar")
+		-> "https://bar.example.org";
+
+baz: * -> setPath("/baz") -> <shunt>`,
+		ids: []string{"foo", "bar", "baz"},
+		positions: []Position{
+			{Offset: 11, Line: 2, Column: 1},
+			{Offset: 42, Line: 3, Column: 2},
+			{Offset: 95, Line: 7, Column: 1},
+		},
+	}, {
+		title:    "syntax error",
+		code:     "foo: Path(\"/foo\") -> <shunt>;\nbar: Path(\"/bar\") -> ",
+		errorPos: &Position{Offset: 51, Line: 2, Column: 22},
+	}, {
+		title:    "invalid route definition",
+		code:     "foo: Path(\"/foo\") -> <shunt>;\nbar: Path(42) -> <shunt>",
+		errorPos: &Position{Offset: 30, Line: 2, Column: 1},
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			routes, positions, err := ParseWithPositions(test.code)
+			if test.errorPos != nil {
+				var perr *PositionError
+				if !errors.As(err, &perr) {
+					t.Fatalf("failed to fail with position: %v", err)
+				}
+
+				if perr.Position != *test.errorPos {
+					t.Errorf("unexpected error position: %+v, expected: %+v", perr.Position, *test.errorPos)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(routes) != len(test.ids) || len(positions) != len(test.positions) {
+				t.Fatalf("unexpected number of routes: %d, positions: %d", len(routes), len(positions))
+			}
+
+			for i, r := range routes {
+				if r.Id != test.ids[i] {
+					t.Errorf("unexpected route id: %s, expected: %s", r.Id, test.ids[i])
+				}
+
+				if positions[i] != test.positions[i] {
+					t.Errorf("unexpected position of %s: %+v, expected: %+v", r.Id, positions[i], test.positions[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseJSONWithPositions(t *testing.T) {
+	for _, test := range []struct {
+		title     string
+		data      string
+		ids       []string
+		positions []Position
+		errorPos  *Position
+	}{{
+		title: "empty",
+		data:  "[]",
+	}, {
+		title: "routes",
+		data: `[
+  {"id": "foo", "backend": {"type": "shunt"}},
+  {
+    "id": "bar",
+    "predicates": [{"name": "Path", "args": ["/bar"]}],
+    "backend": {"type": "network", "address": "https://bar.example.org"}
+  }
+]`,
+		ids: []string{"foo", "bar"},
+		positions: []Position{
+			{Offset: 4, Line: 2, Column: 3},
+			{Offset: 51, Line: 3, Column: 3},
+		},
+	}, {
+		title:    "not an array",
+		data:     ` {"id": "foo"}`,
+		errorPos: &Position{Offset: 1, Line: 1, Column: 2},
+	}, {
+		title:    "syntax error",
+		data:     "[\n  {\"id\": \"foo\"},\n  {\"id\" \"bar\"}\n]",
+		errorPos: &Position{Offset: 28, Line: 3, Column: 10},
+	}, {
+		title:    "invalid route",
+		data:     "[\n  {\"id\": \"foo\"},\n  {\"id\": \"bar\", \"backend\": {\"type\": \"foo\"}}\n]",
+		errorPos: &Position{Offset: 21, Line: 3, Column: 3},
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			routes, positions, err := ParseJSONWithPositions([]byte(test.data))
+			if test.errorPos != nil {
+				var perr *PositionError
+				if !errors.As(err, &perr) {
+					t.Fatalf("failed to fail with position: %v", err)
+				}
+
+				if perr.Position != *test.errorPos {
+					t.Errorf("unexpected error position: %+v, expected: %+v", perr.Position, *test.errorPos)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(routes) != len(test.ids) || len(positions) != len(test.positions) {
+				t.Fatalf("unexpected number of routes: %d, positions: %d", len(routes), len(positions))
+			}
+
+			for i, r := range routes {
+				if r.Id != test.ids[i] {
+					t.Errorf("unexpected route id: %s, expected: %s", r.Id, test.ids[i])
+				}
+
+				if positions[i] != test.positions[i] {
+					t.Errorf("unexpected position of %s: %+v, expected: %+v", r.Id, positions[i], test.positions[i])
+				}
+			}
+		})
+	}
+}
@@ -122,3 +122,103 @@ func TestRoundtripRegexp(t *testing.T) {
 		})
 	}
 }
+
+// Test the nested predicate groups of the Or and Not predicates are
+// preserved by the serialization, the JSON format and the copy
+func TestRoundtripPredicateGroups(t *testing.T) {
+	for i, expression := range []string{
+		`Or(Host(/^www[.]example[.]org$/), Host("^api[.]example[.]org$")) -> <shunt>`,
+		`Path("/foo") && Not(Header("X-Beta", "true")) -> <shunt>`,
+		`Or(Method("GET") && Header("X-Beta", "true"), (Method("POST") && Cookie("beta", "1")), Path("/bar/:id")) -> <shunt>`,
+		`Not(Or(Traffic(.3), Not(*))) -> <shunt>`,
+	} {
+		t.Run(fmt.Sprintf("test#%d", i), func(t *testing.T) {
+			routes, err := Parse(expression)
+			require.NoError(t, err)
+			require.Len(t, routes, 1)
+
+			in := routes[0]
+			t.Logf("%s", in)
+
+			outs, err := Parse(in.String())
+			require.NoError(t, err)
+			require.Len(t, outs, 1)
+			assert.True(t, Eq(in, outs[0]), "string: %s", outs[0])
+
+			b, err := in.MarshalJSON()
+			require.NoError(t, err)
+
+			var out Route
+			require.NoError(t, out.UnmarshalJSON(b))
+			assert.True(t, Eq(in, &out), "json: %s", b)
+
+			c := Copy(in)
+			assert.True(t, Eq(in, c), "copy: %s", c)
+		})
+	}
+}
+
+func TestPredicateGroupsJSONPlainArrays(t *testing.T) {
+	for _, test := range []struct {
+		args     string
+		expected interface{}
+	}{
+		{args: `[[null]]`, expected: []interface{}{nil}},
+		{args: `[[]]`, expected: []interface{}{}},
+		{args: `[[{"args":["a"]}]]`, expected: []interface{}{map[string]interface{}{"args": []interface{}{"a"}}}},
+		{args: `[[{"name":"Host","args":["a"]},null]]`, expected: []interface{}{map[string]interface{}{"name": "Host", "args": []interface{}{"a"}}, nil}},
+	} {
+		t.Run(test.args, func(t *testing.T) {
+			var r Route
+			require.NoError(t, r.UnmarshalJSON([]byte(`{"predicates":[{"name":"Foo","args":`+test.args+`}],"backend":{"type":"shunt"}}`)))
+			require.Len(t, r.Predicates, 1)
+			require.Len(t, r.Predicates[0].Args, 1)
+			assert.Equal(t, test.expected, r.Predicates[0].Args[0])
+
+			s := r.String()
+			assert.NotContains(t, s, "Foo(*)")
+
+			b, err := r.MarshalJSON()
+			require.NoError(t, err)
+
+			var out Route
+			require.NoError(t, out.UnmarshalJSON(b))
+			assert.True(t, Eq(&r, &out), "json: %s", b)
+		})
+	}
+}
+
+func TestPredicateGroups(t *testing.T) {
+	routes, err := Parse(`Path("/foo") && Or(Host("a"), (Method("GET") && Header("X-Beta", "true")), Not(*)) -> <shunt>`)
+	require.NoError(t, err)
+	require.Len(t, routes, 1)
+
+	// the not wrapped tree predicates remain on the route
+	r := routes[0]
+	assert.Equal(t, "/foo", r.Path)
+	require.Len(t, r.Predicates, 1)
+
+	or := r.Predicates[0]
+	assert.Equal(t, "Or", or.Name)
+	require.Len(t, or.Args, 3)
+	assert.Equal(t, []*Predicate{{Name: "Host", Args: []interface{}{"a"}}}, or.Args[0])
+	assert.Equal(t, []*Predicate{
+		{Name: "Method", Args: []interface{}{"GET"}},
+		{Name: "Header", Args: []interface{}{"X-Beta", "true"}},
+	}, or.Args[1])
+	assert.Equal(t, []*Predicate{{Name: "Not", Args: []interface{}{[]*Predicate{}}}}, or.Args[2])
+
+	c := Copy(r)
+	c.Predicates[0].Args[1].([]*Predicate)[0].Args[0] = "POST"
+	assert.Equal(t, "GET", or.Args[1].([]*Predicate)[0].Args[0], "copy must be deep")
+	assert.False(t, Eq(r, c))
+
+	for _, invalid := range []string{
+		`Or((Host("a")) -> <shunt>`,
+		`Or(Host("a") &&) -> <shunt>`,
+		`* -> setPath(Host("a")) -> <shunt>`,
+	} {
+		_, err := Parse(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -61,6 +61,8 @@ func argsString(args []interface{}) string {
 			sargs = appendFmt(sargs, f, a)
 		case string:
 			sargs = appendFmtEscape(sargs, `"%s"`, `"`, a)
+		case []*Predicate:
+			sargs = append(sargs, predicateGroupString(v))
 		default:
 			if m, ok := a.(interface{ MarshalText() ([]byte, error) }); ok {
 				t, err := m.MarshalText()
@@ -78,6 +80,25 @@ func argsString(args []interface{}) string {
 	return strings.Join(sargs, ", ")
 }
 
+// serializes a nested predicate group, used as the argument of the Or and
+// Not predicates. Groups of multiple predicates are enclosed in parentheses.
+func predicateGroupString(g []*Predicate) string {
+	if len(g) == 0 {
+		return "*"
+	}
+
+	ps := make([]string, len(g))
+	for i, p := range g {
+		ps[i] = p.String()
+	}
+
+	if len(ps) == 1 {
+		return ps[0]
+	}
+
+	return "(" + strings.Join(ps, " && ") + ")"
+}
+
 func (r *Route) predicateString() string {
 	var predicates []string
 
@@ -0,0 +1,260 @@
+/*
+Package backendtls provides the backendTLS filter, that configures the
+TLS client settings of the backend connections of a route, e.g. a client
+certificate for mTLS to a partner backend, or a private CA bundle:
+
+	backendTLS("/secrets/partner/tls.crt", "/secrets/partner/tls.key", "/secrets/partner/ca.crt", "api.partner.example.org", "1.2")
+
+The certificate, key and CA arguments are the names of the secrets, that
+are resolved with a secrets.SecretsReader. When the secrets change, e.g.
+due to the rotation of the secret files, the filter creates a new TLS
+configuration, and the proxy uses a new transport with it.
+*/
+package backendtls
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/secrets"
+)
+
+// Config is the TLS configuration of the backend connections, set by
+// the backendTLS filter in the state bag.
+type Config struct {
+
+	// Key identifies the TLS configuration. It changes, when the
+	// TLS material changes. The proxy uses it to cache the backend
+	// transports.
+	Key string
+
+	// TLS is the client configuration of the backend connections.
+	TLS *tls.Config
+}
+
+type (
+	spec struct {
+		secretsReader secrets.SecretsReader
+	}
+
+	filter struct {
+		secretsReader secrets.SecretsReader
+		certSecret    string
+		keySecret     string
+		caSecret      string
+		serverName    string
+		minVersion    uint16
+
+		mu     sync.Mutex
+		cert   []byte
+		key    []byte
+		ca     []byte
+		config *Config
+	}
+)
+
+var tlsVersions = map[string]uint16{
+	"1.3": tls.VersionTLS13,
+	"13":  tls.VersionTLS13,
+	"1.2": tls.VersionTLS12,
+	"12":  tls.VersionTLS12,
+	"1.1": tls.VersionTLS11,
+	"11":  tls.VersionTLS11,
+	"1.0": tls.VersionTLS10,
+	"10":  tls.VersionTLS10,
+}
+
+var (
+	errMissingSecret = errors.New("secret not found")
+	errInvalidCA     = errors.New("no valid certificate found in the CA bundle")
+)
+
+// New creates a filter specification for the backendTLS() filter:
+//
+//	backendTLS(certSecret, keySecret, caSecret, serverName, minVersion)
+//
+// The certificate and the key secrets contain the PEM encoded client
+// certificate and its private key. The CA secret contains the PEM
+// encoded certificates used to verify the backend, instead of the
+// system trust store. The server name overrides the host name used
+// for SNI and for verifying the backend certificate. The minimum
+// version is one of "1.0", "1.1", "1.2" or "1.3", the default is
+// "1.2".
+//
+// At least the first three arguments are required, any of them can be
+// an empty string, except that the certificate and the key are set
+// together.
+//
+// The configuration replaces the global client TLS settings of the
+// proxy for the route. When the TLS material cannot be loaded, the
+// previously loaded configuration is used, or, if there is none, the
+// requests are responded with 502 Bad Gateway.
+func New(sr secrets.SecretsReader) filters.Spec {
+	return &spec{secretsReader: sr}
+}
+
+func (*spec) Name() string { return filters.BackendTLSName }
+
+func (s *spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) < 3 || len(args) > 5 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	var sargs [5]string
+	for i, a := range args {
+		s, ok := a.(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		sargs[i] = s
+	}
+
+	if (sargs[0] == "") != (sargs[1] == "") {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &filter{
+		secretsReader: s.secretsReader,
+		certSecret:    sargs[0],
+		keySecret:     sargs[1],
+		caSecret:      sargs[2],
+		serverName:    sargs[3],
+		minVersion:    tls.VersionTLS12,
+	}
+
+	if sargs[4] != "" {
+		v, ok := tlsVersions[sargs[4]]
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		f.minVersion = v
+	}
+
+	return f, nil
+}
+
+func (f *filter) secret(name string) ([]byte, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	if f.secretsReader == nil {
+		return nil, errMissingSecret
+	}
+
+	b, ok := f.secretsReader.GetSecret(name)
+	if !ok {
+		return nil, errMissingSecret
+	}
+
+	return b, nil
+}
+
+func (f *filter) createConfig(cert, key, ca []byte) (*Config, error) {
+	c := &tls.Config{
+		ServerName: f.serverName,
+		MinVersion: f.minVersion,
+	}
+
+	if len(cert) > 0 {
+		kp, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Certificates = []tls.Certificate{kp}
+	}
+
+	if len(ca) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errInvalidCA
+		}
+
+		c.RootCAs = pool
+	}
+
+	h := sha256.New()
+	for _, b := range [][]byte{cert, key, ca, []byte(f.serverName), {byte(f.minVersion >> 8), byte(f.minVersion)}} {
+		h.Write(b)
+		h.Write([]byte{0})
+	}
+
+	return &Config{Key: hex.EncodeToString(h.Sum(nil)), TLS: c}, nil
+}
+
+func (f *filter) previous() *Config {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.config
+}
+
+// current returns the configuration matching the current secrets,
+// and creates a new one when they changed since the last request.
+func (f *filter) current() (*Config, error) {
+	var material [3][]byte
+	for i, name := range []string{f.certSecret, f.keySecret, f.caSecret} {
+		b, err := f.secret(name)
+		if err != nil {
+			return f.previous(), fmt.Errorf("%s: %w", name, err)
+		}
+
+		material[i] = b
+	}
+
+	cert, key, ca := material[0], material[1], material[2]
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.config != nil && bytes.Equal(cert, f.cert) && bytes.Equal(key, f.key) && bytes.Equal(ca, f.ca) {
+		return f.config, nil
+	}
+
+	c, err := f.createConfig(cert, key, ca)
+	if err != nil {
+		// during the rotation, the secrets may be updated one by
+		// one, the previous configuration is kept until they match
+		return f.config, err
+	}
+
+	if f.config != nil {
+		log.Infof("backendTLS: TLS material changed, certificate: %s, CA: %s", f.certSecret, f.caSecret)
+	}
+
+	f.cert, f.key, f.ca, f.config = cert, key, ca, c
+	return c, nil
+}
+
+// BackendTLSConfig returns the TLS configuration loaded by the last
+// request, or nil before the first one. The proxy uses it to find the
+// transports referenced by the routes.
+func (f *filter) BackendTLSConfig() *Config { return f.previous() }
+
+func (f *filter) Request(ctx filters.FilterContext) {
+	c, err := f.current()
+	if err != nil {
+		log.Errorf("backendTLS: failed to load the TLS material, certificate: %s, CA: %s: %v", f.certSecret, f.caSecret, err)
+	}
+
+	if c == nil {
+		ctx.Serve(&http.Response{StatusCode: http.StatusBadGateway})
+		return
+	}
+
+	// allows overwrite
+	ctx.StateBag()[filters.BackendTLS] = c
+}
+
+func (*filter) Response(filters.FilterContext) {}
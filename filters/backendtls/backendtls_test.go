@@ -0,0 +1,223 @@
+package backendtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+)
+
+type testSecrets struct {
+	mu      sync.Mutex
+	secrets map[string][]byte
+}
+
+func (s *testSecrets) GetSecret(name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.secrets[name]
+	return b, ok
+}
+
+func (s *testSecrets) set(name string, b []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.secrets[name] = b
+}
+
+func (*testSecrets) Close() {}
+
+func testCert(t *testing.T, cn string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder})
+}
+
+func TestCreateFilter(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		args       []interface{}
+		minVersion uint16
+		fail       bool
+	}{{
+		name: "no args",
+		fail: true,
+	}, {
+		name: "too few args",
+		args: []interface{}{"cert", "key"},
+		fail: true,
+	}, {
+		name: "not a string",
+		args: []interface{}{"cert", "key", 42},
+		fail: true,
+	}, {
+		name: "cert without key",
+		args: []interface{}{"cert", "", "ca"},
+		fail: true,
+	}, {
+		name: "invalid version",
+		args: []interface{}{"", "", "ca", "", "1.4"},
+		fail: true,
+	}, {
+		name: "too many args",
+		args: []interface{}{"cert", "key", "ca", "", "1.2", "foo"},
+		fail: true,
+	}, {
+		name:       "CA only",
+		args:       []interface{}{"", "", "ca"},
+		minVersion: tls.VersionTLS12,
+	}, {
+		name:       "all args",
+		args:       []interface{}{"cert", "key", "ca", "api.example.org", "1.3"},
+		minVersion: tls.VersionTLS13,
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := New(nil).CreateFilter(tt.args)
+			if tt.fail {
+				if err == nil {
+					t.Fatal("failed to fail")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if v := f.(*filter).minVersion; v != tt.minVersion {
+				t.Errorf("unexpected min version: %x", v)
+			}
+		})
+	}
+}
+
+func request(t *testing.T, f filters.Filter) *filtertest.Context {
+	req, err := http.NewRequest("GET", "https://www.example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &filtertest.Context{FRequest: req, FStateBag: make(map[string]interface{})}
+	f.Request(ctx)
+	return ctx
+}
+
+func config(t *testing.T, f filters.Filter) *Config {
+	ctx := request(t, f)
+	if ctx.FServed {
+		t.Fatalf("unexpected response: %d", ctx.FResponse.StatusCode)
+	}
+
+	c, ok := ctx.FStateBag[filters.BackendTLS].(*Config)
+	if !ok {
+		t.Fatal("TLS configuration not set")
+	}
+
+	return c
+}
+
+func TestRequest(t *testing.T) {
+	cert, key := testCert(t, "client")
+	ca, _ := testCert(t, "ca")
+	sr := &testSecrets{secrets: map[string][]byte{"cert": cert, "key": key, "ca": ca}}
+
+	f, err := New(sr).CreateFilter([]interface{}{"cert", "key", "ca", "api.example.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := config(t, f)
+	if len(c.TLS.Certificates) != 1 || c.TLS.RootCAs == nil || c.TLS.ServerName != "api.example.org" || c.TLS.MinVersion != tls.VersionTLS12 {
+		t.Fatalf("unexpected TLS configuration: %+v", c.TLS)
+	}
+
+	if config(t, f) != c {
+		t.Error("failed to reuse the configuration")
+	}
+
+	// rotation
+	cert, key = testCert(t, "client")
+	sr.set("cert", cert)
+	sr.set("key", key)
+	rotated := config(t, f)
+	if rotated == c || rotated.Key == c.Key {
+		t.Fatal("failed to reload the rotated certificate")
+	}
+
+	// partially rotated material keeps the previous configuration
+	cert, _ = testCert(t, "client")
+	sr.set("cert", cert)
+	if config(t, f) != rotated {
+		t.Error("failed to keep the previous configuration")
+	}
+}
+
+func TestInvalidMaterial(t *testing.T) {
+	cert, key := testCert(t, "client")
+	for _, tt := range []struct {
+		name    string
+		secrets map[string][]byte
+	}{{
+		name:    "missing secret",
+		secrets: map[string][]byte{"cert": cert, "key": key},
+	}, {
+		name:    "invalid key pair",
+		secrets: map[string][]byte{"cert": cert, "key": []byte("foo"), "ca": cert},
+	}, {
+		name:    "invalid CA",
+		secrets: map[string][]byte{"cert": cert, "key": key, "ca": []byte("foo")},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := New(&testSecrets{secrets: tt.secrets}).CreateFilter([]interface{}{"cert", "key", "ca"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := request(t, f)
+			if !ctx.FServed || ctx.FResponse.StatusCode != http.StatusBadGateway {
+				t.Error("failed to respond with bad gateway")
+			}
+
+			if _, ok := ctx.FStateBag[filters.BackendTLS]; ok {
+				t.Error("unexpected TLS configuration")
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package buffer
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// storage holds the buffered content, in memory or in a temporary
+// file, shared by the bodies and the readers created from the same
+// request body. The temporary file is removed when the last reference
+// is released.
+type storage struct {
+	mu   sync.Mutex
+	refs int
+	data []byte
+	file *os.File
+	size int64
+}
+
+func (s *storage) acquire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refs++
+}
+
+func (s *storage) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refs--
+	if s.refs > 0 || s.file == nil {
+		return
+	}
+
+	s.file.Close()
+	os.Remove(s.file.Name())
+	s.file = nil
+}
+
+func (s *storage) reader() io.Reader {
+	if s.file != nil {
+		return io.NewSectionReader(s.file, 0, s.size)
+	}
+
+	return bytes.NewReader(s.data)
+}
+
+// Body is a fully buffered request body that can be read multiple
+// times. It is set as the request body by the bufferRequestBody filter.
+// Besides reading it directly, independent readers can be created from
+// it, e.g. for retrying the backend request or for sending the request
+// to a shadow backend.
+type Body struct {
+	storage *storage
+	r       io.Reader
+	once    sync.Once
+}
+
+type reader struct {
+	io.Reader
+	storage *storage
+	once    sync.Once
+}
+
+func newBody(s *storage) *Body {
+	s.acquire()
+	return &Body{storage: s, r: s.reader()}
+}
+
+// Size returns the length of the buffered content.
+func (b *Body) Size() int64 {
+	return b.storage.size
+}
+
+// Read reads the buffered content. It doesn't affect the readers
+// created with NewReader or the clones of the body.
+func (b *Body) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
+// Close releases the body. The buffered content stays available to the
+// readers and clones that were created from it and not yet closed.
+func (b *Body) Close() error {
+	b.once.Do(b.storage.release)
+	return nil
+}
+
+// NewReader returns a reader of the complete buffered content. It must
+// be closed by the caller. Passed to an http.Client or an
+// http.RoundTripper as the request body, it is closed by them.
+func (b *Body) NewReader() io.ReadCloser {
+	b.storage.acquire()
+	return &reader{Reader: b.storage.reader(), storage: b.storage}
+}
+
+// Clone returns a new body sharing the buffered content of the
+// original one. It must be closed by the caller.
+func (b *Body) Clone() *Body {
+	return newBody(b.storage)
+}
+
+func (r *reader) Close() error {
+	r.once.Do(r.storage.release)
+	return nil
+}
+
+// partialBody is used for the oversized requests when they are streamed
+// to the backend. It reads the already buffered part first, and then the
+// rest of the original body.
+type partialBody struct {
+	io.Reader
+	buffered *Body
+	original io.ReadCloser
+}
+
+func (b *partialBody) Close() error {
+	b.buffered.Close()
+	return b.original.Close()
+}
@@ -0,0 +1,215 @@
+/*
+Package buffer provides a filter to buffer the complete request body
+before the request is proxied.
+
+The buffered body can be read multiple times, which allows the proxy
+to retry the requests with a body, and the tee and teeLoopback filters
+and the loopback routes to send the body again without streaming
+tricks.
+
+The package also provides the maxRequestBodySize filter, that limits
+the size of the request body.
+*/
+package buffer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando/skipper/filters"
+)
+
+const (
+	rejectOversized = "reject"
+	streamOversized = "stream"
+)
+
+type spec struct{}
+
+type filter struct {
+	maxBytes int64
+	spill    int64
+	stream   bool
+}
+
+// NewBufferRequestBody creates a filter specification to instantiate
+// bufferRequestBody() filters.
+//
+// The filters read the complete request body, and replace it with a
+// replayable Body:
+//
+//	bufferRequestBody(1048576, 65536, "stream")
+//
+// The first argument is the maximum size of the buffered body in bytes.
+// The optional second argument is the size in bytes above which the body
+// is buffered in a temporary file instead of the memory, 0 means that it
+// is always kept in memory. The optional third argument defines how the
+// bodies larger than the maximum size are handled: "reject" responds
+// with 413 Request Entity Too Large, "stream" proxies them unbuffered.
+// The default is "reject".
+func NewBufferRequestBody() filters.Spec { return &spec{} }
+
+func (*spec) Name() string { return filters.BufferRequestBodyName }
+
+func intArg(a interface{}) (int64, error) {
+	switch v := a.(type) {
+	case int:
+		return int64(v), nil
+	case float64:
+		return int64(v), nil
+	default:
+		return 0, filters.ErrInvalidFilterParameters
+	}
+}
+
+func (*spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) == 0 || len(args) > 3 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	var (
+		f   filter
+		err error
+	)
+
+	if f.maxBytes, err = intArg(args[0]); err != nil {
+		return nil, err
+	}
+
+	if f.maxBytes <= 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	if len(args) > 1 {
+		if f.spill, err = intArg(args[1]); err != nil {
+			return nil, err
+		}
+
+		if f.spill < 0 {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+	}
+
+	if len(args) > 2 {
+		switch args[2] {
+		case rejectOversized:
+		case streamOversized:
+			f.stream = true
+		default:
+			return nil, filters.ErrInvalidFilterParameters
+		}
+	}
+
+	return &f, nil
+}
+
+// read buffers the body up to the maximum size plus one byte, so that
+// the oversized bodies can be detected.
+func (f *filter) read(body io.Reader) (*storage, error) {
+	limit := f.maxBytes + 1
+	r := io.LimitReader(body, limit)
+	if f.spill <= 0 || f.spill >= limit {
+		data, err := io.ReadAll(r)
+		return &storage{data: data, size: int64(len(data))}, err
+	}
+
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, r, f.spill+1)
+	if err == io.EOF {
+		return &storage{data: buf.Bytes(), size: n}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	file, err := os.CreateTemp("", "skipper-body-")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &storage{file: file}
+	if _, err := buf.WriteTo(file); err != nil {
+		s.refs = 1
+		s.release()
+		return nil, err
+	}
+
+	rest, err := io.Copy(file, r)
+	s.size = n + rest
+	if err != nil {
+		s.refs = 1
+		s.release()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (f *filter) reject(ctx filters.FilterContext) {
+	ctx.Serve(&http.Response{
+		StatusCode: http.StatusRequestEntityTooLarge,
+		Header:     make(http.Header),
+	})
+}
+
+// Request buffers the request body. Requests without a body and the
+// requests with an already buffered body, e.g. on loopback routes, are
+// left untouched.
+func (f *filter) Request(ctx filters.FilterContext) {
+	req := ctx.Request()
+	if req.Body == nil || req.Body == http.NoBody || req.ContentLength == 0 && len(req.TransferEncoding) == 0 {
+		return
+	}
+
+	if _, ok := req.Body.(*Body); ok {
+		return
+	}
+
+	if req.ContentLength > f.maxBytes {
+		if !f.stream {
+			f.reject(ctx)
+		}
+
+		return
+	}
+
+	s, err := f.read(req.Body)
+	if errors.Is(err, ErrBodyTooLarge) {
+		f.reject(ctx)
+		return
+	} else if err != nil {
+		log.Errorf("bufferRequestBody: failed to read the request body: %v", err)
+		ctx.Serve(&http.Response{
+			StatusCode: http.StatusBadRequest,
+			Header:     make(http.Header),
+		})
+
+		return
+	}
+
+	b := newBody(s)
+	if s.size > f.maxBytes {
+		if !f.stream {
+			b.Close()
+			f.reject(ctx)
+			return
+		}
+
+		req.Body = &partialBody{
+			Reader:   io.MultiReader(b, req.Body),
+			buffered: b,
+			original: req.Body,
+		}
+
+		return
+	}
+
+	req.Body = b
+	req.ContentLength = s.size
+	req.TransferEncoding = nil
+}
+
+func (*filter) Response(filters.FilterContext) {}
@@ -0,0 +1,290 @@
+package buffer
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+)
+
+type testBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *testBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func newRequest(t *testing.T, content string, contentLength int64) (*http.Request, *testBody) {
+	body := &testBody{Reader: strings.NewReader(content)}
+	req, err := http.NewRequest("POST", "https://www.example.org", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.ContentLength = contentLength
+	if contentLength < 0 {
+		req.TransferEncoding = []string{"chunked"}
+	}
+
+	return req, body
+}
+
+func createFilter(t *testing.T, args ...interface{}) filters.Filter {
+	f, err := NewBufferRequestBody().CreateFilter(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+func readAll(t *testing.T, r io.Reader) string {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+func TestCreateFilter(t *testing.T) {
+	for _, test := range []struct {
+		title    string
+		args     []interface{}
+		expected filter
+		fail     bool
+	}{{
+		title: "no args",
+		fail:  true,
+	}, {
+		title: "too many args",
+		args:  []interface{}{1024, 512, "reject", "foo"},
+		fail:  true,
+	}, {
+		title: "invalid max",
+		args:  []interface{}{"1024"},
+		fail:  true,
+	}, {
+		title: "zero max",
+		args:  []interface{}{0},
+		fail:  true,
+	}, {
+		title:    "max only",
+		args:     []interface{}{1024.0},
+		expected: filter{maxBytes: 1024},
+	}, {
+		title: "negative spill",
+		args:  []interface{}{1024, -1},
+		fail:  true,
+	}, {
+		title:    "spill",
+		args:     []interface{}{1024, 512},
+		expected: filter{maxBytes: 1024, spill: 512},
+	}, {
+		title:    "reject",
+		args:     []interface{}{1024, 0, "reject"},
+		expected: filter{maxBytes: 1024},
+	}, {
+		title:    "stream",
+		args:     []interface{}{1024, 0, "stream"},
+		expected: filter{maxBytes: 1024, stream: true},
+	}, {
+		title: "invalid oversize mode",
+		args:  []interface{}{1024, 0, "drop"},
+		fail:  true,
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			f, err := NewBufferRequestBody().CreateFilter(test.args)
+			if test.fail {
+				if err == nil {
+					t.Fatal("failed to fail")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if *f.(*filter) != test.expected {
+				t.Errorf("invalid filter, expected: %+v, got: %+v", test.expected, *f.(*filter))
+			}
+		})
+	}
+}
+
+func TestNoBody(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://www.example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &filtertest.Context{FRequest: req}
+	createFilter(t, 1024).Request(ctx)
+	if req.Body != nil || ctx.FServed {
+		t.Error("unexpected change of the request")
+	}
+}
+
+func TestBufferInMemory(t *testing.T) {
+	const content = "Hello, world!"
+	for _, contentLength := range []int64{int64(len(content)), -1} {
+		req, original := newRequest(t, content, contentLength)
+		ctx := &filtertest.Context{FRequest: req}
+		createFilter(t, 1024).Request(ctx)
+
+		b, ok := req.Body.(*Body)
+		if !ok {
+			t.Fatal("failed to buffer the body")
+		}
+
+		if b.storage.file != nil {
+			t.Error("unexpected temporary file")
+		}
+
+		if req.ContentLength != int64(len(content)) || len(req.TransferEncoding) != 0 {
+			t.Errorf("invalid content length: %d, %v", req.ContentLength, req.TransferEncoding)
+		}
+
+		for i := 0; i < 3; i++ {
+			r := b.NewReader()
+			if s := readAll(t, r); s != content {
+				t.Errorf("invalid content: %s", s)
+			}
+
+			r.Close()
+		}
+
+		if s := readAll(t, b); s != content {
+			t.Errorf("invalid content: %s", s)
+		}
+
+		if original.closed {
+			t.Error("the original body must be closed by the server")
+		}
+
+		b.Close()
+	}
+}
+
+func TestSpillToDisk(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	req, _ := newRequest(t, content, -1)
+	ctx := &filtertest.Context{FRequest: req}
+	createFilter(t, 4096, 64).Request(ctx)
+
+	b, ok := req.Body.(*Body)
+	if !ok {
+		t.Fatal("failed to buffer the body")
+	}
+
+	if b.storage.file == nil {
+		t.Fatal("failed to spill the body to disk")
+	}
+
+	name := b.storage.file.Name()
+	r := b.NewReader()
+	clone := b.Clone()
+	b.Close()
+
+	if s := readAll(t, r); s != content {
+		t.Error("invalid content of the reader")
+	}
+
+	r.Close()
+	if s := readAll(t, clone); s != content {
+		t.Error("invalid content of the clone")
+	}
+
+	if _, err := os.Stat(name); err != nil {
+		t.Fatal("temporary file removed too early")
+	}
+
+	clone.Close()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Error("failed to remove the temporary file")
+	}
+}
+
+func TestOversized(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	for _, test := range []struct {
+		title         string
+		contentLength int64
+		args          []interface{}
+	}{{
+		title:         "known length",
+		contentLength: int64(len(content)),
+		args:          []interface{}{64, 0},
+	}, {
+		title:         "chunked",
+		contentLength: -1,
+		args:          []interface{}{64, 0},
+	}, {
+		title:         "chunked, spilled",
+		contentLength: -1,
+		args:          []interface{}{64, 16},
+	}} {
+		t.Run(test.title+", reject", func(t *testing.T) {
+			req, _ := newRequest(t, content, test.contentLength)
+			ctx := &filtertest.Context{FRequest: req}
+			createFilter(t, test.args...).Request(ctx)
+			if !ctx.FServed || ctx.FResponse.StatusCode != http.StatusRequestEntityTooLarge {
+				t.Error("failed to reject the request")
+			}
+		})
+
+		t.Run(test.title+", stream", func(t *testing.T) {
+			req, original := newRequest(t, content, test.contentLength)
+			ctx := &filtertest.Context{FRequest: req}
+			createFilter(t, append(test.args, "stream")...).Request(ctx)
+			if ctx.FServed {
+				t.Fatal("unexpected response")
+			}
+
+			if _, ok := req.Body.(*Body); ok {
+				t.Fatal("unexpected buffering")
+			}
+
+			if s := readAll(t, req.Body); s != content {
+				t.Errorf("invalid content: %s", s)
+			}
+
+			if req.ContentLength != test.contentLength {
+				t.Errorf("unexpected content length: %d", req.ContentLength)
+			}
+
+			req.Body.Close()
+			if !original.closed {
+				t.Error("failed to close the original body")
+			}
+		})
+	}
+}
+
+func TestLoopbackKeepsBuffer(t *testing.T) {
+	req, _ := newRequest(t, "Hello, world!", -1)
+	ctx := &filtertest.Context{FRequest: req}
+	f := createFilter(t, 1024)
+	f.Request(ctx)
+	b := req.Body
+	f.Request(ctx)
+	if req.Body != b {
+		t.Error("unexpected buffering of a buffered body")
+	}
+
+	var buf bytes.Buffer
+	buf.ReadFrom(req.Body)
+	if buf.String() != "Hello, world!" {
+		t.Errorf("invalid content: %s", buf.String())
+	}
+}
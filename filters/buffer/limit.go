@@ -0,0 +1,119 @@
+package buffer
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/zalando/skipper/filters"
+)
+
+// BodyTooLargeKey is set in the state bag by the maxRequestBodySize
+// filter, when the Content-Length of the request exceeds the limit. The
+// proxy doesn't execute the rest of the request filters, and rejects
+// these requests with 413 Request Entity Too Large.
+const BodyTooLargeKey = "#requestbodytoolarge"
+
+// ErrBodyTooLarge is returned when reading a limited request body that
+// exceeds the limit.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+type limitSpec struct{}
+
+type limitFilter struct {
+	maxBytes int64
+}
+
+// limitedBody returns ErrBodyTooLarge, once more than the allowed bytes
+// were read from the underlying body.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  bool
+}
+
+// NewMaxRequestBodySize creates a filter specification to instantiate
+// maxRequestBodySize() filters.
+//
+// The filters limit the size of the request body:
+//
+//	maxRequestBodySize(1048576)
+//
+// The requests with a larger Content-Length are rejected by the proxy
+// with 413 Request Entity Too Large, without reading the body, and
+// without executing the subsequent filters of the route. Reading
+// the chunked bodies fails once the limit is exceeded, which aborts the
+// backend request, and the proxy responds with 413, too. The filter
+// needs to precede the filters that read the body, e.g. sedRequest, in
+// order to protect them.
+func NewMaxRequestBodySize() filters.Spec { return limitSpec{} }
+
+func (limitSpec) Name() string { return filters.MaxRequestBodySizeName }
+
+func (limitSpec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) != 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	maxBytes, err := intArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if maxBytes <= 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return &limitFilter{maxBytes: maxBytes}, nil
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, ErrBodyTooLarge
+	}
+
+	// reading one byte more than the limit detects the oversized bodies
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remaining {
+		b.exceeded = true
+		return int(b.remaining), ErrBodyTooLarge
+	}
+
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// LimitBody limits the size of the request body to maxBytes. It returns
+// false, when the Content-Length of the request exceeds the limit. In
+// this case, reading the body fails right away. Buffered bodies are not
+// wrapped, because their size is known.
+func LimitBody(req *http.Request, maxBytes int64) bool {
+	if req.ContentLength > maxBytes {
+		req.Body = &limitedBody{ReadCloser: req.Body, exceeded: true}
+		return false
+	}
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return true
+	}
+
+	if _, ok := req.Body.(*Body); ok {
+		return true
+	}
+
+	req.Body = &limitedBody{ReadCloser: req.Body, remaining: maxBytes}
+	return true
+}
+
+// Request limits the size of the request body.
+func (f *limitFilter) Request(ctx filters.FilterContext) {
+	if !LimitBody(ctx.Request(), f.maxBytes) {
+		ctx.StateBag()[BodyTooLargeKey] = true
+	}
+}
+
+func (*limitFilter) Response(filters.FilterContext) {}
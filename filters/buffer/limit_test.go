@@ -0,0 +1,136 @@
+package buffer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/zalando/skipper/filters/filtertest"
+)
+
+func TestCreateMaxRequestBodySize(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{"1024"},
+		{0},
+		{-1},
+		{1024, 2048},
+	} {
+		if _, err := NewMaxRequestBodySize().CreateFilter(args); err == nil {
+			t.Errorf("failed to fail: %v", args)
+		}
+	}
+
+	if _, err := NewMaxRequestBodySize().CreateFilter([]interface{}{1024.0}); err != nil {
+		t.Error(err)
+	}
+}
+
+func limitRequest(t *testing.T, body string, contentLength int64, limit int) (*filtertest.Context, []byte, error) {
+	f, err := NewMaxRequestBodySize().CreateFilter([]interface{}{limit})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("POST", "https://www.example.org", io.NopCloser(strings.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.ContentLength = contentLength
+	ctx := &filtertest.Context{FRequest: req, FStateBag: make(map[string]interface{})}
+	f.Request(ctx)
+
+	b, err := io.ReadAll(ctx.FRequest.Body)
+	return ctx, b, err
+}
+
+func TestMaxRequestBodySize(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		body          string
+		contentLength int64
+		limit         int
+		tooLarge      bool
+		readErr       bool
+	}{{
+		name:          "content length within the limit",
+		body:          "Hello, world!",
+		contentLength: 13,
+		limit:         13,
+	}, {
+		name:          "content length exceeds the limit",
+		body:          "Hello, world!",
+		contentLength: 13,
+		limit:         12,
+		tooLarge:      true,
+		readErr:       true,
+	}, {
+		name:          "chunked within the limit",
+		body:          "Hello, world!",
+		contentLength: -1,
+		limit:         13,
+	}, {
+		name:          "chunked exceeds the limit",
+		body:          strings.Repeat("Hello, world!", 1000),
+		contentLength: -1,
+		limit:         12,
+		readErr:       true,
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, b, err := limitRequest(t, tt.body, tt.contentLength, tt.limit)
+			if _, ok := ctx.FStateBag[BodyTooLargeKey]; ok != tt.tooLarge {
+				t.Errorf("unexpected state, too large: %v", ok)
+			}
+
+			if tt.readErr {
+				if !errors.Is(err, ErrBodyTooLarge) {
+					t.Errorf("unexpected error: %v", err)
+				}
+
+				if len(b) > tt.limit {
+					t.Errorf("read more than the limit: %d", len(b))
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(b) != tt.body {
+				t.Errorf("unexpected body: %s", b)
+			}
+		})
+	}
+}
+
+func TestMaxRequestBodySizeBuffered(t *testing.T) {
+	bf, err := NewBufferRequestBody().CreateFilter([]interface{}{1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := NewMaxRequestBodySize().CreateFilter([]interface{}{12})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("POST", "https://www.example.org", io.NopCloser(bytes.NewBufferString("Hello, world!")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.ContentLength = -1
+	ctx := &filtertest.Context{FRequest: req, FStateBag: make(map[string]interface{})}
+	lf.Request(ctx)
+	bf.Request(ctx)
+
+	if !ctx.FServed || ctx.FResponse.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Error("failed to reject the oversized body")
+	}
+}
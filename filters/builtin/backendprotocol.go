@@ -0,0 +1,60 @@
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+)
+
+const (
+	// BackendProtocolHTTP1 is the default protocol of the backend
+	// requests, HTTP/1.1 over cleartext or TLS.
+	BackendProtocolHTTP1 = "http1"
+
+	// BackendProtocolH2 is HTTP/2 over TLS, negotiated with ALPN.
+	BackendProtocolH2 = "h2"
+
+	// BackendProtocolH2C is HTTP/2 over cleartext, with prior
+	// knowledge.
+	BackendProtocolH2C = "h2c"
+)
+
+type backendProtocol struct {
+	protocol string
+}
+
+// NewBackendProtocol creates a filter specification to instantiate
+// backendProtocol() filters. The filters set the protocol used for the
+// backend requests of the route: "http1", "h2" (HTTP/2 over TLS) or
+// "h2c" (HTTP/2 over cleartext).
+func NewBackendProtocol() filters.Spec {
+	return &backendProtocol{}
+}
+
+func (*backendProtocol) Name() string { return filters.BackendProtocolName }
+
+func (*backendProtocol) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) != 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	p, ok := args[0].(string)
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	switch p {
+	case BackendProtocolHTTP1, BackendProtocolH2, BackendProtocolH2C:
+		return &backendProtocol{protocol: p}, nil
+	default:
+		return nil, filters.ErrInvalidFilterParameters
+	}
+}
+
+// BackendProtocol returns the protocol set by the filter.
+func (p *backendProtocol) BackendProtocol() string { return p.protocol }
+
+func (p *backendProtocol) Request(ctx filters.FilterContext) {
+	// allows overwrite
+	ctx.StateBag()[filters.BackendProtocol] = p.protocol
+}
+
+func (*backendProtocol) Response(filters.FilterContext) {}
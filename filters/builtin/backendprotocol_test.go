@@ -0,0 +1,34 @@
+package builtin
+
+import (
+	"testing"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+)
+
+func TestBackendProtocol(t *testing.T) {
+	spec := NewBackendProtocol()
+	if spec.Name() != filters.BackendProtocolName {
+		t.Error("wrong name")
+	}
+
+	for _, args := range [][]interface{}{nil, {"h3"}, {2}, {"h2", "h2c"}} {
+		if _, err := spec.CreateFilter(args); err == nil {
+			t.Errorf("failed to fail: %v", args)
+		}
+	}
+
+	c := &filtertest.Context{FStateBag: make(map[string]interface{})}
+	for _, p := range []string{BackendProtocolH2C, BackendProtocolH2, BackendProtocolHTTP1} {
+		f, err := spec.CreateFilter([]interface{}{p})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f.Request(c)
+		if c.FStateBag[filters.BackendProtocol] != p {
+			t.Errorf("invalid protocol, expected: %s, got: %v", p, c.FStateBag[filters.BackendProtocol])
+		}
+	}
+}
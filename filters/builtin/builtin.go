@@ -7,19 +7,25 @@ import (
 	"github.com/zalando/skipper/filters"
 	"github.com/zalando/skipper/filters/accesslog"
 	"github.com/zalando/skipper/filters/auth"
+	"github.com/zalando/skipper/filters/buffer"
+	"github.com/zalando/skipper/filters/cache"
 	"github.com/zalando/skipper/filters/circuit"
+	"github.com/zalando/skipper/filters/connectionpool"
 	"github.com/zalando/skipper/filters/consistenthash"
 	"github.com/zalando/skipper/filters/cookie"
 	"github.com/zalando/skipper/filters/cors"
 	"github.com/zalando/skipper/filters/diag"
+	"github.com/zalando/skipper/filters/errorpage"
 	"github.com/zalando/skipper/filters/fadein"
 	"github.com/zalando/skipper/filters/flowid"
 	logfilter "github.com/zalando/skipper/filters/log"
+	"github.com/zalando/skipper/filters/retry"
 	"github.com/zalando/skipper/filters/rfc"
 	"github.com/zalando/skipper/filters/scheduler"
 	"github.com/zalando/skipper/filters/sed"
 	"github.com/zalando/skipper/filters/tee"
 	"github.com/zalando/skipper/filters/tracing"
+	"github.com/zalando/skipper/filters/websocket"
 	"github.com/zalando/skipper/filters/xforward"
 	"github.com/zalando/skipper/script"
 )
@@ -159,6 +165,10 @@ func MakeRegistry() filters.Registry {
 		NewHeaderToQuery(),
 		NewQueryToHeader(),
 		NewBackendTimeout(),
+		NewBackendProtocol(),
+		connectionpool.New(),
+		websocket.New(),
+		errorpage.New(),
 		NewSetDynamicBackendHostFromHeader(),
 		NewSetDynamicBackendSchemeFromHeader(),
 		NewSetDynamicBackendUrlFromHeader(),
@@ -185,6 +195,7 @@ func MakeRegistry() filters.Registry {
 		tee.NewTeeDeprecated(),
 		tee.NewTeeNoFollow(),
 		tee.NewTeeLoopback(),
+		tee.NewTeeDiff(),
 		sed.New(),
 		sed.NewDelimited(),
 		sed.NewRequest(),
@@ -196,6 +207,12 @@ func MakeRegistry() filters.Registry {
 		circuit.NewConsecutiveBreaker(),
 		circuit.NewRateBreaker(),
 		circuit.NewDisableBreaker(),
+		retry.NewRetry(),
+		retry.NewHedge(),
+		retry.NewFallback(),
+		buffer.NewBufferRequestBody(),
+		buffer.NewMaxRequestBodySize(),
+		cache.NewCache(),
 		script.NewLuaScript(),
 		cors.NewOrigin(),
 		logfilter.NewUnverifiedAuditLog(),
@@ -210,6 +227,8 @@ func MakeRegistry() filters.Registry {
 		auth.NewForwardTokenField(),
 		scheduler.NewLIFO(),
 		scheduler.NewLIFOGroup(),
+		scheduler.NewAdaptiveConcurrency(),
+		scheduler.NewCoalesce(),
 		rfc.NewPath(),
 		rfc.NewHost(),
 		fadein.NewFadeIn(),
@@ -0,0 +1,497 @@
+/*
+Package cache provides an in-memory HTTP response cache filter.
+
+The cached responses are stored in a size bounded LRU store, shared
+by all the routes using the filter. The caching follows the rules of
+a shared cache, as described in RFC 7234, including the revalidation
+of the stale responses with ETag and Last-Modified, and the
+stale-while-revalidate and stale-if-error extensions of RFC 5861.
+*/
+package cache
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+)
+
+const (
+	// DefaultMaxSize is the default size limit of the cache in bytes.
+	DefaultMaxSize = 64 << 20
+
+	// DefaultMaxEntrySize is the default size limit of a single
+	// cached response in bytes.
+	DefaultMaxEntrySize = 1 << 20
+
+	// StaleIfErrorKey is the key used in the state bag to pass the
+	// stale cached response to the proxy, that it can serve, when the
+	// backend request fails.
+	StaleIfErrorKey = "#cachestaleiferror"
+
+	stateKey      = "#cachestate"
+	revalidateKey = "#cacherevalidate"
+)
+
+// Options configures the cache shared by the filters.
+type Options struct {
+
+	// MaxSize is the size limit of the cache in bytes, including
+	// the response headers. Defaults to DefaultMaxSize.
+	MaxSize int64
+
+	// MaxEntrySize is the size limit of a single cached response.
+	// Larger responses are not stored. Defaults to
+	// DefaultMaxEntrySize.
+	MaxEntrySize int64
+}
+
+type spec struct {
+	options Options
+	store   *store
+	filters uint64
+}
+
+// filter caches the responses of a single route. The routes are
+// identified by their filter instance, because the routes with the same
+// host and path may differ in their other predicates or filters.
+type filter struct {
+	id      string
+	options Options
+	store   *store
+}
+
+// state is the request scoped state of the filter, shared between
+// the request and the response phase.
+type state struct {
+	base        string
+	resource    string
+	requestTime time.Time
+	control     control
+	entry       *entry
+	served      bool
+	conditional bool
+	background  bool
+}
+
+// StaleIfError provides the stale cached response of a request for the
+// proxy, when the backend request fails with an error, e.g. dial error,
+// timeout or open circuit breaker, and there is no backend response that
+// the response filters could replace.
+type StaleIfError struct {
+	state *state
+}
+
+// cacheable status codes, RFC 7231 section 6.1
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// NewCache creates a filter specification for the cache() filter,
+// using the default options.
+func NewCache() filters.Spec {
+	return NewCacheWithOptions(Options{})
+}
+
+// NewCacheWithOptions creates a filter specification for the cache()
+// filter.
+//
+// Example:
+//
+//	* -> cache() -> "https://www.example.org"
+//
+// The filter caches the responses of the GET requests, as allowed by
+// their Cache-Control, Expires and Vary headers, and serves the fresh
+// responses from the cache without contacting the backend. The stale
+// responses having an ETag or a Last-Modified header are revalidated
+// with a conditional request. The stale responses are served while
+// they are revalidated in the background, when the response allows it
+// with stale-while-revalidate, and when the backend responds with a
+// 5xx status, or the proxy fails to get a response from the backend,
+// when the response or the request allows it with stale-if-error.
+//
+// The responses are cached per route, the routes with the same host and
+// path don't share the cached responses. The cached responses of a route
+// are not used anymore, when the route changes. The requests with unsafe
+// methods, e.g. POST, invalidate the cached responses of the same URL of
+// all the routes.
+//
+// The filters created by the same specification share the same cache.
+func NewCacheWithOptions(o Options) filters.Spec {
+	if o.MaxSize <= 0 {
+		o.MaxSize = DefaultMaxSize
+	}
+
+	if o.MaxEntrySize <= 0 {
+		o.MaxEntrySize = DefaultMaxEntrySize
+	}
+
+	return &spec{options: o, store: newStore(o.MaxSize)}
+}
+
+func (*spec) Name() string { return filters.CacheName }
+
+func (s *spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) != 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	id := strconv.FormatUint(atomic.AddUint64(&s.filters, 1), 36)
+	return &filter{id: id, options: s.options, store: s.store}, nil
+}
+
+func resourceKey(r *http.Request) string {
+	return r.Host + r.URL.RequestURI()
+}
+
+func isUnsafe(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return false
+	default:
+		return true
+	}
+}
+
+func isConditional(r *http.Request) bool {
+	return r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != ""
+}
+
+// notModified checks if the conditional request of the client matches
+// the cached response, as described in RFC 7232 section 6.
+func notModified(r *http.Request, e *entry) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := strings.TrimPrefix(e.header.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+
+		for _, t := range strings.Split(inm, ",") {
+			t = strings.TrimSpace(t)
+			if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	lm, err := http.ParseTime(e.header.Get("Last-Modified"))
+	return err == nil && !lm.After(ims)
+}
+
+func (e *entry) response(r *http.Request, now time.Time) *http.Response {
+	h := e.header.Clone()
+	h.Set("Age", strconv.FormatInt(int64(e.age(now)/time.Second), 10))
+
+	if isConditional(r) && notModified(r, e) {
+		h.Del("Content-Length")
+		return &http.Response{
+			StatusCode: http.StatusNotModified,
+			Header:     h,
+			Body:       io.NopCloser(bytes.NewReader(nil)),
+		}
+	}
+
+	return &http.Response{
+		StatusCode:    e.statusCode,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+	}
+}
+
+// replaceResponse replaces the status, the headers and the body of the
+// backend response with the ones of a cached entry.
+func (e *entry) replaceResponse(rsp *http.Response, now time.Time) {
+	if rsp.Body != nil {
+		rsp.Body.Close()
+	}
+
+	c := e.response(&http.Request{Header: http.Header{}}, now)
+	rsp.StatusCode = c.StatusCode
+	rsp.Header = c.Header
+	rsp.Body = c.Body
+	rsp.ContentLength = c.ContentLength
+}
+
+func newEntry(base, resource string, statusCode int, h http.Header, body []byte, requestTime, responseTime time.Time) *entry {
+	e := &entry{
+		base:         base,
+		resource:     resource,
+		statusCode:   statusCode,
+		body:         body,
+		responseTime: responseTime,
+		initialAge:   initialAge(h, requestTime, responseTime),
+		control:      parseControl(h),
+	}
+
+	h.Del("Age")
+	e.header = h
+	e.lifetime = freshness(h, e.control)
+	return e
+}
+
+// refresh creates a new entry from a stored one, updated with the
+// headers of a 304 Not Modified response, RFC 7234 section 4.3.4.
+func (e *entry) refresh(rsp *http.Response, requestTime, responseTime time.Time) *entry {
+	h := e.header.Clone()
+	for k, v := range rsp.Header {
+		switch k {
+		case "Content-Length", "Content-Encoding", "Transfer-Encoding":
+		default:
+			h[k] = v
+		}
+	}
+
+	return newEntry(e.base, e.resource, e.statusCode, h, e.body, requestTime, responseTime)
+}
+
+func (e *entry) hasValidators() bool {
+	return e.header.Get("ETag") != "" || e.header.Get("Last-Modified") != ""
+}
+
+func (f *filter) serve(ctx filters.FilterContext, st *state, e *entry, now time.Time) {
+	st.served = true
+	ctx.Serve(e.response(ctx.Request(), now))
+}
+
+func (f *filter) revalidate(ctx filters.FilterContext, e *entry) {
+	if !f.store.startRevalidation(e) {
+		return
+	}
+
+	cc, err := ctx.Split()
+	if err != nil {
+		f.store.finishRevalidation(e)
+		return
+	}
+
+	cc.StateBag()[revalidateKey] = e
+	go cc.Loopback()
+}
+
+func (f *filter) Request(ctx filters.FilterContext) {
+	req := ctx.Request()
+	resource := resourceKey(req)
+	if isUnsafe(req.Method) {
+		f.store.invalidate(resource)
+		return
+	}
+
+	if req.Method != "GET" || req.Header.Get("Authorization") != "" {
+		return
+	}
+
+	rc := parseControl(req.Header)
+	if rc.noStore {
+		return
+	}
+
+	now := time.Now()
+	base := f.id + " " + resource
+	st := &state{base: base, resource: resource, requestTime: now, control: rc}
+	ctx.StateBag()[stateKey] = st
+
+	var e *entry
+	if re, ok := ctx.StateBag()[revalidateKey].(*entry); ok {
+		st.background = true
+		e = re
+	} else {
+		e = f.store.get(base, req.Header)
+		if e == nil {
+			ctx.Metrics().IncCounter("miss")
+			return
+		}
+
+		age := e.age(now)
+		if !rc.noCache && (!rc.hasMaxAge || age <= rc.maxAge) {
+			if age < e.lifetime {
+				ctx.Metrics().IncCounter("hit")
+				f.serve(ctx, st, e, now)
+				return
+			}
+
+			if !e.control.mustRevalidate && age-e.lifetime < e.control.staleWhileRevalidate {
+				ctx.Metrics().IncCounter("stale")
+				f.revalidate(ctx, e)
+				f.serve(ctx, st, e, now)
+				return
+			}
+		}
+
+		ctx.Metrics().IncCounter("miss")
+	}
+
+	st.entry = e
+	if !st.background {
+		ctx.StateBag()[StaleIfErrorKey] = &StaleIfError{state: st}
+	}
+
+	if !isConditional(req) && e.hasValidators() {
+		st.conditional = true
+		if etag := e.header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+
+		if lm := e.header.Get("Last-Modified"); lm != "" {
+			req.Header.Set("If-Modified-Since", lm)
+		}
+	}
+}
+
+func (f *filter) cacheable(rsp *http.Response) ([]string, bool) {
+	if !cacheableStatus[rsp.StatusCode] || rsp.Header.Get("Set-Cookie") != "" {
+		return nil, false
+	}
+
+	c := parseControl(rsp.Header)
+	if c.noStore || c.private {
+		return nil, false
+	}
+
+	vary, ok := varyHeaders(rsp.Header)
+	if !ok {
+		return nil, false
+	}
+
+	if rsp.ContentLength > f.options.MaxEntrySize {
+		return nil, false
+	}
+
+	// responses without freshness are only stored, when they can be
+	// revalidated, or served stale
+	if freshness(rsp.Header, c) == 0 &&
+		rsp.Header.Get("ETag") == "" && rsp.Header.Get("Last-Modified") == "" &&
+		c.staleWhileRevalidate == 0 && c.staleIfError == 0 {
+		return nil, false
+	}
+
+	return vary, true
+}
+
+func (f *filter) set(ctx filters.FilterContext, e *entry, vary []string, h http.Header) {
+	if n := f.store.set(e, vary, h); n > 0 {
+		ctx.Metrics().IncCounterBy("evictions", int64(n))
+	}
+}
+
+func (f *filter) Response(ctx filters.FilterContext) {
+	st, ok := ctx.StateBag()[stateKey].(*state)
+	if !ok || st.served {
+		return
+	}
+
+	if st.background {
+		defer f.store.finishRevalidation(st.entry)
+	}
+
+	req := ctx.Request()
+	rsp := ctx.Response()
+	now := time.Now()
+	switch {
+	case rsp.StatusCode == http.StatusNotModified && st.conditional:
+		e := st.entry.refresh(rsp, st.requestTime, now)
+		if vary, ok := varyHeaders(e.header); ok {
+			f.set(ctx, e, vary, req.Header)
+		}
+
+		ctx.Metrics().IncCounter("revalidated")
+		e.replaceResponse(rsp, now)
+		return
+	case rsp.StatusCode >= http.StatusInternalServerError && st.entry != nil:
+		if st.staleIfError(now) {
+			ctx.Metrics().IncCounter("staleiferror")
+			st.entry.replaceResponse(rsp, now)
+			return
+		}
+	}
+
+	vary, ok := f.cacheable(rsp)
+	if !ok {
+		return
+	}
+
+	statusCode, header := rsp.StatusCode, rsp.Header.Clone()
+	rsp.Body = &capture{
+		ReadCloser: rsp.Body,
+		maxSize:    f.options.MaxEntrySize,
+		done: func(body []byte) {
+			f.set(ctx, newEntry(st.base, st.resource, statusCode, header, body, st.requestTime, now), vary, req.Header)
+		},
+	}
+}
+
+// staleIfError checks if the stale entry can be served in case of an
+// error, as allowed by the response or the request.
+func (st *state) staleIfError(now time.Time) bool {
+	staleIfError := st.entry.control.staleIfError
+	if st.control.staleIfError > staleIfError {
+		staleIfError = st.control.staleIfError
+	}
+
+	return st.entry.age(now)-st.entry.lifetime < staleIfError
+}
+
+// Response returns the stale cached response, when stale-if-error allows
+// serving it, otherwise nil. When it returns a response, the cache
+// filter doesn't process it in the response phase.
+func (s *StaleIfError) Response(ctx filters.FilterContext) *http.Response {
+	now := time.Now()
+	if s.state.served || !s.state.staleIfError(now) {
+		return nil
+	}
+
+	ctx.Metrics().IncCounter("staleiferror")
+	s.state.served = true
+	return s.state.entry.response(&http.Request{Header: http.Header{}}, now)
+}
+
+// capture collects the response body while it is copied to the client,
+// and stores the response when the body was read completely.
+type capture struct {
+	io.ReadCloser
+	buf      bytes.Buffer
+	maxSize  int64
+	exceeded bool
+	done     func([]byte)
+}
+
+func (c *capture) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if !c.exceeded {
+		if int64(c.buf.Len()+n) > c.maxSize {
+			c.exceeded = true
+			c.buf = bytes.Buffer{}
+		} else {
+			c.buf.Write(p[:n])
+		}
+	}
+
+	if err == io.EOF && !c.exceeded && c.done != nil {
+		c.done(c.buf.Bytes())
+		c.done = nil
+	}
+
+	return n, err
+}
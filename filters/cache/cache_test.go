@@ -0,0 +1,573 @@
+package cache_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/filters/cache"
+	"github.com/zalando/skipper/filters/filtertest"
+	"github.com/zalando/skipper/metrics/metricstest"
+	"github.com/zalando/skipper/proxy/proxytest"
+)
+
+type testBackend struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []*http.Request
+	handler  http.HandlerFunc
+}
+
+func newTestBackend(h http.HandlerFunc) *testBackend {
+	b := &testBackend{handler: h}
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b.mu.Lock()
+		b.requests = append(b.requests, r)
+		h := b.handler
+		b.mu.Unlock()
+		h(w, r)
+	}))
+
+	return b
+}
+
+func (b *testBackend) count() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.requests)
+}
+
+func (b *testBackend) last() *http.Request {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.requests[len(b.requests)-1]
+}
+
+func (b *testBackend) setHandler(h http.HandlerFunc) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handler = h
+}
+
+func respond(cacheControl string, headers ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+
+		for i := 0; i+1 < len(headers); i += 2 {
+			w.Header().Set(headers[i], headers[i+1])
+		}
+
+		if etag := w.Header().Get("ETag"); etag != "" && r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Write([]byte("Hello, " + r.Header.Get("Accept-Language")))
+	}
+}
+
+// testRequest executes the filter, and in case the filter didn't serve
+// the request, forwards it to the backend, like the proxy.
+func testRequest(t *testing.T, f filters.Filter, m *metricstest.MockMetrics, method, u string, header ...string) (*http.Response, string) {
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+
+	ctx := &filtertest.Context{
+		FRequest:  req,
+		FStateBag: make(map[string]interface{}),
+		FMetrics:  m,
+	}
+
+	f.Request(ctx)
+	if !ctx.FServed {
+		rsp, err := http.DefaultTransport.RoundTrip(ctx.FRequest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx.FResponse = rsp
+	}
+
+	f.Response(ctx)
+	rsp := ctx.FResponse
+	defer rsp.Body.Close()
+	b, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rsp, string(b)
+}
+
+func createFilter(t *testing.T, o cache.Options) filters.Filter {
+	f, err := cache.NewCacheWithOptions(o).CreateFilter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+func checkCounters(t *testing.T, m *metricstest.MockMetrics, expected map[string]int64) {
+	m.WithCounters(func(c map[string]int64) {
+		for k, v := range expected {
+			if c[k] != v {
+				t.Errorf("invalid counter %s, expected: %d, got: %d", k, v, c[k])
+			}
+		}
+	})
+}
+
+func TestCreateCache(t *testing.T) {
+	if _, err := cache.NewCache().CreateFilter([]interface{}{"foo"}); err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestCacheability(t *testing.T) {
+	for _, test := range []struct {
+		title         string
+		cacheControl  string
+		headers       []string
+		requestHeader []string
+		method        string
+		cached        bool
+	}{{
+		title:        "max-age",
+		cacheControl: "max-age=60",
+		cached:       true,
+	}, {
+		title:        "s-maxage overrides max-age",
+		cacheControl: "max-age=60, s-maxage=0",
+	}, {
+		title:   "expires",
+		headers: []string{"Expires", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)},
+		cached:  true,
+	}, {
+		title:   "invalid expires",
+		headers: []string{"Expires", "0"},
+	}, {
+		title: "no explicit freshness",
+	}, {
+		title:        "no-store",
+		cacheControl: "max-age=60, no-store",
+	}, {
+		title:        "private",
+		cacheControl: "private, max-age=60",
+	}, {
+		title:        "vary on everything",
+		cacheControl: "max-age=60",
+		headers:      []string{"Vary", "*"},
+	}, {
+		title:        "set cookie",
+		cacheControl: "max-age=60",
+		headers:      []string{"Set-Cookie", "foo=bar"},
+	}, {
+		title:         "no-store request",
+		cacheControl:  "max-age=60",
+		requestHeader: []string{"Cache-Control", "no-store"},
+	}, {
+		title:         "authorized request",
+		cacheControl:  "max-age=60",
+		requestHeader: []string{"Authorization", "Bearer foo"},
+	}, {
+		title:        "HEAD request",
+		cacheControl: "max-age=60",
+		method:       "HEAD",
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			b := newTestBackend(respond(test.cacheControl, test.headers...))
+			defer b.Close()
+
+			method := test.method
+			if method == "" {
+				method = "GET"
+			}
+
+			f := createFilter(t, cache.Options{})
+			m := &metricstest.MockMetrics{}
+			for i := 0; i < 2; i++ {
+				testRequest(t, f, m, method, b.URL, test.requestHeader...)
+			}
+
+			if test.cached && b.count() != 1 || !test.cached && b.count() != 2 {
+				t.Errorf("unexpected backend requests: %d", b.count())
+			}
+		})
+	}
+}
+
+func TestCacheHit(t *testing.T) {
+	b := newTestBackend(respond("max-age=60", "Age", "10"))
+	defer b.Close()
+
+	f := createFilter(t, cache.Options{})
+	m := &metricstest.MockMetrics{}
+	testRequest(t, f, m, "GET", b.URL)
+	rsp, body := testRequest(t, f, m, "GET", b.URL)
+	if rsp.StatusCode != http.StatusOK || body != "Hello, " {
+		t.Errorf("invalid cached response: %d, %s", rsp.StatusCode, body)
+	}
+
+	if rsp.Header.Get("Age") != "10" {
+		t.Errorf("invalid age: %s", rsp.Header.Get("Age"))
+	}
+
+	if b.count() != 1 {
+		t.Errorf("unexpected backend requests: %d", b.count())
+	}
+
+	// the conditional requests of the clients are served from the cache
+	rsp, _ = testRequest(t, f, m, "GET", b.URL, "If-Modified-Since", time.Now().UTC().Format(http.TimeFormat))
+	if rsp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status without validators: %d", rsp.StatusCode)
+	}
+
+	// the request can require fresher response
+	testRequest(t, f, m, "GET", b.URL, "Cache-Control", "max-age=5")
+	if b.count() != 2 {
+		t.Errorf("unexpected backend requests: %d", b.count())
+	}
+
+	checkCounters(t, m, map[string]int64{"hit": 2, "miss": 2})
+}
+
+func TestCacheVary(t *testing.T) {
+	b := newTestBackend(respond("max-age=60", "Vary", "Accept-Language"))
+	defer b.Close()
+
+	f := createFilter(t, cache.Options{})
+	m := &metricstest.MockMetrics{}
+	for _, lang := range []string{"en", "de", "en", "de"} {
+		if _, body := testRequest(t, f, m, "GET", b.URL, "Accept-Language", lang); body != "Hello, "+lang {
+			t.Errorf("invalid variant: %s", body)
+		}
+	}
+
+	if b.count() != 2 {
+		t.Errorf("unexpected backend requests: %d", b.count())
+	}
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	lastModified := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	b := newTestBackend(respond("no-cache", "ETag", `"v1"`, "Last-Modified", lastModified))
+	defer b.Close()
+
+	f := createFilter(t, cache.Options{})
+	m := &metricstest.MockMetrics{}
+	testRequest(t, f, m, "GET", b.URL)
+	rsp, body := testRequest(t, f, m, "GET", b.URL)
+	if rsp.StatusCode != http.StatusOK || body != "Hello, " {
+		t.Errorf("invalid revalidated response: %d, %s", rsp.StatusCode, body)
+	}
+
+	if b.count() != 2 || b.last().Header.Get("If-None-Match") != `"v1"` || b.last().Header.Get("If-Modified-Since") != lastModified {
+		t.Errorf("failed to revalidate: %d, %v", b.count(), b.last().Header)
+	}
+
+	checkCounters(t, m, map[string]int64{"revalidated": 1, "miss": 2})
+
+	// the conditional requests of the clients are forwarded
+	rsp, _ = testRequest(t, f, m, "GET", b.URL, "If-None-Match", `"v1"`)
+	if rsp.StatusCode != http.StatusNotModified {
+		t.Errorf("unexpected status: %d", rsp.StatusCode)
+	}
+
+	// fresh responses with validators are served as not modified
+	b.setHandler(respond("max-age=60", "ETag", `"v2"`))
+	testRequest(t, f, m, "GET", b.URL)
+	rsp, _ = testRequest(t, f, m, "GET", b.URL, "If-None-Match", `"v0", W/"v2"`)
+	if rsp.StatusCode != http.StatusNotModified || b.count() != 4 {
+		t.Errorf("failed to serve not modified: %d, %d", rsp.StatusCode, b.count())
+	}
+}
+
+func TestCacheStaleIfError(t *testing.T) {
+	b := newTestBackend(respond("max-age=0, stale-if-error=60", "ETag", `"v1"`))
+	defer b.Close()
+
+	f := createFilter(t, cache.Options{})
+	m := &metricstest.MockMetrics{}
+	testRequest(t, f, m, "GET", b.URL)
+
+	b.setHandler(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	rsp, body := testRequest(t, f, m, "GET", b.URL)
+	if rsp.StatusCode != http.StatusOK || body != "Hello, " {
+		t.Errorf("failed to serve stale response: %d, %s", rsp.StatusCode, body)
+	}
+
+	checkCounters(t, m, map[string]int64{"staleiferror": 1})
+
+	// without stale-if-error, the error is returned
+	b.setHandler(respond("max-age=0", "ETag", `"v2"`))
+	testRequest(t, f, m, "GET", b.URL)
+	b.setHandler(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	if rsp, _ := testRequest(t, f, m, "GET", b.URL); rsp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status: %d", rsp.StatusCode)
+	}
+}
+
+func TestCacheStaleIfErrorProxy(t *testing.T) {
+	b := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stale-if-error" {
+			respond("max-age=0, stale-if-error=60", "ETag", `"v1"`)(w, r)
+			return
+		}
+
+		respond("max-age=0", "ETag", `"v1"`)(w, r)
+	})
+	defer b.Close()
+
+	r, err := eskip.Parse(fmt.Sprintf(`* -> cache() -> "%s"`, b.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := proxytest.New(builtin.MakeRegistry(), r...)
+	defer p.Close()
+
+	get := func(path string) (int, string) {
+		rsp, err := http.Get(p.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer rsp.Body.Close()
+		b, err := io.ReadAll(rsp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return rsp.StatusCode, string(b)
+	}
+
+	get("/stale-if-error")
+	get("/no-stale-if-error")
+
+	// the proxy fails to connect to the backend, and there is no
+	// backend response
+	b.Close()
+
+	if status, body := get("/stale-if-error"); status != http.StatusOK || body != "Hello, " {
+		t.Errorf("failed to serve stale response: %d, %s", status, body)
+	}
+
+	if status, _ := get("/no-stale-if-error"); status != http.StatusBadGateway {
+		t.Errorf("unexpected status: %d", status)
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	b := newTestBackend(respond("max-age=60"))
+	defer b.Close()
+
+	f := createFilter(t, cache.Options{})
+	m := &metricstest.MockMetrics{}
+	testRequest(t, f, m, "GET", b.URL+"/foo?bar=baz")
+	testRequest(t, f, m, "POST", b.URL+"/foo?bar=baz")
+	testRequest(t, f, m, "GET", b.URL+"/foo?bar=baz")
+	if b.count() != 3 {
+		t.Errorf("failed to invalidate: %d", b.count())
+	}
+}
+
+func TestCachePerRoute(t *testing.T) {
+	backend := func(name string) *testBackend {
+		return newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Write([]byte(name))
+		})
+	}
+
+	stable := backend("stable")
+	defer stable.Close()
+	beta := backend("beta")
+	defer beta.Close()
+
+	r, err := eskip.Parse(fmt.Sprintf(`
+		stable: * -> cache() -> "%s";
+		beta: Header("X-Beta", "true") -> cache() -> "%s";
+	`, stable.URL, beta.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := proxytest.New(builtin.MakeRegistry(), r...)
+	defer p.Close()
+
+	request := func(method string, header ...string) string {
+		req, err := http.NewRequest(method, p.URL+"/foo", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer rsp.Body.Close()
+		b, err := io.ReadAll(rsp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(b)
+	}
+
+	// the routes with the same host and path don't share the cached
+	// responses
+	for i := 0; i < 2; i++ {
+		if body := request("GET"); body != "stable" {
+			t.Errorf("unexpected response of the stable route: %s", body)
+		}
+
+		if body := request("GET", "X-Beta", "true"); body != "beta" {
+			t.Errorf("unexpected response of the beta route: %s", body)
+		}
+	}
+
+	if stable.count() != 1 || beta.count() != 1 {
+		t.Errorf("unexpected backend requests: %d, %d", stable.count(), beta.count())
+	}
+
+	// the unsafe requests invalidate the cached responses of all the
+	// routes
+	request("POST", "X-Beta", "true")
+	request("GET")
+	if stable.count() != 2 {
+		t.Errorf("failed to invalidate the responses of the other route: %d", stable.count())
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	b := newTestBackend(respond("max-age=60"))
+	defer b.Close()
+
+	f := createFilter(t, cache.Options{MaxSize: 1 << 10, MaxEntrySize: 1 << 10})
+	m := &metricstest.MockMetrics{}
+	for i := 0; i < 30; i++ {
+		testRequest(t, f, m, "GET", fmt.Sprintf("%s/%d", b.URL, i))
+	}
+
+	m.WithCounters(func(c map[string]int64) {
+		if c["evictions"] == 0 || c["miss"] != 30 {
+			t.Errorf("invalid counters: %v", c)
+		}
+	})
+
+	// the most recent one is still cached
+	testRequest(t, f, m, "GET", b.URL+"/29")
+	checkCounters(t, m, map[string]int64{"hit": 1})
+}
+
+func TestCacheMaxEntrySize(t *testing.T) {
+	b := newTestBackend(respond("max-age=60"))
+	defer b.Close()
+
+	f := createFilter(t, cache.Options{MaxEntrySize: 3})
+	m := &metricstest.MockMetrics{}
+	for i := 0; i < 2; i++ {
+		if _, body := testRequest(t, f, m, "GET", b.URL); body != "Hello, " {
+			t.Errorf("invalid body: %s", body)
+		}
+	}
+
+	if b.count() != 2 {
+		t.Errorf("unexpected backend requests: %d", b.count())
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		version int
+	)
+
+	b := newTestBackend(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		version++
+		v := version
+		mu.Unlock()
+
+		w.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+		fmt.Fprintf(w, "v%d", v)
+	})
+	defer b.Close()
+
+	r, err := eskip.Parse(fmt.Sprintf(`* -> cache() -> "%s"`, b.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := proxytest.New(builtin.MakeRegistry(), r...)
+	defer p.Close()
+
+	get := func() string {
+		rsp, err := http.Get(p.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer rsp.Body.Close()
+		b, err := io.ReadAll(rsp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(b)
+	}
+
+	if v := get(); v != "v1" {
+		t.Fatalf("unexpected response: %s", v)
+	}
+
+	// the stale response is served, while it is revalidated
+	if v := get(); v != "v1" {
+		t.Fatalf("unexpected response: %s", v)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for b.count() != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if b.count() != 2 {
+		t.Fatalf("failed to revalidate in the background: %d", b.count())
+	}
+
+	deadline = time.Now().Add(time.Second)
+	for get() != "v2" {
+		if time.Now().After(deadline) {
+			t.Fatal("failed to store the revalidated response")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// control contains the Cache-Control directives relevant for a shared
+// cache, see RFC 7234 section 5.2 and RFC 5861.
+type control struct {
+	noStore              bool
+	noCache              bool
+	private              bool
+	mustRevalidate       bool
+	maxAge               time.Duration
+	hasMaxAge            bool
+	sMaxAge              time.Duration
+	hasSMaxAge           bool
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+}
+
+func parseSeconds(v string) (time.Duration, bool) {
+	s, err := strconv.ParseInt(strings.Trim(v, `"`), 10, 64)
+	if err != nil || s < 0 {
+		return 0, false
+	}
+
+	return time.Duration(s) * time.Second, true
+}
+
+func parseControl(h http.Header) control {
+	var c control
+	for _, hv := range h.Values("Cache-Control") {
+		for _, d := range strings.Split(hv, ",") {
+			d = strings.TrimSpace(d)
+			name, value := d, ""
+			if i := strings.Index(d, "="); i >= 0 {
+				name, value = d[:i], d[i+1:]
+			}
+
+			switch strings.ToLower(name) {
+			case "no-store":
+				c.noStore = true
+			case "no-cache":
+				c.noCache = true
+			case "private":
+				c.private = true
+			case "must-revalidate", "proxy-revalidate":
+				c.mustRevalidate = true
+			case "max-age":
+				c.maxAge, c.hasMaxAge = parseSeconds(value)
+			case "s-maxage":
+				c.sMaxAge, c.hasSMaxAge = parseSeconds(value)
+			case "stale-while-revalidate":
+				c.staleWhileRevalidate, _ = parseSeconds(value)
+			case "stale-if-error":
+				c.staleIfError, _ = parseSeconds(value)
+			}
+		}
+	}
+
+	// HTTP/1.0 caches, RFC 7234 section 5.4
+	if len(h.Values("Cache-Control")) == 0 {
+		for _, p := range h.Values("Pragma") {
+			if strings.Contains(strings.ToLower(p), "no-cache") {
+				c.noCache = true
+			}
+		}
+	}
+
+	return c
+}
+
+// freshness returns the freshness lifetime of a response, as described
+// in RFC 7234 section 4.2.1. Responses without explicit expiration
+// have zero lifetime, and they are only served after revalidation.
+func freshness(h http.Header, c control) time.Duration {
+	switch {
+	case c.noCache:
+		return 0
+	case c.hasSMaxAge:
+		return c.sMaxAge
+	case c.hasMaxAge:
+		return c.maxAge
+	}
+
+	expires := h.Get("Expires")
+	if expires == "" {
+		return 0
+	}
+
+	// invalid dates, e.g. "0", mean already expired
+	e, err := http.ParseTime(expires)
+	if err != nil {
+		return 0
+	}
+
+	date, err := http.ParseTime(h.Get("Date"))
+	if err != nil {
+		return 0
+	}
+
+	if d := e.Sub(date); d > 0 {
+		return d
+	}
+
+	return 0
+}
+
+// initialAge calculates the corrected initial age of a response, as
+// described in RFC 7234 section 4.2.3.
+func initialAge(h http.Header, requestTime, responseTime time.Time) time.Duration {
+	var apparentAge time.Duration
+	if date, err := http.ParseTime(h.Get("Date")); err == nil {
+		apparentAge = responseTime.Sub(date)
+		if apparentAge < 0 {
+			apparentAge = 0
+		}
+	}
+
+	ageValue, _ := parseSeconds(h.Get("Age"))
+	correctedAgeValue := ageValue + responseTime.Sub(requestTime)
+	if apparentAge > correctedAgeValue {
+		return apparentAge
+	}
+
+	return correctedAgeValue
+}
+
+// varyHeaders returns the canonical names of the request headers
+// listed in the Vary header, and false when the response varies on
+// everything.
+func varyHeaders(h http.Header) ([]string, bool) {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, n := range strings.Split(v, ",") {
+			n = strings.TrimSpace(n)
+			switch n {
+			case "":
+			case "*":
+				return nil, false
+			default:
+				names = append(names, http.CanonicalHeaderKey(n))
+			}
+		}
+	}
+
+	sort.Strings(names)
+	return names, true
+}
@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	key        string
+	base       string
+	resource   string
+	statusCode int
+	header     http.Header
+	body       []byte
+
+	// the time when the response was received, and its age at that
+	// time, calculated as in RFC 7234 section 4.2.3
+	responseTime time.Time
+	initialAge   time.Duration
+
+	control  control
+	lifetime time.Duration
+
+	revalidating bool
+}
+
+// variants stores the request headers selecting the variants of a
+// resource, as listed in the Vary header of its last stored response,
+// and the keys of the stored variants.
+type variants struct {
+	headers []string
+	keys    map[string]bool
+}
+
+// store is a size bounded LRU cache of the responses. It is safe for
+// concurrent use. The resources index the bases of the stored responses
+// with the same URL, cached by different routes.
+type store struct {
+	mu        sync.Mutex
+	maxSize   int64
+	size      int64
+	lru       *list.List
+	entries   map[string]*list.Element
+	variants  map[string]*variants
+	resources map[string]map[string]bool
+}
+
+func newStore(maxSize int64) *store {
+	return &store{
+		maxSize:   maxSize,
+		lru:       list.New(),
+		entries:   make(map[string]*list.Element),
+		variants:  make(map[string]*variants),
+		resources: make(map[string]map[string]bool),
+	}
+}
+
+func (e *entry) size() int64 {
+	n := len(e.key) + len(e.body)
+	for k, v := range e.header {
+		n += len(k)
+		for _, vi := range v {
+			n += len(vi)
+		}
+	}
+
+	return int64(n)
+}
+
+func (e *entry) age(now time.Time) time.Duration {
+	age := now.Sub(e.responseTime)
+	if age < 0 {
+		age = 0
+	}
+
+	return e.initialAge + age
+}
+
+func varyKey(base string, headers []string, h http.Header) string {
+	if len(headers) == 0 {
+		return base
+	}
+
+	var b strings.Builder
+	b.WriteString(base)
+	for _, k := range headers {
+		b.WriteString("\n")
+		b.WriteString(k)
+		b.WriteString(":")
+		b.WriteString(strings.Join(h.Values(k), ","))
+	}
+
+	return b.String()
+}
+
+// get returns the stored response variant matching the request
+// headers.
+func (s *store) get(base string, h http.Header) *entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.variants[base]
+	if !ok {
+		return nil
+	}
+
+	el, ok := s.entries[varyKey(base, v.headers, h)]
+	if !ok {
+		return nil
+	}
+
+	s.lru.MoveToFront(el)
+	return el.Value.(*entry)
+}
+
+// startRevalidation marks an entry as being revalidated, and returns
+// false when it was already marked.
+func (s *store) startRevalidation(e *entry) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e.revalidating {
+		return false
+	}
+
+	e.revalidating = true
+	return true
+}
+
+func (s *store) finishRevalidation(e *entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.revalidating = false
+}
+
+func (s *store) removeElement(el *list.Element) {
+	e := el.Value.(*entry)
+	s.lru.Remove(el)
+	delete(s.entries, e.key)
+	s.size -= e.size()
+
+	v := s.variants[e.base]
+	delete(v.keys, e.key)
+	if len(v.keys) == 0 {
+		delete(s.variants, e.base)
+		delete(s.resources[e.resource], e.base)
+		if len(s.resources[e.resource]) == 0 {
+			delete(s.resources, e.resource)
+		}
+	}
+}
+
+func (s *store) removeBase(base string) {
+	for key := range s.variants[base].keys {
+		s.removeElement(s.entries[key])
+	}
+}
+
+// set stores an entry, and returns the number of entries evicted to
+// make room for it. Entries larger than the max size of the store are
+// not stored.
+func (s *store) set(e *entry, vary []string, h http.Header) (evicted int) {
+	e.key = varyKey(e.base, vary, h)
+	size := e.size()
+	if size > s.maxSize {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// when the varying headers of a resource change, the previous
+	// variants cannot be selected anymore
+	if v, ok := s.variants[e.base]; ok && !equalHeaders(v.headers, vary) {
+		s.removeBase(e.base)
+	}
+
+	if el, ok := s.entries[e.key]; ok {
+		s.removeElement(el)
+	}
+
+	for s.size+size > s.maxSize && s.lru.Len() > 0 {
+		s.removeElement(s.lru.Back())
+		evicted++
+	}
+
+	v, ok := s.variants[e.base]
+	if !ok {
+		v = &variants{headers: vary, keys: make(map[string]bool)}
+		s.variants[e.base] = v
+		if s.resources[e.resource] == nil {
+			s.resources[e.resource] = make(map[string]bool)
+		}
+
+		s.resources[e.resource][e.base] = true
+	}
+
+	s.entries[e.key] = s.lru.PushFront(e)
+	v.keys[e.key] = true
+	s.size += size
+	return
+}
+
+// invalidate removes all the stored variants of a resource, cached by
+// any of the routes.
+func (s *store) invalidate(resource string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for base := range s.resources[resource] {
+		s.removeBase(base)
+	}
+}
+
+func equalHeaders(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func testEntry(base string, body string) *entry {
+	return newEntry(base, base, http.StatusOK, http.Header{}, []byte(body), time.Now(), time.Now())
+}
+
+func TestStoreVariants(t *testing.T) {
+	s := newStore(1 << 10)
+	vary := []string{"Accept-Language"}
+	s.set(testEntry("/foo", "en"), vary, http.Header{"Accept-Language": []string{"en"}})
+	s.set(testEntry("/foo", "de"), vary, http.Header{"Accept-Language": []string{"de"}})
+
+	for _, lang := range []string{"en", "de"} {
+		e := s.get("/foo", http.Header{"Accept-Language": []string{lang}})
+		if e == nil || string(e.body) != lang {
+			t.Errorf("failed to get the variant: %s", lang)
+		}
+	}
+
+	if e := s.get("/foo", http.Header{"Accept-Language": []string{"fr"}}); e != nil {
+		t.Error("unexpected variant")
+	}
+
+	// changing the varying headers drops the previous variants
+	s.set(testEntry("/foo", "gzip"), []string{"Accept-Encoding"}, http.Header{"Accept-Encoding": []string{"gzip"}})
+	if e := s.get("/foo", http.Header{"Accept-Language": []string{"en"}}); e != nil {
+		t.Error("unexpected variant")
+	}
+
+	if s.lru.Len() != 1 || len(s.entries) != 1 {
+		t.Errorf("unexpected entries: %d", s.lru.Len())
+	}
+
+	s.invalidate("/foo")
+	if s.lru.Len() != 0 || len(s.entries) != 0 || len(s.variants) != 0 || s.size != 0 {
+		t.Error("failed to invalidate the variants")
+	}
+}
+
+func TestStoreEviction(t *testing.T) {
+	e := testEntry("/0", "0123456789")
+	e.key = e.base
+	s := newStore(3 * e.size())
+	for _, base := range []string{"/0", "/1", "/2"} {
+		if n := s.set(testEntry(base, "0123456789"), nil, nil); n != 0 {
+			t.Fatalf("unexpected eviction: %d", n)
+		}
+	}
+
+	// the least recently used is /1
+	s.get("/0", nil)
+	if n := s.set(testEntry("/3", "0123456789"), nil, nil); n != 1 {
+		t.Fatalf("expected one eviction, got: %d", n)
+	}
+
+	if s.get("/1", nil) != nil {
+		t.Error("failed to evict the least recently used entry")
+	}
+
+	for _, base := range []string{"/0", "/2", "/3"} {
+		if s.get(base, nil) == nil {
+			t.Errorf("unexpected eviction: %s", base)
+		}
+	}
+
+	// too large for the store
+	if n := s.set(testEntry("/4", string(make([]byte, 4*e.size()))), nil, nil); n != 0 || s.get("/4", nil) != nil {
+		t.Error("unexpected entry stored")
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Package connectionpool provides the backendConnectionPool filter, that
+configures a dedicated connection pool for the backend requests of a
+route, instead of the one shared by all the routes:
+
+	backendConnectionPool(16, 8, "30s", "5s")
+
+The arguments are the maximum number of the connections per backend
+host, the maximum number of the idle connections per backend host, the
+idle connection timeout, and the response header timeout. The proxy
+shares the pools between the routes with identical settings. The
+settings apply to the HTTP/1.1 backends, the HTTP/2 requests are
+multiplexed on a single connection per host.
+*/
+package connectionpool
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+)
+
+// Config contains the settings of a connection pool. The zero values
+// mean the defaults of the proxy.
+type Config struct {
+
+	// Key identifies the pool settings, the routes with the same key
+	// share the connection pool.
+	Key string
+
+	// MaxConnsPerHost limits the number of the connections per
+	// backend host, including the ones in use. When reached, the
+	// requests wait for a free connection. 0 means no limit.
+	MaxConnsPerHost int
+
+	// MaxIdleConnsPerHost limits the number of the idle connections
+	// kept per backend host.
+	MaxIdleConnsPerHost int
+
+	// IdleConnTimeout is the time after which an idle connection is
+	// closed.
+	IdleConnTimeout time.Duration
+
+	// ResponseHeaderTimeout limits the time waiting for the response
+	// headers of the backend.
+	ResponseHeaderTimeout time.Duration
+}
+
+type spec struct{}
+
+type filter struct {
+	config *Config
+}
+
+// New creates a filter specification to instantiate
+// backendConnectionPool() filters.
+func New() filters.Spec { return spec{} }
+
+func (spec) Name() string { return filters.BackendConnectionPoolName }
+
+func intArg(a interface{}) (int, error) {
+	switch v := a.(type) {
+	case int:
+		return v, nil
+	case float64:
+		return int(v), nil
+	default:
+		return 0, filters.ErrInvalidFilterParameters
+	}
+}
+
+func durationArg(a interface{}) (time.Duration, error) {
+	if s, ok := a.(string); ok {
+		return time.ParseDuration(s)
+	}
+
+	i, err := intArg(a)
+	return time.Duration(i) * time.Millisecond, err
+}
+
+// CreateFilter creates a backendConnectionPool filter. It accepts one to
+// four arguments: the maximum number of the connections per host (int),
+// the maximum number of the idle connections per host (int), the idle
+// connection timeout and the response header timeout (duration string
+// or milliseconds). Zero values keep the defaults of the proxy.
+func (spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) == 0 || len(args) > 4 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	var (
+		c   Config
+		err error
+	)
+
+	if c.MaxConnsPerHost, err = intArg(args[0]); err != nil {
+		return nil, err
+	}
+
+	if len(args) > 1 {
+		if c.MaxIdleConnsPerHost, err = intArg(args[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(args) > 2 {
+		if c.IdleConnTimeout, err = durationArg(args[2]); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(args) > 3 {
+		if c.ResponseHeaderTimeout, err = durationArg(args[3]); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.MaxConnsPerHost < 0 || c.MaxIdleConnsPerHost < 0 || c.IdleConnTimeout < 0 || c.ResponseHeaderTimeout < 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	c.Key = fmt.Sprintf("%d/%d/%v/%v", c.MaxConnsPerHost, c.MaxIdleConnsPerHost, c.IdleConnTimeout, c.ResponseHeaderTimeout)
+	return &filter{config: &c}, nil
+}
+
+// ConnectionPoolConfig returns the pool settings of the filter. The
+// proxy uses it to find the connection pools referenced by the routes.
+func (f *filter) ConnectionPoolConfig() *Config { return f.config }
+
+func (f *filter) Request(ctx filters.FilterContext) {
+	ctx.StateBag()[filters.BackendConnectionPool] = f.config
+}
+
+func (*filter) Response(filters.FilterContext) {}
@@ -0,0 +1,77 @@
+package connectionpool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+)
+
+func TestCreateFilter(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		args     []interface{}
+		expected Config
+		fail     bool
+	}{{
+		name: "no args",
+		fail: true,
+	}, {
+		name: "too many args",
+		args: []interface{}{1, 2, "1s", "1s", 5},
+		fail: true,
+	}, {
+		name: "invalid max conns",
+		args: []interface{}{"1"},
+		fail: true,
+	}, {
+		name: "negative max idle",
+		args: []interface{}{1, -1},
+		fail: true,
+	}, {
+		name: "invalid duration",
+		args: []interface{}{1, 2, "foo"},
+		fail: true,
+	}, {
+		name:     "max conns only",
+		args:     []interface{}{16.0},
+		expected: Config{Key: "16/0/0s/0s", MaxConnsPerHost: 16},
+	}, {
+		name: "all args",
+		args: []interface{}{16, 8, "30s", 500},
+		expected: Config{
+			Key:                   "16/8/30s/500ms",
+			MaxConnsPerHost:       16,
+			MaxIdleConnsPerHost:   8,
+			IdleConnTimeout:       30 * time.Second,
+			ResponseHeaderTimeout: 500 * time.Millisecond,
+		},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := New().CreateFilter(tt.args)
+			if tt.fail {
+				if err == nil {
+					t.Fatal("failed to fail")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := &filtertest.Context{FStateBag: make(map[string]interface{})}
+			f.Request(ctx)
+			c, ok := ctx.FStateBag[filters.BackendConnectionPool].(*Config)
+			if !ok {
+				t.Fatal("connection pool not set")
+			}
+
+			if *c != tt.expected {
+				t.Errorf("unexpected config, expected: %+v, got: %+v", tt.expected, *c)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Package errorpage provides the errorPage filter, that replaces the body
+of the error responses with a custom page:
+
+	errorPage("5xx", "maintenance")
+
+The first argument is the status pattern, a status code, where the digits
+can be replaced by x, e.g. 503, 50x or 5xx. The second argument is either
+the name of a page in the template directory, or an inline HTML template.
+
+The page is rendered as HTML or as JSON, depending on the Accept header
+of the request. Without a JSON template, the JSON format is a Problem
+Details document, as defined in RFC 7807. The filter applies also to the
+errors of the proxy on the same route, e.g. when the circuit breaker is
+open or the backend is not available.
+
+The templates receive the Data of the response.
+*/
+package errorpage
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/zalando/skipper/filters"
+)
+
+// PagesKey is the key in the state bag, where the errorPage filters
+// executed for the request are stored, so that the proxy can use them for
+// its own errors.
+const PagesKey = "#errorpages"
+
+var errInvalidStatusPattern = errors.New("invalid status pattern")
+
+// StatusPattern matches status codes. The digits can be replaced by x,
+// e.g. 503, 50x or 5xx.
+type StatusPattern string
+
+// Options contains the settings of the errorPage filters.
+type Options struct {
+
+	// Templates contain the pages that can be referenced by name.
+	Templates *Templates
+}
+
+type spec struct {
+	options Options
+}
+
+type filter struct {
+	pattern StatusPattern
+	page    *Page
+}
+
+// ParseStatusPattern validates a status pattern. Only the client and
+// server error statuses can be matched.
+func ParseStatusPattern(s string) (StatusPattern, error) {
+	if len(s) != 3 || (s[0] != '4' && s[0] != '5') {
+		return "", errInvalidStatusPattern
+	}
+
+	for i := 1; i < len(s); i++ {
+		if (s[i] < '0' || s[i] > '9') && s[i] != 'x' && s[i] != 'X' {
+			return "", errInvalidStatusPattern
+		}
+	}
+
+	return StatusPattern(s), nil
+}
+
+// Match checks whether the status code matches the pattern.
+func (p StatusPattern) Match(status int) bool {
+	s := strconv.Itoa(status)
+	if len(s) != len(p) {
+		return false
+	}
+
+	for i := range s {
+		if p[i] != 'x' && p[i] != 'X' && p[i] != s[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// New creates a filter specification for the errorPage() filter, that
+// accepts only inline templates.
+func New() filters.Spec {
+	return NewWithOptions(Options{})
+}
+
+// NewWithOptions creates a filter specification for the errorPage()
+// filter.
+func NewWithOptions(o Options) filters.Spec {
+	return &spec{options: o}
+}
+
+func (*spec) Name() string { return filters.ErrorPageName }
+
+func (s *spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) != 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	ps, ok := args[0].(string)
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	t, ok := args[1].(string)
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	pattern, err := ParseStatusPattern(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	page := s.options.Templates.Get(t)
+	if page == nil {
+		if page, err = NewPage(t); err != nil {
+			return nil, err
+		}
+	}
+
+	return &filter{pattern: pattern, page: page}, nil
+}
+
+// Request stores the filter in the state bag. The page is rendered by the
+// proxy, when the status of the final response matches, including the
+// errors of the proxy.
+func (f *filter) Request(ctx filters.FilterContext) {
+	pages, _ := ctx.StateBag()[PagesKey].([]*filter)
+	ctx.StateBag()[PagesKey] = append(pages, f)
+}
+
+func (*filter) Response(filters.FilterContext) {}
+
+// ForStatus returns the page of the last errorPage filter executed for
+// the request, that matches the status code, or nil. When multiple
+// filters match, the last one applies.
+func ForStatus(stateBag map[string]interface{}, status int) *Page {
+	pages, _ := stateBag[PagesKey].([]*filter)
+	for i := len(pages) - 1; i >= 0; i-- {
+		if pages[i].pattern.Match(status) {
+			return pages[i].page
+		}
+	}
+
+	return nil
+}
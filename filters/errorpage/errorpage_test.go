@@ -0,0 +1,224 @@
+package errorpage
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zalando/skipper/filters/filtertest"
+)
+
+func TestStatusPattern(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		invalid bool
+		match   []int
+		noMatch []int
+	}{
+		{pattern: "", invalid: true},
+		{pattern: "200", invalid: true},
+		{pattern: "5xxx", invalid: true},
+		{pattern: "5y0", invalid: true},
+		{pattern: "503", match: []int{503}, noMatch: []int{502, 404}},
+		{pattern: "50x", match: []int{500, 503}, noMatch: []int{404, 510}},
+		{pattern: "5XX", match: []int{500, 599}, noMatch: []int{404, 200}},
+		{pattern: "4xx", match: []int{404, 429}, noMatch: []int{500, 4040}},
+	} {
+		t.Run(tt.pattern, func(t *testing.T) {
+			p, err := ParseStatusPattern(tt.pattern)
+			if tt.invalid {
+				if err == nil {
+					t.Fatal("failed to fail")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, s := range tt.match {
+				if !p.Match(s) {
+					t.Errorf("failed to match %d", s)
+				}
+			}
+
+			for _, s := range tt.noMatch {
+				if p.Match(s) {
+					t.Errorf("unexpected match %d", s)
+				}
+			}
+		})
+	}
+}
+
+func TestAcceptsJSON(t *testing.T) {
+	for _, tt := range []struct {
+		accept   string
+		expected bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"text/html", false},
+		{"application/json", true},
+		{"application/problem+json", true},
+		{"application/json, */*", true},
+		{"text/html, application/json", false},
+		{"text/html;q=0.5, application/json", true},
+		{"text/html, application/json;q=0.9", false},
+		{"application/json;q=0", false},
+		{"text/*, application/json", true},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", false},
+	} {
+		t.Run(tt.accept, func(t *testing.T) {
+			if v := acceptsJSON(tt.accept); v != tt.expected {
+				t.Errorf("unexpected result, expected: %v, got: %v", tt.expected, v)
+			}
+		})
+	}
+}
+
+func writeTemplates(t *testing.T, files map[string]string) *Templates {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	templates, err := LoadTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return templates
+}
+
+func TestTemplates(t *testing.T) {
+	templates := writeTemplates(t, map[string]string{
+		"503.html":         "unavailable {{.RouteID}}",
+		"5xx.html":         "server error {{.Status}}",
+		"5xx.json":         `{"error": {{json .Title}}}`,
+		"default.html":     "error {{.Status}} {{.FlowID}}",
+		"maintenance.html": "maintenance",
+		"ignored.txt":      "ignored",
+	})
+
+	if templates.Get("ignored") != nil {
+		t.Error("unexpected template loaded")
+	}
+
+	r := httptest.NewRequest("GET", "/foo", nil)
+	r.Header.Set("X-Flow-Id", "flow42")
+	for _, tt := range []struct {
+		status      int
+		accept      string
+		contentType string
+		body        string
+	}{
+		{503, "", htmlContentType, "unavailable route1"},
+		{502, "", htmlContentType, "server error 502"},
+		{502, "application/json", jsonContentType, `{"error": "Bad Gateway"}`},
+		{404, "", htmlContentType, "error 404 flow42"},
+		{404, "application/json", jsonContentType, `{"type":"about:blank","title":"Not Found","status":404,"instance":"/foo","flowId":"flow42","routeId":"route1"}`},
+	} {
+		r.Header.Set("Accept", tt.accept)
+		p := templates.ForStatus(tt.status)
+		if p == nil {
+			t.Fatalf("page not found for %d", tt.status)
+		}
+
+		contentType, body, err := p.Render(r, NewData(r, "route1", tt.status))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if contentType != tt.contentType || string(body) != tt.body {
+			t.Errorf("unexpected page for %d, %s: %s, %s", tt.status, tt.accept, contentType, body)
+		}
+	}
+
+	if p := writeTemplates(t, nil).ForStatus(500); p != nil {
+		t.Error("unexpected page")
+	}
+
+	if _, err := LoadTemplates(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("failed to fail for missing directory")
+	}
+}
+
+func TestCreateFilter(t *testing.T) {
+	templates := writeTemplates(t, map[string]string{"maintenance.html": "maintenance"})
+	spec := NewWithOptions(Options{Templates: templates})
+
+	for _, args := range [][]interface{}{
+		nil,
+		{"5xx"},
+		{"5xx", "foo", "bar"},
+		{500, "foo"},
+		{"5xx", 42},
+		{"3xx", "foo"},
+		{"5xx", "{{.Invalid"},
+	} {
+		if _, err := spec.CreateFilter(args); err == nil {
+			t.Errorf("failed to fail: %v", args)
+		}
+	}
+
+	named, err := spec.CreateFilter([]interface{}{"5xx", "maintenance"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inline, err := spec.CreateFilter([]interface{}{"503", "<p>{{.Title}}</p>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &filtertest.Context{FStateBag: make(map[string]interface{})}
+	named.Request(ctx)
+	inline.Request(ctx)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	for status, expected := range map[int]string{
+		http.StatusBadGateway:         "maintenance",
+		http.StatusServiceUnavailable: "<p>Service Unavailable</p>",
+	} {
+		p := ForStatus(ctx.StateBag(), status)
+		if p == nil {
+			t.Fatalf("page not found for %d", status)
+		}
+
+		_, body, err := p.Render(r, NewData(r, "", status))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(body) != expected {
+			t.Errorf("unexpected page for %d: %s", status, body)
+		}
+	}
+
+	if p := ForStatus(ctx.StateBag(), http.StatusNotFound); p != nil {
+		t.Error("unexpected page for 404")
+	}
+
+	r.Header.Set("Accept", "application/problem+json")
+	_, body, err := ForStatus(ctx.StateBag(), http.StatusServiceUnavailable).Render(r, NewData(r, "", http.StatusServiceUnavailable))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc["status"] != float64(http.StatusServiceUnavailable) || doc["title"] != "Service Unavailable" {
+		t.Errorf("unexpected problem document: %s", body)
+	}
+}
@@ -0,0 +1,271 @@
+package errorpage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/zalando/skipper/filters/flowid"
+)
+
+const (
+	htmlContentType = "text/html; charset=utf-8"
+	jsonContentType = "application/problem+json"
+
+	// DefaultTemplate is the name of the template used for all the
+	// statuses without a more specific template.
+	DefaultTemplate = "default"
+)
+
+// Data is passed to the error page templates.
+type Data struct {
+
+	// Status is the HTTP status code of the response.
+	Status int
+
+	// Title is the text of the status code.
+	Title string
+
+	// FlowID is the value of the X-Flow-Id request header, when set.
+	FlowID string
+
+	// RouteID is the id of the matched route, empty when no route was
+	// found.
+	RouteID string
+
+	// Instance is the path of the request.
+	Instance string
+}
+
+// problem is the default JSON document of the error pages, as defined
+// in RFC 7807.
+type problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Instance string `json:"instance,omitempty"`
+	FlowID   string `json:"flowId,omitempty"`
+	RouteID  string `json:"routeId,omitempty"`
+}
+
+// Page is an error page, rendered either as HTML or as JSON. The JSON
+// format is rendered from a template, when available, otherwise it is
+// a Problem Details document (RFC 7807).
+type Page struct {
+	html *htmltemplate.Template
+	json *texttemplate.Template
+}
+
+// Templates contains the error pages loaded from a directory.
+type Templates struct {
+	pages map[string]*Page
+}
+
+var templateFuncs = map[string]interface{}{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// LoadTemplates loads the error pages from a directory. The HTML
+// templates need the .html extension, and the JSON templates need the
+// .json extension. The name of a page is the file name without the
+// extension, and the HTML and the JSON template with the same name
+// belong to the same page. Pages named by a status code, e.g. 503, or
+// by a status class, e.g. 5xx, are used by the proxy for its own
+// errors, and the page named 'default' for the rest.
+func LoadTemplates(dir string) (*Templates, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Templates{pages: make(map[string]*Page)}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+
+		ext := filepath.Ext(f.Name())
+		if ext != ".html" && ext != ".json" {
+			continue
+		}
+
+		name := strings.TrimSuffix(f.Name(), ext)
+		b, err := os.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		p := t.pages[name]
+		if p == nil {
+			p = &Page{}
+			t.pages[name] = p
+		}
+
+		if ext == ".html" {
+			p.html, err = htmltemplate.New(f.Name()).Funcs(templateFuncs).Parse(string(b))
+		} else {
+			p.json, err = texttemplate.New(f.Name()).Funcs(templateFuncs).Parse(string(b))
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("error page template %s: %w", f.Name(), err)
+		}
+	}
+
+	return t, nil
+}
+
+// Get returns the page by name, or nil, if it does not exist.
+func (t *Templates) Get(name string) *Page {
+	if t == nil {
+		return nil
+	}
+
+	return t.pages[name]
+}
+
+// ForStatus returns the page for a status code, looking for the status
+// code, the status class, and the default page, in this order. It
+// returns nil when none of them exists.
+func (t *Templates) ForStatus(status int) *Page {
+	if t == nil {
+		return nil
+	}
+
+	for _, name := range []string{
+		strconv.Itoa(status),
+		fmt.Sprintf("%dxx", status/100),
+		DefaultTemplate,
+	} {
+		if p, ok := t.pages[name]; ok {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// NewPage creates a page from an inline HTML template.
+func NewPage(html string) (*Page, error) {
+	t, err := htmltemplate.New("inline").Funcs(templateFuncs).Parse(html)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Page{html: t}, nil
+}
+
+// NewData creates the template data for a request.
+func NewData(r *http.Request, routeID string, status int) Data {
+	return Data{
+		Status:   status,
+		Title:    http.StatusText(status),
+		FlowID:   r.Header.Get(flowid.HeaderName),
+		RouteID:  routeID,
+		Instance: r.URL.Path,
+	}
+}
+
+// Render renders the page in the format accepted by the request, and
+// returns the content type and the body.
+func (p *Page) Render(r *http.Request, d Data) (string, []byte, error) {
+	var buf bytes.Buffer
+	if p.html != nil && !acceptsJSON(r.Header.Get("Accept")) {
+		if err := p.html.Execute(&buf, d); err != nil {
+			return "", nil, err
+		}
+
+		return htmlContentType, buf.Bytes(), nil
+	}
+
+	if p.json != nil {
+		if err := p.json.Execute(&buf, d); err != nil {
+			return "", nil, err
+		}
+
+		return jsonContentType, buf.Bytes(), nil
+	}
+
+	b, err := json.Marshal(problem{
+		Type:     "about:blank",
+		Title:    d.Title,
+		Status:   d.Status,
+		Instance: d.Instance,
+		FlowID:   d.FlowID,
+		RouteID:  d.RouteID,
+	})
+
+	return jsonContentType, b, err
+}
+
+// mediaRangeQuality returns the quality of the most specific media
+// range in the Accept header matching one of the types, and the
+// specificity of the match: 2 for an exact match, 1 for a subtype
+// wildcard and 0 for */*. It returns -1 specificity when none of them
+// matches.
+func mediaRangeQuality(accept string, types ...string) (q float64, specificity int) {
+	specificity = -1
+	for _, r := range strings.Split(accept, ",") {
+		params := strings.Split(r, ";")
+		mediaRange := strings.ToLower(strings.TrimSpace(params[0]))
+
+		rq := 1.0
+		for _, p := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(kv) == 2 && strings.TrimSpace(kv[0]) == "q" {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64); err == nil {
+					rq = v
+				}
+			}
+		}
+
+		for _, t := range types {
+			s := -1
+			switch {
+			case mediaRange == t:
+				s = 2
+			case mediaRange == t[:strings.Index(t, "/")]+"/*":
+				s = 1
+			case mediaRange == "*/*":
+				s = 0
+			}
+
+			if s > specificity {
+				q, specificity = rq, s
+			}
+		}
+	}
+
+	return
+}
+
+// acceptsJSON returns true when the Accept header prefers JSON over
+// HTML. Without a preference, the response is HTML.
+func acceptsJSON(accept string) bool {
+	if accept == "" {
+		return false
+	}
+
+	jq, js := mediaRangeQuality(accept, "application/json", "application/problem+json")
+	hq, hs := mediaRangeQuality(accept, "text/html", "application/xhtml+xml")
+	switch {
+	case js < 0 || jq == 0:
+		return false
+	case hs < 0 || hq == 0:
+		return true
+	case jq != hq:
+		return jq > hq
+	default:
+		return js > hs
+	}
+}
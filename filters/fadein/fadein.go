@@ -200,6 +200,32 @@ func NewPostProcessor() routing.PostProcessor {
 	}
 }
 
+// keepDetected keeps the detection time of the endpoints of a reused
+// route, without modifying the route.
+func (p *postProcessor) keepDetected(ri *routing.Route, now time.Time) {
+	if ri.LBFadeInDuration <= 0 {
+		return
+	}
+
+	for i := range ri.LBEndpoints {
+		ep := &ri.LBEndpoints[i]
+		s, h, err := normalizeSchemeHost(ep.Scheme, ep.Host)
+		if err != nil {
+			continue
+		}
+
+		key := endpointKey(s, h)
+		d, ok := p.detected[key]
+		if !ok {
+			d.when = ep.Detected
+		}
+
+		d.duration = ri.LBFadeInDuration
+		d.lastActive = now
+		p.detected[key] = d
+	}
+}
+
 func (p *postProcessor) Do(r []*routing.Route) []*routing.Route {
 	const configErrFmt = "Error while processing endpoint fade-in settings: %s, %s, %v."
 	now := time.Now()
@@ -209,6 +235,13 @@ func (p *postProcessor) Do(r []*routing.Route) []*routing.Route {
 			continue
 		}
 
+		// the reused routes are already in use, and they keep their
+		// settings, only the detection of their endpoints is kept alive
+		if ri.Reused {
+			p.keepDetected(ri, now)
+			continue
+		}
+
 		ri.LBFadeInDuration = 0
 		ri.LBFadeInExponent = 1
 		endpointsCreated := make(map[string]time.Time)
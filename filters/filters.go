@@ -27,6 +27,18 @@ const (
 
 	// BackendRatelimit is the key used in the state bag to configure backend ratelimit in proxy
 	BackendRatelimit = "backend:ratelimit"
+
+	// BackendProtocol is the key used in the state bag to configure the protocol of the backend requests in proxy
+	BackendProtocol = "backend:protocol"
+
+	// BackendTLS is the key used in the state bag to configure the TLS client settings of the backend requests in proxy
+	BackendTLS = "backend:tls"
+
+	// BackendConnectionPool is the key used in the state bag to configure the connection pool of the backend requests in proxy
+	BackendConnectionPool = "backend:connectionpool"
+
+	// WebSocket is the key used in the state bag to configure the WebSocket frame handling of the upgraded connections in proxy
+	WebSocket = "backend:websocket"
 )
 
 // Context object providing state and information that is unique to a request.
@@ -213,6 +225,7 @@ const (
 	RandomContentName                          = "randomContent"
 	RepeatContentName                          = "repeatContent"
 	BackendTimeoutName                         = "backendTimeout"
+	BackendProtocolName                        = "backendProtocol"
 	LatencyName                                = "latency"
 	BandwidthName                              = "bandwidth"
 	ChunksName                                 = "chunks"
@@ -298,6 +311,19 @@ const (
 	EndpointCreatedName                        = "endpointCreated"
 	ConsistentHashKeyName                      = "consistentHashKey"
 	ConsistentHashBalanceFactorName            = "consistentHashBalanceFactor"
+	RetryName                                  = "retry"
+	BufferRequestBodyName                      = "bufferRequestBody"
+	HedgeName                                  = "hedge"
+	CacheName                                  = "cache"
+	CoalesceName                               = "coalesce"
+	BackendTLSName                             = "backendTLS"
+	FallbackName                               = "fallback"
+	TeeDiffName                                = "teeDiff"
+	MaxRequestBodySizeName                     = "maxRequestBodySize"
+	BackendConnectionPoolName                  = "backendConnectionPool"
+	WebSocketName                              = "webSocket"
+	ErrorPageName                              = "errorPage"
+	AdaptiveConcurrencyName                    = "adaptiveConcurrency"
 
 	// Undocumented filters
 	HealthCheckName        = "healthcheck"
@@ -0,0 +1,134 @@
+package retry
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/zalando/skipper/filters"
+)
+
+// FallbackKey is the key used in the state bag to pass the fallback
+// settings to the proxy.
+const FallbackKey = "#fallback"
+
+// Fallback contains the settings of the fallback of a route, used when
+// the primary backend fails.
+type Fallback struct {
+
+	// RouteID, when set, is the id of the route that handles the
+	// request instead of the failed backend.
+	RouteID string
+
+	// URL, when set, is the backend that receives the request
+	// instead of the failed backend.
+	URL *url.URL
+
+	// OnStatus contains the backend response status codes that
+	// trigger the fallback, besides the backend errors.
+	OnStatus []int
+}
+
+type fallbackSpec struct{}
+
+type fallbackFilter struct {
+	fallback *Fallback
+}
+
+// Target returns the id of the fallback route, or the fallback URL.
+func (f *Fallback) Target() string {
+	if f.URL != nil {
+		return f.URL.String()
+	}
+
+	return f.RouteID
+}
+
+// FallbackStatus returns true if the response status code of the
+// primary backend triggers the fallback.
+func (f *Fallback) FallbackStatus(code int) bool {
+	for _, s := range f.OnStatus {
+		if s == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewFallback creates a filter specification to instantiate fallback()
+// filters.
+//
+// The filters set a fallback for the current route, used when the
+// backend cannot be connected, it times out, the circuit breaker of
+// the backend is open, or it responds with one of the configured
+// status codes:
+//
+//	fallback("backupRoute", 502, 503)
+//	fallback("https://backup.example.org", "5xx")
+//
+// The first argument is either the id of a route, or the URL of a
+// network backend. The rest of the arguments are the status codes
+// (int), or the comma separated lists of the status codes, where 5xx
+// means all 5xx codes (string).
+//
+// When the request has a body, the fallback is used after a failed
+// backend request only when the body can be sent again, e.g. when it
+// was buffered by the bufferRequestBody filter.
+func NewFallback() filters.Spec { return &fallbackSpec{} }
+
+func (*fallbackSpec) Name() string { return filters.FallbackName }
+
+func parseFallbackTarget(a interface{}) (*Fallback, error) {
+	s, ok := a.(string)
+	if !ok || s == "" {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" {
+		return &Fallback{RouteID: s}, nil
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid fallback URL: %s", s)
+	}
+
+	return &Fallback{URL: u}, nil
+}
+
+func (*fallbackSpec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) == 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f, err := parseFallbackTarget(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range args[1:] {
+		if c, err := intArg(a); err == nil {
+			if c < 100 || c > 599 {
+				return nil, fmt.Errorf("invalid status code: %d", c)
+			}
+
+			f.OnStatus = append(f.OnStatus, c)
+			continue
+		}
+
+		codes, err := parseStatus(a)
+		if err != nil {
+			return nil, err
+		}
+
+		f.OnStatus = append(f.OnStatus, codes...)
+	}
+
+	return &fallbackFilter{fallback: f}, nil
+}
+
+func (f *fallbackFilter) Request(ctx filters.FilterContext) {
+	ctx.StateBag()[FallbackKey] = f.fallback
+}
+
+func (*fallbackFilter) Response(filters.FilterContext) {}
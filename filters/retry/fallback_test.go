@@ -0,0 +1,91 @@
+package retry
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/zalando/skipper/filters/filtertest"
+)
+
+func TestCreateFallback(t *testing.T) {
+	for _, test := range []struct {
+		title    string
+		args     []interface{}
+		expected *Fallback
+		fail     bool
+	}{{
+		title: "no args",
+		fail:  true,
+	}, {
+		title: "empty target",
+		args:  []interface{}{""},
+		fail:  true,
+	}, {
+		title: "invalid target",
+		args:  []interface{}{42},
+		fail:  true,
+	}, {
+		title: "unsupported scheme",
+		args:  []interface{}{"ftp://backup.example.org"},
+		fail:  true,
+	}, {
+		title:    "route id",
+		args:     []interface{}{"backup"},
+		expected: &Fallback{RouteID: "backup"},
+	}, {
+		title:    "URL",
+		args:     []interface{}{"https://backup.example.org"},
+		expected: &Fallback{URL: &url.URL{Scheme: "https", Host: "backup.example.org"}},
+	}, {
+		title:    "status codes",
+		args:     []interface{}{"backup", 502.0, "503, 504"},
+		expected: &Fallback{RouteID: "backup", OnStatus: []int{502, 503, 504}},
+	}, {
+		title: "invalid status code",
+		args:  []interface{}{"backup", 42},
+		fail:  true,
+	}, {
+		title: "invalid status class",
+		args:  []interface{}{"backup", "6xx"},
+		fail:  true,
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			f, err := NewFallback().CreateFilter(test.args)
+			if test.fail {
+				if err == nil {
+					t.Fatal("failed to fail")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fb := f.(*fallbackFilter).fallback
+			if !reflect.DeepEqual(fb, test.expected) {
+				t.Errorf("invalid fallback, expected: %+v, got: %+v", test.expected, fb)
+			}
+		})
+	}
+}
+
+func TestFallbackRequest(t *testing.T) {
+	f, err := NewFallback().CreateFilter([]interface{}{"backup", "5xx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &filtertest.Context{FStateBag: make(map[string]interface{})}
+	f.Request(ctx)
+	fb, ok := ctx.FStateBag[FallbackKey].(*Fallback)
+	if !ok {
+		t.Fatal("fallback not set")
+	}
+
+	if fb.Target() != "backup" || !fb.FallbackStatus(503) || fb.FallbackStatus(404) {
+		t.Errorf("invalid fallback: %+v", fb)
+	}
+}
@@ -0,0 +1,78 @@
+package retry
+
+import (
+	"time"
+
+	"github.com/zalando/skipper/filters"
+)
+
+// HedgePolicyKey is the key used in the state bag to pass the hedging
+// policy to the proxy.
+const HedgePolicyKey = "#hedgepolicy"
+
+// HedgePolicy contains the settings of the hedged backend requests of
+// a route.
+type HedgePolicy struct {
+
+	// Delay is the time to wait for the response headers of a
+	// backend request before sending the next, parallel request.
+	Delay time.Duration
+
+	// MaxHedges is the maximum number of the additional requests.
+	MaxHedges int
+}
+
+type hedgeSpec struct{}
+
+type hedgeFilter struct {
+	policy *HedgePolicy
+}
+
+// NewHedge creates a filter specification to instantiate hedge()
+// filters.
+//
+// The filters enable hedged backend requests for the current route:
+//
+//	hedge("50ms", 2)
+//
+// When the backend doesn't respond with the headers within the delay
+// (milliseconds or duration string), the proxy sends the request to
+// another endpoint of the load balanced route, and uses the response
+// that arrives first. At most the maximum number of hedges (int,
+// optional, default 1) are sent. Only the requests with idempotent
+// methods, and without a body or with a buffered body, are hedged.
+func NewHedge() filters.Spec { return &hedgeSpec{} }
+
+func (*hedgeSpec) Name() string { return filters.HedgeName }
+
+func (*hedgeSpec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	p := &HedgePolicy{MaxHedges: 1}
+
+	var err error
+	if p.Delay, err = durationArg(args[0]); err != nil {
+		return nil, err
+	}
+
+	if len(args) > 1 {
+		if p.MaxHedges, err = intArg(args[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.Delay <= 0 || p.MaxHedges < 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return &hedgeFilter{policy: p}, nil
+}
+
+// Request stores the hedging policy in the state bag.
+func (f *hedgeFilter) Request(ctx filters.FilterContext) {
+	ctx.StateBag()[HedgePolicyKey] = f.policy
+}
+
+func (*hedgeFilter) Response(filters.FilterContext) {}
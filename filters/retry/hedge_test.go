@@ -0,0 +1,66 @@
+package retry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/filters/filtertest"
+)
+
+func TestCreateHedge(t *testing.T) {
+	for _, test := range []struct {
+		title    string
+		args     []interface{}
+		expected HedgePolicy
+		fail     bool
+	}{{
+		title: "no args",
+		fail:  true,
+	}, {
+		title: "too many args",
+		args:  []interface{}{"10ms", 2, 3},
+		fail:  true,
+	}, {
+		title: "invalid delay",
+		args:  []interface{}{"foo"},
+		fail:  true,
+	}, {
+		title: "zero delay",
+		args:  []interface{}{0},
+		fail:  true,
+	}, {
+		title:    "delay only",
+		args:     []interface{}{"10ms"},
+		expected: HedgePolicy{Delay: 10 * time.Millisecond, MaxHedges: 1},
+	}, {
+		title:    "delay in milliseconds",
+		args:     []interface{}{15.0, 3},
+		expected: HedgePolicy{Delay: 15 * time.Millisecond, MaxHedges: 3},
+	}, {
+		title: "invalid max hedges",
+		args:  []interface{}{"10ms", 0},
+		fail:  true,
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			f, err := NewHedge().CreateFilter(test.args)
+			if test.fail {
+				if err == nil {
+					t.Fatal("failed to fail")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := &filtertest.Context{FStateBag: make(map[string]interface{})}
+			f.Request(ctx)
+			p, ok := ctx.FStateBag[HedgePolicyKey].(*HedgePolicy)
+			if !ok || *p != test.expected {
+				t.Errorf("invalid policy, expected: %+v, got: %+v", test.expected, p)
+			}
+		})
+	}
+}
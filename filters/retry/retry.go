@@ -0,0 +1,275 @@
+/*
+Package retry provides a filter to configure the retry policy of the
+backend requests on the route level.
+
+The filter itself only stores the policy in the state bag of the
+request, the retries are executed by the proxy.
+*/
+package retry
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+)
+
+const (
+	// PolicyKey is the key used in the state bag to pass the retry
+	// policy to the proxy.
+	PolicyKey = "#retrypolicy"
+
+	defaultBackoff    = 25 * time.Millisecond
+	defaultMaxBackoff = 250 * time.Millisecond
+)
+
+// ErrorClass represents the groups of backend errors that can be
+// retried.
+type ErrorClass int
+
+const (
+	// ConnectError indicates that the TCP or TLS connection to the
+	// backend could not be established.
+	ConnectError ErrorClass = 1 << iota
+
+	// ResetError indicates that the connection was broken after the
+	// request was sent, e.g. connection reset or unexpected EOF.
+	ResetError
+
+	// TimeoutError indicates that the per-try timeout of an attempt
+	// was reached.
+	TimeoutError
+)
+
+// Policy contains the retry settings of a route.
+type Policy struct {
+
+	// MaxAttempts is the maximum number of backend requests,
+	// including the first one.
+	MaxAttempts int
+
+	// OnStatus contains the backend response status codes that
+	// are retried.
+	OnStatus []int
+
+	// OnErrors contains the error classes that are retried.
+	OnErrors ErrorClass
+
+	// PerTryTimeout, when set, limits the duration of the
+	// individual attempts the same way as the backendTimeout
+	// filter limits the whole backend request.
+	PerTryTimeout time.Duration
+
+	// Backoff is the base of the exponential backoff between
+	// the attempts.
+	Backoff time.Duration
+
+	// MaxBackoff caps the exponential backoff.
+	MaxBackoff time.Duration
+}
+
+type spec struct{}
+
+type filter struct {
+	policy *Policy
+}
+
+// RetriesStatus returns true if the policy allows retrying a response
+// with the given status code.
+func (p *Policy) RetriesStatus(code int) bool {
+	for _, s := range p.OnStatus {
+		if s == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RetriesError returns true if the policy allows retrying the given
+// error class.
+func (p *Policy) RetriesError(c ErrorClass) bool {
+	return p.OnErrors&c != 0
+}
+
+// BackoffFor returns the upper limit of the backoff before the attempt
+// with the given 1 based index. The actual wait is expected to be a
+// random (jittered) value between 0 and this limit.
+func (p *Policy) BackoffFor(attempt int) time.Duration {
+	if attempt <= 1 || p.Backoff <= 0 {
+		return 0
+	}
+
+	b := p.Backoff
+	for i := 2; i < attempt && b < p.MaxBackoff; i++ {
+		b *= 2
+	}
+
+	if p.MaxBackoff > 0 && b > p.MaxBackoff {
+		b = p.MaxBackoff
+	}
+
+	return b
+}
+
+// NewRetry creates a filter specification to instantiate retry() filters.
+//
+// The filters set the retry policy of the backend requests for the
+// current route:
+//
+//	retry(3, "502,503", "connect,reset", "500ms", "25ms", "250ms")
+//
+// The arguments are: the maximum number of attempts including the first
+// request (int), the comma separated list of the retried status codes,
+// where 5xx means all 5xx codes (string), the comma separated list of the
+// retried error classes: connect, reset and timeout (string), the per-try
+// timeout, the backoff base and the maximum backoff (milliseconds or
+// duration string). Only the first argument is mandatory. By default,
+// only connect errors are retried, and no per-try timeout is applied.
+func NewRetry() filters.Spec { return &spec{} }
+
+func (*spec) Name() string { return filters.RetryName }
+
+func intArg(a interface{}) (int, error) {
+	switch v := a.(type) {
+	case int:
+		return v, nil
+	case float64:
+		return int(v), nil
+	default:
+		return 0, filters.ErrInvalidFilterParameters
+	}
+}
+
+func durationArg(a interface{}) (time.Duration, error) {
+	if s, ok := a.(string); ok {
+		return time.ParseDuration(s)
+	}
+
+	i, err := intArg(a)
+	return time.Duration(i) * time.Millisecond, err
+}
+
+func parseStatus(a interface{}) ([]int, error) {
+	s, ok := a.(string)
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	var codes []int
+	for _, si := range strings.Split(s, ",") {
+		si = strings.TrimSpace(si)
+		switch {
+		case si == "":
+		case len(si) == 3 && strings.HasSuffix(si, "xx"):
+			class, err := strconv.Atoi(si[:1])
+			if err != nil || class < 1 || class > 5 {
+				return nil, fmt.Errorf("invalid status class: %s", si)
+			}
+
+			for c := class * 100; c < (class+1)*100; c++ {
+				codes = append(codes, c)
+			}
+		default:
+			c, err := strconv.Atoi(si)
+			if err != nil || c < 100 || c > 599 {
+				return nil, fmt.Errorf("invalid status code: %s", si)
+			}
+
+			codes = append(codes, c)
+		}
+	}
+
+	return codes, nil
+}
+
+func parseErrorClasses(a interface{}) (ErrorClass, error) {
+	s, ok := a.(string)
+	if !ok {
+		return 0, filters.ErrInvalidFilterParameters
+	}
+
+	var c ErrorClass
+	for _, si := range strings.Split(s, ",") {
+		switch strings.TrimSpace(si) {
+		case "":
+		case "connect":
+			c |= ConnectError
+		case "reset":
+			c |= ResetError
+		case "timeout":
+			c |= TimeoutError
+		default:
+			return 0, fmt.Errorf("invalid error class: %s", si)
+		}
+	}
+
+	return c, nil
+}
+
+func (*spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) == 0 || len(args) > 6 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	p := &Policy{
+		OnErrors:   ConnectError,
+		Backoff:    defaultBackoff,
+		MaxBackoff: defaultMaxBackoff,
+	}
+
+	var err error
+	if p.MaxAttempts, err = intArg(args[0]); err != nil {
+		return nil, err
+	}
+
+	if p.MaxAttempts < 1 {
+		return nil, fmt.Errorf("invalid number of attempts: %d", p.MaxAttempts)
+	}
+
+	if len(args) > 1 {
+		if p.OnStatus, err = parseStatus(args[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(args) > 2 {
+		if p.OnErrors, err = parseErrorClasses(args[2]); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(args) > 3 {
+		if p.PerTryTimeout, err = durationArg(args[3]); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(args) > 4 {
+		if p.Backoff, err = durationArg(args[4]); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(args) > 5 {
+		if p.MaxBackoff, err = durationArg(args[5]); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.PerTryTimeout < 0 || p.Backoff < 0 || p.MaxBackoff < 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return &filter{policy: p}, nil
+}
+
+// Request stores the retry policy in the state bag. The last retry
+// filter of the route wins.
+func (f *filter) Request(ctx filters.FilterContext) {
+	ctx.StateBag()[PolicyKey] = f.policy
+}
+
+func (*filter) Response(filters.FilterContext) {}
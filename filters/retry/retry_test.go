@@ -0,0 +1,171 @@
+package retry
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+)
+
+func TestCreateFilter(t *testing.T) {
+	for _, test := range []struct {
+		title    string
+		args     []interface{}
+		expected *Policy
+		fail     bool
+	}{{
+		title: "no args",
+		fail:  true,
+	}, {
+		title: "too many args",
+		args:  []interface{}{3, "503", "connect", "1s", "1ms", "2ms", "foo"},
+		fail:  true,
+	}, {
+		title: "invalid attempts",
+		args:  []interface{}{0},
+		fail:  true,
+	}, {
+		title: "attempts as string",
+		args:  []interface{}{"3"},
+		fail:  true,
+	}, {
+		title: "only attempts",
+		args:  []interface{}{3.0},
+		expected: &Policy{
+			MaxAttempts: 3,
+			OnErrors:    ConnectError,
+			Backoff:     defaultBackoff,
+			MaxBackoff:  defaultMaxBackoff,
+		},
+	}, {
+		title: "status codes",
+		args:  []interface{}{2, "502, 503"},
+		expected: &Policy{
+			MaxAttempts: 2,
+			OnStatus:    []int{502, 503},
+			OnErrors:    ConnectError,
+			Backoff:     defaultBackoff,
+			MaxBackoff:  defaultMaxBackoff,
+		},
+	}, {
+		title: "invalid status code",
+		args:  []interface{}{2, "502,foo"},
+		fail:  true,
+	}, {
+		title: "invalid status class",
+		args:  []interface{}{2, "6xx"},
+		fail:  true,
+	}, {
+		title: "error classes",
+		args:  []interface{}{2, "", "reset,timeout"},
+		expected: &Policy{
+			MaxAttempts: 2,
+			OnErrors:    ResetError | TimeoutError,
+			Backoff:     defaultBackoff,
+			MaxBackoff:  defaultMaxBackoff,
+		},
+	}, {
+		title: "no error classes",
+		args:  []interface{}{2, "503", ""},
+		expected: &Policy{
+			MaxAttempts: 2,
+			OnStatus:    []int{503},
+			Backoff:     defaultBackoff,
+			MaxBackoff:  defaultMaxBackoff,
+		},
+	}, {
+		title: "invalid error class",
+		args:  []interface{}{2, "", "connect,foo"},
+		fail:  true,
+	}, {
+		title: "all args",
+		args:  []interface{}{4, "503", "connect", "500ms", 10, "1s"},
+		expected: &Policy{
+			MaxAttempts:   4,
+			OnStatus:      []int{503},
+			OnErrors:      ConnectError,
+			PerTryTimeout: 500 * time.Millisecond,
+			Backoff:       10 * time.Millisecond,
+			MaxBackoff:    time.Second,
+		},
+	}, {
+		title: "invalid duration",
+		args:  []interface{}{4, "503", "connect", "foo"},
+		fail:  true,
+	}, {
+		title: "negative duration",
+		args:  []interface{}{4, "503", "connect", "1s", "-1ms"},
+		fail:  true,
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			f, err := NewRetry().CreateFilter(test.args)
+			if test.fail {
+				if err == nil {
+					t.Fatal("failed to fail")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p := f.(*filter).policy
+			if !reflect.DeepEqual(p, test.expected) {
+				t.Errorf("invalid policy, expected: %+v, got: %+v", test.expected, p)
+			}
+		})
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	f, err := NewRetry().CreateFilter([]interface{}{2, "5xx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := f.(*filter).policy
+	if !p.RetriesStatus(500) || !p.RetriesStatus(599) || p.RetriesStatus(499) || p.RetriesStatus(404) {
+		t.Errorf("invalid status class: %v", p.OnStatus)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := &Policy{Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	for attempt, expected := range []time.Duration{
+		0,
+		0,
+		10 * time.Millisecond,
+		20 * time.Millisecond,
+		40 * time.Millisecond,
+		50 * time.Millisecond,
+		50 * time.Millisecond,
+	} {
+		if b := p.BackoffFor(attempt); b != expected {
+			t.Errorf("invalid backoff for attempt %d, expected: %v, got: %v", attempt, expected, b)
+		}
+	}
+}
+
+func TestStoresPolicy(t *testing.T) {
+	spec := NewRetry()
+	if spec.Name() != filters.RetryName {
+		t.Fatal("invalid name")
+	}
+
+	f, err := spec.CreateFilter([]interface{}{3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &filtertest.Context{FStateBag: make(map[string]interface{})}
+	f.Request(ctx)
+
+	p, ok := ctx.FStateBag[PolicyKey].(*Policy)
+	if !ok || p.MaxAttempts != 3 {
+		t.Errorf("failed to store the policy: %v", ctx.FStateBag[PolicyKey])
+	}
+}
@@ -0,0 +1,127 @@
+package scheduler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/scheduler"
+)
+
+// key used to pass the start of the requests from the request to the
+// response filter
+const adaptiveConcurrencyKey = "adaptiveconcurrency"
+
+type (
+	adaptiveConcurrencySpec struct{}
+
+	adaptiveConcurrencyFilter struct {
+		config  scheduler.AdaptiveConfig
+		limiter *scheduler.AdaptiveLimiter
+	}
+)
+
+// NewAdaptiveConcurrency creates a filter specification for the
+// adaptiveConcurrency() filter, that adjusts the concurrency limit of
+// the lifo or lifoGroup queue of the route, based on the round trip
+// times of the backend requests.
+func NewAdaptiveConcurrency() filters.Spec {
+	return &adaptiveConcurrencySpec{}
+}
+
+func (*adaptiveConcurrencySpec) Name() string { return filters.AdaptiveConcurrencyName }
+
+// CreateFilter creates an adaptiveConcurrency filter. The first
+// parameter is the minimum, the second the maximum concurrency, and the
+// optional third is the algorithm, "gradient" (default) or "vegas".
+//
+// The filter needs a lifo or a lifoGroup filter on the same route, and
+// it should be placed after it, so that the measured round trip times
+// don't contain the time spent in the queue. The initial limit is the
+// MaxConcurrency of the queue, bounded by the minimum and the maximum.
+func (*adaptiveConcurrencySpec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	min, err := intArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	max, err := intArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if min < 1 || max < min {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	c := scheduler.AdaptiveConfig{
+		MinConcurrency: min,
+		MaxConcurrency: max,
+		Algorithm:      scheduler.Gradient,
+	}
+
+	if len(args) > 2 {
+		a, ok := args[2].(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		switch scheduler.AdaptiveAlgorithm(a) {
+		case scheduler.Gradient, scheduler.Vegas:
+			c.Algorithm = scheduler.AdaptiveAlgorithm(a)
+		default:
+			return nil, filters.ErrInvalidFilterParameters
+		}
+	}
+
+	return &adaptiveConcurrencyFilter{config: c}, nil
+}
+
+// AdaptiveConfig returns the settings of the limiter.
+func (f *adaptiveConcurrencyFilter) AdaptiveConfig() scheduler.AdaptiveConfig {
+	return f.config
+}
+
+// SetLimiter binds the limiter of the queue to the filter.
+func (f *adaptiveConcurrencyFilter) SetLimiter(l *scheduler.AdaptiveLimiter) {
+	f.limiter = l
+}
+
+// GetLimiter is only used in tests.
+func (f *adaptiveConcurrencyFilter) GetLimiter() *scheduler.AdaptiveLimiter {
+	return f.limiter
+}
+
+// Request records the start of the request.
+func (f *adaptiveConcurrencyFilter) Request(ctx filters.FilterContext) {
+	pending, _ := ctx.StateBag()[adaptiveConcurrencyKey].([]time.Time)
+	ctx.StateBag()[adaptiveConcurrencyKey] = append(pending, time.Now())
+}
+
+// Response passes the round trip time of the request to the limiter.
+// The responses with the status 502, 503 and 504 are counted as
+// failures.
+func (f *adaptiveConcurrencyFilter) Response(ctx filters.FilterContext) {
+	pending, _ := ctx.StateBag()[adaptiveConcurrencyKey].([]time.Time)
+	last := len(pending) - 1
+	if last < 0 {
+		return
+	}
+
+	start := pending[last]
+	ctx.StateBag()[adaptiveConcurrencyKey] = pending[:last]
+	if f.limiter == nil {
+		return
+	}
+
+	switch ctx.Response().StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		f.limiter.Sample(time.Since(start), true)
+	default:
+		f.limiter.Sample(time.Since(start), false)
+	}
+}
@@ -0,0 +1,66 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/zalando/skipper/scheduler"
+)
+
+func TestCreateAdaptiveConcurrency(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		args     []interface{}
+		expected scheduler.AdaptiveConfig
+		fail     bool
+	}{{
+		name: "no args",
+		fail: true,
+	}, {
+		name: "too many args",
+		args: []interface{}{1, 10, "vegas", 4},
+		fail: true,
+	}, {
+		name: "invalid min",
+		args: []interface{}{"1", 10},
+		fail: true,
+	}, {
+		name: "zero min",
+		args: []interface{}{0, 10},
+		fail: true,
+	}, {
+		name: "max lower than min",
+		args: []interface{}{10, 5},
+		fail: true,
+	}, {
+		name: "unknown algorithm",
+		args: []interface{}{1, 10, "aimd"},
+		fail: true,
+	}, {
+		name:     "default algorithm",
+		args:     []interface{}{1.0, 10.0},
+		expected: scheduler.AdaptiveConfig{MinConcurrency: 1, MaxConcurrency: 10, Algorithm: scheduler.Gradient},
+	}, {
+		name:     "vegas",
+		args:     []interface{}{5, 50, "vegas"},
+		expected: scheduler.AdaptiveConfig{MinConcurrency: 5, MaxConcurrency: 50, Algorithm: scheduler.Vegas},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewAdaptiveConcurrency().CreateFilter(tt.args)
+			if tt.fail {
+				if err == nil {
+					t.Fatal("failed to fail")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if c := f.(scheduler.AdaptiveFilter).AdaptiveConfig(); c != tt.expected {
+				t.Errorf("unexpected config, expected: %+v, got: %+v", tt.expected, c)
+			}
+		})
+	}
+}
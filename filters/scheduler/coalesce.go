@@ -0,0 +1,215 @@
+package scheduler
+
+import (
+	"bytes"
+	stdlibcontext "context"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+)
+
+const (
+	defaultCoalesceMaxBodySize = 1 << 20
+
+	coalesceKey = "#coalesce"
+)
+
+type (
+	coalesceSpec struct{}
+
+	coalesceFilter struct {
+		key         *eskip.Template
+		maxBodySize int64
+
+		mu    sync.Mutex
+		calls map[string]*coalescedCall
+	}
+
+	// coalescedCall is a backend request executed on behalf of the
+	// concurrent requests with the same key.
+	coalescedCall struct {
+		filter *coalesceFilter
+		key    string
+		once   sync.Once
+		done   chan struct{}
+
+		// nil, when the response cannot be shared
+		response *coalescedResponse
+	}
+
+	coalescedResponse struct {
+		statusCode int
+		header     http.Header
+		trailer    http.Header
+		body       []byte
+	}
+
+	bodyReadCloser struct {
+		io.Reader
+		io.Closer
+	}
+)
+
+// NewCoalesce creates a filter specification for the coalesce()
+// filter. The filter coalesces the concurrent GET requests with the
+// same key into a single backend request, and serves the copies of the
+// response to all the requests:
+//
+//	coalesce("${request.header.Accept}")
+//
+// The key consists of the method, the host, the path and the query of
+// the request, and the key template argument, resolved the same way
+// as the templates of the other filters, e.g. for including headers.
+// The optional second argument is the maximum size in bytes of the
+// response body that can be shared, the default is 1MB. When the body
+// is larger, or the response sets cookies, the waiting requests are
+// forwarded to the backend individually.
+//
+// Requests are coalesced only within the same route. Combined with the
+// lifo() or lifoGroup() filters, placing coalesce() in front of them
+// makes the waiting requests not occupy the slots of the queue.
+func NewCoalesce() filters.Spec { return &coalesceSpec{} }
+
+func (*coalesceSpec) Name() string { return filters.CoalesceName }
+
+func (*coalesceSpec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	key, ok := args[0].(string)
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &coalesceFilter{
+		key:         eskip.NewTemplate(key),
+		maxBodySize: defaultCoalesceMaxBodySize,
+		calls:       make(map[string]*coalescedCall),
+	}
+
+	if len(args) == 2 {
+		size, err := intArg(args[1])
+		if err != nil || size <= 0 {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		f.maxBodySize = int64(size)
+	}
+
+	return f, nil
+}
+
+func (f *coalesceFilter) requestKey(ctx filters.FilterContext) string {
+	r := ctx.Request()
+	k, _ := f.key.ApplyContext(ctx)
+	return r.Method + " " + r.Host + r.URL.RequestURI() + "\n" + k
+}
+
+// join returns the in-flight call for a key, or starts a new one. It
+// returns true when the caller needs to execute the call.
+func (f *coalesceFilter) join(key string) (*coalescedCall, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if c, ok := f.calls[key]; ok {
+		return c, false
+	}
+
+	c := &coalescedCall{filter: f, key: key, done: make(chan struct{})}
+	f.calls[key] = c
+	return c, true
+}
+
+// finish publishes the response to the waiting requests. Only the
+// first call has an effect.
+func (c *coalescedCall) finish(rsp *coalescedResponse) {
+	c.once.Do(func() {
+		c.filter.mu.Lock()
+		delete(c.filter.calls, c.key)
+		c.filter.mu.Unlock()
+
+		c.response = rsp
+		close(c.done)
+	})
+}
+
+// watch releases the waiting requests, when the leading request
+// finishes without a response, e.g. due to a backend error.
+func (c *coalescedCall) watch(ctx stdlibcontext.Context) {
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		c.finish(nil)
+	}
+}
+
+func (r *coalescedResponse) copy() *http.Response {
+	return &http.Response{
+		StatusCode:    r.statusCode,
+		Header:        r.header.Clone(),
+		Trailer:       r.trailer.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(r.body)),
+		ContentLength: int64(len(r.body)),
+	}
+}
+
+func (f *coalesceFilter) Request(ctx filters.FilterContext) {
+	req := ctx.Request()
+	if req.Method != "GET" || req.ContentLength > 0 {
+		return
+	}
+
+	c, leader := f.join(f.requestKey(ctx))
+	if leader {
+		ctx.StateBag()[coalesceKey] = c
+		go c.watch(req.Context())
+		return
+	}
+
+	select {
+	case <-c.done:
+	case <-req.Context().Done():
+		return
+	}
+
+	if c.response == nil {
+		ctx.Metrics().IncCounter("uncoalesced")
+		return
+	}
+
+	ctx.Metrics().IncCounter("coalesced")
+	ctx.Serve(c.response.copy())
+}
+
+func (f *coalesceFilter) Response(ctx filters.FilterContext) {
+	c, ok := ctx.StateBag()[coalesceKey].(*coalescedCall)
+	if !ok {
+		return
+	}
+
+	delete(ctx.StateBag(), coalesceKey)
+	rsp := ctx.Response()
+	if rsp.Header.Get("Set-Cookie") != "" {
+		c.finish(nil)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(rsp.Body, f.maxBodySize+1))
+	if err != nil || int64(len(body)) > f.maxBodySize {
+		c.finish(nil)
+		rsp.Body = bodyReadCloser{Reader: io.MultiReader(bytes.NewReader(body), rsp.Body), Closer: rsp.Body}
+		return
+	}
+
+	rsp.Body.Close()
+	rsp.Body = io.NopCloser(bytes.NewReader(body))
+	c.finish(&coalescedResponse{
+		statusCode: rsp.StatusCode,
+		header:     rsp.Header.Clone(),
+		trailer:    rsp.Trailer.Clone(),
+		body:       body,
+	})
+}
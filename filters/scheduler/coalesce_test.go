@@ -0,0 +1,260 @@
+package scheduler
+
+import (
+	stdlibcontext "context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"github.com/zalando/skipper/metrics/metricstest"
+	"github.com/zalando/skipper/proxy"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"github.com/zalando/skipper/scheduler"
+)
+
+func TestNewCoalesce(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		args    []interface{}
+		wantMax int64
+		wantErr bool
+	}{{
+		name:    "no args",
+		wantErr: true,
+	}, {
+		name:    "invalid key",
+		args:    []interface{}{42},
+		wantErr: true,
+	}, {
+		name:    "key",
+		args:    []interface{}{"${request.header.Accept}"},
+		wantMax: defaultCoalesceMaxBodySize,
+	}, {
+		name:    "key and max body size",
+		args:    []interface{}{"", 1024},
+		wantMax: 1024,
+	}, {
+		name:    "invalid max body size",
+		args:    []interface{}{"", 0},
+		wantErr: true,
+	}, {
+		name:    "too many args",
+		args:    []interface{}{"", 1024, 1},
+		wantErr: true,
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewCoalesce().CreateFilter(tt.args)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantMax, f.(*coalesceFilter).maxBodySize)
+		})
+	}
+}
+
+func coalesceProxy(t *testing.T, doc string) (string, func()) {
+	dc, err := testdataclient.NewDoc(doc)
+	require.NoError(t, err)
+
+	reg := scheduler.RegistryWith(scheduler.Options{})
+
+	fr := make(filters.Registry)
+	fr.Register(NewCoalesce())
+	fr.Register(NewLIFO())
+
+	rt := routing.New(routing.Options{
+		SignalFirstLoad: true,
+		FilterRegistry:  fr,
+		DataClients:     []routing.DataClient{dc},
+		PostProcessors:  []routing.PostProcessor{reg},
+	})
+
+	<-rt.FirstLoad()
+
+	pr := proxy.WithParams(proxy.Params{Routing: rt})
+	ts := httptest.NewServer(pr)
+	return ts.URL, func() {
+		ts.Close()
+		pr.Close()
+		rt.Close()
+		reg.Close()
+	}
+}
+
+func coalesceSpike(t *testing.T, n int, url, variant string) []string {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		bodies []string
+	)
+
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			req, err := http.NewRequest("GET", url, nil)
+			require.NoError(t, err)
+			req.Header.Set("X-Variant", variant)
+
+			rsp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer rsp.Body.Close()
+
+			b, err := io.ReadAll(rsp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, rsp.StatusCode)
+
+			mu.Lock()
+			bodies = append(bodies, string(b))
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+	return bodies
+}
+
+func TestCoalesce(t *testing.T) {
+	var requests int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(200 * time.Millisecond)
+		w.Header().Set("X-Variant", r.Header.Get("X-Variant"))
+		w.Write([]byte("Hello, " + r.Header.Get("X-Variant")))
+	}))
+	defer backend.Close()
+
+	// the waiting requests don't occupy the single slot of the queue
+	u, closeProxy := coalesceProxy(t, fmt.Sprintf(
+		`* -> coalesce("${request.header.X-Variant}") -> lifo(1, 1, "1s") -> "%s"`,
+		backend.URL,
+	))
+	defer closeProxy()
+
+	for _, body := range coalesceSpike(t, 20, u, "foo") {
+		assert.Equal(t, "Hello, foo", body)
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	var wg sync.WaitGroup
+	for _, v := range []string{"foo", "bar"} {
+		wg.Add(1)
+		go func(v string) {
+			defer wg.Done()
+			for _, body := range coalesceSpike(t, 5, u, v) {
+				assert.Equal(t, "Hello, "+v, body)
+			}
+		}(v)
+	}
+
+	wg.Wait()
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+func TestCoalesceMaxBodySize(t *testing.T) {
+	var requests int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte(strings.Repeat("x", 128)))
+	}))
+	defer backend.Close()
+
+	u, closeProxy := coalesceProxy(t, fmt.Sprintf(`* -> coalesce("", 64) -> "%s"`, backend.URL))
+	defer closeProxy()
+
+	for _, body := range coalesceSpike(t, 5, u, "") {
+		assert.Len(t, body, 128)
+	}
+
+	assert.Equal(t, int32(5), atomic.LoadInt32(&requests))
+}
+
+func coalesceContext(ctx stdlibcontext.Context, m *metricstest.MockMetrics) *filtertest.Context {
+	req, _ := http.NewRequestWithContext(ctx, "GET", "https://www.example.org/foo", nil)
+	return &filtertest.Context{
+		FRequest:  req,
+		FStateBag: make(map[string]interface{}),
+		FMetrics:  m,
+	}
+}
+
+func TestCoalesceMetrics(t *testing.T) {
+	f, err := NewCoalesce().CreateFilter([]interface{}{""})
+	require.NoError(t, err)
+
+	m := &metricstest.MockMetrics{}
+	followers := func(n int) ([]*filtertest.Context, func()) {
+		var (
+			wg  sync.WaitGroup
+			fcs []*filtertest.Context
+		)
+
+		for i := 0; i < n; i++ {
+			fc := coalesceContext(stdlibcontext.Background(), m)
+			fcs = append(fcs, fc)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				f.Request(fc)
+			}()
+		}
+
+		// wait until all the followers joined the call
+		time.Sleep(50 * time.Millisecond)
+		return fcs, wg.Wait
+	}
+
+	// the leader finishes without a response
+	ctx, cancel := stdlibcontext.WithCancel(stdlibcontext.Background())
+	leader := coalesceContext(ctx, m)
+	f.Request(leader)
+	fcs, wait := followers(2)
+	cancel()
+	wait()
+
+	for _, fc := range fcs {
+		assert.False(t, fc.FServed)
+	}
+
+	// the leader shares the response
+	leader = coalesceContext(stdlibcontext.Background(), m)
+	f.Request(leader)
+	fcs, wait = followers(3)
+	leader.FResponse = &http.Response{
+		StatusCode: http.StatusTeapot,
+		Header:     http.Header{"X-Foo": []string{"bar"}},
+		Body:       io.NopCloser(strings.NewReader("Hello, world!")),
+	}
+
+	f.Response(leader)
+	wait()
+	m.WithCounters(func(counters map[string]int64) {
+		assert.Equal(t, int64(2), counters["uncoalesced"])
+		assert.Equal(t, int64(3), counters["coalesced"])
+	})
+
+	for _, fc := range append(fcs, leader) {
+		assert.Equal(t, http.StatusTeapot, fc.FResponse.StatusCode)
+		assert.Equal(t, "bar", fc.FResponse.Header.Get("X-Foo"))
+		b, err := io.ReadAll(fc.FResponse.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "Hello, world!", string(b))
+	}
+}
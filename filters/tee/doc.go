@@ -21,5 +21,10 @@ It is possible to change the path of the tee request, in a similar way to the mo
 	Path("/api/v1") -> tee("https://api.example.org", "^/v1", "/v2" ) -> "http://api.example.org"
 
 In the above example, one can test how a new version of an API would behave on incoming requests.
+
+The teeDiff filter sends the shadow request the same way, and compares the shadow response with the
+response of the main backend, reporting the mismatches as metrics and sampled log entries:
+
+	* -> teeDiff("https://api-v2.example.org", "Content-Type", "meta.timestamp") -> "https://api.example.org"
 */
 package tee
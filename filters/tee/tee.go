@@ -10,6 +10,7 @@ import (
 
 	log "github.com/sirupsen/logrus"
 	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/buffer"
 )
 
 const (
@@ -197,7 +198,10 @@ func cloneRequest(t *tee, req *http.Request) (*http.Request, io.ReadCloser, erro
 	mainBody := req.Body
 
 	// see proxy.go:231
-	if req.ContentLength != 0 {
+	if b, ok := req.Body.(*buffer.Body); ok {
+		// the http client closes the reader
+		teeBody = b.NewReader()
+	} else if req.ContentLength != 0 {
 		pr, pw := io.Pipe()
 		teeBody = pr
 		mainBody = &teeTie{mainBody, pw}
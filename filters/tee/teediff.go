@@ -0,0 +1,546 @@
+package tee
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/flowid"
+	"github.com/zalando/skipper/metrics"
+)
+
+const (
+	diffStateKey = "tee:diff"
+
+	defaultDiffMaxBodySize   = 1 << 20
+	defaultDiffLogSampleRate = 0.1
+	requestIDHeader          = "X-Request-Id"
+)
+
+// DiffOptions for the teeDiff filter.
+type DiffOptions struct {
+
+	// Timeout specifies a time limit for the shadow requests, including
+	// reading the response body.
+	Timeout time.Duration
+
+	// MaxBodySize limits the size of the response bodies that are
+	// compared. When either of the bodies is larger, only the status
+	// and the headers are compared.
+	MaxBodySize int64
+
+	// Metrics receives the comparison counters. Defaults to
+	// metrics.Default.
+	Metrics metrics.Metrics
+}
+
+type teeDiffSpec struct {
+	options DiffOptions
+}
+
+type teeDiff struct {
+	tee        tee
+	options    DiffOptions
+	headers    []string
+	ignore     [][]string
+	sampleRate float64
+	metricsKey string
+	comparedFn func(*diffResult) // test hook
+}
+
+type capturedResponse struct {
+	status   int
+	header   http.Header
+	body     []byte
+	complete bool
+	err      error
+}
+
+type diffState struct {
+	shadow    chan *capturedResponse
+	requestID string
+	method    string
+	path      string
+}
+
+type diffResult struct {
+	requestID    string
+	status       int
+	shadowStatus int
+	headers      []string
+	bodyPath     string
+	bodyCompared bool
+	shadowErr    error
+}
+
+// diffBody captures the primary response body, while it is streamed to
+// the client, and triggers the comparison when the body was read or
+// closed.
+type diffBody struct {
+	io.ReadCloser
+	buf      bytes.Buffer
+	max      int64
+	overflow bool
+	eof      bool
+	once     sync.Once
+	done     func([]byte, bool)
+}
+
+// NewTeeDiff returns a filter specification, whose instances send the
+// same request to a shadow backend as tee() does, and compare the shadow
+// response with the response of the primary backend.
+//
+// Name: "teeDiff".
+func NewTeeDiff() filters.Spec {
+	return TeeDiffWithOptions(DiffOptions{})
+}
+
+// TeeDiffWithOptions returns a teeDiff filter specification with the
+// given options.
+func TeeDiffWithOptions(o DiffOptions) filters.Spec {
+	if o.Timeout <= 0 {
+		o.Timeout = defaultTeeTimeout
+	}
+
+	if o.MaxBodySize <= 0 {
+		o.MaxBodySize = defaultDiffMaxBodySize
+	}
+
+	return &teeDiffSpec{options: o}
+}
+
+func (*teeDiffSpec) Name() string { return filters.TeeDiffName }
+
+func splitList(a interface{}) ([]string, error) {
+	s, ok := a.(string)
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	var l []string
+	for _, si := range strings.Split(s, ",") {
+		if si = strings.TrimSpace(si); si != "" {
+			l = append(l, si)
+		}
+	}
+
+	return l, nil
+}
+
+// CreateFilter creates a teeDiff filter. Arguments:
+//
+//	teeDiff("https://shadow.example.org", "Content-Type,Location", "meta.timestamp,items.id", 0.01)
+//
+// The first argument is the shadow backend. The optional second argument
+// is a comma separated list of the compared headers. The optional third
+// argument is a comma separated list of JSON fields ignored when
+// comparing the bodies, as dot separated paths, where the arrays are
+// traversed implicitly and * matches every field of an object. The
+// optional fourth argument is the ratio of the mismatches that are
+// logged.
+func (spec *teeDiffSpec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) == 0 || len(args) > 4 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	backend, ok := args[0].(string)
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	u, err := url.Parse(backend)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid shadow backend in %s: %s", filters.TeeDiffName, backend)
+	}
+
+	f := &teeDiff{
+		tee: tee{
+			client: &http.Client{
+				Timeout: spec.options.Timeout,
+				CheckRedirect: func(*http.Request, []*http.Request) error {
+					return http.ErrUseLastResponse
+				},
+			},
+			typ:    asBackend,
+			host:   u.Host,
+			scheme: u.Scheme,
+		},
+		options:    spec.options,
+		sampleRate: defaultDiffLogSampleRate,
+		metricsKey: "teediff." + u.Host + ".",
+	}
+
+	if len(args) > 1 {
+		if f.headers, err = splitList(args[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(args) > 2 {
+		fields, err := splitList(args[2])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, fi := range fields {
+			f.ignore = append(f.ignore, strings.Split(fi, "."))
+		}
+	}
+
+	if len(args) > 3 {
+		rate, ok := args[3].(float64)
+		if !ok || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid log sample rate in %s: %v", filters.TeeDiffName, args[3])
+		}
+
+		f.sampleRate = rate
+	}
+
+	return f, nil
+}
+
+func (f *teeDiff) metrics() metrics.Metrics {
+	if f.options.Metrics != nil {
+		return f.options.Metrics
+	}
+
+	return metrics.Default
+}
+
+func readCapped(r io.Reader, max int64) ([]byte, bool, error) {
+	b, err := io.ReadAll(io.LimitReader(r, max+1))
+	if int64(len(b)) > max {
+		return nil, false, err
+	}
+
+	return b, true, err
+}
+
+func (f *teeDiff) shadowRequest(req *http.Request, result chan<- *capturedResponse) {
+	defer func() {
+		if f.tee.shadowRequestDone != nil {
+			f.tee.shadowRequestDone()
+		}
+	}()
+
+	rsp, err := f.tee.client.Do(req)
+	if err != nil {
+		result <- &capturedResponse{err: err}
+		return
+	}
+
+	defer rsp.Body.Close()
+	body, complete, err := readCapped(rsp.Body, f.options.MaxBodySize)
+	if err != nil {
+		result <- &capturedResponse{err: err}
+		return
+	}
+
+	result <- &capturedResponse{
+		status:   rsp.StatusCode,
+		header:   rsp.Header,
+		body:     body,
+		complete: complete,
+	}
+}
+
+// Request sends the copy of the request to the shadow backend.
+func (f *teeDiff) Request(ctx filters.FilterContext) {
+	req := ctx.Request()
+	shadowRequest, body, err := cloneRequest(&f.tee, req)
+	if err != nil {
+		log.Warnf("%s: error while cloning the shadow request: %v", filters.TeeDiffName, err)
+		return
+	}
+
+	req.Body = body
+
+	requestID := req.Header.Get(flowid.HeaderName)
+	if requestID == "" {
+		requestID = req.Header.Get(requestIDHeader)
+	}
+
+	state := &diffState{
+		shadow:    make(chan *capturedResponse, 1),
+		requestID: requestID,
+		method:    req.Method,
+		path:      req.URL.Path,
+	}
+
+	ctx.StateBag()[diffStateKey] = state
+	go f.shadowRequest(shadowRequest, state.shadow)
+}
+
+// Response captures the primary response, and compares it with the
+// shadow response once the body was streamed to the client.
+func (f *teeDiff) Response(ctx filters.FilterContext) {
+	state, ok := ctx.StateBag()[diffStateKey].(*diffState)
+	if !ok {
+		return
+	}
+
+	rsp := ctx.Response()
+	primary := &capturedResponse{
+		status: rsp.StatusCode,
+		header: rsp.Header.Clone(),
+	}
+
+	done := func(body []byte, complete bool) {
+		primary.body = body
+		primary.complete = complete
+		go f.compare(state, primary)
+	}
+
+	if rsp.Body == nil {
+		done(nil, true)
+		return
+	}
+
+	rsp.Body = &diffBody{ReadCloser: rsp.Body, max: f.options.MaxBodySize, done: done}
+}
+
+func (b *diffBody) finish() {
+	b.once.Do(func() {
+		complete := b.eof && !b.overflow
+		var body []byte
+		if complete {
+			body = b.buf.Bytes()
+		}
+
+		b.done(body, complete)
+	})
+}
+
+func (b *diffBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && !b.overflow {
+		if int64(b.buf.Len()+n) > b.max {
+			b.overflow = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+
+	if err == io.EOF {
+		b.eof = true
+		b.finish()
+	}
+
+	return n, err
+}
+
+func (b *diffBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish()
+	return err
+}
+
+func decodeBody(h http.Header, b []byte) []byte {
+	if !strings.EqualFold(h.Get("Content-Encoding"), "gzip") {
+		return b
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return b
+	}
+
+	defer r.Close()
+	d, err := io.ReadAll(r)
+	if err != nil {
+		return b
+	}
+
+	return d
+}
+
+func isJSON(h http.Header) bool {
+	mt, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	return err == nil && (mt == "application/json" || strings.HasSuffix(mt, "+json"))
+}
+
+// ignoreField deletes the field at the path from the decoded JSON
+// value. Arrays are traversed implicitly, and * matches every field of
+// an object.
+func ignoreField(v interface{}, path []string) {
+	if len(path) == 0 {
+		return
+	}
+
+	switch vv := v.(type) {
+	case []interface{}:
+		for _, item := range vv {
+			ignoreField(item, path)
+		}
+	case map[string]interface{}:
+		for k, item := range vv {
+			if path[0] != "*" && path[0] != k {
+				continue
+			}
+
+			if len(path) == 1 {
+				delete(vv, k)
+			} else {
+				ignoreField(item, path[1:])
+			}
+		}
+	}
+}
+
+// diffJSON returns the path of the first difference between two decoded
+// JSON values, or false if they are equal.
+func diffJSON(a, b interface{}, path string) (string, bool) {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return path, true
+		}
+
+		for k, ai := range av {
+			bi, ok := bv[k]
+			if !ok {
+				return path + "." + k, true
+			}
+
+			if p, diff := diffJSON(ai, bi, path+"."+k); diff {
+				return p, true
+			}
+		}
+
+		return "", false
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return path, true
+		}
+
+		for i := range av {
+			if p, diff := diffJSON(av[i], bv[i], fmt.Sprintf("%s[%d]", path, i)); diff {
+				return p, true
+			}
+		}
+
+		return "", false
+	default:
+		if a != b {
+			return path, true
+		}
+
+		return "", false
+	}
+}
+
+// diffBodies returns the location of the first difference between the
+// bodies: the JSON path, when both of them are JSON, otherwise $.
+func (f *teeDiff) diffBodies(primary, shadow *capturedResponse) (string, bool) {
+	pb := decodeBody(primary.header, primary.body)
+	sb := decodeBody(shadow.header, shadow.body)
+	if isJSON(primary.header) && isJSON(shadow.header) {
+		var pv, sv interface{}
+		if json.Unmarshal(pb, &pv) == nil && json.Unmarshal(sb, &sv) == nil {
+			for _, p := range f.ignore {
+				ignoreField(pv, p)
+				ignoreField(sv, p)
+			}
+
+			return diffJSON(pv, sv, "$")
+		}
+	}
+
+	if !bytes.Equal(pb, sb) {
+		return "$", true
+	}
+
+	return "", false
+}
+
+func (f *teeDiff) diff(state *diffState, primary, shadow *capturedResponse) *diffResult {
+	r := &diffResult{
+		requestID:    state.requestID,
+		status:       primary.status,
+		shadowStatus: shadow.status,
+	}
+
+	for _, h := range f.headers {
+		if strings.Join(primary.header.Values(h), ",") != strings.Join(shadow.header.Values(h), ",") {
+			r.headers = append(r.headers, h)
+		}
+	}
+
+	if primary.complete && shadow.complete {
+		r.bodyCompared = true
+		r.bodyPath, _ = f.diffBodies(primary, shadow)
+	}
+
+	return r
+}
+
+func (r *diffResult) mismatch() bool {
+	return r.status != r.shadowStatus || len(r.headers) > 0 || r.bodyPath != ""
+}
+
+func (f *teeDiff) compare(state *diffState, primary *capturedResponse) {
+	shadow := <-state.shadow
+	m := f.metrics()
+
+	var r *diffResult
+	if shadow.err != nil {
+		r = &diffResult{requestID: state.requestID, status: primary.status, shadowErr: shadow.err}
+		m.IncCounter(f.metricsKey + "shadowerror")
+	} else {
+		r = f.diff(state, primary, shadow)
+		m.IncCounter(f.metricsKey + "compared")
+		if !r.bodyCompared {
+			m.IncCounter(f.metricsKey + "bodyskipped")
+		}
+
+		if r.mismatch() {
+			m.IncCounter(f.metricsKey + "mismatch")
+			if r.status != r.shadowStatus {
+				m.IncCounter(f.metricsKey + "mismatch.status")
+			}
+
+			if len(r.headers) > 0 {
+				m.IncCounter(f.metricsKey + "mismatch.headers")
+			}
+
+			if r.bodyPath != "" {
+				m.IncCounter(f.metricsKey + "mismatch.body")
+			}
+
+			if rand.Float64() < f.sampleRate {
+				log.WithFields(log.Fields{
+					"requestId":    r.requestID,
+					"shadow":       f.tee.host,
+					"method":       state.method,
+					"path":         state.path,
+					"status":       r.status,
+					"shadowStatus": r.shadowStatus,
+					"headers":      r.headers,
+					"body":         r.bodyPath,
+				}).Infof("%s: shadow response mismatch", filters.TeeDiffName)
+			}
+		}
+	}
+
+	if f.comparedFn != nil {
+		f.comparedFn(r)
+	}
+}
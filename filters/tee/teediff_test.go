@@ -0,0 +1,303 @@
+package tee
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/filters/filtertest"
+	"github.com/zalando/skipper/metrics/metricstest"
+)
+
+func TestTeeDiffCreateFilter(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		args []interface{}
+		fail bool
+	}{{
+		name: "no args",
+		fail: true,
+	}, {
+		name: "invalid backend",
+		args: []interface{}{"shadow"},
+		fail: true,
+	}, {
+		name: "invalid headers",
+		args: []interface{}{"https://shadow.example.org", 42},
+		fail: true,
+	}, {
+		name: "invalid sample rate",
+		args: []interface{}{"https://shadow.example.org", "", "", 1.5},
+		fail: true,
+	}, {
+		name: "too many args",
+		args: []interface{}{"https://shadow.example.org", "", "", 0.5, "foo"},
+		fail: true,
+	}, {
+		name: "backend only",
+		args: []interface{}{"https://shadow.example.org"},
+	}, {
+		name: "all args",
+		args: []interface{}{"https://shadow.example.org", "Content-Type, Location", "meta.timestamp,items.id", 0.01},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTeeDiff().CreateFilter(tt.args)
+			if tt.fail && err == nil {
+				t.Error("failed to fail")
+			} else if !tt.fail && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestIgnoreField(t *testing.T) {
+	v := map[string]interface{}{
+		"id": "foo",
+		"meta": map[string]interface{}{
+			"timestamp": 42.0,
+			"version":   "1",
+		},
+		"items": []interface{}{
+			map[string]interface{}{"id": 1.0, "name": "bar"},
+			map[string]interface{}{"id": 2.0, "name": "baz"},
+		},
+		"links": map[string]interface{}{
+			"self": map[string]interface{}{"href": "/foo"},
+			"next": map[string]interface{}{"href": "/foo?page=2"},
+		},
+	}
+
+	for _, p := range []string{"meta.timestamp", "items.id", "links.*.href", "missing.field"} {
+		ignoreField(v, strings.Split(p, "."))
+	}
+
+	expected := map[string]interface{}{
+		"id":   "foo",
+		"meta": map[string]interface{}{"version": "1"},
+		"items": []interface{}{
+			map[string]interface{}{"name": "bar"},
+			map[string]interface{}{"name": "baz"},
+		},
+		"links": map[string]interface{}{
+			"self": map[string]interface{}{},
+			"next": map[string]interface{}{},
+		},
+	}
+
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("unexpected result: %v", v)
+	}
+}
+
+func gzipped(t *testing.T, s string) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.Bytes()
+}
+
+func TestTeeDiff(t *testing.T) {
+	jsonHeader := http.Header{"Content-Type": []string{"application/json"}}
+	shadowResponses := map[string]struct {
+		status int
+		header http.Header
+		body   []byte
+	}{
+		"/json":   {200, jsonHeader, []byte(`{"id": 1, "meta": {"timestamp": 2}, "items": [{"name": "foo"}]}`)},
+		"/text":   {200, http.Header{"Content-Type": []string{"text/plain"}}, []byte("Hello, world!")},
+		"/status": {503, nil, nil},
+		"/header": {200, http.Header{"Location": []string{"/bar"}}, nil},
+		"/gzip":   {200, http.Header{"Content-Type": []string{"application/json"}, "Content-Encoding": []string{"gzip"}}, gzipped(t, `{"id": 1}`)},
+		"/large":  {200, nil, []byte(strings.Repeat("x", 100))},
+	}
+
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rsp := shadowResponses[r.URL.Path]
+		for k, v := range rsp.header {
+			w.Header()[k] = v
+		}
+
+		w.WriteHeader(rsp.status)
+		w.Write(rsp.body)
+	}))
+	defer shadow.Close()
+
+	for _, tt := range []struct {
+		name     string
+		path     string
+		status   int
+		header   http.Header
+		body     []byte
+		expected diffResult
+	}{{
+		name:     "JSON with ignored fields",
+		path:     "/json",
+		status:   200,
+		header:   jsonHeader,
+		body:     []byte(`{"items":[{"name":"foo"}],"meta":{"timestamp":1},"id":1.0}`),
+		expected: diffResult{requestID: "foo", status: 200, shadowStatus: 200, bodyCompared: true},
+	}, {
+		name:     "JSON mismatch",
+		path:     "/json",
+		status:   200,
+		header:   jsonHeader,
+		body:     []byte(`{"items":[{"name":"bar"}],"meta":{"timestamp":2},"id":1}`),
+		expected: diffResult{requestID: "foo", status: 200, shadowStatus: 200, bodyCompared: true, bodyPath: "$.items[0].name"},
+	}, {
+		name:     "text mismatch",
+		path:     "/text",
+		status:   200,
+		header:   http.Header{"Content-Type": []string{"text/plain"}},
+		body:     []byte("Hello, World!"),
+		expected: diffResult{requestID: "foo", status: 200, shadowStatus: 200, bodyCompared: true, bodyPath: "$"},
+	}, {
+		name:     "status mismatch",
+		path:     "/status",
+		status:   200,
+		expected: diffResult{requestID: "foo", status: 200, shadowStatus: 503, bodyCompared: true},
+	}, {
+		name:     "header mismatch",
+		path:     "/header",
+		status:   200,
+		header:   http.Header{"Location": []string{"/foo"}},
+		expected: diffResult{requestID: "foo", status: 200, shadowStatus: 200, bodyCompared: true, headers: []string{"Location"}},
+	}, {
+		name:     "gzip",
+		path:     "/gzip",
+		status:   200,
+		header:   jsonHeader,
+		body:     []byte(`{"id": 1}`),
+		expected: diffResult{requestID: "foo", status: 200, shadowStatus: 200, bodyCompared: true},
+	}, {
+		name:     "too large body",
+		path:     "/large",
+		status:   200,
+		body:     []byte(strings.Repeat("y", 100)),
+		expected: diffResult{requestID: "foo", status: 200, shadowStatus: 200},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &metricstest.MockMetrics{}
+			spec := TeeDiffWithOptions(DiffOptions{MaxBodySize: 64, Metrics: m})
+			f, err := spec.CreateFilter([]interface{}{shadow.URL, "Location", "meta.timestamp", 1.0})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			compared := make(chan *diffResult, 1)
+			f.(*teeDiff).comparedFn = func(r *diffResult) { compared <- r }
+
+			req, err := http.NewRequest("GET", "https://www.example.org"+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("X-Flow-Id", "foo")
+			header := tt.header
+			if header == nil {
+				header = make(http.Header)
+			}
+
+			ctx := &filtertest.Context{
+				FRequest:  req,
+				FStateBag: make(map[string]interface{}),
+				FResponse: &http.Response{
+					StatusCode: tt.status,
+					Header:     header,
+					Body:       io.NopCloser(bytes.NewReader(tt.body)),
+				},
+			}
+
+			f.Request(ctx)
+			f.Response(ctx)
+
+			body, err := io.ReadAll(ctx.FResponse.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx.FResponse.Body.Close()
+			if !bytes.Equal(body, tt.body) {
+				t.Fatalf("the response body was modified: %s", body)
+			}
+
+			var r *diffResult
+			select {
+			case r = <-compared:
+			case <-time.After(3 * time.Second):
+				t.Fatal("timeout")
+			}
+
+			if !reflect.DeepEqual(*r, tt.expected) {
+				t.Errorf("unexpected result, expected: %+v, got: %+v", tt.expected, *r)
+			}
+
+			key := "teediff." + strings.TrimPrefix(shadow.URL, "http://") + "."
+			m.WithCounters(func(c map[string]int64) {
+				if c[key+"compared"] != 1 {
+					t.Errorf("unexpected counters: %v", c)
+				}
+
+				var expectedMismatch int64
+				if tt.expected.mismatch() {
+					expectedMismatch = 1
+				}
+
+				if c[key+"mismatch"] != expectedMismatch {
+					t.Errorf("unexpected mismatch counter: %v", c)
+				}
+			})
+		})
+	}
+}
+
+func TestTeeDiffShadowError(t *testing.T) {
+	shadow := httptest.NewServer(nil)
+	shadow.Close()
+
+	m := &metricstest.MockMetrics{}
+	f, err := TeeDiffWithOptions(DiffOptions{Metrics: m}).CreateFilter([]interface{}{shadow.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compared := make(chan *diffResult, 1)
+	f.(*teeDiff).comparedFn = func(r *diffResult) { compared <- r }
+
+	req, err := http.NewRequest("GET", "https://www.example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &filtertest.Context{
+		FRequest:  req,
+		FStateBag: make(map[string]interface{}),
+		FResponse: &http.Response{StatusCode: 200, Header: make(http.Header)},
+	}
+
+	f.Request(ctx)
+	f.Response(ctx)
+
+	if r := <-compared; r.shadowErr == nil {
+		t.Error("failed to report the shadow error")
+	}
+
+	m.WithCounters(func(c map[string]int64) {
+		if c["teediff."+strings.TrimPrefix(shadow.URL, "http://")+".shadowerror"] != 1 {
+			t.Errorf("unexpected counters: %v", c)
+		}
+	})
+}
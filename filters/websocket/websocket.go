@@ -0,0 +1,116 @@
+/*
+Package websocket provides the webSocket filter, that enables the
+WebSocket frame handling of the upgraded connections of a route:
+
+	webSocket(65536, "5m", "1h")
+
+With the filter, the proxy parses the WebSocket frames forwarded between
+the client and the backend, and it counts the messages, the bytes and
+the close codes per direction. The optional arguments limit the size of
+the messages, the time without any frames, and the duration of the
+connections. When a limit is exceeded, the proxy sends a close frame to
+both sides, and closes the connections.
+
+The upgraded connections are proxied only when the experimental upgrade
+support is enabled.
+*/
+package websocket
+
+import (
+	"time"
+
+	"github.com/zalando/skipper/filters"
+)
+
+// Config contains the WebSocket settings of a route. The zero values
+// mean no limit.
+type Config struct {
+
+	// MaxMessageSize limits the size of the data messages in bytes,
+	// including all their fragments.
+	MaxMessageSize int64
+
+	// IdleTimeout is the time after which the connection is closed,
+	// when no frames were sent in either direction.
+	IdleTimeout time.Duration
+
+	// MaxDuration limits the lifetime of the connection.
+	MaxDuration time.Duration
+}
+
+type spec struct{}
+
+type filter struct {
+	config *Config
+}
+
+// New creates a filter specification to instantiate webSocket()
+// filters.
+func New() filters.Spec { return spec{} }
+
+func (spec) Name() string { return filters.WebSocketName }
+
+func intArg(a interface{}) (int64, error) {
+	switch v := a.(type) {
+	case int:
+		return int64(v), nil
+	case float64:
+		return int64(v), nil
+	default:
+		return 0, filters.ErrInvalidFilterParameters
+	}
+}
+
+func durationArg(a interface{}) (time.Duration, error) {
+	if s, ok := a.(string); ok {
+		return time.ParseDuration(s)
+	}
+
+	i, err := intArg(a)
+	return time.Duration(i) * time.Millisecond, err
+}
+
+// CreateFilter creates a webSocket filter. It accepts up to three
+// arguments: the maximum message size in bytes (int), the idle timeout
+// and the maximum connection duration (duration string or
+// milliseconds). Zero values mean no limit.
+func (spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) > 3 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	var (
+		c   Config
+		err error
+	)
+
+	if len(args) > 0 {
+		if c.MaxMessageSize, err = intArg(args[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(args) > 1 {
+		if c.IdleTimeout, err = durationArg(args[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(args) > 2 {
+		if c.MaxDuration, err = durationArg(args[2]); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.MaxMessageSize < 0 || c.IdleTimeout < 0 || c.MaxDuration < 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return &filter{config: &c}, nil
+}
+
+func (f *filter) Request(ctx filters.FilterContext) {
+	ctx.StateBag()[filters.WebSocket] = f.config
+}
+
+func (*filter) Response(filters.FilterContext) {}
@@ -0,0 +1,78 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+)
+
+func TestCreateFilter(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		args     []interface{}
+		expected Config
+		fail     bool
+	}{{
+		name: "too many args",
+		args: []interface{}{1, "1s", "1s", 5},
+		fail: true,
+	}, {
+		name: "invalid max message size",
+		args: []interface{}{"1"},
+		fail: true,
+	}, {
+		name: "negative max message size",
+		args: []interface{}{-1},
+		fail: true,
+	}, {
+		name: "invalid duration",
+		args: []interface{}{1, "foo"},
+		fail: true,
+	}, {
+		name: "negative duration",
+		args: []interface{}{1, 0, "-1s"},
+		fail: true,
+	}, {
+		name: "no args",
+	}, {
+		name:     "max message size only",
+		args:     []interface{}{65536.0},
+		expected: Config{MaxMessageSize: 65536},
+	}, {
+		name: "all args",
+		args: []interface{}{1024, "5m", 3600000},
+		expected: Config{
+			MaxMessageSize: 1024,
+			IdleTimeout:    5 * time.Minute,
+			MaxDuration:    time.Hour,
+		},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := New().CreateFilter(tt.args)
+			if tt.fail {
+				if err == nil {
+					t.Fatal("failed to fail")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := &filtertest.Context{FStateBag: make(map[string]interface{})}
+			f.Request(ctx)
+			c, ok := ctx.FStateBag[filters.WebSocket].(*Config)
+			if !ok {
+				t.Fatal("websocket config not set")
+			}
+
+			if *c != tt.expected {
+				t.Errorf("unexpected config, expected: %+v, got: %+v", tt.expected, *c)
+			}
+		})
+	}
+}
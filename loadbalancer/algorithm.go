@@ -53,6 +53,25 @@ var (
 	defaultAlgorithm = newRoundRobin
 )
 
+func isEjected(ep routing.LBEndpoint) bool {
+	return ep.Metrics != nil && ep.Metrics.IsEjected()
+}
+
+// skipEjected returns the index of the first endpoint starting from i,
+// that is not ejected by the outlier detection. When all endpoints are
+// ejected, it returns i, because it is better to try an endpoint than
+// to fail the request.
+func skipEjected(ep []routing.LBEndpoint, i int) int {
+	for j := 0; j < len(ep); j++ {
+		k := (i + j) % len(ep)
+		if !isEjected(ep[k]) {
+			return k
+		}
+	}
+
+	return i
+}
+
 func fadeInState(now time.Time, duration time.Duration, detected time.Time) (time.Duration, bool) {
 	rel := now.Sub(detected)
 	return rel, rel > 0 && rel < duration
@@ -94,7 +113,7 @@ func shiftToRemaining(rnd *rand.Rand, ctx *routing.LBContext, wi []int, wf []flo
 	notFadingIndexes := wi
 	ep := ctx.Route.LBEndpoints
 	for i := 0; i < len(ep); i++ {
-		if _, fadingIn := fadeInState(now, ctx.Route.LBFadeInDuration, ep[i].Detected); !fadingIn {
+		if _, fadingIn := fadeInState(now, ctx.Route.LBFadeInDuration, ep[i].Detected); !fadingIn && !isEjected(ep[i]) {
 			notFadingIndexes = append(notFadingIndexes, i)
 		}
 	}
@@ -155,7 +174,7 @@ func (r *roundRobin) Apply(ctx *routing.LBContext) routing.LBEndpoint {
 
 	r.mx.Lock()
 	defer r.mx.Unlock()
-	r.index = (r.index + 1) % len(ctx.Route.LBEndpoints)
+	r.index = skipEjected(ctx.Route.LBEndpoints, (r.index+1)%len(ctx.Route.LBEndpoints))
 
 	if ctx.Route.LBFadeInDuration <= 0 {
 		return ctx.Route.LBEndpoints[r.index]
@@ -188,7 +207,7 @@ func (r *random) Apply(ctx *routing.LBContext) routing.LBEndpoint {
 		return ctx.Route.LBEndpoints[0]
 	}
 
-	i := r.rand.Intn(len(ctx.Route.LBEndpoints))
+	i := skipEjected(ctx.Route.LBEndpoints, r.rand.Intn(len(ctx.Route.LBEndpoints)))
 	if ctx.Route.LBFadeInDuration <= 0 {
 		return ctx.Route.LBEndpoints[i]
 	}
@@ -244,6 +263,20 @@ func (ch consistentHash) search(key string) int {
 	return ch[ringIndex].index
 }
 
+// Returns index of endpoint with closest hash to key's hash, which is not ejected
+func (ch consistentHash) searchNotEjected(key string, ctx *routing.LBContext) int {
+	ringIndex := ch.searchRing(key)
+	for i := 0; i < ch.Len(); i++ {
+		if !isEjected(ctx.Route.LBEndpoints[ch[ringIndex].index]) {
+			break
+		}
+
+		ringIndex = (ringIndex + 1) % ch.Len()
+	}
+
+	return ch[ringIndex].index
+}
+
 func computeLoadAverage(ctx *routing.LBContext) float64 {
 	sum := 1.0 // add 1 to include the request that just arrived
 	endpoints := ctx.Route.LBEndpoints
@@ -264,7 +297,7 @@ func (ch consistentHash) boundedLoadSearch(key string, balanceFactor float64, ct
 		load := ctx.Route.LBEndpoints[endpointIndex].Metrics.GetInflightRequests()
 		// We know there must be an endpoint whose load <= average load.
 		// Since targetLoad >= average load (balancerFactor >= 1), there must also be an endpoint with load <= targetLoad.
-		if load <= int(targetLoad) {
+		if load <= int(targetLoad) && !isEjected(ctx.Route.LBEndpoints[endpointIndex]) {
 			break
 		}
 		ringIndex = (ringIndex + 1) % ch.Len()
@@ -286,7 +319,7 @@ func (ch consistentHash) Apply(ctx *routing.LBContext) routing.LBEndpoint {
 	balanceFactor, ok := ctx.Params[ConsistentHashBalanceFactor].(float64)
 	var choice int
 	if !ok {
-		choice = ch.search(key)
+		choice = ch.searchNotEjected(key, ctx)
 	} else {
 		choice = ch.boundedLoadSearch(key, balanceFactor, ctx)
 	}
@@ -316,10 +349,10 @@ func (p *powerOfRandomNChoices) Apply(ctx *routing.LBContext) routing.LBEndpoint
 	p.mx.Lock()
 	defer p.mx.Unlock()
 
-	best := ctx.Route.LBEndpoints[p.rand.Intn(ne)]
+	best := ctx.Route.LBEndpoints[skipEjected(ctx.Route.LBEndpoints, p.rand.Intn(ne))]
 
 	for i := 1; i < p.numberOfChoices; i++ {
-		ce := ctx.Route.LBEndpoints[p.rand.Intn(ne)]
+		ce := ctx.Route.LBEndpoints[skipEjected(ctx.Route.LBEndpoints, p.rand.Intn(ne))]
 
 		if p.getScore(ce) > p.getScore(best) {
 			best = ce
@@ -414,6 +447,24 @@ func setAlgorithm(r *routing.Route) error {
 	return nil
 }
 
+// ValidateRoute implements routing.RouteValidator, checking the endpoints
+// and the algorithm of the LB routes.
+func (p *algorithmProvider) ValidateRoute(r *routing.Route) error {
+	if r.Route.BackendType != eskip.LBBackend {
+		return nil
+	}
+
+	if len(r.Route.LBEndpoints) == 0 {
+		return errors.New("no endpoints defined")
+	}
+
+	if err := parseEndpoints(r); err != nil {
+		return err
+	}
+
+	return setAlgorithm(r)
+}
+
 // Do implements routing.PostProcessor
 func (p *algorithmProvider) Do(r []*routing.Route) []*routing.Route {
 	rr := make([]*routing.Route, 0, len(r))
@@ -423,6 +474,13 @@ func (p *algorithmProvider) Do(r []*routing.Route) []*routing.Route {
 			continue
 		}
 
+		// the reused routes are already in use with their endpoints and
+		// algorithm state
+		if ri.Reused {
+			rr = append(rr, ri)
+			continue
+		}
+
 		if len(ri.Route.LBEndpoints) == 0 {
 			log.Errorf("failed to post-process LB route: %s, no endpoints defined", ri.Id)
 			continue
@@ -209,6 +209,50 @@ func TestSelectAlgorithm(t *testing.T) {
 	})
 }
 
+func TestValidateRoute(t *testing.T) {
+	p := NewAlgorithmProvider().(routing.RouteValidator)
+	for _, test := range []struct {
+		title string
+		route eskip.Route
+		fail  bool
+	}{{
+		title: "not an LB route",
+		route: eskip.Route{BackendType: eskip.NetworkBackend, Backend: "https://www.example.org"},
+	}, {
+		title: "valid LB route",
+		route: eskip.Route{
+			BackendType: eskip.LBBackend,
+			LBAlgorithm: "roundRobin",
+			LBEndpoints: []string{"https://www1.example.org", "https://www2.example.org"},
+		},
+	}, {
+		title: "no endpoints",
+		route: eskip.Route{BackendType: eskip.LBBackend},
+		fail:  true,
+	}, {
+		title: "invalid endpoint",
+		route: eskip.Route{BackendType: eskip.LBBackend, LBEndpoints: []string{"::"}},
+		fail:  true,
+	}, {
+		title: "invalid algorithm",
+		route: eskip.Route{
+			BackendType: eskip.LBBackend,
+			LBAlgorithm: "fooBar",
+			LBEndpoints: []string{"https://www1.example.org"},
+		},
+		fail: true,
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			err := p.ValidateRoute(&routing.Route{Route: test.route})
+			if test.fail && err == nil {
+				t.Error("failed to fail")
+			} else if !test.fail && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
 func TestApply(t *testing.T) {
 	const R = 1000
 	const N = 10
@@ -59,5 +59,10 @@ Lame duck (unhealthy)
 
     The backend task is listening on its port and can serve, but is
     explicitly asking clients to stop sending requests.
+
+Package loadbalancer also implements a passive outlier detection, see
+OutlierDetector. The endpoints of a route, that fail repeatedly, are
+ejected for a limited time, and the algorithms skip them, unless all
+the endpoints of the route are ejected.
 */
 package loadbalancer
@@ -0,0 +1,292 @@
+package loadbalancer
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/routing"
+)
+
+const (
+	DefaultOutlierConsecutiveFailures = 5
+	DefaultOutlierBaseEjectionTime    = 30 * time.Second
+	DefaultOutlierMaxEjectionTime     = 300 * time.Second
+	DefaultOutlierMaxEjectionPercent  = 10
+)
+
+// OutlierOptions configures the passive outlier detection.
+type OutlierOptions struct {
+
+	// ConsecutiveFailures is the number of the consecutive failed
+	// requests to an endpoint, after which the endpoint is ejected.
+	// The failed requests are the 5xx responses, the connection
+	// errors, and the requests exceeding the LatencyThreshold.
+	// Defaults to DefaultOutlierConsecutiveFailures.
+	ConsecutiveFailures int
+
+	// LatencyThreshold, when greater than 0, makes the requests
+	// taking longer than it count as failures.
+	LatencyThreshold time.Duration
+
+	// BaseEjectionTime is the duration of the first ejection of an
+	// endpoint. Every subsequent ejection doubles it, up to
+	// MaxEjectionTime. Defaults to DefaultOutlierBaseEjectionTime.
+	BaseEjectionTime time.Duration
+
+	// MaxEjectionTime limits the ejection time. Defaults to
+	// DefaultOutlierMaxEjectionTime.
+	MaxEjectionTime time.Duration
+
+	// MaxEjectionPercent limits the ratio of the ejected endpoints of
+	// a route. At least one endpoint can be always ejected. Defaults
+	// to DefaultOutlierMaxEjectionPercent.
+	MaxEjectionPercent int
+
+	// Metrics receives the ejection counters. Defaults to
+	// metrics.Default.
+	Metrics metrics.Metrics
+}
+
+type outlierState struct {
+	mu           sync.Mutex
+	route        string
+	endpoint     string
+	consecutive  int
+	ejections    int
+	ejectedUntil time.Time
+}
+
+// OutlierDetector implements the passive outlier detection of the LB
+// endpoints. The proxy records the result of the backend requests, and
+// when an endpoint of a route fails repeatedly, the detector ejects it
+// from the load balancing for an exponentially growing duration. The
+// LB algorithms skip the ejected endpoints, unless all the endpoints
+// of a route are ejected.
+//
+// OutlierDetector is also a routing.PostProcessor, that keeps the
+// ejections across the routing updates, and an http.Handler, that
+// lists the ejected endpoints.
+type OutlierDetector struct {
+	options   OutlierOptions
+	endpoints sync.Map
+}
+
+// OutlierEndpoint is the JSON representation of an ejected endpoint.
+type OutlierEndpoint struct {
+	Route        string    `json:"route"`
+	Endpoint     string    `json:"endpoint"`
+	EjectedUntil time.Time `json:"ejectedUntil"`
+	Ejections    int       `json:"ejections"`
+}
+
+// NewOutlierDetector creates an outlier detector.
+func NewOutlierDetector(o OutlierOptions) *OutlierDetector {
+	if o.ConsecutiveFailures <= 0 {
+		o.ConsecutiveFailures = DefaultOutlierConsecutiveFailures
+	}
+
+	if o.BaseEjectionTime <= 0 {
+		o.BaseEjectionTime = DefaultOutlierBaseEjectionTime
+	}
+
+	if o.MaxEjectionTime <= 0 {
+		o.MaxEjectionTime = DefaultOutlierMaxEjectionTime
+	}
+
+	if o.MaxEjectionTime < o.BaseEjectionTime {
+		o.MaxEjectionTime = o.BaseEjectionTime
+	}
+
+	if o.MaxEjectionPercent <= 0 {
+		o.MaxEjectionPercent = DefaultOutlierMaxEjectionPercent
+	}
+
+	if o.Metrics == nil {
+		o.Metrics = metrics.Default
+	}
+
+	return &OutlierDetector{options: o}
+}
+
+func outlierKey(routeID string, ep *routing.LBEndpoint) string {
+	return routeID + " " + ep.Scheme + "://" + ep.Host
+}
+
+func (d *OutlierDetector) ejectionTime(ejections int) time.Duration {
+	t := d.options.BaseEjectionTime
+	for i := 0; i < ejections && t < d.options.MaxEjectionTime; i++ {
+		t *= 2
+	}
+
+	if t > d.options.MaxEjectionTime {
+		t = d.options.MaxEjectionTime
+	}
+
+	return t
+}
+
+func (d *OutlierDetector) canEject(r *routing.Route) bool {
+	var ejected int
+	for _, ep := range r.LBEndpoints {
+		if isEjected(ep) {
+			ejected++
+		}
+	}
+
+	allowed := len(r.LBEndpoints) * d.options.MaxEjectionPercent / 100
+	if allowed < 1 {
+		allowed = 1
+	}
+
+	return ejected < allowed
+}
+
+// Record registers the result of a backend request to an endpoint of a
+// load balanced route.
+func (d *OutlierDetector) Record(r *routing.Route, ep *routing.LBEndpoint, failed bool, latency time.Duration) {
+	if d == nil || r == nil || ep == nil || ep.Metrics == nil {
+		return
+	}
+
+	if d.options.LatencyThreshold > 0 && latency > d.options.LatencyThreshold {
+		failed = true
+	}
+
+	key := outlierKey(r.Id, ep)
+	var s *outlierState
+	if si, ok := d.endpoints.Load(key); ok {
+		s = si.(*outlierState)
+	} else if !failed {
+		return
+	} else {
+		si, _ := d.endpoints.LoadOrStore(key, &outlierState{route: r.Id, endpoint: ep.Scheme + "://" + ep.Host})
+		s = si.(*outlierState)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if !failed {
+		s.consecutive = 0
+
+		// the ejection time is reset, when the endpoint was healthy
+		// for the max ejection time after the last ejection
+		if s.ejections > 0 && now.Sub(s.ejectedUntil) > d.options.MaxEjectionTime {
+			s.ejections = 0
+		}
+
+		return
+	}
+
+	s.consecutive++
+	if s.consecutive < d.options.ConsecutiveFailures || ep.Metrics.IsEjected() {
+		return
+	}
+
+	if !d.canEject(r) {
+		d.options.Metrics.IncCounter("outlier.ejections.skipped." + r.Id)
+		return
+	}
+
+	s.consecutive = 0
+	s.ejectedUntil = now.Add(d.ejectionTime(s.ejections))
+	s.ejections++
+	ep.Metrics.SetEjectedUntil(s.ejectedUntil)
+
+	d.options.Metrics.IncCounter("outlier.ejections." + r.Id)
+	log.Infof("outlier detection: endpoint %s of route %s ejected until %v", s.endpoint, r.Id, s.ejectedUntil)
+}
+
+// Do implements routing.PostProcessor. It keeps the ejections of the
+// endpoints across the routing updates, and drops the state of the
+// removed endpoints.
+func (d *OutlierDetector) Do(routes []*routing.Route) []*routing.Route {
+	current := make(map[string]bool)
+	for _, r := range routes {
+		if r.BackendType != eskip.LBBackend {
+			continue
+		}
+
+		for i := range r.LBEndpoints {
+			ep := &r.LBEndpoints[i]
+			key := outlierKey(r.Id, ep)
+			current[key] = true
+
+			si, ok := d.endpoints.Load(key)
+			if !ok || ep.Metrics == nil {
+				continue
+			}
+
+			s := si.(*outlierState)
+			s.mu.Lock()
+			ep.Metrics.SetEjectedUntil(s.ejectedUntil)
+			s.mu.Unlock()
+		}
+	}
+
+	d.endpoints.Range(func(key, _ interface{}) bool {
+		if !current[key.(string)] {
+			d.endpoints.Delete(key)
+		}
+
+		return true
+	})
+
+	return routes
+}
+
+// Ejected returns the currently ejected endpoints.
+func (d *OutlierDetector) Ejected() []OutlierEndpoint {
+	var ejected []OutlierEndpoint
+	now := time.Now()
+	d.endpoints.Range(func(_, si interface{}) bool {
+		s := si.(*outlierState)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.ejectedUntil.After(now) {
+			ejected = append(ejected, OutlierEndpoint{
+				Route:        s.route,
+				Endpoint:     s.endpoint,
+				EjectedUntil: s.ejectedUntil,
+				Ejections:    s.ejections,
+			})
+		}
+
+		return true
+	})
+
+	sort.Slice(ejected, func(i, j int) bool {
+		if ejected[i].Route == ejected[j].Route {
+			return ejected[i].Endpoint < ejected[j].Endpoint
+		}
+
+		return ejected[i].Route < ejected[j].Route
+	})
+
+	return ejected
+}
+
+// ServeHTTP lists the currently ejected endpoints in JSON format.
+func (d *OutlierDetector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ejected := d.Ejected()
+	if ejected == nil {
+		ejected = []OutlierEndpoint{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ejected); err != nil {
+		log.Errorf("outlier detection: failed to encode the ejected endpoints: %v", err)
+	}
+}
@@ -0,0 +1,243 @@
+package loadbalancer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/metrics/metricstest"
+	"github.com/zalando/skipper/routing"
+)
+
+func outlierRoute(id string, n int) *routing.Route {
+	return outlierRouteWithAlgorithm(id, "", n)
+}
+
+func outlierRouteWithAlgorithm(id, algorithm string, n int) *routing.Route {
+	var eps []string
+	for i := 0; i < n; i++ {
+		eps = append(eps, fmt.Sprintf("http://127.0.0.1:123%d", i))
+	}
+
+	r := &routing.Route{
+		Route: eskip.Route{
+			Id:          id,
+			BackendType: eskip.LBBackend,
+			LBAlgorithm: algorithm,
+			LBEndpoints: eps,
+		},
+	}
+
+	return NewAlgorithmProvider().Do([]*routing.Route{r})[0]
+}
+
+func fail(d *OutlierDetector, r *routing.Route, i, n int) {
+	for j := 0; j < n; j++ {
+		d.Record(r, &r.LBEndpoints[i], true, 0)
+	}
+}
+
+func TestOutlierEjection(t *testing.T) {
+	m := &metricstest.MockMetrics{}
+	d := NewOutlierDetector(OutlierOptions{
+		ConsecutiveFailures: 3,
+		BaseEjectionTime:    time.Minute,
+		MaxEjectionTime:     3 * time.Minute,
+		MaxEjectionPercent:  100,
+		Metrics:             m,
+	})
+
+	r := outlierRoute("foo", 2)
+	ep := &r.LBEndpoints[0]
+
+	// a successful request resets the consecutive failures
+	fail(d, r, 0, 2)
+	d.Record(r, ep, false, 0)
+	fail(d, r, 0, 2)
+	if ep.Metrics.IsEjected() {
+		t.Fatal("unexpected ejection")
+	}
+
+	fail(d, r, 0, 1)
+	if !ep.Metrics.IsEjected() {
+		t.Fatal("failed to eject the endpoint")
+	}
+
+	if r.LBEndpoints[1].Metrics.IsEjected() {
+		t.Fatal("unexpected ejection of the healthy endpoint")
+	}
+
+	if d := ep.Metrics.EjectedUntil().Sub(time.Now()); d > time.Minute {
+		t.Errorf("unexpected ejection time: %v", d)
+	}
+
+	// the ejection time grows exponentially, up to the max
+	for _, expected := range []time.Duration{2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		ep.Metrics.SetEjectedUntil(time.Time{})
+		start := time.Now()
+		fail(d, r, 0, 3)
+		ejection := ep.Metrics.EjectedUntil().Sub(start)
+		if ejection < expected || ejection > expected+time.Second {
+			t.Errorf("unexpected ejection time, expected: %v, got: %v", expected, ejection)
+		}
+	}
+
+	m.WithCounters(func(counters map[string]int64) {
+		if counters["outlier.ejections.foo"] != 4 {
+			t.Errorf("unexpected ejection count: %d", counters["outlier.ejections.foo"])
+		}
+	})
+}
+
+func TestOutlierMaxEjectionPercent(t *testing.T) {
+	m := &metricstest.MockMetrics{}
+	d := NewOutlierDetector(OutlierOptions{
+		ConsecutiveFailures: 1,
+		MaxEjectionPercent:  20,
+		Metrics:             m,
+	})
+
+	r := outlierRoute("foo", 10)
+	for i := range r.LBEndpoints {
+		fail(d, r, i, 1)
+	}
+
+	var ejected int
+	for _, ep := range r.LBEndpoints {
+		if ep.Metrics.IsEjected() {
+			ejected++
+		}
+	}
+
+	if ejected != 2 {
+		t.Errorf("unexpected number of ejected endpoints: %d", ejected)
+	}
+
+	m.WithCounters(func(counters map[string]int64) {
+		if counters["outlier.ejections.skipped.foo"] != 8 {
+			t.Errorf("unexpected skipped ejection count: %d", counters["outlier.ejections.skipped.foo"])
+		}
+	})
+
+	// at least one endpoint can be ejected
+	r = outlierRoute("bar", 2)
+	fail(d, r, 0, 1)
+	fail(d, r, 1, 1)
+	if !r.LBEndpoints[0].Metrics.IsEjected() || r.LBEndpoints[1].Metrics.IsEjected() {
+		t.Error("unexpected ejections")
+	}
+}
+
+func TestOutlierLatencyThreshold(t *testing.T) {
+	d := NewOutlierDetector(OutlierOptions{
+		ConsecutiveFailures: 2,
+		LatencyThreshold:    100 * time.Millisecond,
+		MaxEjectionPercent:  100,
+		Metrics:             &metricstest.MockMetrics{},
+	})
+
+	r := outlierRoute("foo", 2)
+	ep := &r.LBEndpoints[0]
+	d.Record(r, ep, false, 50*time.Millisecond)
+	d.Record(r, ep, false, 200*time.Millisecond)
+	if ep.Metrics.IsEjected() {
+		t.Fatal("unexpected ejection")
+	}
+
+	d.Record(r, ep, false, 200*time.Millisecond)
+	if !ep.Metrics.IsEjected() {
+		t.Error("failed to eject the slow endpoint")
+	}
+}
+
+func TestOutlierRoutingUpdate(t *testing.T) {
+	d := NewOutlierDetector(OutlierOptions{
+		ConsecutiveFailures: 1,
+		MaxEjectionPercent:  100,
+		Metrics:             &metricstest.MockMetrics{},
+	})
+
+	r := outlierRoute("foo", 3)
+	fail(d, r, 1, 1)
+
+	// the new route instance keeps the ejection
+	r = d.Do([]*routing.Route{outlierRoute("foo", 3)})[0]
+	if r.LBEndpoints[0].Metrics.IsEjected() || !r.LBEndpoints[1].Metrics.IsEjected() {
+		t.Fatal("failed to keep the ejection")
+	}
+
+	if len(d.Ejected()) != 1 {
+		t.Fatal("failed to list the ejected endpoint")
+	}
+
+	// the removed endpoint is dropped
+	d.Do([]*routing.Route{outlierRoute("foo", 1)})
+	if len(d.Ejected()) != 0 {
+		t.Error("failed to drop the removed endpoint")
+	}
+}
+
+func TestOutlierHandler(t *testing.T) {
+	d := NewOutlierDetector(OutlierOptions{
+		ConsecutiveFailures: 1,
+		MaxEjectionPercent:  100,
+		Metrics:             &metricstest.MockMetrics{},
+	})
+
+	fail(d, outlierRoute("foo", 2), 1, 1)
+	fail(d, outlierRoute("bar", 2), 0, 1)
+
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/outliers", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", w.Code)
+	}
+
+	var ejected []OutlierEndpoint
+	if err := json.Unmarshal(w.Body.Bytes(), &ejected); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ejected) != 2 ||
+		ejected[0].Route != "bar" || ejected[0].Endpoint != "http://127.0.0.1:1230" ||
+		ejected[1].Route != "foo" || ejected[1].Endpoint != "http://127.0.0.1:1231" ||
+		ejected[0].Ejections != 1 {
+		t.Errorf("unexpected ejected endpoints: %+v", ejected)
+	}
+
+	w = httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("POST", "/outliers", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected status code: %d", w.Code)
+	}
+}
+
+func TestApplySkipsEjected(t *testing.T) {
+	for _, algorithm := range []string{"roundRobin", "random", "consistentHash", "powerOfRandomNChoices"} {
+		t.Run(algorithm, func(t *testing.T) {
+			r := outlierRouteWithAlgorithm("foo", algorithm, 3)
+			req, _ := http.NewRequest("GET", "http://127.0.0.1:1234/foo", nil)
+			ctx := &routing.LBContext{Request: req, Route: r}
+
+			r.LBEndpoints[1].Metrics.SetEjectedUntil(time.Now().Add(time.Minute))
+			for i := 0; i < 100; i++ {
+				if ep := r.LBAlgorithm.Apply(ctx); ep.Host == r.LBEndpoints[1].Host {
+					t.Fatal("ejected endpoint selected")
+				}
+			}
+
+			// when all endpoints are ejected, they are still used
+			for _, ep := range r.LBEndpoints {
+				ep.Metrics.SetEjectedUntil(time.Now().Add(time.Minute))
+			}
+
+			if ep := r.LBAlgorithm.Apply(ctx); ep.Host == "" {
+				t.Error("no endpoint selected")
+			}
+		})
+	}
+}
@@ -21,6 +21,12 @@ const (
 	combinedLogFormat = commonLogFormat + ` "%s" "%s"`
 	// We add the duration in ms, a requested host and a flow id and audit log
 	accessLogFormat = combinedLogFormat + " %d %s %s %s\n"
+
+	// format of the connection level entries, e.g. of the TLS passthrough:
+	// remote_host - - [date] "protocol server_name backend" status bytes_received bytes_sent duration route_id
+	connectionLogFormat = `%s - - [%s] "%s %s %s" %s %d %d %d %s` + "\n"
+
+	connectionEntryType = "connection"
 )
 
 type accessLogFormatter struct {
@@ -46,6 +52,44 @@ type AccessEntry struct {
 	RequestTime time.Time
 }
 
+// ConnectionEntry is the access log entry of a proxied connection, that
+// is not handled as HTTP, e.g. of the TLS passthrough.
+type ConnectionEntry struct {
+
+	// RemoteAddr is the address of the client.
+	RemoteAddr string
+
+	// Protocol of the connection, e.g. TLS.
+	Protocol string
+
+	// ServerName is the server name requested by the client.
+	ServerName string
+
+	// RouteID is the id of the matched route, empty when no route was
+	// found.
+	RouteID string
+
+	// Backend is the address of the backend, empty when the connection
+	// was not forwarded.
+	Backend string
+
+	// Status is the outcome of the connection, e.g. ok, noroute or
+	// backenderror.
+	Status string
+
+	// BytesReceived is the number of bytes received from the client.
+	BytesReceived int64
+
+	// BytesSent is the number of bytes sent to the client.
+	BytesSent int64
+
+	// Duration is the time the connection was open.
+	Duration time.Duration
+
+	// StartTime is the time the connection was accepted.
+	StartTime time.Time
+}
+
 // TODO: create individual instances from the access log and
 // delegate the ownership from the package level to the user
 // code.
@@ -81,11 +125,19 @@ func omitWhitespace(h string) string {
 }
 
 func (f *accessLogFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	format := f.format
 	keys := []string{
 		"host", "timestamp", "method", "uri", "proto",
 		"status", "response-size", "referer", "user-agent",
 		"duration", "requested-host", "flow-id", "audit"}
 
+	if e.Data["type"] == connectionEntryType {
+		format = connectionLogFormat
+		keys = []string{
+			"host", "timestamp", "proto", "requested-host", "backend",
+			"status", "bytes-received", "bytes-sent", "duration", "route-id"}
+	}
+
 	values := make([]interface{}, len(keys))
 	for i, key := range keys {
 		if s, ok := e.Data[key].(string); ok {
@@ -95,7 +147,7 @@ func (f *accessLogFormatter) Format(e *logrus.Entry) ([]byte, error) {
 		}
 	}
 
-	return []byte(fmt.Sprintf(f.format, values...)), nil
+	return []byte(fmt.Sprintf(format, values...)), nil
 }
 
 func stripQueryString(u string) string {
@@ -168,3 +220,25 @@ func LogAccess(entry *AccessEntry, additional map[string]interface{}) {
 
 	accessLog.WithFields(logData).Infoln()
 }
+
+// LogConnection logs a proxied connection, that is not handled as HTTP,
+// e.g. of the TLS passthrough.
+func LogConnection(entry *ConnectionEntry) {
+	if accessLog == nil || entry == nil {
+		return
+	}
+
+	accessLog.WithFields(logrus.Fields{
+		"type":           connectionEntryType,
+		"timestamp":      entry.StartTime.Format(dateFormat),
+		"host":           stripPort(entry.RemoteAddr),
+		"proto":          entry.Protocol,
+		"requested-host": entry.ServerName,
+		"backend":        entry.Backend,
+		"status":         entry.Status,
+		"bytes-received": entry.BytesReceived,
+		"bytes-sent":     entry.BytesSent,
+		"duration":       int64(entry.Duration / time.Millisecond),
+		"route-id":       entry.RouteID,
+	}).Infoln()
+}
@@ -3,6 +3,7 @@ package logging
 import (
 	"bytes"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -242,3 +243,50 @@ func TestAccessLogStripQuery(t *testing.T) {
 	entry.Request.RequestURI += "?foo=bar"
 	testAccessLog(t, entry, logOutput, Options{AccessLogStripQuery: true})
 }
+
+func TestConnectionLog(t *testing.T) {
+	entry := &ConnectionEntry{
+		RemoteAddr:    "127.0.0.1:56324",
+		Protocol:      "TLS",
+		ServerName:    "db.example.org",
+		RouteID:       "db",
+		Backend:       "10.0.0.5:5432",
+		Status:        "ok",
+		BytesReceived: 1024,
+		BytesSent:     2048,
+		Duration:      42 * time.Millisecond,
+		StartTime:     testDate(),
+	}
+
+	for _, tt := range []struct {
+		title    string
+		entry    *ConnectionEntry
+		options  Options
+		expected string
+	}{{
+		title:    "text",
+		entry:    entry,
+		expected: `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "TLS db.example.org 10.0.0.5:5432" ok 1024 2048 42 db`,
+	}, {
+		title:    "no route",
+		entry:    &ConnectionEntry{RemoteAddr: "127.0.0.1:56324", Protocol: "TLS", ServerName: "unknown.example.org", Status: "noroute", StartTime: testDate()},
+		expected: `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "TLS unknown.example.org -" noroute 0 0 0 -`,
+	}, {
+		title:    "JSON",
+		entry:    entry,
+		options:  Options{AccessLogJSONEnabled: true},
+		expected: `{"backend":"10.0.0.5:5432","bytes-received":1024,"bytes-sent":2048,"duration":42,"host":"127.0.0.1","level":"info","msg":"","proto":"TLS","requested-host":"db.example.org","route-id":"db","status":"ok","timestamp":"10/Oct/2000:13:55:36 -0700","type":"connection"}`,
+	}, {
+		title: "empty entry",
+	}} {
+		t.Run(tt.title, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.options.AccessLogOutput = &buf
+			Init(tt.options)
+			LogConnection(tt.entry)
+			if got := strings.TrimSuffix(buf.String(), "\n"); got != tt.expected {
+				t.Errorf("unexpected connection log, expected: %s, got: %s", tt.expected, got)
+			}
+		})
+	}
+}
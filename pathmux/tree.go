@@ -66,7 +66,30 @@ func (n *node) sortStaticChild(i int) {
 	}
 }
 
+// clone creates a shallow copy of the node, with its own children slices,
+// used for the copy-on-write updates.
+func (n *node) clone() *node {
+	c := *n
+	c.staticIndices = append([]byte(nil), n.staticIndices...)
+	c.staticChild = append([]*node(nil), n.staticChild...)
+	return &c
+}
+
+func (n *node) isEmpty() bool {
+	return n.leafValue == nil &&
+		len(n.staticChild) == 0 &&
+		n.wildcardChild == nil &&
+		n.catchAllChild == nil
+}
+
 func (n *node) addPath(path string) (*node, error) {
+	return n.insertPath(path, false)
+}
+
+// insertPath adds the path to the node. When copyOnWrite is true, the node
+// itself needs to be a copy, and the visited children are copied before
+// they are changed.
+func (n *node) insertPath(path string, copyOnWrite bool) (*node, error) {
 	leaf := len(path) == 0
 	if leaf {
 		return n, nil
@@ -94,6 +117,8 @@ func (n *node) addPath(path string) (*node, error) {
 		thisToken = thisToken[1:]
 		if n.catchAllChild == nil {
 			n.catchAllChild = &node{path: thisToken, isCatchAll: true}
+		} else if copyOnWrite {
+			n.catchAllChild = n.catchAllChild.clone()
 		}
 
 		if path[1:] != n.catchAllChild.path {
@@ -111,9 +136,11 @@ func (n *node) addPath(path string) (*node, error) {
 		// Token starts with a :
 		if n.wildcardChild == nil {
 			n.wildcardChild = &node{path: "wildcard"}
+		} else if copyOnWrite {
+			n.wildcardChild = n.wildcardChild.clone()
 		}
 
-		return n.wildcardChild.addPath(remainingPath)
+		return n.wildcardChild.insertPath(remainingPath, copyOnWrite)
 
 	} else {
 		if strings.ContainsAny(thisToken, ":*") {
@@ -123,12 +150,16 @@ func (n *node) addPath(path string) (*node, error) {
 		// Do we have an existing node that starts with the same letter?
 		for i, index := range n.staticIndices {
 			if c == index {
+				if copyOnWrite {
+					n.staticChild[i] = n.staticChild[i].clone()
+				}
+
 				// Yes. Split it based on the common prefix of the existing
 				// node and the new one.
 				child, prefixSplit := n.splitCommonPrefix(i, thisToken)
 				child.priority++
 				n.sortStaticChild(i)
-				return child.addPath(path[prefixSplit:])
+				return child.insertPath(path[prefixSplit:], copyOnWrite)
 			}
 		}
 
@@ -142,10 +173,62 @@ func (n *node) addPath(path string) (*node, error) {
 			n.staticIndices = append(n.staticIndices, c)
 			n.staticChild = append(n.staticChild, child)
 		}
-		return child.addPath(remainingPath)
+		return child.insertPath(remainingPath, copyOnWrite)
 	}
 }
 
+// deletePath returns a copy of the node without the value of the path, or
+// nil, when the node became empty. Only the nodes along the path are
+// copied.
+func (n *node) deletePath(path string) *node {
+	c := n.clone()
+	if len(path) == 0 {
+		c.leafValue = nil
+	} else {
+		switch path[0] {
+		case '*':
+			if c.catchAllChild != nil && c.catchAllChild.path == path[1:] {
+				c.catchAllChild = nil
+			}
+		case ':':
+			if c.wildcardChild != nil {
+				nextSlash := strings.Index(path, "/")
+				if nextSlash == -1 {
+					nextSlash = len(path)
+				}
+
+				c.wildcardChild = c.wildcardChild.deletePath(path[nextSlash:])
+			}
+		default:
+			for i, index := range c.staticIndices {
+				if index != path[0] {
+					continue
+				}
+
+				child := c.staticChild[i]
+				if !strings.HasPrefix(path, child.path) {
+					break
+				}
+
+				if child = child.deletePath(path[len(child.path):]); child != nil {
+					c.staticChild[i] = child
+					break
+				}
+
+				c.staticIndices = append(c.staticIndices[:i], c.staticIndices[i+1:]...)
+				c.staticChild = append(c.staticChild[:i], c.staticChild[i+1:]...)
+				break
+			}
+		}
+	}
+
+	if c.isEmpty() {
+		return nil
+	}
+
+	return c
+}
+
 func (n *node) splitCommonPrefix(existingNodeIndex int, path string) (*node, int) {
 	childNode := n.staticChild[existingNodeIndex]
 
@@ -289,6 +372,35 @@ func (t *Tree) Add(path string, value interface{}) error {
 	return nil
 }
 
+// Set returns a new tree, that contains the value associated to the path,
+// in addition to the values of the original tree. The original tree is not
+// modified, and it can be used concurrently. Only the nodes along the path
+// are copied, the rest of the nodes are shared between the two trees. When
+// setting the value fails, the original tree can be used further.
+func (t *Tree) Set(path string, value interface{}) (*Tree, error) {
+	root := (*node)(t).clone()
+	n, err := root.insertPath(path[1:], true)
+	if err != nil {
+		return nil, err
+	}
+
+	n.leafValue = value
+	return (*Tree)(root), nil
+}
+
+// Delete returns a new tree without the value associated to the path. The
+// original tree is not modified, and it can be used concurrently. Only the
+// nodes along the path are copied, the rest of the nodes are shared between
+// the two trees.
+func (t *Tree) Delete(path string) *Tree {
+	root := (*node)(t).deletePath(path[1:])
+	if root == nil {
+		return &Tree{}
+	}
+
+	return (*Tree)(root)
+}
+
 // Lookup tries to find a value in the tree associated to a path. If the found path definition contains
 // wildcards, the values of the wildcards are returned in the second argument.
 func (t *Tree) Lookup(path string) (interface{}, []string) {
@@ -307,6 +307,131 @@ func TestDefaultMatcher(t *testing.T) {
 	}
 }
 
+func TestSetDelete(t *testing.T) {
+	paths := []string{
+		"/",
+		"/images",
+		"/images/:name",
+		"/images/*path",
+		"/ima/:par",
+		"/apples",
+		"/appeasement",
+		"/date/:year/:month",
+		"/date/:year/:month/*post",
+		"/:page",
+	}
+
+	requests := []string{
+		"/",
+		"/images",
+		"/images/foo.jpg",
+		"/images/foo/bar.jpg",
+		"/ima/foo",
+		"/apples",
+		"/appeasement",
+		"/appealing",
+		"/date/2023/01",
+		"/date/2023/01/post",
+		"/foo",
+		"/foo/bar",
+	}
+
+	lookupAll := func(tree *Tree) map[string]interface{} {
+		r := make(map[string]interface{})
+		for _, p := range requests {
+			v, _ := tree.Lookup(p)
+			r[p] = v
+		}
+
+		return r
+	}
+
+	build := func(paths ...string) *Tree {
+		tree := &Tree{}
+		for _, p := range paths {
+			if err := tree.Add(p, p); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return tree
+	}
+
+	checkTree := func(t *testing.T, tree *Tree, paths ...string) {
+		expected := lookupAll(build(paths...))
+		for p, v := range lookupAll(tree) {
+			if v != expected[p] {
+				t.Errorf("unexpected value for %s: %v, expected: %v", p, v, expected[p])
+			}
+		}
+	}
+
+	original := build(paths...)
+	before := lookupAll(original)
+
+	tree := &Tree{}
+	for _, p := range paths {
+		var err error
+		if tree, err = tree.Set(p, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkTree(t, tree, paths...)
+
+	var remaining []string
+	for i, p := range paths {
+		if i%2 == 0 {
+			remaining = append(remaining, p)
+			continue
+		}
+
+		tree = tree.Delete(p)
+		original = original.Delete(p)
+	}
+
+	checkTree(t, tree, remaining...)
+	checkTree(t, original, remaining...)
+
+	tree = tree.Delete("/not/existing")
+	checkTree(t, tree, remaining...)
+
+	// the catch-all name can change after deleting the path
+	tree = tree.Delete("/images/*path")
+	if tree, err := tree.Set("/images/*other", "/images/*other"); err != nil {
+		t.Fatal(err)
+	} else if v, _ := tree.Lookup("/images/foo/bar.jpg"); v != "/images/*other" {
+		t.Errorf("unexpected value: %v", v)
+	}
+
+	if _, err := tree.Set("/date/:year/:month/*other", "other"); err == nil {
+		t.Error("failed to fail on a conflicting catch-all")
+	}
+
+	for _, p := range paths {
+		tree = tree.Delete(p)
+	}
+
+	if v, _ := tree.Lookup("/"); v != nil {
+		t.Errorf("unexpected value in empty tree: %v", v)
+	}
+
+	// the original tree is not changed by the copies
+	original = build(paths...)
+	for _, p := range paths {
+		original.Delete(p)
+		if _, err := original.Set(p, "changed"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for p, v := range lookupAll(original) {
+		if v != before[p] {
+			t.Errorf("original tree changed for %s: %v, expected: %v", p, v, before[p])
+		}
+	}
+}
+
 func BenchmarkTreeNullRequest(b *testing.B) {
 	b.ReportAllocs()
 	tree := &node{path: "/"}
@@ -43,4 +43,7 @@ const (
 	ClientIPName              = "ClientIP"
 	TeeName                   = "Tee"
 	TrafficName               = "Traffic"
+	SNIName                   = "SNI"
+	OrName                    = "Or"
+	NotName                   = "Not"
 )
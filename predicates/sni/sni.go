@@ -0,0 +1,106 @@
+/*
+Package sni implements the SNI predicate, that matches the TLS
+passthrough connections by the server name received in the TLS
+ClientHello.
+
+The predicate matches only the requests created with NewRequest, that
+are used to look up the routes of the TLS passthrough connections, and
+never the HTTP requests. The server names are compared case insensitive,
+and a name starting with "*." matches a single label of subdomains.
+
+Examples:
+
+	db: SNI("db.example.org") -> "tcp://10.0.0.5:5432";
+	mtls: SNI("*.mtls.example.org") -> <roundRobin, "tcp://10.0.1.1:443", "tcp://10.0.1.2:443">;
+*/
+package sni
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/zalando/skipper/predicates"
+	"github.com/zalando/skipper/routing"
+)
+
+type contextKey struct{}
+
+type spec struct{}
+
+type predicate struct {
+	names []string
+}
+
+// New creates the specification of the SNI predicate.
+func New() routing.PredicateSpec { return &spec{} }
+
+func (*spec) Name() string { return predicates.SNIName }
+
+func (*spec) Create(args []interface{}) (routing.Predicate, error) {
+	if len(args) == 0 {
+		return nil, predicates.ErrInvalidPredicateParameters
+	}
+
+	p := &predicate{}
+	for _, a := range args {
+		name, ok := a.(string)
+		if !ok || name == "" {
+			return nil, predicates.ErrInvalidPredicateParameters
+		}
+
+		p.names = append(p.names, strings.ToLower(name))
+	}
+
+	return p, nil
+}
+
+// NewRequest creates the request used to look up the route of a TLS
+// passthrough connection. The host of the request is the server name,
+// so the Host predicates match, too.
+func NewRequest(serverName, remoteAddr string) *http.Request {
+	r := &http.Request{
+		Method:     http.MethodConnect,
+		URL:        &url.URL{Path: "/"},
+		Host:       serverName,
+		Header:     make(http.Header),
+		RemoteAddr: remoteAddr,
+		TLS:        &tls.ConnectionState{ServerName: serverName},
+	}
+
+	return r.WithContext(context.WithValue(context.Background(), contextKey{}, serverName))
+}
+
+// ServerName returns the server name of a request created with
+// NewRequest, and false for the other requests.
+func ServerName(r *http.Request) (string, bool) {
+	name, ok := r.Context().Value(contextKey{}).(string)
+	return name, ok
+}
+
+func matchName(pattern, name string) bool {
+	if !strings.HasPrefix(pattern, "*.") {
+		return pattern == name
+	}
+
+	i := strings.IndexByte(name, '.')
+	return i > 0 && name[i:] == pattern[1:]
+}
+
+func (p *predicate) Match(r *http.Request) bool {
+	name, ok := ServerName(r)
+	if !ok {
+		return false
+	}
+
+	name = strings.ToLower(name)
+	for _, pattern := range p.names {
+		if matchName(pattern, name) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,90 @@
+package sni
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSNIArgs(t *testing.T) {
+	s := New()
+	for _, args := range [][]interface{}{
+		{},
+		{""},
+		{1.2},
+		{"db.example.org", 3.4},
+	} {
+		if _, err := s.Create(args); err == nil {
+			t.Errorf("expected error for arguments: %v", args)
+		}
+	}
+}
+
+func TestSNIMatch(t *testing.T) {
+	s := New()
+	for _, tc := range []struct {
+		name  string
+		args  []interface{}
+		match bool
+	}{{
+		name:  "db.example.org",
+		args:  []interface{}{"db.example.org"},
+		match: true,
+	}, {
+		name:  "DB.Example.org",
+		args:  []interface{}{"db.example.ORG"},
+		match: true,
+	}, {
+		name:  "db.example.org",
+		args:  []interface{}{"api.example.org", "db.example.org"},
+		match: true,
+	}, {
+		name:  "db.example.org",
+		args:  []interface{}{"example.org"},
+		match: false,
+	}, {
+		name:  "db.example.org",
+		args:  []interface{}{"*.example.org"},
+		match: true,
+	}, {
+		name:  "example.org",
+		args:  []interface{}{"*.example.org"},
+		match: false,
+	}, {
+		name:  "a.db.example.org",
+		args:  []interface{}{"*.example.org"},
+		match: false,
+	}, {
+		name:  "",
+		args:  []interface{}{"*.example.org"},
+		match: false,
+	}} {
+		p, err := s.Create(tc.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if m := p.Match(NewRequest(tc.name, "127.0.0.1:56324")); m != tc.match {
+			t.Errorf("unexpected match for %q with %v: %t", tc.name, tc.args, m)
+		}
+	}
+}
+
+func TestSNIDoesNotMatchHTTP(t *testing.T) {
+	p, err := New().Create([]interface{}{"db.example.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := http.NewRequest("GET", "https://db.example.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Match(r) {
+		t.Error("unexpected match of an HTTP request")
+	}
+
+	if _, ok := ServerName(r); ok {
+		t.Error("unexpected server name of an HTTP request")
+	}
+}
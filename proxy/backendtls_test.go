@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/filters/backendtls"
+	"github.com/zalando/skipper/filters/builtin"
+)
+
+type testSecrets struct {
+	mu      sync.Mutex
+	secrets map[string][]byte
+}
+
+func (s *testSecrets) GetSecret(name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.secrets[name]
+	return b, ok
+}
+
+func (s *testSecrets) set(name string, b []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.secrets[name] = b
+}
+
+func (*testSecrets) Close() {}
+
+func testClientCert(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder})
+}
+
+// mtlsBackend starts a backend requiring a client certificate, and
+// returns it together with its CA in PEM format.
+func mtlsBackend(t *testing.T, clientCert []byte, protocol string) (*httptest.Server, []byte) {
+	block, _ := pem.Decode(clientCert)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.TLS.PeerCertificates[0].Subject.CommonName, r.Proto)
+	}))
+
+	backend.EnableHTTP2 = protocol == "h2"
+	backend.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	backend.StartTLS()
+
+	return backend, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: backend.Certificate().Raw})
+}
+
+func getBody(u string) (*http.Response, string, error) {
+	rsp, err := http.Get(u)
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer rsp.Body.Close()
+	b, err := io.ReadAll(rsp.Body)
+	return rsp, string(b), err
+}
+
+func TestBackendTLS(t *testing.T) {
+	for _, protocol := range []string{"http1", "h2"} {
+		t.Run(protocol, func(t *testing.T) {
+			cert, key := testClientCert(t)
+			backend, ca := mtlsBackend(t, cert, protocol)
+			defer backend.Close()
+
+			sr := &testSecrets{secrets: map[string][]byte{"cert": cert, "key": key, "ca": ca}}
+			fr := builtin.MakeRegistry()
+			fr.Register(backendtls.New(sr))
+
+			doc := fmt.Sprintf(`
+				mtls: Path("/mtls") -> backendProtocol("%[1]s") -> backendTLS("cert", "key", "ca", "example.com") -> "%[2]s";
+				default: Path("/default") -> backendProtocol("%[1]s") -> "%[2]s";
+			`, protocol, backend.URL)
+
+			tp, err := newTestProxyWithFilters(fr, doc, FlagsNone)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer tp.close()
+			ps := httptest.NewServer(tp.proxy)
+			defer ps.Close()
+
+			expectedProto := "HTTP/1.1"
+			if protocol == "h2" {
+				expectedProto = "HTTP/2.0"
+			}
+
+			rsp, body, err := getBody(ps.URL + "/mtls")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rsp.StatusCode != http.StatusOK || body != "client "+expectedProto {
+				t.Fatalf("unexpected response: %d, %s", rsp.StatusCode, body)
+			}
+
+			// the default transport doesn't trust the backend
+			rsp, _, err = getBody(ps.URL + "/default")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rsp.StatusCode == http.StatusOK {
+				t.Fatal("failed to fail")
+			}
+
+			// rotating to a certificate not trusted by the backend
+			cert, key = testClientCert(t)
+			sr.set("cert", cert)
+			sr.set("key", key)
+
+			rsp, _, err = getBody(ps.URL + "/mtls")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rsp.StatusCode == http.StatusOK {
+				t.Fatal("failed to fail")
+			}
+
+			if n := tp.proxy.routeTransports.len(); n != 2 {
+				t.Fatalf("unexpected number of transports: %d", n)
+			}
+
+			// only the transport of the current TLS material is
+			// referenced by the route
+			tp.proxy.routeTransports.cleanup(referencedTransports(tp.routing.Get().Routes()))
+			if n := tp.proxy.routeTransports.len(); n != 1 {
+				t.Errorf("failed to drop the transport of the rotated certificate: %d", n)
+			}
+
+			tp.proxy.routeTransports.cleanup(referencedTransports(nil))
+			if n := tp.proxy.routeTransports.len(); n != 0 {
+				t.Errorf("failed to drop the unreferenced transports: %d", n)
+			}
+		})
+	}
+}
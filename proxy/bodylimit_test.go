@@ -0,0 +1,202 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/metrics/metricstest"
+)
+
+// chunkedReader hides the size of the body from the http client.
+type chunkedReader struct{ io.Reader }
+
+// readBody reads the request body in the request phase, and counts the
+// read bytes
+type readBody struct{ read int64 }
+
+func (*readBody) Name() string                                         { return "readBody" }
+func (r *readBody) CreateFilter([]interface{}) (filters.Filter, error) { return r, nil }
+func (*readBody) Response(filters.FilterContext)                       {}
+
+func (r *readBody) Request(ctx filters.FilterContext) {
+	n, _ := io.Copy(io.Discard, ctx.Request().Body)
+	atomic.AddInt64(&r.read, n)
+}
+
+func TestMaxRequestBodySize(t *testing.T) {
+	var served int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+
+		atomic.AddInt32(&served, 1)
+		w.Write(b)
+	}))
+	defer backend.Close()
+
+	doc := fmt.Sprintf(`
+		global: Path("/global") -> "%[1]s";
+		route: Path("/route") -> maxRequestBodySize(16) -> "%[1]s";
+		sed: Path("/sed") -> maxRequestBodySize(16) -> sedRequest("o", "0") -> "%[1]s";
+	`, backend.URL)
+
+	tp, err := newTestProxyWithParams(doc, Params{MaxRequestBodySize: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tp.close()
+	m := &metricstest.MockMetrics{}
+	tp.proxy.metrics = countingMetrics{Metrics: metrics.Void, mock: m}
+
+	ps := httptest.NewServer(tp.proxy)
+	defer ps.Close()
+
+	for _, tt := range []struct {
+		name     string
+		path     string
+		body     string
+		chunked  bool
+		status   int
+		response string
+		rejected string
+	}{{
+		name:     "global limit, within",
+		path:     "/global",
+		body:     strings.Repeat("x", 64),
+		status:   http.StatusOK,
+		response: strings.Repeat("x", 64),
+	}, {
+		name:     "global limit, content length",
+		path:     "/global",
+		body:     strings.Repeat("x", 65),
+		status:   http.StatusRequestEntityTooLarge,
+		rejected: "global",
+	}, {
+		name:     "global limit, chunked",
+		path:     "/global",
+		body:     strings.Repeat("x", 1<<20),
+		chunked:  true,
+		status:   http.StatusRequestEntityTooLarge,
+		rejected: "global",
+	}, {
+		name:     "route limit, within",
+		path:     "/route",
+		body:     "Hello, world!",
+		chunked:  true,
+		status:   http.StatusOK,
+		response: "Hello, world!",
+	}, {
+		name:     "route limit, content length",
+		path:     "/route",
+		body:     strings.Repeat("x", 17),
+		status:   http.StatusRequestEntityTooLarge,
+		rejected: "route",
+	}, {
+		name:     "route limit, chunked",
+		path:     "/route",
+		body:     strings.Repeat("x", 1<<20),
+		chunked:  true,
+		status:   http.StatusRequestEntityTooLarge,
+		rejected: "route",
+	}, {
+		name:     "sed, within",
+		path:     "/sed",
+		body:     "Hello, world!",
+		chunked:  true,
+		status:   http.StatusOK,
+		response: "Hell0, w0rld!",
+	}, {
+		name:     "sed, chunked",
+		path:     "/sed",
+		body:     strings.Repeat("Hello, world!", 1<<16),
+		chunked:  true,
+		status:   http.StatusRequestEntityTooLarge,
+		rejected: "sed",
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&served, 0)
+
+			var body io.Reader = strings.NewReader(tt.body)
+			if tt.chunked {
+				body = chunkedReader{body}
+			}
+
+			rsp, err := http.Post(ps.URL+tt.path, "text/plain", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer rsp.Body.Close()
+			b, err := io.ReadAll(rsp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rsp.StatusCode != tt.status {
+				t.Fatalf("unexpected status, expected: %d, got: %d", tt.status, rsp.StatusCode)
+			}
+
+			if tt.response != "" && string(b) != tt.response {
+				t.Errorf("unexpected response: %s", b)
+			}
+
+			if tt.rejected == "" {
+				return
+			}
+
+			if atomic.LoadInt32(&served) != 0 {
+				t.Error("the backend received the oversized body")
+			}
+
+			m.WithCounters(func(c map[string]int64) {
+				if c["requestbodytoolarge."+tt.rejected] == 0 {
+					t.Errorf("rejection not counted: %v", c)
+				}
+			})
+		})
+	}
+}
+
+func TestMaxRequestBodySizeSkipsFilters(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer backend.Close()
+
+	fr := builtin.MakeRegistry()
+	rb := &readBody{}
+	fr.Register(rb)
+
+	doc := fmt.Sprintf(`* -> maxRequestBodySize(16) -> readBody() -> "%s"`, backend.URL)
+	tp, err := newTestProxyWithFiltersAndParams(fr, doc, Params{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tp.close()
+	ps := httptest.NewServer(tp.proxy)
+	defer ps.Close()
+
+	rsp, err := http.Post(ps.URL, "text/plain", strings.NewReader(strings.Repeat("x", 1<<10)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("unexpected status: %d", rsp.StatusCode)
+	}
+
+	if n := atomic.LoadInt64(&rb.read); n != 0 {
+		t.Errorf("the filter read the oversized body: %d", n)
+	}
+}
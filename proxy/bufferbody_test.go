@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bodyBackend struct {
+	*httptest.Server
+	bodies chan string
+}
+
+func newBodyBackend(statuses ...int) *bodyBackend {
+	b := &bodyBackend{bodies: make(chan string, 16)}
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		b.bodies <- string(body)
+
+		status := http.StatusOK
+		if len(statuses) > 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+
+		w.WriteHeader(status)
+	}))
+
+	return b
+}
+
+func (b *bodyBackend) receive(t *testing.T) string {
+	select {
+	case body := <-b.bodies:
+		return body
+	case <-time.After(time.Second):
+		t.Fatal("timeout while waiting for the backend request")
+		return ""
+	}
+}
+
+func postChunked(t *testing.T, u, body string) *http.Response {
+	// the reader hides the length of the body, so that it is sent
+	// chunked
+	rsp, err := http.Post(u, "text/plain", io.MultiReader(strings.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsp.Body.Close()
+	return rsp
+}
+
+func TestBufferedBodyRetry(t *testing.T) {
+	const body = "Hello, world!"
+	backend := newBodyBackend(http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	defer backend.Close()
+
+	doc := fmt.Sprintf(`* -> bufferRequestBody(1024) -> retry(3, "503", "", 0, 0, 0) -> "%s"`, backend.URL)
+	tp, err := newTestProxy(doc, FlagsNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tp.close()
+	ps := httptest.NewServer(tp.proxy)
+	defer ps.Close()
+
+	if rsp := postChunked(t, ps.URL, body); rsp.StatusCode != http.StatusOK {
+		t.Errorf("failed to retry, got: %d", rsp.StatusCode)
+	}
+
+	for i := 0; i < 3; i++ {
+		if b := backend.receive(t); b != body {
+			t.Errorf("invalid body of attempt %d: %s", i+1, b)
+		}
+	}
+}
+
+func TestBufferedBodyLoopback(t *testing.T) {
+	const body = "Hello, world!"
+	backend := newBodyBackend()
+	defer backend.Close()
+
+	doc := fmt.Sprintf(`
+		entry: Path("/entry") -> bufferRequestBody(1024) -> setPath("/backend") -> <loopback>;
+		main: Path("/backend") -> "%s";
+	`, backend.URL)
+
+	tp, err := newTestProxy(doc, FlagsNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tp.close()
+	ps := httptest.NewServer(tp.proxy)
+	defer ps.Close()
+
+	if rsp := postChunked(t, ps.URL+"/entry", body); rsp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status: %d", rsp.StatusCode)
+	}
+
+	if b := backend.receive(t); b != body {
+		t.Errorf("invalid body: %s", b)
+	}
+}
+
+func TestBufferedBodyTeeLoopback(t *testing.T) {
+	const body = "Hello, world!"
+	main := newBodyBackend()
+	defer main.Close()
+
+	shadow := newBodyBackend()
+	defer shadow.Close()
+
+	doc := fmt.Sprintf(`
+		main: * -> bufferRequestBody(1024, 4) -> teeLoopback("shadow") -> "%s";
+		shadow: Tee("shadow") -> "%s";
+	`, main.URL, shadow.URL)
+
+	tp, err := newTestProxy(doc, FlagsNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tp.close()
+	ps := httptest.NewServer(tp.proxy)
+	defer ps.Close()
+
+	for i := 0; i < 3; i++ {
+		if rsp := postChunked(t, ps.URL, body); rsp.StatusCode != http.StatusOK {
+			t.Errorf("unexpected status: %d", rsp.StatusCode)
+		}
+
+		if b := main.receive(t); b != body {
+			t.Errorf("invalid body of the main request: %s", b)
+		}
+
+		if b := shadow.receive(t); b != body {
+			t.Errorf("invalid body of the shadow request: %s", b)
+		}
+	}
+}
+
+func TestBufferedBodyOversized(t *testing.T) {
+	const body = "Hello, world!"
+	backend := newBodyBackend()
+	defer backend.Close()
+
+	doc := fmt.Sprintf(`
+		reject: Path("/reject") -> bufferRequestBody(4) -> "%s";
+		stream: Path("/stream") -> bufferRequestBody(4, 0, "stream") -> "%s";
+	`, backend.URL, backend.URL)
+
+	tp, err := newTestProxy(doc, FlagsNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tp.close()
+	ps := httptest.NewServer(tp.proxy)
+	defer ps.Close()
+
+	if rsp := postChunked(t, ps.URL+"/reject", body); rsp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("failed to reject the request, got: %d", rsp.StatusCode)
+	}
+
+	if rsp := postChunked(t, ps.URL+"/stream", body); rsp.StatusCode != http.StatusOK {
+		t.Errorf("failed to stream the request, got: %d", rsp.StatusCode)
+	}
+
+	if b := backend.receive(t); b != body {
+		t.Errorf("invalid body: %s", b)
+	}
+
+	if len(backend.bodies) != 0 {
+		t.Error("unexpected backend request")
+	}
+}
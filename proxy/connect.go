@@ -0,0 +1,223 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const connectEstablished = "HTTP/1.1 200 Connection Established\r\n\r\n"
+
+var (
+	errConnectNotAllowed     = errors.New("CONNECT destination not allowed")
+	errConnectInvalidTarget  = errors.New("invalid CONNECT target")
+	errConnectNotSupported   = errors.New("CONNECT is supported only over HTTP/1")
+	errConnectUnsupportedURL = errors.New("unsupported upstream proxy scheme")
+)
+
+// connectDestination is an entry of the CONNECT allowlist. The host
+// starting with "*." matches the subdomains, the host "*" matches any
+// host, and the port "*" or an empty port matches any port.
+type connectDestination struct {
+	host string
+	port string
+}
+
+// connectBody closes the connection of the upstream proxy together
+// with the response body, when the upstream proxy rejected the tunnel.
+type connectBody struct {
+	io.ReadCloser
+	conn net.Conn
+}
+
+func (b connectBody) Close() error {
+	b.conn.Close()
+	return b.ReadCloser.Close()
+}
+
+func parseConnectAllowlist(entries []string) []connectDestination {
+	var d []connectDestination
+	for _, e := range entries {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e == "" {
+			continue
+		}
+
+		host, port, err := net.SplitHostPort(e)
+		if err != nil {
+			host, port = strings.Trim(e, "[]"), ""
+		}
+
+		d = append(d, connectDestination{host: host, port: port})
+	}
+
+	return d
+}
+
+func (d connectDestination) match(host, port string) bool {
+	if d.port != "" && d.port != "*" && d.port != port {
+		return false
+	}
+
+	if d.host == "*" {
+		return true
+	}
+
+	if strings.HasPrefix(d.host, "*.") {
+		return strings.HasSuffix(host, d.host[1:])
+	}
+
+	return d.host == host
+}
+
+// connectAllowed checks the destination of a tunnel. When the allowlist
+// is empty, no destination is allowed, to avoid opening tunnels to
+// arbitrary destinations through the dynamic backends.
+func (p *Proxy) connectAllowed(destination string) bool {
+	host, port, err := net.SplitHostPort(destination)
+	if err != nil {
+		return false
+	}
+
+	host = strings.ToLower(host)
+	for _, d := range p.connectAllowlist {
+		if d.match(host, port) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isConnectRequest(r *http.Request) bool {
+	return r.Method == http.MethodConnect
+}
+
+func (p *Proxy) connectMetricsKey(routeID, key string) string {
+	return "connect." + routeID + "." + key
+}
+
+// makeConnectRequest opens the tunnel of a CONNECT request, after the
+// request filters of the route were executed. The tunnel is opened to
+// the requested destination for the dynamic backends, or to the backend
+// of the route. When the route contains the backendIsProxy filter, the
+// CONNECT request is forwarded to the backend as an upstream proxy.
+//
+// It returns a response only when the upstream proxy rejected the
+// tunnel, otherwise, when the tunnel was opened, it returns a handled
+// error.
+func (p *Proxy) makeConnectRequest(ctx *context) (*http.Response, *proxyError) {
+	if ctx.request.ProtoMajor != 1 {
+		return nil, &proxyError{err: errConnectNotSupported, code: http.StatusHTTPVersionNotSupported}
+	}
+
+	if _, _, err := net.SplitHostPort(ctx.request.Host); err != nil {
+		return nil, &proxyError{err: errConnectInvalidTarget, code: http.StatusBadRequest}
+	}
+
+	req, endpoint, err := mapRequest(ctx, ctx.request.Context(), p.flags.HopHeadersRemoval())
+	if err != nil {
+		return nil, &proxyError{err: err, code: http.StatusBadRequest}
+	}
+
+	upstream, err := proxyFromHeader(req)
+	if err != nil {
+		return nil, &proxyError{err: err, code: http.StatusBadGateway}
+	}
+
+	destination := canonicalAddr(req.URL)
+	if !p.connectAllowed(destination) {
+		p.metrics.IncCounter("connect.notallowed")
+		return nil, &proxyError{err: errConnectNotAllowed, code: http.StatusForbidden}
+	}
+
+	if endpoint != nil {
+		endpoint.Metrics.IncInflightRequest()
+		defer endpoint.Metrics.DecInflightRequest()
+	}
+
+	ctx.routingTraceHop.endpoint(destination)
+	var backendConn net.Conn
+	if upstream != nil {
+		if upstream.Scheme != "http" && upstream.Scheme != "https" {
+			return nil, &proxyError{err: errConnectUnsupportedURL, code: http.StatusBadGateway}
+		}
+
+		up := &upgradeProxy{
+			backendAddr:     upstream,
+			tlsClientConfig: p.clientTLS,
+			insecure:        p.flags.Insecure(),
+		}
+
+		backendConn, err = up.dialBackend(&http.Request{URL: upstream})
+	} else {
+		backendConn, err = p.connectDialer.DialContext(ctx.request.Context(), "tcp", destination)
+	}
+
+	if err != nil {
+		p.metrics.IncErrorsBackend(ctx.route.Id)
+		return nil, &proxyError{err: err, code: http.StatusBadGateway}
+	}
+
+	backendReader := bufio.NewReader(backendConn)
+	var response []byte
+	if upstream == nil {
+		response = []byte(connectEstablished)
+	} else {
+		req.Host = destination
+		if err := req.Write(backendConn); err != nil {
+			backendConn.Close()
+			return nil, &proxyError{err: err, code: http.StatusBadGateway}
+		}
+
+		rsp, err := http.ReadResponse(backendReader, req)
+		if err != nil {
+			backendConn.Close()
+			return nil, &proxyError{err: err, code: http.StatusBadGateway}
+		}
+
+		if rsp.StatusCode != http.StatusOK {
+			rsp.Body = connectBody{ReadCloser: rsp.Body, conn: backendConn}
+			return rsp, nil
+		}
+
+		// the tunnel has no body, only the status line and the headers
+		// are passed on to the client
+		rsp.Body.Close()
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "HTTP/1.1 %s\r\n", rsp.Status)
+		rsp.Header.Write(&b)
+		b.WriteString("\r\n")
+		response = b.Bytes()
+	}
+
+	defer backendConn.Close()
+	clientConn, clientReadWriter, err := ctx.responseWriter.(http.Hijacker).Hijack()
+	if err != nil {
+		return nil, &proxyError{err: err}
+	}
+
+	defer clientConn.Close()
+
+	// NOTE: from this point forward, we own the connection and we can't
+	// use the response writer any more
+	ctx.successfulUpgrade = true
+	ctx.tunnelStatusCode = http.StatusOK
+	if _, err := clientConn.Write(response); err != nil {
+		p.log.Errorf("Error writing the CONNECT response to the client: %v", err)
+		return nil, &proxyError{handled: true}
+	}
+
+	p.metrics.IncCounter(p.connectMetricsKey(ctx.route.Id, "connections"))
+	received, sent := tunnel(clientConn, clientReadWriter.Reader, clientConn, backendConn, backendReader)
+	ctx.tunnelBytesSent = sent
+	p.metrics.IncCounterBy(p.connectMetricsKey(ctx.route.Id, "bytes.received"), received)
+	p.metrics.IncCounterBy(p.connectMetricsKey(ctx.route.Id, "bytes.sent"), sent)
+	p.log.Debugf("finished CONNECT tunnel to %s", destination)
+	return nil, &proxyError{handled: true}
+}
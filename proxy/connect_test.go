@@ -0,0 +1,280 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/metrics/metricstest"
+)
+
+// startEchoServer starts a TCP server, that responds to each line with
+// the prefix and the line.
+func startEchoServer(t *testing.T, prefix string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+
+					fmt.Fprintf(c, "%s%s", prefix, line)
+				}
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+// startUpstreamProxy starts a forward proxy accepting the CONNECT
+// requests with the expected authorization header, and tunnelling them
+// to an echo server, responding with the received authority.
+func startUpstreamProxy(t *testing.T, authorization string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				req, err := http.ReadRequest(r)
+				if err != nil {
+					return
+				}
+
+				if req.Method != http.MethodConnect || req.Header.Get("Authorization") != authorization {
+					io.WriteString(c, "HTTP/1.1 407 Proxy Authentication Required\r\nContent-Length: 6\r\n\r\ndenied")
+					return
+				}
+
+				io.WriteString(c, "HTTP/1.1 200 Connection established\r\nX-Upstream: true\r\n\r\n")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+
+					fmt.Fprintf(c, "upstream %s %s", req.Host, line)
+				}
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+// connect sends a CONNECT request through the proxy, and when the
+// tunnel is established, it sends a line and returns the received line.
+func connect(t *testing.T, proxyAddr, target string) (*http.Response, string) {
+	c, err := net.Dial("tcp", proxyAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(3 * time.Second))
+	fmt.Fprintf(c, "CONNECT %[1]s HTTP/1.1\r\nHost: %[1]s\r\n\r\n", target)
+
+	r := bufio.NewReader(c)
+	req := &http.Request{Method: http.MethodConnect}
+	rsp, err := http.ReadResponse(r, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		return rsp, string(b)
+	}
+
+	if _, err := io.WriteString(c, "hello\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rsp, line
+}
+
+func TestConnect(t *testing.T) {
+	direct := startEchoServer(t, "direct ")
+	fixed := startEchoServer(t, "fixed ")
+	upstream := startUpstreamProxy(t, "Bearer token")
+
+	doc := fmt.Sprintf(`
+		direct: Method("CONNECT") && Host("^direct[.]example[.]org:443$")
+			-> setDynamicBackendHost("%s")
+			-> <dynamic>;
+		fixed: Method("CONNECT") && Host("^fixed[.]example[.]org:443$")
+			-> "http://%s";
+		upstream: Method("CONNECT") && Host("^upstream[.]example[.]org:443$")
+			-> backendIsProxy()
+			-> setRequestHeader("Authorization", "Bearer token")
+			-> "http://%s";
+		denied: Method("CONNECT") && Host("^denied[.]example[.]org:443$")
+			-> backendIsProxy()
+			-> "http://%s";
+		unauthorized: Method("CONNECT") && Host("^unauthorized[.]example[.]org:443$")
+			-> status(401)
+			-> <shunt>;
+	`, direct, fixed, upstream, upstream)
+
+	tp, err := newTestProxyWithParams(doc, Params{
+		EnableConnect:    true,
+		ConnectAllowlist: []string{"127.0.0.1:*", "upstream.example.org:443", "*.example.org:8443"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tp.close()
+	m := &metricstest.MockMetrics{}
+	tp.proxy.metrics = countingMetrics{Metrics: metrics.Void, mock: m}
+
+	ps := httptest.NewServer(tp.proxy)
+	defer ps.Close()
+	proxyAddr := strings.TrimPrefix(ps.URL, "http://")
+
+	for _, tt := range []struct {
+		title    string
+		target   string
+		status   int
+		expected string
+	}{{
+		title:    "dynamic backend",
+		target:   "direct.example.org:443",
+		status:   http.StatusOK,
+		expected: "direct hello\n",
+	}, {
+		title:    "network backend",
+		target:   "fixed.example.org:443",
+		status:   http.StatusOK,
+		expected: "fixed hello\n",
+	}, {
+		title:    "upstream proxy",
+		target:   "upstream.example.org:443",
+		status:   http.StatusOK,
+		expected: "upstream upstream.example.org:443 hello\n",
+	}, {
+		title:    "not in the allowlist",
+		target:   "denied.example.org:443",
+		status:   http.StatusForbidden,
+		expected: "Forbidden",
+	}, {
+		title:  "rejected by a filter",
+		target: "unauthorized.example.org:443",
+		status: http.StatusUnauthorized,
+	}, {
+		title:  "no route",
+		target: "unknown.example.org:443",
+		status: http.StatusNotFound,
+	}} {
+		t.Run(tt.title, func(t *testing.T) {
+			rsp, body := connect(t, proxyAddr, tt.target)
+			if rsp.StatusCode != tt.status {
+				t.Fatalf("unexpected status: %d, expected: %d", rsp.StatusCode, tt.status)
+			}
+
+			if tt.expected != "" && !strings.HasPrefix(body, tt.expected) {
+				t.Errorf("unexpected response: %q, expected: %q", body, tt.expected)
+			}
+		})
+	}
+
+	waitForCounter(t, m, "connect.direct.bytes.sent", int64(len("direct hello\n")))
+	waitForCounter(t, m, "connect.direct.bytes.received", int64(len("hello\n")))
+	waitForCounter(t, m, "connect.upstream.connections", 1)
+	waitForCounter(t, m, "connect.notallowed", 1)
+}
+
+func TestConnectUpstreamRejects(t *testing.T) {
+	upstream := startUpstreamProxy(t, "Bearer token")
+	tp, err := newTestProxyWithParams(
+		fmt.Sprintf(`* -> backendIsProxy() -> "http://%s"`, upstream),
+		Params{EnableConnect: true, ConnectAllowlist: []string{"www.example.org:443"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tp.close()
+	ps := httptest.NewServer(tp.proxy)
+	defer ps.Close()
+
+	rsp, body := connect(t, strings.TrimPrefix(ps.URL, "http://"), "www.example.org:443")
+	if rsp.StatusCode != http.StatusProxyAuthRequired || body != "denied" {
+		t.Errorf("unexpected response: %d, %q", rsp.StatusCode, body)
+	}
+}
+
+func TestConnectAllowlist(t *testing.T) {
+	p := &Proxy{connectAllowlist: parseConnectAllowlist([]string{
+		"www.example.org:443",
+		"*.example.com:*",
+		"api.example.net",
+		"[2001:db8::1]:443",
+		" ",
+	})}
+
+	for destination, allowed := range map[string]bool{
+		"www.example.org:443":  true,
+		"WWW.Example.org:443":  true,
+		"www.example.org:8443": false,
+		"example.org:443":      false,
+		"a.b.example.com:22":   true,
+		"example.com:22":       false,
+		"api.example.net:9000": true,
+		"[2001:db8::1]:443":    true,
+		"[2001:db8::2]:443":    false,
+		"no-port.example.org":  false,
+	} {
+		if p.connectAllowed(destination) != allowed {
+			t.Errorf("unexpected allowlist check for %s, expected: %t", destination, allowed)
+		}
+	}
+
+	if (&Proxy{}).connectAllowed("any.example.org:443") {
+		t.Error("empty allowlist should reject all destinations")
+	}
+
+	allowAll := &Proxy{connectAllowlist: parseConnectAllowlist([]string{"*:*"})}
+	if !allowAll.connectAllowed("any.example.org:443") {
+		t.Error("failed to allow any destination")
+	}
+}
@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/metrics/metricstest"
+	"github.com/zalando/skipper/routing"
+)
+
+func TestBackendConnectionPool(t *testing.T) {
+	var (
+		connections, maxConnections int32
+		release                     = make(chan struct{})
+	)
+
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(300 * time.Millisecond)
+			return
+		}
+
+		<-release
+	}))
+
+	backend.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+		switch s {
+		case http.StateNew:
+			n := atomic.AddInt32(&connections, 1)
+			for {
+				max := atomic.LoadInt32(&maxConnections)
+				if n <= max || atomic.CompareAndSwapInt32(&maxConnections, max, n) {
+					break
+				}
+			}
+		case http.StateClosed, http.StateHijacked:
+			atomic.AddInt32(&connections, -1)
+		}
+	}
+
+	backend.Start()
+	defer backend.Close()
+
+	doc := fmt.Sprintf(`
+		pool1: Path("/pool1") -> backendConnectionPool(1) -> "%[1]s";
+		pool2: Path("/pool2") -> backendConnectionPool(1) -> "%[1]s";
+		slow: Path("/slow") -> backendConnectionPool(0, 0, 0, "50ms") -> "%[1]s";
+	`, backend.URL)
+
+	tp, err := newTestProxyWithParams(doc, Params{CloseIdleConnsPeriod: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tp.close()
+	m := &metricstest.MockMetrics{}
+	tp.proxy.metrics = countingMetrics{Metrics: metrics.Void, mock: m}
+
+	ps := httptest.NewServer(tp.proxy)
+	defer ps.Close()
+
+	const requests = 4
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rsp, _, err := getBody(fmt.Sprintf("%s/pool%d", ps.URL, i%2+1))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if rsp.StatusCode != http.StatusOK {
+				t.Errorf("unexpected status: %d", rsp.StatusCode)
+			}
+		}(i)
+	}
+
+	// waiting for all the requests to reach the proxy
+	time.Sleep(100 * time.Millisecond)
+
+	// the routes share the transport, but the in-flight requests are
+	// reported per route
+	checkInflight := func(route string, expected float64) {
+		if v, ok := m.Gauge("backendconnectionpool." + route + ".inflight"); !ok || v != expected {
+			t.Errorf("unexpected in-flight requests of %s: %v, expected: %v", route, v, expected)
+		}
+	}
+
+	checkInflight("pool1", requests/2)
+	checkInflight("pool2", requests/2)
+	close(release)
+	wg.Wait()
+	checkInflight("pool1", 0)
+	checkInflight("pool2", 0)
+
+	if n := atomic.LoadInt32(&maxConnections); n != 1 {
+		t.Errorf("unexpected number of the backend connections: %d", n)
+	}
+
+	m.WithCounters(func(c map[string]int64) {
+		if c["backendconnectionpool.pool1.saturated"]+c["backendconnectionpool.pool2.saturated"] != requests-1 {
+			t.Errorf("unexpected saturation counters: %v", c)
+		}
+	})
+
+	rsp, _, err := getBody(ps.URL + "/slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rsp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("failed to apply the response header timeout: %d", rsp.StatusCode)
+	}
+
+	// the routes with the same settings share the pool
+	if n := tp.proxy.routeTransports.len(); n != 2 {
+		t.Fatalf("unexpected number of transports: %d", n)
+	}
+
+	// the transports referenced by the routes are kept, also when idle
+	routes := tp.routing.Get().Routes()
+	tp.proxy.routeTransports.cleanup(referencedTransports(routes))
+	if n := tp.proxy.routeTransports.len(); n != 2 {
+		t.Fatalf("unexpected number of transports after cleanup: %d", n)
+	}
+
+	// removing the slow route drops its pool, the shared one is kept
+	var remaining []*routing.Route
+	for _, r := range routes {
+		if r.Id != "slow" {
+			remaining = append(remaining, r)
+		}
+	}
+
+	tp.proxy.routeTransports.cleanup(referencedTransports(remaining))
+	if n := tp.proxy.routeTransports.len(); n != 1 {
+		t.Errorf("failed to drop the transport of the removed route: %d", n)
+	}
+
+	tp.proxy.routeTransports.cleanup(referencedTransports(nil))
+	if n := tp.proxy.routeTransports.len(); n != 0 {
+		t.Errorf("failed to drop the unreferenced transports: %d", n)
+	}
+}
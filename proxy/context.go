@@ -11,6 +11,7 @@ import (
 
 	"github.com/opentracing/opentracing-go"
 	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/buffer"
 	"github.com/zalando/skipper/metrics"
 	"github.com/zalando/skipper/routing"
 )
@@ -30,6 +31,8 @@ type context struct {
 	deprecatedServed     bool
 	servedWithResponse   bool // to support the deprecated way independently
 	successfulUpgrade    bool
+	tunnelStatusCode     int
+	tunnelBytesSent      int64
 	pathParams           map[string]string
 	stateBag             map[string]interface{}
 	originalRequest      *http.Request
@@ -47,6 +50,12 @@ type context struct {
 	proxy                *Proxy
 	routeLookup          *routing.RouteLookup
 	cancelBackendContext stdlibcontext.CancelFunc
+	triedEndpoints       map[string]struct{}
+	grpcStatus           string
+	fallback             string
+	fallbackRoute        *routing.Route
+	routingTrace         *routingTrace
+	routingTraceHop      *routingTraceHop
 }
 
 type filterMetrics struct {
@@ -161,6 +170,21 @@ func (c *context) applyRoute(route *routing.Route, params map[string]string, pre
 	c.pathParams = appendParams(c.pathParams, params)
 }
 
+// addBackendContextCancel registers a cancel function to be called
+// together with the existing one, when the request was served.
+func (c *context) addBackendContextCancel(cancel stdlibcontext.CancelFunc) {
+	if c.cancelBackendContext == nil {
+		c.cancelBackendContext = cancel
+		return
+	}
+
+	previous := c.cancelBackendContext
+	c.cancelBackendContext = func() {
+		cancel()
+		previous()
+	}
+}
+
 func (c *context) ensureDefaultResponse() {
 	if c.response == nil {
 		c.response = defaultResponse(c.request)
@@ -276,6 +300,10 @@ func (c *context) Split() (filters.FilterContext, error) {
 
 func (c *context) Loopback() {
 	err := c.proxy.do(c)
+	if b, ok := c.request.Body.(*buffer.Body); ok {
+		b.Close()
+	}
+
 	if c.response != nil && c.response.Body != nil {
 		if _, err := io.Copy(io.Discard, c.response.Body); err != nil {
 			c.proxy.log.Errorf("context: error while discarding remainder response body: %v.", err)
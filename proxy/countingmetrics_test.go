@@ -0,0 +1,19 @@
+package proxy
+
+import (
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/metrics/metricstest"
+)
+
+// countingMetrics records only the counters and the gauges, and ignores
+// the rest
+type countingMetrics struct {
+	metrics.Metrics
+	mock *metricstest.MockMetrics
+}
+
+func (m countingMetrics) IncCounter(key string) { m.mock.IncCounter(key) }
+
+func (m countingMetrics) IncCounterBy(key string, value int64) { m.mock.IncCounterBy(key, value) }
+
+func (m countingMetrics) UpdateGauge(key string, value float64) { m.mock.UpdateGauge(key, value) }
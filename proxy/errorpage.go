@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/zalando/skipper/filters/errorpage"
+)
+
+func (ctx *context) routeID() string {
+	if ctx.route == nil {
+		return ""
+	}
+
+	return ctx.route.Id
+}
+
+// applyErrorPage replaces the body of the response with the error page of
+// the route, when one of its errorPage filters matches the status code.
+func (p *Proxy) applyErrorPage(ctx *context) {
+	rsp := ctx.response
+	page := errorpage.ForStatus(ctx.StateBag(), rsp.StatusCode)
+	if page == nil {
+		return
+	}
+
+	contentType, body, err := page.Render(ctx.Request(), errorpage.NewData(ctx.Request(), ctx.routeID(), rsp.StatusCode))
+	if err != nil {
+		p.log.Errorf("Failed to render the error page of route %s: %v", ctx.routeID(), err)
+		return
+	}
+
+	if rsp.Body != nil {
+		rsp.Body.Close()
+	}
+
+	rsp.Header.Del("Content-Encoding")
+	rsp.Header.Set("Content-Type", contentType)
+	rsp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	rsp.ContentLength = int64(len(body))
+	rsp.Body = io.NopCloser(bytes.NewReader(body))
+}
+
+// errorPageBody returns the content type and the body of the errors
+// generated by the proxy. It uses the error page of the route, or the
+// global one, when available, and plain text otherwise.
+func (p *Proxy) errorPageBody(ctx *context, code int) (string, []byte) {
+	page := errorpage.ForStatus(ctx.StateBag(), code)
+	if page == nil {
+		page = p.errorPages.ForStatus(code)
+	}
+
+	if page != nil {
+		contentType, body, err := page.Render(ctx.Request(), errorpage.NewData(ctx.Request(), ctx.routeID(), code))
+		if err == nil {
+			return contentType, body
+		}
+
+		p.log.Errorf("Failed to render the error page: %v", err)
+	}
+
+	return "text/plain; charset=utf-8", []byte(http.StatusText(code) + "\n")
+}
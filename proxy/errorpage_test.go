@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zalando/skipper/filters/errorpage"
+)
+
+func TestErrorPage(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/unavailable":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("backend error"))
+		case "/notfound":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("backend not found"))
+		}
+	}))
+	defer backend.Close()
+
+	closed := httptest.NewServer(nil)
+	closed.Close()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "404.html"), []byte("no route {{.FlowID}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	templates, err := errorpage.LoadTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := fmt.Sprintf(`
+		backend: PathRegexp("^/(unavailable|notfound)$")
+			-> errorPage("5xx", "<h1>{{.Status}} {{.RouteID}}</h1>")
+			-> "%s";
+		proxyError: Path("/closed")
+			-> errorPage("50x", "<h1>{{.Title}}</h1>")
+			-> "%s";
+	`, backend.URL, closed.URL)
+
+	tp, err := newTestProxyWithParams(doc, Params{ErrorPages: templates})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tp.close()
+	ps := httptest.NewServer(tp.proxy)
+	defer ps.Close()
+
+	for _, tt := range []struct {
+		path        string
+		accept      string
+		status      int
+		contentType string
+		body        string
+	}{{
+		path:        "/unavailable",
+		status:      http.StatusServiceUnavailable,
+		contentType: "text/html; charset=utf-8",
+		body:        "<h1>503 backend</h1>",
+	}, {
+		path:        "/unavailable",
+		accept:      "application/json",
+		status:      http.StatusServiceUnavailable,
+		contentType: "application/problem+json",
+		body:        `{"type":"about:blank","title":"Service Unavailable","status":503,"instance":"/unavailable","flowId":"flow42","routeId":"backend"}`,
+	}, {
+		path:        "/notfound",
+		status:      http.StatusNotFound,
+		contentType: "text/plain; charset=utf-8",
+		body:        "backend not found",
+	}, {
+		path:        "/closed",
+		status:      http.StatusBadGateway,
+		contentType: "text/html; charset=utf-8",
+		body:        "<h1>Bad Gateway</h1>",
+	}, {
+		path:        "/noroute",
+		status:      http.StatusNotFound,
+		contentType: "text/html; charset=utf-8",
+		body:        "no route flow42",
+	}} {
+		t.Run(tt.path+" "+tt.accept, func(t *testing.T) {
+			req, err := http.NewRequest("GET", ps.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("X-Flow-Id", "flow42")
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			rsp, err := http.DefaultTransport.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer rsp.Body.Close()
+			b, err := io.ReadAll(rsp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rsp.StatusCode != tt.status {
+				t.Errorf("unexpected status, expected: %d, got: %d", tt.status, rsp.StatusCode)
+			}
+
+			if ct := rsp.Header.Get("Content-Type"); ct != tt.contentType {
+				t.Errorf("unexpected content type, expected: %s, got: %s", tt.contentType, ct)
+			}
+
+			if rsp.Header.Get("Content-Encoding") != "" {
+				t.Error("unexpected content encoding")
+			}
+
+			if string(b) != tt.body {
+				t.Errorf("unexpected body, expected: %s, got: %s", tt.body, b)
+			}
+		})
+	}
+}
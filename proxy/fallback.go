@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	stdlibcontext "context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/retry"
+	"github.com/zalando/skipper/tracing"
+)
+
+// needsFallback decides whether the failed backend request, or the
+// response of the primary backend, triggers the fallback of the route.
+func needsFallback(ctx *context, fallback *retry.Fallback, rsp *http.Response, perr *proxyError) bool {
+	// the request body is not consumed, when the breaker is open
+	if perr == errCircuitBreakerOpen {
+		return true
+	}
+
+	if !isBodyReplayable(ctx.request) {
+		return false
+	}
+
+	if perr != nil {
+		return !perr.handled && perr.code != 499 && ctx.request.Context().Err() == nil
+	}
+
+	return fallback.FallbackStatus(rsp.StatusCode)
+}
+
+// makeFallbackRequest sends the request to the fallback backend, or it
+// executes the fallback route, the same way as a loopback.
+func (p *Proxy) makeFallbackRequest(ctx *context, fallback *retry.Fallback) (*http.Response, error) {
+	// the fallback of the route is applied only once, the fallback
+	// route can have its own, limited by the max loopbacks
+	delete(ctx.StateBag(), retry.FallbackKey)
+
+	if ctx.proxySpan != nil {
+		ctx.proxySpan.Finish()
+		ctx.proxySpan = nil
+	}
+
+	ctx.fallback = fallback.Target()
+	p.metrics.IncCounter("fallback." + ctx.route.Id)
+	p.tracing.setTag(ctx.initialSpan, FallbackTag, ctx.fallback)
+	tracing.LogKV("fallback", ctx.fallback, ctx.request.Context())
+
+	if fallback.URL != nil {
+		rsp, perr := p.makeFallbackURLRequest(ctx, fallback.URL)
+		if perr != nil {
+			return nil, perr
+		}
+
+		return rsp, nil
+	}
+
+	route := ctx.routeLookup.ByID(fallback.RouteID)
+	if route == nil {
+		return nil, &proxyError{
+			err:  fmt.Errorf("fallback route not found: %s", fallback.RouteID),
+			code: http.StatusBadGateway,
+		}
+	}
+
+	fallbackCtx := ctx.clone()
+	fallbackCtx.fallbackRoute = route
+	if err := p.do(fallbackCtx); err != nil {
+		return nil, err
+	}
+
+	ctx.proxySpan = fallbackCtx.proxySpan
+	return fallbackCtx.response, nil
+}
+
+func (p *Proxy) makeFallbackURLRequest(ctx *context, u *url.URL) (*http.Response, *proxyError) {
+	backendContext := ctx.request.Context()
+	if timeout, ok := ctx.StateBag()[filters.BackendTimeout]; ok {
+		var cancel stdlibcontext.CancelFunc
+		backendContext, cancel = stdlibcontext.WithTimeout(backendContext, timeout.(time.Duration))
+		ctx.addBackendContextCancel(cancel)
+	}
+
+	req, _, err := mapRequest(ctx, backendContext, p.flags.HopHeadersRemoval())
+	if err != nil {
+		return nil, &proxyError{err: fmt.Errorf("could not map fallback request: %w", err)}
+	}
+
+	// the outgoing host is kept only when it was preserved
+	if req.Host == ctx.route.Host {
+		req.Host = u.Host
+	}
+
+	req.URL.Scheme = u.Scheme
+	req.URL.Host = u.Host
+
+	backendStart := time.Now()
+	rsp, perr := p.sendBackendRequest(ctx, req, nil)
+	if perr != nil {
+		p.metrics.IncErrorsBackend(ctx.route.Id)
+		return nil, perr
+	}
+
+	p.metrics.MeasureBackendHost(u.Host, backendStart)
+	return rsp, nil
+}
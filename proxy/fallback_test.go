@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+
+	"github.com/zalando/skipper/circuit"
+)
+
+func fallbackBackend(name string, status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "%s %s %s", name, r.Host, b)
+	}))
+}
+
+func fallbackRequest(t *testing.T, method, u, body string) (int, string) {
+	req, err := http.NewRequest(method, u, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Host = "www.example.org"
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rsp.Body.Close()
+	b, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rsp.StatusCode, string(b)
+}
+
+func TestFallback(t *testing.T) {
+	unavailable := fallbackBackend("primary", http.StatusServiceUnavailable)
+	defer unavailable.Close()
+
+	notFound := fallbackBackend("primary", http.StatusNotFound)
+	defer notFound.Close()
+
+	backup := fallbackBackend("backup", http.StatusOK)
+	defer backup.Close()
+
+	refused := httptest.NewServer(nil)
+	refused.Close()
+
+	doc := fmt.Sprintf(`
+		backup: Header("X-Backup", "true") -> setResponseHeader("X-Backup-Route", "true") -> "%[1]s";
+		refusedToURL: Path("/refused-url") -> fallback("%[1]s") -> "%[2]s";
+		refusedToRoute: Path("/refused-route") -> fallback("backup") -> "%[2]s";
+		status: Path("/status") -> fallback("backup", 503) -> "%[3]s";
+		otherStatus: Path("/other-status") -> fallback("backup", 503) -> "%[4]s";
+		bufferedBody: Path("/buffered") -> bufferRequestBody(1024) -> fallback("backup", 503) -> "%[3]s";
+		unknownRoute: Path("/unknown-route") -> fallback("foo") -> "%[2]s";
+	`, backup.URL, refused.URL, unavailable.URL, notFound.URL)
+
+	tracer := mocktracer.New()
+	tp, err := newTestProxyWithParams(doc, Params{OpenTracing: &OpenTracingParams{Tracer: tracer}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tp.close()
+	ps := httptest.NewServer(tp.proxy)
+	defer ps.Close()
+
+	backupHost := strings.TrimPrefix(backup.URL, "http://")
+	for _, test := range []struct {
+		title    string
+		method   string
+		path     string
+		body     string
+		status   int
+		response string
+	}{{
+		title:    "connection refused, fallback URL",
+		method:   "GET",
+		path:     "/refused-url",
+		status:   http.StatusOK,
+		response: "backup " + backupHost + " ",
+	}, {
+		title:    "connection refused, fallback route",
+		method:   "GET",
+		path:     "/refused-route",
+		status:   http.StatusOK,
+		response: "backup " + backupHost + " ",
+	}, {
+		title:    "fallback on status",
+		method:   "GET",
+		path:     "/status",
+		status:   http.StatusOK,
+		response: "backup " + backupHost + " ",
+	}, {
+		title:    "no fallback on other status",
+		method:   "GET",
+		path:     "/other-status",
+		status:   http.StatusNotFound,
+		response: "primary " + strings.TrimPrefix(notFound.URL, "http://") + " ",
+	}, {
+		title:    "no fallback when the body was consumed",
+		method:   "POST",
+		path:     "/status",
+		body:     "Hello, world!",
+		status:   http.StatusServiceUnavailable,
+		response: "primary " + strings.TrimPrefix(unavailable.URL, "http://") + " Hello, world!",
+	}, {
+		title:    "fallback with buffered body",
+		method:   "POST",
+		path:     "/buffered",
+		body:     "Hello, world!",
+		status:   http.StatusOK,
+		response: "backup " + backupHost + " Hello, world!",
+	}, {
+		title:  "fallback route not found",
+		method: "GET",
+		path:   "/unknown-route",
+		status: http.StatusBadGateway,
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			status, body := fallbackRequest(t, test.method, ps.URL+test.path, test.body)
+			if status != test.status {
+				t.Errorf("unexpected status, expected: %d, got: %d", test.status, status)
+			}
+
+			if test.response != "" && body != test.response {
+				t.Errorf("unexpected response, expected: %q, got: %q", test.response, body)
+			}
+		})
+	}
+
+	// client may get response before proxy finishes span
+	time.Sleep(10 * time.Millisecond)
+
+	var fallbacks []interface{}
+	for _, s := range tracer.FinishedSpans() {
+		if f, ok := s.Tags()[FallbackTag]; ok {
+			fallbacks = append(fallbacks, f)
+		}
+	}
+
+	if len(fallbacks) != 5 {
+		t.Errorf("unexpected fallback tags: %v", fallbacks)
+	}
+}
+
+func TestFallbackOnOpenBreaker(t *testing.T) {
+	primary := fallbackBackend("primary", http.StatusInternalServerError)
+	defer primary.Close()
+
+	backup := fallbackBackend("backup", http.StatusOK)
+	defer backup.Close()
+
+	doc := fmt.Sprintf(`* -> consecutiveBreaker(1) -> fallback("%s") -> "%s"`, backup.URL, primary.URL)
+	tp, err := newTestProxyWithParams(doc, Params{CircuitBreakers: circuit.NewRegistry()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tp.close()
+	ps := httptest.NewServer(tp.proxy)
+	defer ps.Close()
+
+	// opens the breaker
+	if status, _ := fallbackRequest(t, "POST", ps.URL, "foo"); status != http.StatusInternalServerError {
+		t.Fatalf("unexpected status: %d", status)
+	}
+
+	// the body is not consumed by the open breaker
+	status, body := fallbackRequest(t, "POST", ps.URL, "bar")
+	if status != http.StatusOK || !strings.HasPrefix(body, "backup") || !strings.HasSuffix(body, " bar") {
+		t.Errorf("unexpected response: %d, %s", status, body)
+	}
+}
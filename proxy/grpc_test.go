@@ -0,0 +1,197 @@
+package proxy_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/proxy"
+	"github.com/zalando/skipper/proxy/proxytest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/status"
+)
+
+type echoService struct {
+	testpb.UnimplementedTestServiceServer
+}
+
+// FullDuplexCall echoes every message immediately, and finishes with
+// an error status when the client requests it.
+func (echoService) FullDuplexCall(stream testpb.TestService_FullDuplexCallServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if s := req.GetResponseStatus(); s != nil {
+			return status.Error(codes.Code(s.Code), s.Message)
+		}
+
+		if err := stream.Send(&testpb.StreamingOutputCallResponse{Payload: req.GetPayload()}); err != nil {
+			return err
+		}
+	}
+}
+
+func startGRPCBackend(t *testing.T) (string, *health.Server, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hs := health.NewServer()
+	s := grpc.NewServer()
+	healthpb.RegisterHealthServer(s, hs)
+	testpb.RegisterTestServiceServer(s, echoService{})
+	go s.Serve(l)
+
+	return "http://" + l.Addr().String(), hs, s.Stop
+}
+
+func dialGRPCProxy(t *testing.T, backend string) (*grpc.ClientConn, func()) {
+	r, err := eskip.Parse(fmt.Sprintf(`* -> backendProtocol("h2c") -> "%s"`, backend))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := proxytest.WithH2C(builtin.MakeRegistry(), proxy.Params{CloseIdleConnsPeriod: -time.Second}, r...)
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := grpc.Dial(u.Host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn, func() {
+		conn.Close()
+		p.Close()
+	}
+}
+
+func TestGRPCUnary(t *testing.T) {
+	backend, hs, stop := startGRPCBackend(t)
+	defer stop()
+
+	conn, closeProxy := dialGRPCProxy(t, backend)
+	defer closeProxy()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	hs.SetServingStatus("foo", healthpb.HealthCheckResponse_SERVING)
+	client := healthpb.NewHealthClient(conn)
+	rsp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rsp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("unexpected status: %v", rsp.Status)
+	}
+
+	// trailers-only response
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "bar"}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected not found status, got: %v", err)
+	}
+}
+
+func TestGRPCServerStreaming(t *testing.T) {
+	backend, hs, stop := startGRPCBackend(t)
+	defer stop()
+
+	conn, closeProxy := dialGRPCProxy(t, backend)
+	defer closeProxy()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	hs.SetServingStatus("foo", healthpb.HealthCheckResponse_SERVING)
+	watch, err := healthpb.NewHealthClient(conn).Watch(ctx, &healthpb.HealthCheckRequest{Service: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every update needs to arrive without the stream being closed
+	for _, expected := range []healthpb.HealthCheckResponse_ServingStatus{
+		healthpb.HealthCheckResponse_SERVING,
+		healthpb.HealthCheckResponse_NOT_SERVING,
+		healthpb.HealthCheckResponse_SERVING,
+	} {
+		rsp, err := watch.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rsp.Status != expected {
+			t.Fatalf("unexpected status, expected: %v, got: %v", expected, rsp.Status)
+		}
+
+		if expected == healthpb.HealthCheckResponse_SERVING {
+			hs.SetServingStatus("foo", healthpb.HealthCheckResponse_NOT_SERVING)
+		} else {
+			hs.SetServingStatus("foo", healthpb.HealthCheckResponse_SERVING)
+		}
+	}
+}
+
+func TestGRPCBidirectionalStreaming(t *testing.T) {
+	backend, _, stop := startGRPCBackend(t)
+	defer stop()
+
+	conn, closeProxy := dialGRPCProxy(t, backend)
+	defer closeProxy()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stream, err := testpb.NewTestServiceClient(conn).FullDuplexCall(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the echo of each message is received before the next one is sent
+	for i := 0; i < 3; i++ {
+		body := []byte(fmt.Sprintf("message %d", i))
+		if err := stream.Send(&testpb.StreamingOutputCallRequest{Payload: &testpb.Payload{Body: body}}); err != nil {
+			t.Fatal(err)
+		}
+
+		rsp, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(rsp.GetPayload().GetBody()) != string(body) {
+			t.Errorf("invalid echo: %s", rsp.GetPayload().GetBody())
+		}
+	}
+
+	// the status is received in the trailers
+	if err := stream.Send(&testpb.StreamingOutputCallRequest{
+		ResponseStatus: &testpb.EchoStatus{Code: int32(codes.Unavailable), Message: "going away"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = stream.Recv()
+	if s, ok := status.FromError(err); !ok || s.Code() != codes.Unavailable || s.Message() != "going away" {
+		t.Errorf("unexpected status: %v", err)
+	}
+}
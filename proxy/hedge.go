@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	stdlibcontext "context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters/retry"
+	"github.com/zalando/skipper/tracing"
+)
+
+type hedgeResult struct {
+	ctx     *context
+	rsp     *http.Response
+	perr    *proxyError
+	cancel  stdlibcontext.CancelFunc
+	attempt int
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func hedgeable(ctx *context, experimentalUpgrade bool) bool {
+	req := ctx.Request()
+	return ctx.route.BackendType == eskip.LBBackend &&
+		len(ctx.route.LBEndpoints) > 1 &&
+		isIdempotent(req.Method) &&
+		isBodyReplayable(req) &&
+		!(experimentalUpgrade && isUpgradeRequest(req))
+}
+
+// discardHedge releases the resources of a hedged request that didn't
+// win.
+func (p *Proxy) discardHedge(r hedgeResult) {
+	r.cancel()
+	consumeBody(r.rsp)
+	if r.ctx.proxySpan != nil {
+		p.tracing.setTag(r.ctx.proxySpan, HedgeCanceledTag, true)
+		r.ctx.proxySpan.Finish()
+	}
+}
+
+// makeBackendRequestWithHedging executes the backend request according
+// to the hedging policy of the route, if there is one. When the
+// response headers of the request don't arrive within the configured
+// delay, it sends the request to another endpoint, and uses the first
+// response. The requests are mapped sequentially, but executed in
+// parallel, each with its own copy of the proxy context and its own
+// proxy span.
+func (p *Proxy) makeBackendRequestWithHedging(ctx *context, backendContext stdlibcontext.Context) (*http.Response, *proxyError) {
+	policy, ok := ctx.StateBag()[retry.HedgePolicyKey].(*retry.HedgePolicy)
+	if !ok || !hedgeable(ctx, p.experimentalUpgrade) {
+		return p.makeBackendRequest(ctx, backendContext)
+	}
+
+	// when retrying, the hedged requests are also considered as tried
+	if ctx.triedEndpoints == nil {
+		ctx.triedEndpoints = make(map[string]struct{})
+		defer func() { ctx.triedEndpoints = nil }()
+	}
+
+	results := make(chan hedgeResult, policy.MaxHedges+1)
+	send := func(attempt int) *proxyError {
+		attemptContext, cancel := stdlibcontext.WithCancel(backendContext)
+		req, endpoint, err := mapRequest(ctx, attemptContext, p.flags.HopHeadersRemoval())
+		if err != nil {
+			cancel()
+			return &proxyError{err: fmt.Errorf("could not map backend request: %w", err)}
+		}
+
+		actx := ctx.clone()
+		go func() {
+			rsp, perr := p.sendBackendRequest(actx, req, endpoint)
+			results <- hedgeResult{ctx: actx, rsp: rsp, perr: perr, cancel: cancel, attempt: attempt}
+		}()
+
+		return nil
+	}
+
+	if perr := send(0); perr != nil {
+		return nil, perr
+	}
+
+	timer := time.NewTimer(policy.Delay)
+	defer timer.Stop()
+
+	var (
+		inflight = 1
+		hedges   int
+		failed   []hedgeResult
+		winner   *hedgeResult
+	)
+
+	for inflight > 0 && winner == nil {
+		select {
+		case <-timer.C:
+			if hedges >= policy.MaxHedges {
+				continue
+			}
+
+			hedges++
+			if perr := send(hedges); perr != nil {
+				p.log.Errorf("Failed to send hedged backend request: %v", perr)
+				continue
+			}
+
+			inflight++
+			p.metrics.IncCounter("hedge." + ctx.route.Id + ".sent")
+			tracing.LogKV("hedge", ctx.route.Id, ctx.request.Context())
+			if hedges < policy.MaxHedges {
+				timer.Reset(policy.Delay)
+			}
+		case r := <-results:
+			inflight--
+			if r.perr == nil {
+				winner = &r
+			} else {
+				failed = append(failed, r)
+			}
+		}
+	}
+
+	if inflight > 0 {
+		// the cancellation makes the remaining requests return early
+		go func(n int) {
+			for i := 0; i < n; i++ {
+				p.discardHedge(<-results)
+			}
+		}(inflight)
+	}
+
+	if winner == nil {
+		// all the requests failed, the last error is returned
+		last := failed[len(failed)-1]
+		for _, r := range failed[:len(failed)-1] {
+			p.discardHedge(r)
+		}
+
+		last.cancel()
+		ctx.proxySpan = last.ctx.proxySpan
+		return nil, last.perr
+	}
+
+	for _, r := range failed {
+		p.discardHedge(r)
+	}
+
+	// the response body is still to be streamed within the context of
+	// the winning request
+	ctx.addBackendContextCancel(winner.cancel)
+	ctx.proxySpan = winner.ctx.proxySpan
+	if hedges > 0 {
+		p.tracing.setTag(ctx.proxySpan, HedgeAttemptTag, winner.attempt)
+	}
+
+	if winner.attempt > 0 {
+		p.metrics.IncCounter("hedge." + ctx.route.Id + ".won")
+	}
+
+	return winner.rsp, nil
+}
@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHedgeSlowEndpoint(t *testing.T) {
+	slow := newCountingBackend(http.StatusOK, 300*time.Millisecond)
+	defer slow.Close()
+
+	fast := newCountingBackend(http.StatusOK, 0)
+	defer fast.Close()
+
+	doc := fmt.Sprintf(`r: * -> hedge("20ms") -> <roundRobin, "%s", "%s">`, slow.URL, fast.URL)
+	tp, ps, m := testRetryProxy(t, doc)
+	defer tp.close()
+	defer ps.Close()
+
+	for i := 0; i < 6; i++ {
+		start := time.Now()
+		if s := getStatus(t, ps.URL); s != http.StatusOK {
+			t.Fatalf("unexpected status: %d", s)
+		}
+
+		if d := time.Since(start); d > 200*time.Millisecond {
+			t.Errorf("failed to hedge the request, took: %v", d)
+		}
+	}
+
+	if fast.count() != 6 {
+		t.Errorf("expected all requests to reach the fast endpoint, got: %d", fast.count())
+	}
+
+	m.WithCounters(func(c map[string]int64) {
+		if c["hedge.r.sent"] != int64(slow.count()) || c["hedge.r.won"] != int64(slow.count()) {
+			t.Errorf("invalid hedge metrics: %v, slow requests: %d", c, slow.count())
+		}
+	})
+
+	// the in-flight requests of the canceled hedges are released
+	req, err := http.NewRequest("GET", ps.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	route, _ := tp.routing.Route(req)
+	inflight := func() (n int) {
+		for _, e := range route.LBEndpoints {
+			n += e.Metrics.GetInflightRequests()
+		}
+
+		return
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for inflight() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if n := inflight(); n != 0 {
+		t.Errorf("unexpected in-flight requests: %d", n)
+	}
+}
+
+func TestHedgeNotIdempotent(t *testing.T) {
+	slow1 := newCountingBackend(http.StatusOK, 50*time.Millisecond)
+	defer slow1.Close()
+
+	slow2 := newCountingBackend(http.StatusOK, 50*time.Millisecond)
+	defer slow2.Close()
+
+	doc := fmt.Sprintf(`r: * -> hedge("5ms") -> <roundRobin, "%s", "%s">`, slow1.URL, slow2.URL)
+	tp, ps, m := testRetryProxy(t, doc)
+	defer tp.close()
+	defer ps.Close()
+
+	rsp, err := http.Post(ps.URL, "text/plain", strings.NewReader("Hello, world!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsp.Body.Close()
+	if slow1.count()+slow2.count() != 1 {
+		t.Errorf("unexpected hedged request")
+	}
+
+	m.WithCounters(func(c map[string]int64) {
+		if c["hedge.r.sent"] != 0 {
+			t.Error("unexpected hedge metrics")
+		}
+	})
+}
+
+func TestHedgeMaxHedges(t *testing.T) {
+	var backends []*countingBackend
+	for i := 0; i < 4; i++ {
+		b := newCountingBackend(http.StatusOK, 100*time.Millisecond)
+		defer b.Close()
+		backends = append(backends, b)
+	}
+
+	doc := fmt.Sprintf(
+		`r: * -> hedge("10ms", 2) -> <roundRobin, "%s", "%s", "%s", "%s">`,
+		backends[0].URL, backends[1].URL, backends[2].URL, backends[3].URL,
+	)
+
+	tp, ps, m := testRetryProxy(t, doc)
+	defer tp.close()
+	defer ps.Close()
+
+	if s := getStatus(t, ps.URL); s != http.StatusOK {
+		t.Fatalf("unexpected status: %d", s)
+	}
+
+	// the canceled requests may still be counted by the backends
+	time.Sleep(50 * time.Millisecond)
+
+	var total int
+	for _, b := range backends {
+		total += b.count()
+	}
+
+	if total != 3 {
+		t.Errorf("expected 3 requests, got: %d", total)
+	}
+
+	m.WithCounters(func(c map[string]int64) {
+		if c["hedge.r.sent"] != 2 {
+			t.Errorf("invalid hedge metrics: %v", c)
+		}
+	})
+}
+
+func TestHedgeAllFailed(t *testing.T) {
+	closed1 := httptest.NewServer(http.NotFoundHandler())
+	closed1.Close()
+
+	closed2 := httptest.NewServer(http.NotFoundHandler())
+	closed2.Close()
+
+	doc := fmt.Sprintf(`r: * -> hedge("10ms") -> <roundRobin, "%s", "%s">`, closed1.URL, closed2.URL)
+	tp, ps, _ := testRetryProxy(t, doc)
+	defer tp.close()
+	defer ps.Close()
+
+	if s := getStatus(t, ps.URL); s != http.StatusBadGateway && s != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status: %d", s)
+	}
+}
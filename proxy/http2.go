@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	stdlibcontext "context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+const (
+	grpcContentType = "application/grpc"
+	grpcStatusKey   = "Grpc-Status"
+)
+
+// gRPC status codes that indicate a failure of the backend, see
+// https://github.com/grpc/grpc/blob/master/doc/statuscodes.md
+var grpcBackendErrors = map[string]bool{
+	"2":  true, // UNKNOWN
+	"4":  true, // DEADLINE_EXCEEDED
+	"12": true, // UNIMPLEMENTED
+	"13": true, // INTERNAL
+	"14": true, // UNAVAILABLE
+	"15": true, // DATA_LOSS
+}
+
+func dialTLS(dialer *skipperDialer, handshakeTimeout time.Duration) func(stdlibcontext.Context, string, string, *tls.Config) (net.Conn, error) {
+	return func(ctx stdlibcontext.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		hctx := ctx
+		if handshakeTimeout > 0 {
+			var cancel stdlibcontext.CancelFunc
+			hctx, cancel = stdlibcontext.WithTimeout(ctx, handshakeTimeout)
+			defer cancel()
+		}
+
+		tc := tls.Client(conn, cfg)
+		if err := tc.HandshakeContext(hctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		if p := tc.ConnectionState().NegotiatedProtocol; p != http2.NextProtoTLS {
+			tc.Close()
+			return nil, fmt.Errorf("http2: unexpected ALPN protocol %q, want %q", p, http2.NextProtoTLS)
+		}
+
+		return tc, nil
+	}
+}
+
+// newH2Transport creates the transport for the HTTP/2 over TLS backends.
+func newH2Transport(dialer *skipperDialer, tlsConfig *tls.Config, handshakeTimeout time.Duration) *http2.Transport {
+	return &http2.Transport{
+		TLSClientConfig: tlsConfig,
+		DialTLSContext:  dialTLS(dialer, handshakeTimeout),
+	}
+}
+
+// newH2CTransport creates the transport for the HTTP/2 over cleartext
+// backends, using prior knowledge.
+func newH2CTransport(dialer *skipperDialer) *http2.Transport {
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx stdlibcontext.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// keepTETrailers restores the TE header for the backend request, when
+// its only value is "trailers", because it is required by gRPC.
+func keepTETrailers(to, from http.Header) {
+	for _, v := range from.Values("Te") {
+		if strings.TrimSpace(strings.ToLower(v)) == "trailers" {
+			to.Set("Te", "trailers")
+			return
+		}
+	}
+}
+
+// trailersOnlyToTrailers moves the status of the gRPC trailers-only
+// responses from the headers to the trailers. The proxy flushes the
+// response headers before copying the body, and therefore it cannot
+// send a trailers-only response to the client.
+func trailersOnlyToTrailers(rsp *http.Response) {
+	if !strings.HasPrefix(rsp.Header.Get("Content-Type"), grpcContentType) || rsp.Header.Get(grpcStatusKey) == "" {
+		return
+	}
+
+	if rsp.Trailer == nil {
+		rsp.Trailer = make(http.Header)
+	}
+
+	for _, k := range []string{grpcStatusKey, "Grpc-Message", "Grpc-Status-Details-Bin"} {
+		if v, ok := rsp.Header[k]; ok {
+			rsp.Trailer[k] = v
+			delete(rsp.Header, k)
+		}
+	}
+}
+
+// dropContentLengthForTrailers removes the Content-Length header of the
+// responses with declared trailers, and of the gRPC responses, so that
+// the HTTP/1.1 clients receive them chunked, including the trailers.
+func dropContentLengthForTrailers(h http.Header, rsp *http.Response) {
+	if len(rsp.Trailer) > 0 || strings.HasPrefix(rsp.Header.Get("Content-Type"), grpcContentType) {
+		h.Del("Content-Length")
+	}
+}
+
+// copyTrailers sets the trailers of the backend response, after the
+// body was copied.
+func copyTrailers(w http.ResponseWriter, rsp *http.Response) {
+	for k, v := range rsp.Trailer {
+		w.Header()[http.TrailerPrefix+k] = v
+	}
+}
+
+// grpcStatus returns the gRPC status of a response, or an empty string
+// for non-gRPC responses. It is taken from the trailers, or from the
+// headers of the trailers-only responses. It expects the body to be
+// already consumed.
+func grpcStatus(rsp *http.Response) string {
+	if !strings.HasPrefix(rsp.Header.Get("Content-Type"), grpcContentType) {
+		return ""
+	}
+
+	if s := rsp.Trailer.Get(grpcStatusKey); s != "" {
+		return s
+	}
+
+	return rsp.Header.Get(grpcStatusKey)
+}
+
+func (p *Proxy) measureGRPCStatus(ctx *context, status string) {
+	p.metrics.IncCounter(fmt.Sprintf("grpc.%s.status.%s", ctx.route.Id, status))
+	if grpcBackendErrors[status] {
+		p.metrics.IncErrorsBackend(ctx.route.Id)
+	}
+}
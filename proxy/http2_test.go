@@ -0,0 +1,177 @@
+package proxy
+
+import (
+	stdlibcontext "context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func trailerBackend(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			t.Errorf("unexpected backend protocol: %s", r.Proto)
+		}
+
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Write([]byte("Hello, world!"))
+		w.Header().Set("X-Checksum", "42")
+	})
+}
+
+func getWithTrailers(t *testing.T, u string) *http.Response {
+	rsp, err := http.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rsp.Body.Close()
+	if _, err := io.ReadAll(rsp.Body); err != nil {
+		t.Fatal(err)
+	}
+
+	return rsp
+}
+
+func TestH2Backend(t *testing.T) {
+	backend := httptest.NewUnstartedServer(trailerBackend(t))
+	backend.EnableHTTP2 = true
+	backend.StartTLS()
+	defer backend.Close()
+
+	doc := fmt.Sprintf(`* -> backendProtocol("h2") -> "%s"`, backend.URL)
+	tp, err := newTestProxy(doc, Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tp.close()
+	ps := httptest.NewServer(tp.proxy)
+	defer ps.Close()
+
+	rsp := getWithTrailers(t, ps.URL)
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rsp.StatusCode)
+	}
+
+	if rsp.Trailer.Get("X-Checksum") != "42" {
+		t.Errorf("failed to forward the trailers: %v", rsp.Trailer)
+	}
+}
+
+func TestH2CBackend(t *testing.T) {
+	backend := httptest.NewServer(h2c.NewHandler(trailerBackend(t), &http2.Server{}))
+	defer backend.Close()
+
+	doc := fmt.Sprintf(`* -> backendProtocol("h2c") -> "%s"`, backend.URL)
+	tp, err := newTestProxy(doc, FlagsNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tp.close()
+	ps := httptest.NewServer(tp.proxy)
+	defer ps.Close()
+
+	rsp := getWithTrailers(t, ps.URL)
+	if rsp.Trailer.Get("X-Checksum") != "42" {
+		t.Errorf("failed to forward the trailers: %v", rsp.Trailer)
+	}
+}
+
+func TestH2DialTLSCanceled(t *testing.T) {
+	// the backend accepts the connections, but never completes the
+	// TLS handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			defer conn.Close()
+		}
+	}()
+
+	ctx, cancel := stdlibcontext.WithTimeout(stdlibcontext.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	dial := dialTLS(newSkipperDialer(net.Dialer{}), 0)
+	go func() {
+		_, err := dial(ctx, "tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("failed to fail")
+		}
+	case <-time.After(3 * time.Second):
+		t.Error("the TLS handshake was not canceled with the context")
+	}
+}
+
+func TestGRPCStatusMetrics(t *testing.T) {
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Te") != "trailers" {
+			t.Errorf("missing TE header: %v", r.Header)
+		}
+
+		w.Header().Set("Content-Type", "application/grpc")
+		if r.URL.Path == "/trailers-only" {
+			w.Header().Set("Grpc-Status", "5")
+			return
+		}
+
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write([]byte{0, 0, 0, 0, 0})
+		w.Header().Set("Grpc-Status", "14")
+	}), &http2.Server{}))
+	defer backend.Close()
+
+	doc := fmt.Sprintf(`r: * -> backendProtocol("h2c") -> "%s"`, backend.URL)
+	tp, ps, m := testRetryProxy(t, doc)
+	defer tp.close()
+	defer ps.Close()
+
+	for _, path := range []string{"/", "/trailers-only"} {
+		req, err := http.NewRequest("POST", ps.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Te", "trailers")
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		if rsp.Header.Get("Grpc-Status") != "" || rsp.Trailer.Get("Grpc-Status") == "" {
+			t.Errorf("the status is expected in the trailers: %v, %v", rsp.Header, rsp.Trailer)
+		}
+	}
+
+	m.WithCounters(func(c map[string]int64) {
+		if c["grpc.r.status.14"] != 1 || c["grpc.r.status.5"] != 1 {
+			t.Errorf("invalid gRPC status metrics: %v", c)
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package proxy_test
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/loadbalancer"
+	"github.com/zalando/skipper/metrics/metricstest"
+	"github.com/zalando/skipper/proxy"
+	"github.com/zalando/skipper/proxy/proxytest"
+)
+
+func TestOutlierDetection(t *testing.T) {
+	healthy := testBackend("healthy", http.StatusOK)
+	defer healthy.Close()
+
+	failing := testBackend("failing", http.StatusInternalServerError)
+	defer failing.Close()
+
+	routes, err := eskip.Parse(`* -> <roundRobin, "` + healthy.URL + `", "` + failing.URL + `">`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	detector := loadbalancer.NewOutlierDetector(loadbalancer.OutlierOptions{
+		ConsecutiveFailures: 3,
+		MaxEjectionPercent:  50,
+		Metrics:             &metricstest.MockMetrics{},
+	})
+
+	p := proxytest.WithParams(builtin.MakeRegistry(), proxy.Params{OutlierDetector: detector}, routes...)
+	defer p.Close()
+
+	get := func() string {
+		rsp, err := http.Get(p.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer rsp.Body.Close()
+		b, err := io.ReadAll(rsp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(b)
+	}
+
+	var failed int
+	for i := 0; i < 6; i++ {
+		if get() == "failing" {
+			failed++
+		}
+	}
+
+	if failed != 3 {
+		t.Fatalf("unexpected number of failed requests: %d", failed)
+	}
+
+	for i := 0; i < 10; i++ {
+		if rsp := get(); rsp != "healthy" {
+			t.Fatalf("ejected endpoint used: %s", rsp)
+		}
+	}
+
+	if ejected := detector.Ejected(); len(ejected) != 1 || ejected[0].Endpoint != failing.URL {
+		t.Errorf("unexpected ejected endpoints: %+v", ejected)
+	}
+}
@@ -25,13 +25,20 @@ import (
 	"github.com/zalando/skipper/eskip"
 	"github.com/zalando/skipper/filters"
 	al "github.com/zalando/skipper/filters/accesslog"
+	"github.com/zalando/skipper/filters/backendtls"
+	"github.com/zalando/skipper/filters/buffer"
 	circuitfilters "github.com/zalando/skipper/filters/circuit"
+	"github.com/zalando/skipper/filters/connectionpool"
+	"github.com/zalando/skipper/filters/errorpage"
 	flowidFilter "github.com/zalando/skipper/filters/flowid"
 	ratelimitfilters "github.com/zalando/skipper/filters/ratelimit"
+	retryfilters "github.com/zalando/skipper/filters/retry"
 	tracingfilter "github.com/zalando/skipper/filters/tracing"
+	websocketfilters "github.com/zalando/skipper/filters/websocket"
 	"github.com/zalando/skipper/loadbalancer"
 	"github.com/zalando/skipper/logging"
 	"github.com/zalando/skipper/metrics"
+	snet "github.com/zalando/skipper/net"
 	"github.com/zalando/skipper/proxy/fastcgi"
 	"github.com/zalando/skipper/ratelimit"
 	"github.com/zalando/skipper/rfc"
@@ -161,6 +168,22 @@ type Params struct {
 	// and the response messages during web socket upgrades.
 	ExperimentalUpgradeAudit bool
 
+	// EnableConnect enables the forward proxy mode for the CONNECT
+	// requests. The CONNECT requests are routed by the requested
+	// host:port, and after the request filters of the route, the
+	// tunnel is opened to the requested destination for the dynamic
+	// backends, or to the backend of the route. When the route contains
+	// the backendIsProxy filter, the backend is used as an upstream
+	// proxy.
+	EnableConnect bool
+
+	// ConnectAllowlist contains the allowed destinations of the CONNECT
+	// tunnels. When empty, all the tunnels are rejected. The entries are
+	// host:port pairs, where the host can start with "*." to match the
+	// subdomains, or it can be "*" to match any host, and the port can
+	// be "*" or omitted to match any port.
+	ConnectAllowlist []string
+
 	// When set, no access log is printed.
 	AccessLogDisabled bool
 
@@ -177,6 +200,12 @@ type Params struct {
 	// wrong routing depending on the current configuration.
 	MaxLoopbacks int
 
+	// MaxRequestBodySize, when greater than 0, limits the size of the
+	// request bodies. The requests with a larger body are rejected
+	// with 413 Request Entity Too Large. The maxRequestBodySize filter
+	// can set a lower limit for individual routes.
+	MaxRequestBodySize int64
+
 	// Same as net/http.Transport.MaxIdleConnsPerHost, but the default
 	// is 64. This value supports scenarios with relatively few remote
 	// hosts. When the routing table contains different hosts in the
@@ -203,6 +232,36 @@ type Params struct {
 	// LoadBalancer to report unhealthy or dead backends to
 	LoadBalancer *loadbalancer.LB
 
+	// OutlierDetector, when set, receives the results of the
+	// requests to the endpoints of the load balanced routes, and
+	// ejects the failing endpoints. It needs to be also set as a
+	// post-processor of the routing.
+	OutlierDetector *loadbalancer.OutlierDetector
+
+	// RoutingTraceSecret, when set, enables the routing trace for the
+	// requests with the X-Skipper-Routing-Trace header matching the
+	// secret. The response of these requests contains the routing
+	// decisions of the proxy in the same header.
+	RoutingTraceSecret string
+
+	// RoutingTraceAllowCIDRs enables the routing trace for the requests
+	// with the X-Skipper-Routing-Trace header, when the remote address
+	// of the connection is in one of the networks, regardless of the
+	// header value.
+	RoutingTraceAllowCIDRs snet.IPNets
+
+	// ErrorPages, when set, contain the pages used for the errors of
+	// the proxy, e.g. when no route was found or the backend is not
+	// available, unless an errorPage filter of the route applies.
+	ErrorPages *errorpage.Templates
+
+	// RetryBudget limits the ratio of the retries to the requests
+	// of the routes with a retry policy, across all routes, to
+	// prevent the retries amplifying an outage. When 0, the
+	// default (0.2) is applied. To disable the budget, set it to
+	// a negative value.
+	RetryBudget float64
+
 	// Defines the time period of how often the idle connections are
 	// forcibly closed. The default is 12 seconds. When set to less than
 	// 0, the proxy doesn't force closing the idle connections.
@@ -315,11 +374,18 @@ type PriorityRoute interface {
 type Proxy struct {
 	experimentalUpgrade      bool
 	experimentalUpgradeAudit bool
+	connectEnabled           bool
+	connectAllowlist         []connectDestination
+	connectDialer            *net.Dialer
 	accessLogDisabled        bool
 	maxLoops                 int
+	maxRequestBodySize       int64
 	defaultHTTPStatus        int
 	routing                  *routing.Routing
 	roundTripper             http.RoundTripper
+	h2RoundTripper           http.RoundTripper
+	h2cRoundTripper          http.RoundTripper
+	routeTransports          *routeTransports
 	priorityRoutes           []PriorityRoute
 	flags                    Flags
 	metrics                  metrics.Metrics
@@ -330,6 +396,11 @@ type Proxy struct {
 	log                      logging.Logger
 	tracing                  *proxyTracing
 	lb                       *loadbalancer.LB
+	outlierDetector          *loadbalancer.OutlierDetector
+	routingTraceSecret       string
+	routingTraceAllowCIDRs   snet.IPNets
+	errorPages               *errorpage.Templates
+	retryBudget              *retryBudget
 	upgradeAuditLogOut       io.Writer
 	upgradeAuditLogErr       io.Writer
 	auditLogHook             chan struct{}
@@ -457,8 +528,40 @@ func setRequestURLForDynamicBackend(u *url.URL, stateBag map[string]interface{})
 	}
 }
 
-func setRequestURLForLoadBalancedBackend(u *url.URL, rt *routing.Route, lbctx *routing.LBContext) *routing.LBEndpoint {
+// untriedEndpoint returns the endpoint selected by the LB algorithm, or,
+// if it was already tried, the next one from the route endpoints that
+// was not tried yet. If all the endpoints were tried, it returns the
+// selected one.
+func untriedEndpoint(endpoints []routing.LBEndpoint, selected routing.LBEndpoint, tried map[string]struct{}) routing.LBEndpoint {
+	if _, ok := tried[selected.Host]; !ok {
+		return selected
+	}
+
+	start := 0
+	for i := range endpoints {
+		if endpoints[i].Host == selected.Host {
+			start = i
+			break
+		}
+	}
+
+	for i := 1; i < len(endpoints); i++ {
+		e := endpoints[(start+i)%len(endpoints)]
+		if _, ok := tried[e.Host]; !ok {
+			return e
+		}
+	}
+
+	return selected
+}
+
+func setRequestURLForLoadBalancedBackend(u *url.URL, rt *routing.Route, lbctx *routing.LBContext, tried map[string]struct{}) *routing.LBEndpoint {
 	e := rt.LBAlgorithm.Apply(lbctx)
+	if tried != nil {
+		e = untriedEndpoint(rt.LBEndpoints, e, tried)
+		tried[e.Host] = struct{}{}
+	}
+
 	u.Scheme = e.Scheme
 	u.Host = e.Host
 	return &e
@@ -479,30 +582,46 @@ func mapRequest(ctx *context, requestContext stdlibcontext.Context, removeHopHea
 		setRequestURLFromRequest(u, r)
 		setRequestURLForDynamicBackend(u, stateBag)
 	case eskip.LBBackend:
-		endpoint = setRequestURLForLoadBalancedBackend(u, rt, &routing.LBContext{Request: r, Route: rt, Params: stateBag})
+		endpoint = setRequestURLForLoadBalancedBackend(u, rt, &routing.LBContext{Request: r, Route: rt, Params: stateBag}, ctx.triedEndpoints)
 	default:
 		u.Scheme = rt.Scheme
 		u.Host = rt.Host
 	}
 
 	body := r.Body
+	buffered, isBuffered := body.(*buffer.Body)
 	if r.ContentLength == 0 {
 		body = nil
+	} else if isBuffered {
+		// every backend request reads the buffered body from the start
+		body = buffered.NewReader()
 	}
 
 	rr, err := http.NewRequestWithContext(requestContext, r.Method, u.String(), body)
 	if err != nil {
+		if isBuffered && body != nil {
+			body.Close()
+		}
+
 		return nil, endpoint, err
 	}
 
 	rr.ContentLength = r.ContentLength
+	if isBuffered && body != nil {
+		rr.GetBody = func() (io.ReadCloser, error) { return buffered.NewReader(), nil }
+	}
 	if removeHopHeaders {
 		rr.Header = cloneHeaderExcluding(r.Header, hopHeaders)
+		keepTETrailers(rr.Header, r.Header)
 	} else {
 		rr.Header = cloneHeader(r.Header)
 	}
 	rr.Host = host
 
+	// the trailers of the incoming request are read after its body,
+	// sharing the map makes them available for the backend request
+	rr.Trailer = r.Trailer
+
 	// If there is basic auth configured in the URL we add them as headers
 	if u.User != nil {
 		up := u.User.String()
@@ -611,12 +730,14 @@ func WithParams(p Params) *Proxy {
 		}
 	}
 
+	dialer := newSkipperDialer(net.Dialer{
+		Timeout:   p.Timeout,
+		KeepAlive: p.KeepAlive,
+		DualStack: p.DualStack,
+	})
+
 	tr := &http.Transport{
-		DialContext: newSkipperDialer(net.Dialer{
-			Timeout:   p.Timeout,
-			KeepAlive: p.KeepAlive,
-			DualStack: p.DualStack,
-		}).DialContext,
+		DialContext:           dialer.DialContext,
 		TLSHandshakeTimeout:   p.TLSHandshakeTimeout,
 		ResponseHeaderTimeout: p.ResponseHeaderTimeout,
 		ExpectContinueTimeout: p.ExpectContinueTimeout,
@@ -627,6 +748,29 @@ func WithParams(p Params) *Proxy {
 		Proxy:                 proxyFromHeader,
 	}
 
+	if p.ClientTLS != nil {
+		tr.TLSClientConfig = p.ClientTLS
+	}
+
+	if p.Flags.Insecure() {
+		if tr.TLSClientConfig == nil {
+			/* #nosec */
+			tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		} else {
+			/* #nosec */
+			tr.TLSClientConfig.InsecureSkipVerify = true
+		}
+	}
+
+	var h2TLS *tls.Config
+	if tr.TLSClientConfig != nil {
+		h2TLS = tr.TLSClientConfig.Clone()
+	}
+
+	h2 := newH2Transport(dialer, h2TLS, p.TLSHandshakeTimeout)
+	h2c := newH2CTransport(dialer)
+	routeTransports := newRouteTransports(tr, h2TLS, dialer, p.TLSHandshakeTimeout, p.CustomHttpRoundTripperWrap)
+
 	quit := make(chan struct{})
 	// We need this to reliably fade on DNS change, which is right
 	// now not fixed with IdleConnTimeout in the http.Transport.
@@ -637,6 +781,9 @@ func WithParams(p Params) *Proxy {
 				select {
 				case <-time.After(p.CloseIdleConnsPeriod):
 					tr.CloseIdleConnections()
+					h2.CloseIdleConnections()
+					h2c.CloseIdleConnections()
+					routeTransports.closeIdle()
 				case <-quit:
 					return
 				}
@@ -644,25 +791,38 @@ func WithParams(p Params) *Proxy {
 		}()
 	}
 
-	if p.ClientTLS != nil {
-		tr.TLSClientConfig = p.ClientTLS
+	// the transports not referenced by the current routes are dropped,
+	// also when the idle connections are not closed periodically
+	cleanupPeriod := p.CloseIdleConnsPeriod
+	if cleanupPeriod <= 0 {
+		cleanupPeriod = DefaultCloseIdleConnsPeriod
 	}
 
-	if p.Flags.Insecure() {
-		if tr.TLSClientConfig == nil {
-			/* #nosec */
-			tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-		} else {
-			/* #nosec */
-			tr.TLSClientConfig.InsecureSkipVerify = true
+	go func() {
+		for {
+			select {
+			case <-time.After(cleanupPeriod):
+				var routes []*routing.Route
+				if p.Routing != nil {
+					routes = p.Routing.Get().Routes()
+				}
+
+				routeTransports.cleanup(referencedTransports(routes))
+			case <-quit:
+				return
+			}
 		}
-	}
+	}()
 
 	m := metrics.Default
 	if p.Flags.Debug() {
 		m = metrics.Void
 	}
 
+	if p.RetryBudget == 0 {
+		p.RetryBudget = DefaultRetryBudget
+	}
+
 	if p.MaxLoopbacks == 0 {
 		p.MaxLoopbacks = DefaultMaxLoopbacks
 	} else if p.MaxLoopbacks < 0 {
@@ -680,6 +840,9 @@ func WithParams(p Params) *Proxy {
 	return &Proxy{
 		routing:                  p.Routing,
 		roundTripper:             p.CustomHttpRoundTripperWrap(tr),
+		h2RoundTripper:           p.CustomHttpRoundTripperWrap(h2),
+		h2cRoundTripper:          p.CustomHttpRoundTripperWrap(h2c),
+		routeTransports:          routeTransports,
 		priorityRoutes:           p.PriorityRoutes,
 		flags:                    p.Flags,
 		metrics:                  m,
@@ -687,9 +850,18 @@ func WithParams(p Params) *Proxy {
 		flushInterval:            p.FlushInterval,
 		experimentalUpgrade:      p.ExperimentalUpgrade,
 		experimentalUpgradeAudit: p.ExperimentalUpgradeAudit,
+		connectEnabled:           p.EnableConnect,
+		connectAllowlist:         parseConnectAllowlist(p.ConnectAllowlist),
+		connectDialer:            &net.Dialer{Timeout: p.Timeout, KeepAlive: p.KeepAlive},
 		maxLoops:                 p.MaxLoopbacks,
+		maxRequestBodySize:       p.MaxRequestBodySize,
 		breakers:                 p.CircuitBreakers,
 		lb:                       p.LoadBalancer,
+		outlierDetector:          p.OutlierDetector,
+		routingTraceSecret:       p.RoutingTraceSecret,
+		routingTraceAllowCIDRs:   p.RoutingTraceAllowCIDRs,
+		errorPages:               p.ErrorPages,
+		retryBudget:              newRetryBudget(p.RetryBudget),
 		limiters:                 p.RateLimiters,
 		log:                      &logging.DefaultLog{},
 		defaultHTTPStatus:        defaultHTTPStatus,
@@ -761,11 +933,18 @@ func (p *Proxy) applyFiltersToRequest(f []*routing.RouteFilter, ctx *context) []
 			p.log.Errorf("error while processing filter during request: %s: %v (%s)", fi.Name, err, stack)
 		})
 		filterTracing.logEnd(fi.Name)
+		ctx.routingTraceHop.requestFilter(fi.Name, time.Since(start), ctx.deprecatedShunted() || ctx.shunted())
 
 		filters = append(filters, fi)
 		if ctx.deprecatedShunted() || ctx.shunted() {
 			break
 		}
+
+		// the request is rejected, before the rest of the filters could
+		// read the oversized body
+		if _, ok := ctx.StateBag()[buffer.BodyTooLargeKey]; ok {
+			break
+		}
 	}
 
 	p.metrics.MeasureAllFiltersRequest(ctx.route.Id, filtersStart)
@@ -798,6 +977,7 @@ func (p *Proxy) applyFiltersToResponse(filters []*routing.RouteFilter, ctx *cont
 			p.log.Errorf("error while processing filters during response: %s: %v (%s)", fi.Name, err, stack)
 		})
 		filterTracing.logEnd(fi.Name)
+		ctx.routingTraceHop.responseFilter(fi.Name, time.Since(start))
 	}
 
 	p.metrics.MeasureAllFiltersResponse(ctx.route.Id, filtersStart)
@@ -811,6 +991,11 @@ func addBranding(headerMap http.Header) {
 }
 
 func (p *Proxy) lookupRoute(ctx *context) (rt *routing.Route, params map[string]string) {
+	if ctx.fallbackRoute != nil {
+		rt, ctx.fallbackRoute = ctx.fallbackRoute, nil
+		return rt, nil
+	}
+
 	for _, prt := range p.priorityRoutes {
 		rt, params = prt.Match(ctx.request)
 		if rt != nil {
@@ -825,13 +1010,13 @@ func (p *Proxy) lookupRoute(ctx *context) (rt *routing.Route, params map[string]
 func (p *Proxy) sendError(c *context, id string, code int) {
 	addBranding(c.responseWriter.Header())
 
-	text := http.StatusText(code) + "\n"
+	contentType, text := p.errorPageBody(c, code)
 
 	c.responseWriter.Header().Set("Content-Length", strconv.Itoa(len(text)))
-	c.responseWriter.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	c.responseWriter.Header().Set("Content-Type", contentType)
 	c.responseWriter.Header().Set("X-Content-Type-Options", "nosniff")
 	c.responseWriter.WriteHeader(code)
-	c.responseWriter.Write([]byte(text))
+	c.responseWriter.Write(text)
 
 	p.metrics.MeasureServe(
 		id,
@@ -847,15 +1032,29 @@ func (p *Proxy) makeUpgradeRequest(ctx *context, req *http.Request) error {
 
 	reverseProxy := httputil.NewSingleHostReverseProxy(backendURL)
 	reverseProxy.FlushInterval = p.flushInterval
+
+	tlsClientConfig, insecure := p.clientTLS, p.flags.Insecure()
+	if c, ok := ctx.StateBag()[filters.BackendTLS].(*backendtls.Config); ok {
+		// the hostname, or the configured server name, is verified
+		// during the handshake
+		tlsClientConfig, insecure = c.TLS, true
+	}
+
 	upgradeProxy := upgradeProxy{
 		backendAddr:     backendURL,
 		reverseProxy:    reverseProxy,
-		insecure:        p.flags.Insecure(),
-		tlsClientConfig: p.clientTLS,
+		insecure:        insecure,
+		tlsClientConfig: tlsClientConfig,
 		useAuditLog:     p.experimentalUpgradeAudit,
 		auditLogOut:     p.upgradeAuditLogOut,
 		auditLogErr:     p.upgradeAuditLogErr,
 		auditLogHook:    p.auditLogHook,
+		metrics:         p.metrics,
+		routeID:         ctx.route.Id,
+	}
+
+	if c, ok := ctx.StateBag()[filters.WebSocket].(*websocketfilters.Config); ok {
+		upgradeProxy.webSocket = c
 	}
 
 	upgradeProxy.serveHTTP(ctx.responseWriter, req)
@@ -870,17 +1069,25 @@ func (p *Proxy) makeBackendRequest(ctx *context, requestContext stdlibcontext.Co
 		return nil, &proxyError{err: fmt.Errorf("could not map backend request: %w", err)}
 	}
 
+	return p.sendBackendRequest(ctx, req, endpoint)
+}
+
+// sendBackendRequest executes an already mapped backend request. It sets
+// the proxy span of the context.
+func (p *Proxy) sendBackendRequest(ctx *context, req *http.Request, endpoint *routing.LBEndpoint) (*http.Response, *proxyError) {
 	if res, ok := p.rejectBackend(ctx, req); ok {
 		return res, nil
 	}
 
+	ctx.routingTraceHop.endpoint(req.URL.Scheme + "://" + req.URL.Host)
+
 	if endpoint != nil {
 		endpoint.Metrics.IncInflightRequest()
 		defer endpoint.Metrics.DecInflightRequest()
 	}
 
 	if p.experimentalUpgrade && isUpgradeRequest(req) {
-		if err = p.makeUpgradeRequest(ctx, req); err != nil {
+		if err := p.makeUpgradeRequest(ctx, req); err != nil {
 			return nil, &proxyError{err: err}
 		}
 
@@ -917,7 +1124,11 @@ func (p *Proxy) makeBackendRequest(ctx *context, requestContext stdlibcontext.Co
 	ctx.proxySpan.LogKV("http_roundtrip", StartEvent)
 	req = injectClientTrace(req, ctx.proxySpan)
 
+	roundTripStart := time.Now()
 	response, err := roundTripper.RoundTrip(req)
+	if endpoint != nil {
+		p.recordOutlier(ctx, req, endpoint, response, err, time.Since(roundTripStart))
+	}
 
 	ctx.proxySpan.LogKV("http_roundtrip", EndEvent)
 	if err != nil {
@@ -938,6 +1149,10 @@ func (p *Proxy) makeBackendRequest(ctx *context, requestContext stdlibcontext.Co
 
 		ctx.proxySpan.LogKV("event", "error", "message", err.Error())
 
+		if errors.Is(err, buffer.ErrBodyTooLarge) {
+			return nil, p.requestBodyTooLarge(ctx, err)
+		}
+
 		if perr, ok := err.(*proxyError); ok {
 			//p.lb.AddHealthcheck(ctx.route.Backend)
 			perr.err = fmt.Errorf("failed to do backend roundtrip to %s: %w", req.URL.Host, perr.err)
@@ -961,6 +1176,25 @@ func (p *Proxy) makeBackendRequest(ctx *context, requestContext stdlibcontext.Co
 	return response, nil
 }
 
+// recordOutlier reports the result of a request to an endpoint to the
+// outlier detection. The requests canceled by the client, or by the
+// proxy, e.g. the losing hedged requests, are not reported.
+func (p *Proxy) recordOutlier(ctx *context, req *http.Request, endpoint *routing.LBEndpoint, rsp *http.Response, err error, latency time.Duration) {
+	if p.outlierDetector == nil || err != nil && (req.Context().Err() == stdlibcontext.Canceled || errors.Is(err, buffer.ErrBodyTooLarge)) {
+		return
+	}
+
+	failed := err != nil || rsp.StatusCode >= http.StatusInternalServerError
+	p.outlierDetector.Record(ctx.route, endpoint, failed, latency)
+}
+
+// requestBodyTooLarge counts the rejected request, and returns the error
+// responded with 413 Request Entity Too Large.
+func (p *Proxy) requestBodyTooLarge(ctx *context, err error) *proxyError {
+	p.metrics.IncCounter("requestbodytoolarge." + ctx.route.Id)
+	return &proxyError{err: err, code: http.StatusRequestEntityTooLarge}
+}
+
 func (p *Proxy) getRoundTripper(ctx *context, req *http.Request) (http.RoundTripper, error) {
 	switch req.URL.Scheme {
 	case "fastcgi":
@@ -986,7 +1220,30 @@ func (p *Proxy) getRoundTripper(ctx *context, req *http.Request) (http.RoundTrip
 
 		return rt, nil
 	default:
-		return p.roundTripper, nil
+		protocol, _ := ctx.StateBag()[filters.BackendProtocol].(string)
+		c, _ := ctx.StateBag()[filters.BackendTLS].(*backendtls.Config)
+		pool, _ := ctx.StateBag()[filters.BackendConnectionPool].(*connectionpool.Config)
+		c, pool = transportConfigs(protocol, c, pool)
+		if pool != nil {
+			return poolRoundTripper{
+				transport: p.routeTransports.get(protocol, c, pool),
+				metrics:   p.metrics,
+				routeID:   ctx.route.Id,
+			}, nil
+		}
+
+		if c != nil {
+			return p.routeTransports.get(protocol, c, nil).roundTripper, nil
+		}
+
+		switch protocol {
+		case "h2":
+			return p.h2RoundTripper, nil
+		case "h2c":
+			return p.h2cRoundTripper, nil
+		default:
+			return p.roundTripper, nil
+		}
 	}
 }
 
@@ -995,7 +1252,9 @@ func (p *Proxy) rejectBackend(ctx *context, req *http.Request) (*http.Response,
 	if ok {
 		s := req.URL.Scheme + "://" + req.URL.Host
 
-		if !p.limiters.Get(limit.Settings).AllowContext(req.Context(), s) {
+		allowed := p.limiters.Get(limit.Settings).AllowContext(req.Context(), s)
+		ctx.routingTraceHop.backendRatelimit(allowed)
+		if !allowed {
 			return &http.Response{
 				StatusCode: limit.StatusCode,
 				Header:     http.Header{"Content-Length": []string{"0"}},
@@ -1020,8 +1279,10 @@ func (p *Proxy) checkBreaker(c *context) (func(bool), bool) {
 	}
 
 	done, ok := b.Allow()
-	if !ok && c.request.Body != nil {
-		// consume the body to prevent goroutine leaks
+	c.routingTraceHop.breaker(ok)
+	if _, fallback := c.stateBag[retryfilters.FallbackKey]; !ok && !fallback && c.request.Body != nil {
+		// consume the body to prevent goroutine leaks, unless it is
+		// sent to the fallback
 		io.Copy(io.Discard, c.request.Body)
 	}
 	return done, ok
@@ -1050,6 +1311,7 @@ func (p *Proxy) do(ctx *context) error {
 	// proxy global setting
 	if !ctx.wasExecuted() {
 		if settings, retryAfter := p.limiters.Check(ctx.request); retryAfter > 0 {
+			ctx.routingTrace.setRatelimit(routingTraceRejected)
 			rerr := newRatelimitError(settings, retryAfter)
 			return rerr
 		}
@@ -1057,6 +1319,14 @@ func (p *Proxy) do(ctx *context) error {
 	// every time the context is used for a request the context executionCounter is incremented
 	// a context executionCounter equal to zero represents a root context.
 	ctx.executionCounter++
+
+	var via string
+	if ctx.fallbackRoute != nil {
+		via = "fallback"
+	} else if ctx.executionCounter > 1 {
+		via = "loopback"
+	}
+
 	lookupStart := time.Now()
 	route, params := p.lookupRoute(ctx)
 	p.metrics.MeasureRouteLookup(lookupStart)
@@ -1070,9 +1340,20 @@ func (p *Proxy) do(ctx *context) error {
 	}
 
 	ctx.applyRoute(route, params, p.flags.PreserveHost())
+	ctx.routingTraceHop = ctx.routingTrace.addHop(route.Id, via)
+
+	// the global limit is applied only once, before any filter could read the body
+	if ctx.executionCounter == 1 && p.maxRequestBodySize > 0 && !buffer.LimitBody(ctx.request, p.maxRequestBodySize) {
+		return p.requestBodyTooLarge(ctx, buffer.ErrBodyTooLarge)
+	}
 
 	processedFilters := p.applyFiltersToRequest(ctx.route.Filters, ctx)
 
+	if _, ok := ctx.StateBag()[buffer.BodyTooLargeKey]; ok && !ctx.shunted() && !ctx.deprecatedShunted() {
+		delete(ctx.StateBag(), buffer.BodyTooLargeKey)
+		return p.requestBodyTooLarge(ctx, buffer.ErrBodyTooLarge)
+	}
+
 	if ctx.deprecatedShunted() {
 		p.log.Debugf("deprecated shunting detected in route: %s", ctx.route.Id)
 		return &proxyError{handled: true}
@@ -1092,6 +1373,16 @@ func (p *Proxy) do(ctx *context) error {
 
 		ctx.setResponse(loopCTX.response, p.flags.PreserveOriginal())
 		ctx.proxySpan = loopCTX.proxySpan
+		if loopCTX.fallback != "" {
+			ctx.fallback = loopCTX.fallback
+		}
+	} else if p.connectEnabled && isConnectRequest(ctx.request) {
+		rsp, perr := p.makeConnectRequest(ctx)
+		if perr != nil {
+			return perr
+		}
+
+		ctx.setResponse(rsp, p.flags.PreserveOriginal())
 	} else if p.flags.Debug() {
 		debugReq, _, err := mapRequest(ctx, ctx.request.Context(), p.flags.HopHeadersRemoval())
 		if err != nil {
@@ -1101,73 +1392,110 @@ func (p *Proxy) do(ctx *context) error {
 		ctx.outgoingDebugRequest = debugReq
 		ctx.setResponse(&http.Response{Header: make(http.Header)}, p.flags.PreserveOriginal())
 	} else {
+		rsp, perr := p.makeBackendRequestWithBreaker(ctx)
+		if fallback, ok := ctx.StateBag()[retryfilters.FallbackKey].(*retryfilters.Fallback); ok && needsFallback(ctx, fallback, rsp, perr) {
+			consumeBody(rsp)
 
-		done, allow := p.checkBreaker(ctx)
-		if !allow {
-			tracing.LogKV("circuit_breaker", "open", ctx.request.Context())
-			return errCircuitBreakerOpen
+			var err error
+			if rsp, err = p.makeFallbackRequest(ctx, fallback); err != nil {
+				return err
+			}
+		} else if perr != nil {
+			if rsp = staleIfErrorResponse(ctx, perr); rsp == nil {
+				return perr
+			}
+
+			rsp.Request = ctx.request
 		}
 
-		backendContext := ctx.request.Context()
-		if timeout, ok := ctx.StateBag()[filters.BackendTimeout]; ok {
-			backendContext, ctx.cancelBackendContext = stdlibcontext.WithTimeout(backendContext, timeout.(time.Duration))
+		ctx.setResponse(rsp, p.flags.PreserveOriginal())
+	}
+
+	addBranding(ctx.response.Header)
+	p.applyFiltersToResponse(processedFilters, ctx)
+	return nil
+}
+
+// makeBackendRequestWithBreaker executes the backend request of a
+// network, dynamic or load balanced route, checking the circuit breaker
+// and applying the retries.
+func (p *Proxy) makeBackendRequestWithBreaker(ctx *context) (*http.Response, *proxyError) {
+	done, allow := p.checkBreaker(ctx)
+	if !allow {
+		tracing.LogKV("circuit_breaker", "open", ctx.request.Context())
+		return nil, errCircuitBreakerOpen
+	}
+
+	backendContext := ctx.request.Context()
+	if timeout, ok := ctx.StateBag()[filters.BackendTimeout]; ok {
+		backendContext, ctx.cancelBackendContext = stdlibcontext.WithTimeout(backendContext, timeout.(time.Duration))
+	}
+
+	backendStart := time.Now()
+	var (
+		rsp  *http.Response
+		perr *proxyError
+	)
+
+	if policy, ok := ctx.StateBag()[retryfilters.PolicyKey].(*retryfilters.Policy); ok {
+		rsp, perr = p.makeBackendRequestWithRetry(ctx, backendContext, policy)
+	} else {
+		rsp, perr = p.makeBackendRequestWithHedging(ctx, backendContext)
+	}
+
+	if perr != nil {
+		if done != nil {
+			done(false)
 		}
 
-		backendStart := time.Now()
-		rsp, perr := p.makeBackendRequest(ctx, backendContext)
-		if perr != nil {
-			if done != nil {
-				done(false)
-			}
+		p.metrics.IncErrorsBackend(ctx.route.Id)
 
-			p.metrics.IncErrorsBackend(ctx.route.Id)
+		if retryable(ctx, perr) {
+			if ctx.proxySpan != nil {
+				ctx.proxySpan.Finish()
+				ctx.proxySpan = nil
+			}
 
-			if retryable(ctx, perr) {
-				if ctx.proxySpan != nil {
-					ctx.proxySpan.Finish()
-					ctx.proxySpan = nil
-				}
+			tracing.LogKV("retry", ctx.route.Id, ctx.Request().Context())
 
-				tracing.LogKV("retry", ctx.route.Id, ctx.Request().Context())
-
-				perr = nil
-				var perr2 *proxyError
-				rsp, perr2 = p.makeBackendRequest(ctx, backendContext)
-				if perr2 != nil {
-					p.log.Errorf("Failed to retry backend request: %v", perr2)
-					if perr2.code >= http.StatusInternalServerError {
-						p.metrics.MeasureBackend5xx(backendStart)
-					}
-					return perr2
+			perr = nil
+			var perr2 *proxyError
+			rsp, perr2 = p.makeBackendRequest(ctx, backendContext)
+			if perr2 != nil {
+				p.log.Errorf("Failed to retry backend request: %v", perr2)
+				if perr2.code >= http.StatusInternalServerError {
+					p.metrics.MeasureBackend5xx(backendStart)
 				}
-			} else {
-				return perr
+				return nil, perr2
 			}
+		} else {
+			return nil, perr
 		}
+	}
 
-		if rsp.StatusCode >= http.StatusInternalServerError {
-			p.metrics.MeasureBackend5xx(backendStart)
-		}
-
-		if done != nil {
-			done(rsp.StatusCode < http.StatusInternalServerError)
-		}
+	if rsp.StatusCode >= http.StatusInternalServerError {
+		p.metrics.MeasureBackend5xx(backendStart)
+	}
 
-		ctx.setResponse(rsp, p.flags.PreserveOriginal())
-		p.metrics.MeasureBackend(ctx.route.Id, backendStart)
-		p.metrics.MeasureBackendHost(ctx.route.Host, backendStart)
+	if done != nil {
+		done(rsp.StatusCode < http.StatusInternalServerError)
 	}
 
-	addBranding(ctx.response.Header)
-	p.applyFiltersToResponse(processedFilters, ctx)
-	return nil
+	p.metrics.MeasureBackend(ctx.route.Id, backendStart)
+	p.metrics.MeasureBackendHost(ctx.route.Host, backendStart)
+	return rsp, nil
 }
 
 func retryable(ctx *context, perr *proxyError) bool {
+	// routes with a retry policy were already retried according to the policy
+	if _, ok := ctx.StateBag()[retryfilters.PolicyKey]; ok {
+		return false
+	}
+
 	req := ctx.Request()
 	return perr.code != 499 && perr.DialError() &&
 		ctx.route.BackendType == eskip.LBBackend &&
-		req != nil && (req.Body == nil || req.Body == http.NoBody)
+		req != nil && isBodyReplayable(req)
 }
 
 func (p *Proxy) serveResponse(ctx *context) {
@@ -1183,9 +1511,13 @@ func (p *Proxy) serveResponse(ctx *context) {
 		return
 	}
 
+	p.applyErrorPage(ctx)
+
 	start := time.Now()
 	p.tracing.logStreamEvent(ctx.proxySpan, StreamHeadersEvent, StartEvent)
+	trailersOnlyToTrailers(ctx.response)
 	copyHeader(ctx.responseWriter.Header(), ctx.response.Header)
+	dropContentLengthForTrailers(ctx.responseWriter.Header(), ctx.response)
 
 	if err := ctx.Request().Context().Err(); err != nil {
 		// deadline exceeded or canceled in stdlib, client closed request
@@ -1203,6 +1535,11 @@ func (p *Proxy) serveResponse(ctx *context) {
 
 	n, err := copyStream(ctx.responseWriter, ctx.response.Body)
 	p.tracing.logStreamEvent(ctx.proxySpan, StreamBodyEvent, strconv.FormatInt(n, 10))
+	copyTrailers(ctx.responseWriter, ctx.response)
+	if ctx.grpcStatus = grpcStatus(ctx.response); ctx.grpcStatus != "" {
+		p.measureGRPCStatus(ctx, ctx.grpcStatus)
+	}
+
 	if err != nil {
 		p.metrics.IncErrorsStreaming(ctx.route.Id)
 		p.log.Errorf("error while copying the response stream: %v", err)
@@ -1380,17 +1717,39 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 		statusCode := lw.GetCode()
+		responseSize := lw.GetBytes()
+		if ctx.tunnelStatusCode != 0 {
+			// the connection of the CONNECT tunnel was hijacked
+			statusCode = ctx.tunnelStatusCode
+			responseSize = ctx.tunnelBytesSent
+		}
 
 		if shouldLog(statusCode, accessLogEnabled) {
 			entry := &logging.AccessEntry{
 				Request:      r,
-				ResponseSize: lw.GetBytes(),
+				ResponseSize: responseSize,
 				StatusCode:   statusCode,
 				RequestTime:  ctx.startServe,
 				Duration:     time.Since(ctx.startServe),
 			}
 
 			additionalData, _ := ctx.stateBag[al.AccessLogAdditionalDataKey].(map[string]interface{})
+			if ctx.grpcStatus != "" || ctx.fallback != "" {
+				withProxyData := make(map[string]interface{})
+				if ctx.grpcStatus != "" {
+					withProxyData["grpc-status"] = ctx.grpcStatus
+				}
+
+				if ctx.fallback != "" {
+					withProxyData["fallback"] = ctx.fallback
+				}
+
+				for k, v := range additionalData {
+					withProxyData[k] = v
+				}
+
+				additionalData = withProxyData
+			}
 
 			logging.LogAccess(entry, additionalData)
 		}
@@ -1411,6 +1770,7 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	p.setCommonSpanInfo(r.URL, r, span)
 	r = r.WithContext(ot.ContextWithSpan(r.Context(), span))
 
+	traceRouting := p.routingTraceEnabled(r)
 	ctx = newContext(lw, r, p)
 	ctx.startServe = time.Now()
 	ctx.tracer = p.tracing.tracer
@@ -1423,10 +1783,23 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				p.log.Errorf("error during closing the response body: %v", err)
 			}
 		}
+
+		// the backend requests read only copies of a buffered body
+		if b, ok := ctx.request.Body.(*buffer.Body); ok {
+			b.Close()
+		}
 	}()
 
+	if traceRouting {
+		ctx.routingTrace = &routingTrace{}
+	}
+
 	err := p.do(ctx)
 
+	if ctx.routingTrace != nil {
+		ctx.responseWriter.Header().Set(RoutingTraceHeader, ctx.routingTrace.String())
+	}
+
 	if err != nil {
 		p.errorResponse(ctx, err)
 	} else {
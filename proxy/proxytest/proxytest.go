@@ -1,6 +1,7 @@
 package proxytest
 
 import (
+	"net/http"
 	"net/http/httptest"
 	"time"
 
@@ -11,6 +12,8 @@ import (
 	"github.com/zalando/skipper/proxy"
 	"github.com/zalando/skipper/routing"
 	"github.com/zalando/skipper/routing/testdataclient"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 type TestProxy struct {
@@ -22,14 +25,21 @@ type TestProxy struct {
 }
 
 func WithRoutingOptions(fr filters.Registry, o routing.Options, routes ...*eskip.Route) *TestProxy {
-	return newTestProxy(fr, o, proxy.Params{CloseIdleConnsPeriod: -time.Second}, routes...)
+	return newTestProxy(fr, o, proxy.Params{CloseIdleConnsPeriod: -time.Second}, false, routes...)
 }
 
 func WithParams(fr filters.Registry, proxyParams proxy.Params, routes ...*eskip.Route) *TestProxy {
-	return newTestProxy(fr, routing.Options{}, proxyParams, routes...)
+	return newTestProxy(fr, routing.Options{}, proxyParams, false, routes...)
 }
 
-func newTestProxy(fr filters.Registry, routingOptions routing.Options, proxyParams proxy.Params, routes ...*eskip.Route) *TestProxy {
+// WithH2C creates a test proxy that accepts HTTP/2 requests over
+// cleartext (h2c) with prior knowledge, as sent e.g. by gRPC clients,
+// besides the HTTP/1.1 requests.
+func WithH2C(fr filters.Registry, proxyParams proxy.Params, routes ...*eskip.Route) *TestProxy {
+	return newTestProxy(fr, routing.Options{}, proxyParams, true, routes...)
+}
+
+func newTestProxy(fr filters.Registry, routingOptions routing.Options, proxyParams proxy.Params, acceptH2C bool, routes ...*eskip.Route) *TestProxy {
 	tl := loggingtest.New()
 
 	if len(routingOptions.DataClients) == 0 {
@@ -45,7 +55,13 @@ func newTestProxy(fr filters.Registry, routingOptions routing.Options, proxyPara
 	proxyParams.Routing = rt
 
 	pr := proxy.WithParams(proxyParams)
-	tsp := httptest.NewServer(pr)
+
+	var handler http.Handler = pr
+	if acceptH2C {
+		handler = h2c.NewHandler(pr, &http2.Server{})
+	}
+
+	tsp := httptest.NewServer(handler)
 
 	if err := tl.WaitFor("route settings applied", 3*time.Second); err != nil {
 		panic(err)
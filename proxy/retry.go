@@ -0,0 +1,230 @@
+package proxy
+
+import (
+	stdlibcontext "context"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zalando/skipper/filters/buffer"
+	"github.com/zalando/skipper/filters/retry"
+	"github.com/zalando/skipper/tracing"
+)
+
+const (
+	// DefaultRetryBudget is the default ratio of the retries to the
+	// requests that have a retry policy.
+	DefaultRetryBudget = 0.2
+
+	// the budget allows this many retries within a window, even when
+	// the ratio would not allow it, to support low traffic routes
+	retryBudgetMinRetries = 10
+	retryBudgetWindow     = 10 * time.Second
+
+	// the discarded response bodies are drained only up to this size,
+	// the larger ones are closed without reusing the connection
+	maxDrainedBodySize = 4 << 10
+)
+
+// retryBudget limits the number of the retries across all routes, so
+// that retries cannot amplify an outage. It counts the requests and the
+// retries in two consecutive time windows, and estimates the ratio over
+// the last window duration.
+type retryBudget struct {
+	mu       sync.Mutex
+	ratio    float64
+	window   time.Duration
+	start    time.Time
+	requests [2]float64
+	retries  [2]float64
+	disabled bool
+	now      func() time.Time
+}
+
+func newRetryBudget(ratio float64) *retryBudget {
+	return &retryBudget{
+		ratio:    ratio,
+		window:   retryBudgetWindow,
+		start:    time.Now(),
+		disabled: ratio < 0,
+		now:      time.Now,
+	}
+}
+
+// rotate shifts the windows, expects the lock to be held.
+func (b *retryBudget) rotate(now time.Time) float64 {
+	elapsed := now.Sub(b.start)
+	if elapsed >= 2*b.window {
+		b.requests = [2]float64{}
+		b.retries = [2]float64{}
+		b.start = now
+		elapsed = 0
+	} else if elapsed >= b.window {
+		b.requests = [2]float64{b.requests[1], 0}
+		b.retries = [2]float64{b.retries[1], 0}
+		b.start = b.start.Add(b.window)
+		elapsed -= b.window
+	}
+
+	// weight of the previous window in the estimate
+	return 1 - float64(elapsed)/float64(b.window)
+}
+
+func (b *retryBudget) request() {
+	if b.disabled {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rotate(b.now())
+	b.requests[1]++
+}
+
+// allow returns true when a retry fits into the budget, and if it does,
+// it counts it.
+func (b *retryBudget) allow() bool {
+	if b.disabled {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	w := b.rotate(b.now())
+	requests := b.requests[0]*w + b.requests[1]
+	retries := b.retries[0]*w + b.retries[1]
+	if retries >= retryBudgetMinRetries && retries >= requests*b.ratio {
+		return false
+	}
+
+	b.retries[1]++
+	return true
+}
+
+// consumeBody drains a small part of the discarded response body, so
+// that the connection can be reused when the body is short, and closes
+// it.
+func consumeBody(rsp *http.Response) {
+	if rsp == nil || rsp.Body == nil {
+		return
+	}
+
+	io.CopyN(io.Discard, rsp.Body, maxDrainedBodySize)
+	rsp.Body.Close()
+}
+
+func isBodyReplayable(r *http.Request) bool {
+	if _, ok := r.Body.(*buffer.Body); ok {
+		return true
+	}
+
+	return r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 && len(r.TransferEncoding) == 0
+}
+
+// retryErrorClass classifies a failed attempt. It returns false when the
+// error must not be retried regardless of the policy.
+func retryErrorClass(perr *proxyError, backendContext, attemptContext stdlibcontext.Context) (retry.ErrorClass, bool) {
+	switch {
+	case perr.handled || perr.code == 499 || backendContext.Err() != nil:
+		return 0, false
+	case perr.DialError():
+		return retry.ConnectError, true
+	case attemptContext.Err() == stdlibcontext.DeadlineExceeded || perr.code == http.StatusGatewayTimeout:
+		return retry.TimeoutError, true
+	default:
+		return retry.ResetError, true
+	}
+}
+
+func (p *Proxy) retryBackoff(backendContext stdlibcontext.Context, policy *retry.Policy, attempt int) bool {
+	max := policy.BackoffFor(attempt)
+	if max <= 0 {
+		return true
+	}
+
+	// full jitter
+	/* #nosec */
+	d := time.Duration(rand.Int63n(int64(max) + 1))
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-backendContext.Done():
+		return false
+	}
+}
+
+// makeBackendRequestWithRetry executes the backend request according to
+// the retry policy of the route. Each attempt can be hedged, and, for
+// load balanced routes, it picks an endpoint that was not tried before,
+// if there is one.
+func (p *Proxy) makeBackendRequestWithRetry(ctx *context, backendContext stdlibcontext.Context, policy *retry.Policy) (*http.Response, *proxyError) {
+	p.retryBudget.request()
+	ctx.triedEndpoints = make(map[string]struct{})
+	defer func() { ctx.triedEndpoints = nil }()
+
+	canRetry := isBodyReplayable(ctx.request)
+	for attempt := 1; ; attempt++ {
+		attemptContext := backendContext
+		var cancel stdlibcontext.CancelFunc
+		if policy.PerTryTimeout > 0 {
+			attemptContext, cancel = stdlibcontext.WithTimeout(backendContext, policy.PerTryTimeout)
+		}
+
+		rsp, perr := p.makeBackendRequestWithHedging(ctx, attemptContext)
+		if ctx.proxySpan != nil && attempt > 1 {
+			p.tracing.setTag(ctx.proxySpan, RetryAttemptTag, attempt-1)
+		}
+
+		retryThis := false
+		if perr != nil {
+			if class, ok := retryErrorClass(perr, backendContext, attemptContext); ok {
+				retryThis = policy.RetriesError(class)
+			}
+		} else {
+			retryThis = policy.RetriesStatus(rsp.StatusCode)
+		}
+
+		if retryThis && canRetry && attempt < policy.MaxAttempts && !p.retryBudget.allow() {
+			p.metrics.IncCounter("retry." + ctx.route.Id + ".budgetexceeded")
+			tracing.LogKV("retry_budget", "exceeded", ctx.request.Context())
+			retryThis = false
+		}
+
+		if !retryThis || !canRetry || attempt >= policy.MaxAttempts {
+			// the response body is still to be streamed within the
+			// attempt context
+			if cancel != nil && perr == nil {
+				ctx.addBackendContextCancel(cancel)
+			} else if cancel != nil {
+				cancel()
+			}
+
+			return rsp, perr
+		}
+
+		consumeBody(rsp)
+		if cancel != nil {
+			cancel()
+		}
+
+		if ctx.proxySpan != nil {
+			ctx.proxySpan.Finish()
+			ctx.proxySpan = nil
+		}
+
+		p.metrics.IncCounter("retry." + ctx.route.Id + ".attempts")
+		tracing.LogKV("retry", ctx.route.Id, ctx.request.Context())
+		if !p.retryBackoff(backendContext, policy, attempt+1) {
+			if backendContext.Err() == stdlibcontext.DeadlineExceeded {
+				return nil, &proxyError{err: backendContext.Err(), code: http.StatusGatewayTimeout}
+			}
+
+			return nil, &proxyError{err: backendContext.Err(), code: 499}
+		}
+	}
+}
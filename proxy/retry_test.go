@@ -0,0 +1,283 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/metrics/metricstest"
+)
+
+type countingBackend struct {
+	*httptest.Server
+	hits int64
+}
+
+func newCountingBackend(status int, delay time.Duration) *countingBackend {
+	b := &countingBackend{}
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&b.hits, 1)
+		time.Sleep(delay)
+		w.WriteHeader(status)
+	}))
+
+	return b
+}
+
+func (b *countingBackend) count() int {
+	return int(atomic.LoadInt64(&b.hits))
+}
+
+func testRetryProxy(t *testing.T, doc string) (*testProxy, *httptest.Server, *metricstest.MockMetrics) {
+	tp, err := newTestProxy(doc, FlagsNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &metricstest.MockMetrics{}
+	tp.proxy.metrics = countingMetrics{Metrics: metrics.Void, mock: m}
+	return tp, httptest.NewServer(tp.proxy), m
+}
+
+func getStatus(t *testing.T, u string) int {
+	rsp, err := http.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rsp.Body.Close()
+	return rsp.StatusCode
+}
+
+func TestRetryOnStatusWithDifferentEndpoint(t *testing.T) {
+	failing := newCountingBackend(http.StatusServiceUnavailable, 0)
+	defer failing.Close()
+
+	healthy := newCountingBackend(http.StatusOK, 0)
+	defer healthy.Close()
+
+	doc := fmt.Sprintf(`r: * -> retry(2, "503") -> <roundRobin, "%s", "%s">`, failing.URL, healthy.URL)
+	tp, ps, m := testRetryProxy(t, doc)
+	defer tp.close()
+	defer ps.Close()
+
+	for i := 0; i < 10; i++ {
+		if s := getStatus(t, ps.URL); s != http.StatusOK {
+			t.Fatalf("failed to retry, got: %d", s)
+		}
+	}
+
+	if healthy.count() != 10 {
+		t.Errorf("expected 10 requests to the healthy endpoint, got: %d", healthy.count())
+	}
+
+	m.WithCounters(func(c map[string]int64) {
+		if c["retry.r.attempts"] != int64(failing.count()) {
+			t.Errorf("invalid number of retries: %d, expected: %d", c["retry.r.attempts"], failing.count())
+		}
+	})
+}
+
+func TestRetryOnConnectError(t *testing.T) {
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	healthy := newCountingBackend(http.StatusOK, 0)
+	defer healthy.Close()
+
+	doc := fmt.Sprintf(`r: * -> retry(2) -> <roundRobin, "%s", "%s">`, closed.URL, healthy.URL)
+	tp, ps, _ := testRetryProxy(t, doc)
+	defer tp.close()
+	defer ps.Close()
+
+	for i := 0; i < 10; i++ {
+		if s := getStatus(t, ps.URL); s != http.StatusOK {
+			t.Fatalf("failed to retry, got: %d", s)
+		}
+	}
+}
+
+func TestRetryMaxAttempts(t *testing.T) {
+	failing := newCountingBackend(http.StatusBadGateway, 0)
+	defer failing.Close()
+
+	doc := fmt.Sprintf(`r: * -> retry(3, "5xx", "connect", "1s", "1ms", "2ms") -> "%s"`, failing.URL)
+	tp, ps, _ := testRetryProxy(t, doc)
+	defer tp.close()
+	defer ps.Close()
+
+	if s := getStatus(t, ps.URL); s != http.StatusBadGateway {
+		t.Errorf("expected the last response, got: %d", s)
+	}
+
+	if failing.count() != 3 {
+		t.Errorf("expected 3 attempts, got: %d", failing.count())
+	}
+}
+
+func TestRetryNotConfiguredStatus(t *testing.T) {
+	failing := newCountingBackend(http.StatusInternalServerError, 0)
+	defer failing.Close()
+
+	doc := fmt.Sprintf(`r: * -> retry(3, "503") -> "%s"`, failing.URL)
+	tp, ps, _ := testRetryProxy(t, doc)
+	defer tp.close()
+	defer ps.Close()
+
+	if s := getStatus(t, ps.URL); s != http.StatusInternalServerError {
+		t.Errorf("unexpected status: %d", s)
+	}
+
+	if failing.count() != 1 {
+		t.Errorf("expected a single attempt, got: %d", failing.count())
+	}
+}
+
+func TestRetryPerTryTimeout(t *testing.T) {
+	slow := newCountingBackend(http.StatusOK, 100*time.Millisecond)
+	defer slow.Close()
+
+	fast := newCountingBackend(http.StatusOK, 0)
+	defer fast.Close()
+
+	doc := fmt.Sprintf(`r: * -> retry(2, "", "timeout", "30ms") -> <roundRobin, "%s", "%s">`, slow.URL, fast.URL)
+	tp, ps, _ := testRetryProxy(t, doc)
+	defer tp.close()
+	defer ps.Close()
+
+	for i := 0; i < 4; i++ {
+		if s := getStatus(t, ps.URL); s != http.StatusOK {
+			t.Fatalf("failed to retry, got: %d", s)
+		}
+	}
+}
+
+func TestRetryRequestWithBody(t *testing.T) {
+	failing := newCountingBackend(http.StatusServiceUnavailable, 0)
+	defer failing.Close()
+
+	doc := fmt.Sprintf(`r: * -> retry(3, "503") -> "%s"`, failing.URL)
+	tp, ps, _ := testRetryProxy(t, doc)
+	defer tp.close()
+	defer ps.Close()
+
+	rsp, err := http.Post(ps.URL, "text/plain", strings.NewReader("Hello, world!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status: %d", rsp.StatusCode)
+	}
+
+	if failing.count() != 1 {
+		t.Errorf("expected a single attempt, got: %d", failing.count())
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	now := time.Now()
+	b := newRetryBudget(0.2)
+	b.start = now
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < 100; i++ {
+		b.request()
+	}
+
+	var allowed int
+	for i := 0; i < 100; i++ {
+		if b.allow() {
+			allowed++
+		}
+	}
+
+	if allowed != 20 {
+		t.Errorf("expected 20 allowed retries, got: %d", allowed)
+	}
+
+	// half of the previous window is still considered
+	now = now.Add(retryBudgetWindow + retryBudgetWindow/2)
+	if b.allow() {
+		t.Error("unexpected retry allowed")
+	}
+
+	// the budget is reset after two windows
+	now = now.Add(2 * retryBudgetWindow)
+	allowed = 0
+	for i := 0; i < 100; i++ {
+		if b.allow() {
+			allowed++
+		}
+	}
+
+	if allowed != retryBudgetMinRetries {
+		t.Errorf("expected %d allowed retries, got: %d", retryBudgetMinRetries, allowed)
+	}
+
+	disabled := newRetryBudget(-1)
+	for i := 0; i < 100; i++ {
+		if !disabled.allow() {
+			t.Fatal("unexpected retry rejected")
+		}
+	}
+}
+
+func TestRetryBudgetExceeded(t *testing.T) {
+	failing := newCountingBackend(http.StatusServiceUnavailable, 0)
+	defer failing.Close()
+
+	doc := fmt.Sprintf(`r: * -> retry(2, "503", "", 0, "1ms", "1ms") -> "%s"`, failing.URL)
+	tp, ps, m := testRetryProxy(t, doc)
+	defer tp.close()
+	defer ps.Close()
+
+	const requests = 30
+	for i := 0; i < requests; i++ {
+		getStatus(t, ps.URL)
+	}
+
+	// 10 minimum retries are allowed, then the ratio applies
+	if n := failing.count() - requests; n < retryBudgetMinRetries || n >= requests {
+		t.Errorf("unexpected number of retries: %d", n)
+	}
+
+	m.WithCounters(func(c map[string]int64) {
+		if c["retry.r.budgetexceeded"] == 0 {
+			t.Error("expected budget exceeded metrics")
+		}
+	})
+}
+
+type endlessBody struct {
+	read   int64
+	closed bool
+}
+
+func (b *endlessBody) Read(p []byte) (int, error) {
+	b.read += int64(len(p))
+	return len(p), nil
+}
+
+func (b *endlessBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestConsumeBodyLimited(t *testing.T) {
+	body := &endlessBody{}
+	consumeBody(&http.Response{Body: body})
+	if body.read > maxDrainedBodySize {
+		t.Errorf("drained too much: %d", body.read)
+	}
+
+	if !body.closed {
+		t.Error("failed to close the body")
+	}
+}
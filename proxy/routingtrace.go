@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+)
+
+// RoutingTraceHeader is the request header enabling the routing trace,
+// and the response header containing it, as JSON.
+const RoutingTraceHeader = "X-Skipper-Routing-Trace"
+
+const (
+	routingTraceAllowed  = "allowed"
+	routingTraceRejected = "rejected"
+)
+
+// the ratelimit filters rejecting a request by serving it
+var routingTraceRatelimitFilters = map[string]bool{
+	filters.RatelimitName:              true,
+	filters.ClientRatelimitName:        true,
+	filters.ClusterRatelimitName:       true,
+	filters.ClusterClientRatelimitName: true,
+}
+
+type (
+	// routingTrace collects the routing decisions of a request, when
+	// enabled by the routing trace header. The loopback and fallback
+	// contexts share the trace of the original request, and record
+	// their own hop.
+	routingTrace struct {
+		mu        sync.Mutex
+		Ratelimit string             `json:"ratelimit,omitempty"`
+		Hops      []*routingTraceHop `json:"hops,omitempty"`
+	}
+
+	routingTraceHop struct {
+		trace           *routingTrace
+		RouteID         string               `json:"route_id"`
+		Via             string               `json:"via,omitempty"`
+		RequestFilters  []routingTraceFilter `json:"request_filters,omitempty"`
+		ResponseFilters []routingTraceFilter `json:"response_filters,omitempty"`
+		ServedBy        string               `json:"served_by,omitempty"`
+		Ratelimit       string               `json:"ratelimit,omitempty"`
+		Breaker         string               `json:"breaker,omitempty"`
+		Endpoints       []string             `json:"endpoints,omitempty"`
+	}
+
+	routingTraceFilter struct {
+		Name     string `json:"name"`
+		Duration int64  `json:"duration_us"`
+	}
+)
+
+// routingTraceEnabled checks whether the request asks for the routing
+// trace, and whether it is allowed by the secret or the remote address.
+func (p *Proxy) routingTraceEnabled(r *http.Request) bool {
+	v, ok := r.Header[RoutingTraceHeader]
+	if !ok {
+		return false
+	}
+
+	// the header is not forwarded, it may contain the secret
+	r.Header.Del(RoutingTraceHeader)
+
+	if p.routingTraceSecret != "" && len(v) > 0 &&
+		subtle.ConstantTimeCompare([]byte(v[0]), []byte(p.routingTraceSecret)) == 1 {
+		return true
+	}
+
+	if len(p.routingTraceAllowCIDRs) > 0 {
+		if ip := net.ParseIP(stripPort(r.RemoteAddr)); ip != nil && p.routingTraceAllowCIDRs.Contain(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *routingTrace) addHop(routeID, via string) *routingTraceHop {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := &routingTraceHop{trace: t, RouteID: routeID, Via: via}
+	t.Hops = append(t.Hops, h)
+	return h
+}
+
+func (t *routingTrace) setRatelimit(decision string) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Ratelimit = decision
+}
+
+func (t *routingTrace) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err.Error()
+	}
+
+	return string(b)
+}
+
+func (h *routingTraceHop) requestFilter(name string, d time.Duration, served bool) {
+	if h == nil {
+		return
+	}
+
+	h.trace.mu.Lock()
+	defer h.trace.mu.Unlock()
+	h.RequestFilters = append(h.RequestFilters, routingTraceFilter{Name: name, Duration: d.Microseconds()})
+	if served {
+		h.ServedBy = name
+	}
+
+	if routingTraceRatelimitFilters[name] {
+		h.ratelimit(!served)
+	}
+}
+
+func (h *routingTraceHop) responseFilter(name string, d time.Duration) {
+	if h == nil {
+		return
+	}
+
+	h.trace.mu.Lock()
+	defer h.trace.mu.Unlock()
+	h.ResponseFilters = append(h.ResponseFilters, routingTraceFilter{Name: name, Duration: d.Microseconds()})
+}
+
+// ratelimit records the decision of a ratelimit, the request is
+// rejected when any of the ratelimits rejected it. It expects the lock
+// to be held.
+func (h *routingTraceHop) ratelimit(allowed bool) {
+	switch {
+	case !allowed:
+		h.Ratelimit = routingTraceRejected
+	case h.Ratelimit == "":
+		h.Ratelimit = routingTraceAllowed
+	}
+}
+
+func (h *routingTraceHop) backendRatelimit(allowed bool) {
+	if h == nil {
+		return
+	}
+
+	h.trace.mu.Lock()
+	defer h.trace.mu.Unlock()
+	h.ratelimit(allowed)
+}
+
+func (h *routingTraceHop) breaker(allowed bool) {
+	if h == nil {
+		return
+	}
+
+	h.trace.mu.Lock()
+	defer h.trace.mu.Unlock()
+	if allowed {
+		h.Breaker = routingTraceAllowed
+	} else {
+		h.Breaker = routingTraceRejected
+	}
+}
+
+func (h *routingTraceHop) endpoint(u string) {
+	if h == nil {
+		return
+	}
+
+	h.trace.mu.Lock()
+	defer h.trace.mu.Unlock()
+	h.Endpoints = append(h.Endpoints, u)
+}
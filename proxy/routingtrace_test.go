@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zalando/skipper/circuit"
+	snet "github.com/zalando/skipper/net"
+)
+
+func TestRoutingTrace(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(RoutingTraceHeader) != "" {
+			t.Error("routing trace header forwarded to the backend")
+		}
+	}))
+	defer backend.Close()
+
+	doc := fmt.Sprintf(`
+		loop: Path("/loop") -> setPath("/target") -> <loopback>;
+		target: Path("/target") -> setResponseHeader("X-Foo", "bar") -> <roundRobin, "%[1]s">;
+		network: Path("/network") -> "%[1]s";
+		served: Path("/served") -> inlineContent("foo") -> <shunt>;
+	`, backend.URL)
+
+	localhost, err := snet.ParseCIDRs([]string{"127.0.0.1/8", "::1/128"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		params   Params
+		path     string
+		header   []string
+		expected *routingTrace
+	}{{
+		name:   "disabled",
+		path:   "/loop",
+		header: []string{"secret"},
+	}, {
+		name:   "no header",
+		params: Params{RoutingTraceSecret: "secret"},
+		path:   "/loop",
+	}, {
+		name:   "wrong secret",
+		params: Params{RoutingTraceSecret: "secret"},
+		path:   "/loop",
+		header: []string{"foo"},
+	}, {
+		name:   "loopback",
+		params: Params{RoutingTraceSecret: "secret"},
+		path:   "/loop",
+		header: []string{"secret"},
+		expected: &routingTrace{Hops: []*routingTraceHop{{
+			RouteID:         "loop",
+			RequestFilters:  []routingTraceFilter{{Name: "setPath"}},
+			ResponseFilters: []routingTraceFilter{{Name: "setPath"}},
+		}, {
+			RouteID:         "target",
+			Via:             "loopback",
+			RequestFilters:  []routingTraceFilter{{Name: "setResponseHeader"}},
+			ResponseFilters: []routingTraceFilter{{Name: "setResponseHeader"}},
+			Endpoints:       []string{backend.URL},
+		}}},
+	}, {
+		name:   "served by filter",
+		params: Params{RoutingTraceSecret: "secret"},
+		path:   "/served",
+		header: []string{"secret"},
+		expected: &routingTrace{Hops: []*routingTraceHop{{
+			RouteID:         "served",
+			RequestFilters:  []routingTraceFilter{{Name: "inlineContent"}},
+			ResponseFilters: []routingTraceFilter{{Name: "inlineContent"}},
+			ServedBy:        "inlineContent",
+		}}},
+	}, {
+		name: "allowed source with circuit breaker",
+		params: Params{
+			RoutingTraceAllowCIDRs: localhost,
+			CircuitBreakers: circuit.NewRegistry(circuit.BreakerSettings{
+				Type:     circuit.ConsecutiveFailures,
+				Failures: 3,
+			}),
+		},
+		path:   "/network",
+		header: []string{"any"},
+		expected: &routingTrace{Hops: []*routingTraceHop{{
+			RouteID:   "network",
+			Breaker:   "allowed",
+			Endpoints: []string{backend.URL},
+		}}},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := newTestProxyWithParams(doc, tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer tp.close()
+			ps := httptest.NewServer(tp.proxy)
+			defer ps.Close()
+
+			req, err := http.NewRequest("GET", ps.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, h := range tt.header {
+				req.Header.Add(RoutingTraceHeader, h)
+			}
+
+			rsp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer rsp.Body.Close()
+			if rsp.StatusCode != http.StatusOK {
+				t.Fatalf("unexpected status: %d", rsp.StatusCode)
+			}
+
+			h := rsp.Header.Get(RoutingTraceHeader)
+			if tt.expected == nil {
+				if h != "" {
+					t.Fatalf("unexpected routing trace: %s", h)
+				}
+
+				return
+			}
+
+			var trace routingTrace
+			if err := json.Unmarshal([]byte(h), &trace); err != nil {
+				t.Fatalf("failed to parse the routing trace: %v, %s", err, h)
+			}
+
+			// the durations are not deterministic
+			for _, hop := range trace.Hops {
+				for i := range hop.RequestFilters {
+					hop.RequestFilters[i].Duration = 0
+				}
+
+				for i := range hop.ResponseFilters {
+					hop.ResponseFilters[i].Duration = 0
+				}
+			}
+
+			got, _ := json.Marshal(&trace)
+			expected, _ := json.Marshal(tt.expected)
+			if string(got) != string(expected) {
+				t.Errorf("unexpected routing trace, expected: %s, got: %s", expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/zalando/skipper/filters/cache"
+)
+
+// staleIfErrorResponse returns the stale cached response provided by the
+// cache filter, when the backend request failed without a response, and
+// stale-if-error allows serving it.
+func staleIfErrorResponse(ctx *context, perr *proxyError) *http.Response {
+	stale, ok := ctx.StateBag()[cache.StaleIfErrorKey].(*cache.StaleIfError)
+	if !ok || perr.handled || perr.code == 499 || ctx.request.Context().Err() != nil {
+		return nil
+	}
+
+	return stale.Response(ctx)
+}
@@ -5,6 +5,8 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+
+	"github.com/zalando/skipper/filters/buffer"
 )
 
 type teeTie struct {
@@ -45,7 +47,11 @@ func cloneRequestForSplit(u *url.URL, req *http.Request) (*http.Request, io.Read
 	var teeBody io.ReadCloser
 	mainBody := req.Body
 
-	if req.ContentLength != 0 {
+	if b, ok := req.Body.(*buffer.Body); ok {
+		// the buffered body is shared, the clone is released by the
+		// loopback of the split context
+		teeBody = b.Clone()
+	} else if req.ContentLength != 0 {
 		pr, pw := io.Pipe()
 		teeBody = pr
 		mainBody = &teeTie{mainBody, pw}
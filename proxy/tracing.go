@@ -10,7 +10,10 @@ const (
 	ClientRequestStateTag = "client.request"
 	ComponentTag          = "component"
 	ErrorTag              = "error"
+	FallbackTag           = "skipper.fallback"
 	FlowIDTag             = "flow_id"
+	HedgeAttemptTag       = "skipper.hedge_attempt"
+	HedgeCanceledTag      = "skipper.hedge_canceled"
 	HostnameTag           = "hostname"
 	HTTPHostTag           = "http.host"
 	HTTPMethodTag         = "http.method"
@@ -18,6 +21,7 @@ const (
 	HTTPPathTag           = "http.path"
 	HTTPUrlTag            = "http.url"
 	HTTPStatusCodeTag     = "http.status_code"
+	RetryAttemptTag       = "skipper.retry_attempt"
 	SkipperRouteIDTag     = "skipper.route_id"
 	SpanKindTag           = "span.kind"
 
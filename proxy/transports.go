@@ -0,0 +1,300 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zalando/skipper/filters/backendtls"
+	"github.com/zalando/skipper/filters/connectionpool"
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/routing"
+)
+
+type routeTransport struct {
+	roundTripper    http.RoundTripper
+	closeIdle       func()
+	maxConnsPerHost int
+
+	// the in-flight requests per backend host, and per route, because
+	// the routes with the same settings share the transport
+	mu            sync.Mutex
+	inflight      map[string]int
+	routeInflight map[string]int
+}
+
+// routeTransports caches the backend transports of the routes with their
+// own TLS configuration, set by the backendTLS filter, or with their own
+// connection pool, set by the backendConnectionPool filter. The
+// transports are identified by the protocol, the key of the TLS
+// configuration and the key of the pool settings, and they are shared by
+// the routes with the same settings. When the TLS material changes, e.g.
+// due to rotated certificates, the key changes, and a new transport is
+// created. The transports that are not referenced by any of the current
+// routes, e.g. because their routes were removed, or because their TLS
+// material changed, are dropped. The cleanup runs periodically, also
+// when closing the idle connections is disabled.
+type routeTransports struct {
+	mu         sync.Mutex
+	transports map[string]*routeTransport
+	create     func(protocol string, c *tls.Config, pool *connectionpool.Config) (http.RoundTripper, func())
+}
+
+// poolRoundTripper counts the in-flight requests of a route, and the
+// in-flight requests of the route transport per backend host, to report
+// the saturation of the connection pool.
+type poolRoundTripper struct {
+	transport *routeTransport
+	metrics   metrics.Metrics
+	routeID   string
+}
+
+// the filters exposing the backend settings of a route, used to find the
+// transports referenced by the current routes
+type (
+	backendProtocolFilter interface{ BackendProtocol() string }
+	backendTLSFilter      interface{ BackendTLSConfig() *backendtls.Config }
+	connectionPoolFilter  interface{ ConnectionPoolConfig() *connectionpool.Config }
+)
+
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func newRouteTransports(
+	tr *http.Transport,
+	h2TLS *tls.Config,
+	dialer *skipperDialer,
+	handshakeTimeout time.Duration,
+	wrap func(http.RoundTripper) http.RoundTripper,
+) *routeTransports {
+	return &routeTransports{
+		transports: make(map[string]*routeTransport),
+		create: func(protocol string, c *tls.Config, pool *connectionpool.Config) (http.RoundTripper, func()) {
+			switch protocol {
+			case "h2":
+				if c == nil {
+					c = h2TLS
+				}
+
+				h2 := newH2Transport(dialer, c.Clone(), handshakeTimeout)
+				return wrap(h2), h2.CloseIdleConnections
+			default:
+				t := tr.Clone()
+				if c != nil {
+					t.TLSClientConfig = c.Clone()
+				}
+
+				if pool != nil {
+					t.MaxConnsPerHost = pool.MaxConnsPerHost
+					if pool.MaxIdleConnsPerHost > 0 {
+						t.MaxIdleConnsPerHost = pool.MaxIdleConnsPerHost
+					}
+
+					if pool.IdleConnTimeout > 0 {
+						t.IdleConnTimeout = pool.IdleConnTimeout
+					}
+
+					if pool.ResponseHeaderTimeout > 0 {
+						t.ResponseHeaderTimeout = pool.ResponseHeaderTimeout
+					}
+				}
+
+				return wrap(t), t.CloseIdleConnections
+			}
+		},
+	}
+}
+
+// transportConfigs returns the settings that apply to the backend
+// transport of a protocol. The TLS settings don't apply to h2c, and the
+// HTTP/2 requests are multiplexed on a single connection per host, so
+// the connection pool settings apply only to HTTP/1.1.
+func transportConfigs(protocol string, c *backendtls.Config, pool *connectionpool.Config) (*backendtls.Config, *connectionpool.Config) {
+	if protocol == "h2c" {
+		c = nil
+	}
+
+	if protocol == "h2" || protocol == "h2c" {
+		pool = nil
+	}
+
+	return c, pool
+}
+
+func transportKey(protocol string, c *backendtls.Config, pool *connectionpool.Config) string {
+	key := protocol + " "
+	if c != nil {
+		key += c.Key
+	}
+
+	key += " "
+	if pool != nil {
+		key += pool.Key
+	}
+
+	return key
+}
+
+// referencedTransports returns the keys of the transports referenced by
+// the backend settings of the routes. The settings are taken from the
+// filters of the routes, the last one of a kind wins, the same way as in
+// the state bag. The TLS configuration of a route is known only after
+// its first request.
+func referencedTransports(routes []*routing.Route) map[string]bool {
+	keys := make(map[string]bool)
+	for _, r := range routes {
+		var (
+			protocol string
+			c        *backendtls.Config
+			pool     *connectionpool.Config
+		)
+
+		for _, rf := range r.Filters {
+			switch f := rf.Filter.(type) {
+			case backendProtocolFilter:
+				protocol = f.BackendProtocol()
+			case backendTLSFilter:
+				if fc := f.BackendTLSConfig(); fc != nil {
+					c = fc
+				}
+			case connectionPoolFilter:
+				pool = f.ConnectionPoolConfig()
+			}
+		}
+
+		c, pool = transportConfigs(protocol, c, pool)
+		if c != nil || pool != nil {
+			keys[transportKey(protocol, c, pool)] = true
+		}
+	}
+
+	return keys
+}
+
+func (t *routeTransports) get(protocol string, c *backendtls.Config, pool *connectionpool.Config) *routeTransport {
+	key := transportKey(protocol, c, pool)
+	var tlsConfig *tls.Config
+	if c != nil {
+		tlsConfig = c.TLS
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rt, ok := t.transports[key]
+	if !ok {
+		roundTripper, closeIdle := t.create(protocol, tlsConfig, pool)
+		rt = &routeTransport{
+			roundTripper:  roundTripper,
+			closeIdle:     closeIdle,
+			inflight:      make(map[string]int),
+			routeInflight: make(map[string]int),
+		}
+
+		if pool != nil {
+			rt.maxConnsPerHost = pool.MaxConnsPerHost
+		}
+
+		t.transports[key] = rt
+	}
+
+	return rt
+}
+
+// closeIdle closes the idle connections of the transports.
+func (t *routeTransports) closeIdle() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, rt := range t.transports {
+		rt.closeIdle()
+	}
+}
+
+// cleanup drops the transports that are not referenced by the current
+// routes, and closes their idle connections. The requests in flight on a
+// dropped transport are not affected.
+func (t *routeTransports) cleanup(referenced map[string]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, rt := range t.transports {
+		if !referenced[key] {
+			rt.closeIdle()
+			delete(t.transports, key)
+		}
+	}
+}
+
+func (t *routeTransports) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.transports)
+}
+
+func decrement(m map[string]int, key string) int {
+	m[key]--
+	n := m[key]
+	if n <= 0 {
+		delete(m, key)
+	}
+
+	return n
+}
+
+// acquire counts an in-flight request of the route to the host, and
+// returns the number of the in-flight requests of the route, and the
+// number of the in-flight requests to the host on the transport,
+// including the current one.
+func (rt *routeTransport) acquire(routeID, host string) (int, int) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.routeInflight[routeID]++
+	rt.inflight[host]++
+	return rt.routeInflight[routeID], rt.inflight[host]
+}
+
+// release returns the number of the remaining in-flight requests of the
+// route.
+func (rt *routeTransport) release(routeID, host string) int {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	decrement(rt.inflight, host)
+	return decrement(rt.routeInflight, routeID)
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// RoundTrip executes the request with the transport of the pool. The
+// connection of a request is in use until its response body is closed,
+// so the in-flight request is counted until then. When all the allowed
+// connections to the host are in use, the request waits for a free
+// connection, and it is counted as saturated.
+func (p poolRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	inflightKey := "backendconnectionpool." + p.routeID + ".inflight"
+	routeInflight, hostInflight := p.transport.acquire(p.routeID, host)
+	p.metrics.UpdateGauge(inflightKey, float64(routeInflight))
+	if p.transport.maxConnsPerHost > 0 && hostInflight > p.transport.maxConnsPerHost {
+		p.metrics.IncCounter("backendconnectionpool." + p.routeID + ".saturated")
+	}
+
+	release := func() {
+		p.metrics.UpdateGauge(inflightKey, float64(p.transport.release(p.routeID, host)))
+	}
+
+	rsp, err := p.transport.roundTripper.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	rsp.Body = &releaseBody{ReadCloser: rsp.Body, release: release}
+	return rsp, nil
+}
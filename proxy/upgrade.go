@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -13,6 +14,8 @@ import (
 	"strings"
 
 	log "github.com/sirupsen/logrus"
+	websocketfilters "github.com/zalando/skipper/filters/websocket"
+	"github.com/zalando/skipper/metrics"
 )
 
 // isUpgradeRequest returns true if and only if there is a "Connection"
@@ -46,6 +49,9 @@ type upgradeProxy struct {
 	auditLogOut     io.Writer
 	auditLogErr     io.Writer
 	auditLogHook    chan struct{}
+	webSocket       *websocketfilters.Config
+	metrics         metrics.Metrics
+	routeID         string
 }
 
 // TODO: add user here
@@ -105,7 +111,8 @@ func (p *upgradeProxy) serveHTTP(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 
-	resp, err := http.ReadResponse(bufio.NewReader(backendConn), req)
+	backendReader := bufio.NewReader(backendConn)
+	resp, err := http.ReadResponse(backendReader, req)
 	if err != nil {
 		log.Errorf("Error reading response from backend: %s", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -132,7 +139,7 @@ func (p *upgradeProxy) serveHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	requestHijackedConn, _, err := w.(http.Hijacker).Hijack()
+	requestHijackedConn, requestReadWriter, err := w.(http.Hijacker).Hijack()
 	if err != nil {
 		log.Errorf("Error hijacking request connection: %s", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -150,22 +157,34 @@ func (p *upgradeProxy) serveHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	done := make(chan struct{}, 2)
+	if p.webSocket != nil && strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		var clientOut io.Writer = requestHijackedConn
+		if p.useAuditLog {
+			clientOut = io.MultiWriter(requestHijackedConn, p.auditLogOut)
+		}
 
-	if p.useAuditLog {
-		copyAsync("backend->request+audit", backendConn, io.MultiWriter(requestHijackedConn, p.auditLogOut), done)
-	} else {
-		copyAsync("backend->request", backendConn, requestHijackedConn, done)
-	}
+		session := newWebSocketSession(
+			p.webSocket,
+			p.metrics,
+			p.routeID,
+			newWSPeer("client", requestHijackedConn, requestReadWriter.Reader, clientOut, false),
+			newWSPeer("backend", backendConn, backendReader, backendConn, true),
+		)
 
-	copyAsync("request->backend", requestHijackedConn, backendConn, done)
+		log.Debugf("Successfully upgraded to protocol %s by user request, forwarding frames", getUpgradeRequest(req))
 
-	log.Debugf("Successfully upgraded to protocol %s by user request", getUpgradeRequest(req))
+		// Return from this method closes both request and backend connections via defer
+		// and thus unblocks the other direction.
+		session.serve()
+	} else {
+		var clientOut io.Writer = requestHijackedConn
+		if p.useAuditLog {
+			clientOut = io.MultiWriter(requestHijackedConn, p.auditLogOut)
+		}
 
-	// Wait for either copyAsync to complete.
-	// Return from this method closes both request and backend connections via defer
-	// and thus unblocks the second copyAsync.
-	<-done
+		log.Debugf("Successfully upgraded to protocol %s by user request", getUpgradeRequest(req))
+		tunnel(requestHijackedConn, requestHijackedConn, clientOut, backendConn, backendConn)
+	}
 
 	if p.useAuditLog {
 		select {
@@ -205,17 +224,43 @@ func (p *upgradeProxy) dialBackend(req *http.Request) (net.Conn, error) {
 	}
 }
 
-func copyAsync(dir string, src io.Reader, dst io.Writer, done chan<- struct{}) {
+func copyAsync(dir string, src io.Reader, dst io.Writer, done chan<- int64) {
 	go func() {
-		_, err := io.Copy(dst, src)
+		n, err := io.Copy(dst, src)
 		// net: errClosing not exported https://github.com/golang/go/issues/4373
-		if err != nil && !strings.Contains(err.Error(), "use of closed network connection") {
+		if err != nil && !errors.Is(err, net.ErrClosed) && !strings.Contains(err.Error(), "use of closed network connection") {
 			log.Errorf("error copying data %s: %v", dir, err)
 		}
-		done <- struct{}{}
+		done <- n
 	}()
 }
 
+// tunnel copies the data between the hijacked client connection and the
+// backend connection in both directions, used by the upgraded and the
+// CONNECT requests. When either direction is finished, it closes both
+// connections to unblock the other direction. It returns the number of
+// bytes copied from the client to the backend, and from the backend to
+// the client.
+func tunnel(client net.Conn, clientIn io.Reader, clientOut io.Writer, backend net.Conn, backendIn io.Reader) (received, sent int64) {
+	toBackend := make(chan int64, 1)
+	toClient := make(chan int64, 1)
+	copyAsync("request->backend", clientIn, backend, toBackend)
+	copyAsync("backend->request", backendIn, clientOut, toClient)
+
+	select {
+	case received = <-toBackend:
+		client.Close()
+		backend.Close()
+		sent = <-toClient
+	case sent = <-toClient:
+		client.Close()
+		backend.Close()
+		received = <-toBackend
+	}
+
+	return
+}
+
 // FROM: http://golang.org/src/net/http/client.go
 // Given a string of the form "host", "host:port", or "[ipv6::address]:port",
 // return true if the string includes a port.
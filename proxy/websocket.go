@@ -0,0 +1,372 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	websocketfilters "github.com/zalando/skipper/filters/websocket"
+	"github.com/zalando/skipper/metrics"
+)
+
+// WebSocket opcodes and close codes, see
+// https://datatracker.ietf.org/doc/html/rfc6455#section-5.2 and
+// https://datatracker.ietf.org/doc/html/rfc6455#section-7.4.1
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+
+	wsCloseGoingAway      = 1001
+	wsCloseMessageTooBig  = 1009
+	wsCloseNoStatus       = 1005
+	wsMaxControlFrameSize = 125
+
+	// wsCloseWriteTimeout limits the time waiting to send a close frame,
+	// while a frame is being forwarded to the same peer
+	wsCloseWriteTimeout = time.Second
+)
+
+var errWebSocketControlFrameTooLarge = errors.New("websocket: control frame too large")
+
+type wsFrameHeader struct {
+	fin     bool
+	opcode  byte
+	masked  bool
+	length  int64
+	maskKey [4]byte
+	raw     []byte
+}
+
+// wsPeer is one side of the upgraded connection. The writes to a peer
+// are serialized per frame, so that the proxy can inject close frames.
+type wsPeer struct {
+	name string
+	conn net.Conn
+	r    io.Reader
+	w    io.Writer
+
+	// frames sent to the backend need to be masked
+	mask bool
+
+	// write lock with timeout
+	lock chan struct{}
+}
+
+// webSocketSession forwards the WebSocket frames between the client and
+// the backend, collecting the metrics and enforcing the limits of the
+// route.
+type webSocketSession struct {
+	config       *websocketfilters.Config
+	metrics      metrics.Metrics
+	routeID      string
+	client       *wsPeer
+	backend      *wsPeer
+	lastActivity int64
+	closed       int32
+	closeOnce    sync.Once
+	done         chan struct{}
+}
+
+func newWSPeer(name string, conn net.Conn, r io.Reader, w io.Writer, mask bool) *wsPeer {
+	return &wsPeer{
+		name: name,
+		conn: conn,
+		r:    r,
+		w:    w,
+		mask: mask,
+		lock: make(chan struct{}, 1),
+	}
+}
+
+func (p *wsPeer) acquire(timeout time.Duration) bool {
+	if timeout <= 0 {
+		p.lock <- struct{}{}
+		return true
+	}
+
+	select {
+	case p.lock <- struct{}{}:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (p *wsPeer) release() { <-p.lock }
+
+func readWSFrameHeader(r io.Reader) (*wsFrameHeader, error) {
+	raw := make([]byte, 2, 14)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, err
+	}
+
+	h := &wsFrameHeader{
+		fin:    raw[0]&0x80 != 0,
+		opcode: raw[0] & 0x0f,
+		masked: raw[1]&0x80 != 0,
+		length: int64(raw[1] & 0x7f),
+	}
+
+	var ext int
+	switch h.length {
+	case 126:
+		ext = 2
+	case 127:
+		ext = 8
+	}
+
+	if h.masked {
+		ext += 4
+	}
+
+	if ext > 0 {
+		raw = raw[:2+ext]
+		if _, err := io.ReadFull(r, raw[2:]); err != nil {
+			return nil, err
+		}
+	}
+
+	b := raw[2:]
+	switch h.length {
+	case 126:
+		h.length = int64(binary.BigEndian.Uint16(b))
+		b = b[2:]
+	case 127:
+		h.length = int64(binary.BigEndian.Uint64(b) & (1<<63 - 1))
+		b = b[8:]
+	}
+
+	if h.masked {
+		copy(h.maskKey[:], b)
+	}
+
+	h.raw = raw
+	return h, nil
+}
+
+func (h *wsFrameHeader) isControl() bool { return h.opcode&0x8 != 0 }
+
+func (h *wsFrameHeader) isData() bool {
+	return h.opcode == wsOpContinuation || h.opcode == wsOpText || h.opcode == wsOpBinary
+}
+
+func wsUnmask(b []byte, key [4]byte) {
+	for i := range b {
+		b[i] ^= key[i%4]
+	}
+}
+
+// wsCloseFrame creates a close frame with the code and the reason,
+// masked when sent to the backend.
+func wsCloseFrame(code int, reason string, mask bool) []byte {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > wsMaxControlFrameSize {
+		payload = payload[:wsMaxControlFrameSize]
+	}
+
+	frame := []byte{0x80 | wsOpClose, byte(len(payload))}
+	if mask {
+		var key [4]byte
+		rand.Read(key[:])
+		frame[1] |= 0x80
+		frame = append(frame, key[:]...)
+		wsUnmask(payload, key)
+	}
+
+	return append(frame, payload...)
+}
+
+// wsCloseCode returns the status code of the close frame payload.
+func wsCloseCode(payload []byte, h *wsFrameHeader) int {
+	if len(payload) < 2 {
+		return wsCloseNoStatus
+	}
+
+	code := make([]byte, 2)
+	copy(code, payload)
+	if h.masked {
+		wsUnmask(code, h.maskKey)
+	}
+
+	return int(binary.BigEndian.Uint16(code))
+}
+
+func newWebSocketSession(
+	config *websocketfilters.Config,
+	m metrics.Metrics,
+	routeID string,
+	client, backend *wsPeer,
+) *webSocketSession {
+	return &webSocketSession{
+		config:       config,
+		metrics:      m,
+		routeID:      routeID,
+		client:       client,
+		backend:      backend,
+		lastActivity: time.Now().UnixNano(),
+		done:         make(chan struct{}),
+	}
+}
+
+func (s *webSocketSession) metricsKey(key string) string {
+	return "websocket." + s.routeID + "." + key
+}
+
+func (s *webSocketSession) touch() {
+	atomic.StoreInt64(&s.lastActivity, time.Now().UnixNano())
+}
+
+// close sends a close frame to both peers, and closes the connections.
+// The peer that violated a limit receives the code, the other one
+// receives 1001 (going away).
+func (s *webSocketSession) close(cause string, code int, violator *wsPeer) {
+	s.closeOnce.Do(func() {
+		atomic.StoreInt32(&s.closed, 1)
+		s.metrics.IncCounter(s.metricsKey("closed." + cause))
+		log.Infof("websocket: closing the connection of route %s: %s", s.routeID, cause)
+
+		for _, p := range []*wsPeer{s.client, s.backend} {
+			c := wsCloseGoingAway
+			if p == violator {
+				c = code
+			}
+
+			if !p.acquire(wsCloseWriteTimeout) {
+				continue
+			}
+
+			p.conn.SetWriteDeadline(time.Now().Add(wsCloseWriteTimeout))
+			p.w.Write(wsCloseFrame(c, cause, p.mask))
+			p.release()
+		}
+
+		s.client.conn.Close()
+		s.backend.conn.Close()
+	})
+}
+
+// forward copies the frames from the source peer to the destination
+// peer, until the source is closed or a limit is exceeded.
+func (s *webSocketSession) forward(src, dst *wsPeer) error {
+	var messageSize int64
+	for {
+		h, err := readWSFrameHeader(src.r)
+		if err != nil {
+			return err
+		}
+
+		s.touch()
+		if h.isData() {
+			messageSize += h.length
+			if s.config.MaxMessageSize > 0 && messageSize > s.config.MaxMessageSize {
+				s.close("maxmessagesize", wsCloseMessageTooBig, src)
+				return nil
+			}
+		}
+
+		if h.isControl() && h.length > wsMaxControlFrameSize {
+			return errWebSocketControlFrameTooLarge
+		}
+
+		var payload []byte
+		if h.isControl() {
+			payload = make([]byte, h.length)
+			if _, err := io.ReadFull(src.r, payload); err != nil {
+				return err
+			}
+		}
+
+		dst.acquire(0)
+		_, err = dst.w.Write(h.raw)
+		if err == nil {
+			if payload != nil {
+				_, err = dst.w.Write(payload)
+			} else {
+				_, err = io.CopyN(dst.w, src.r, h.length)
+			}
+		}
+
+		dst.release()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case h.opcode == wsOpClose:
+			s.metrics.IncCounter(s.metricsKey(src.name + ".close." + strconv.Itoa(wsCloseCode(payload, h))))
+		case h.isData():
+			s.metrics.IncCounterBy(s.metricsKey(src.name+".bytes"), h.length)
+			if h.fin {
+				s.metrics.IncCounter(s.metricsKey(src.name + ".messages"))
+				messageSize = 0
+			}
+		}
+	}
+}
+
+func (s *webSocketSession) watchIdle() {
+	timeout := s.config.IdleTimeout
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-timer.C:
+			idle := time.Since(time.Unix(0, atomic.LoadInt64(&s.lastActivity)))
+			if idle >= timeout {
+				s.close("idletimeout", wsCloseGoingAway, nil)
+				return
+			}
+
+			timer.Reset(timeout - idle)
+		}
+	}
+}
+
+func (s *webSocketSession) watchDuration() {
+	timer := time.NewTimer(s.config.MaxDuration)
+	defer timer.Stop()
+	select {
+	case <-s.done:
+	case <-timer.C:
+		s.close("maxduration", wsCloseGoingAway, nil)
+	}
+}
+
+// serve forwards the frames in both directions, and returns when either
+// of the directions is finished. The caller closes the connections.
+func (s *webSocketSession) serve() {
+	defer close(s.done)
+	if s.config.IdleTimeout > 0 {
+		go s.watchIdle()
+	}
+
+	if s.config.MaxDuration > 0 {
+		go s.watchDuration()
+	}
+
+	s.metrics.IncCounter(s.metricsKey("connections"))
+	start := time.Now()
+	defer s.metrics.MeasureSince(s.metricsKey("duration"), start)
+
+	errs := make(chan error, 2)
+	go func() { errs <- s.forward(s.client, s.backend) }()
+	go func() { errs <- s.forward(s.backend, s.client) }()
+
+	err := <-errs
+	if err != nil && err != io.EOF && !errors.Is(err, net.ErrClosed) && atomic.LoadInt32(&s.closed) == 0 {
+		log.Errorf("websocket: error forwarding frames of route %s: %v", s.routeID, err)
+	}
+}
@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/metrics/metricstest"
+	"golang.org/x/net/websocket"
+)
+
+type testWSClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialTestWS(t *testing.T, proxyURL, path string) *testWSClient {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(proxyURL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\n"+
+		"Host: %s\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Origin: http://www.example.org\r\n"+
+		"Sec-WebSocket-Version: 13\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n", path, conn.RemoteAddr())
+
+	r := bufio.NewReader(conn)
+	rsp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rsp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("failed to upgrade: %d", rsp.StatusCode)
+	}
+
+	return &testWSClient{conn: conn, r: r}
+}
+
+func (c *testWSClient) send(t *testing.T, message string) {
+	var key [4]byte
+	rand.Read(key[:])
+	payload := []byte(message)
+	wsUnmask(payload, key)
+
+	frame := []byte{0x80 | wsOpText, 0x80 | byte(len(payload))}
+	frame = append(frame, key[:]...)
+	if _, err := c.conn.Write(append(frame, payload...)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *testWSClient) receive(t *testing.T) (*wsFrameHeader, []byte) {
+	c.conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	h, err := readWSFrameHeader(c.r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := make([]byte, h.length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	return h, payload
+}
+
+func (c *testWSClient) expectClose(t *testing.T, code int) {
+	h, payload := c.receive(t)
+	if h.opcode != wsOpClose {
+		t.Fatalf("expected close frame, got opcode: %d", h.opcode)
+	}
+
+	if c := wsCloseCode(payload, h); c != code {
+		t.Fatalf("unexpected close code, expected: %d, got: %d", code, c)
+	}
+}
+
+func waitForCounter(t *testing.T, m *metricstest.MockMetrics, key string, expected int64) {
+	timeout := time.After(3 * time.Second)
+	for {
+		var v int64
+		m.WithCounters(func(c map[string]int64) { v = c[key] })
+		if v == expected {
+			return
+		}
+
+		select {
+		case <-timeout:
+			t.Fatalf("unexpected value of %s, expected: %d, got: %d", key, expected, v)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	backend := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		io.Copy(ws, ws)
+	}))
+	defer backend.Close()
+
+	doc := fmt.Sprintf(`
+		limit: Path("/limit") -> webSocket(16) -> "%[1]s";
+		idle: Path("/idle") -> webSocket(0, "300ms") -> "%[1]s";
+		duration: Path("/duration") -> webSocket(0, 0, "200ms") -> "%[1]s";
+	`, backend.URL)
+
+	tp, err := newTestProxyWithParams(doc, Params{ExperimentalUpgrade: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tp.close()
+	m := &metricstest.MockMetrics{}
+	tp.proxy.metrics = countingMetrics{Metrics: metrics.Void, mock: m}
+
+	ps := httptest.NewServer(tp.proxy)
+	defer ps.Close()
+
+	t.Run("messages and max message size", func(t *testing.T) {
+		c := dialTestWS(t, ps.URL, "/limit")
+		defer c.conn.Close()
+
+		c.send(t, "hello")
+		if _, payload := c.receive(t); string(payload) != "hello" {
+			t.Fatalf("unexpected message: %s", payload)
+		}
+
+		waitForCounter(t, m, "websocket.limit.client.messages", 1)
+		waitForCounter(t, m, "websocket.limit.client.bytes", 5)
+		waitForCounter(t, m, "websocket.limit.backend.messages", 1)
+		waitForCounter(t, m, "websocket.limit.backend.bytes", 5)
+
+		c.send(t, "this message is too large")
+		c.expectClose(t, wsCloseMessageTooBig)
+		waitForCounter(t, m, "websocket.limit.closed.maxmessagesize", 1)
+		waitForCounter(t, m, "websocket.limit.client.messages", 1)
+	})
+
+	t.Run("idle timeout", func(t *testing.T) {
+		c := dialTestWS(t, ps.URL, "/idle")
+		defer c.conn.Close()
+
+		for i := 0; i < 3; i++ {
+			time.Sleep(50 * time.Millisecond)
+			c.send(t, "ping")
+			c.receive(t)
+		}
+
+		start := time.Now()
+		c.expectClose(t, wsCloseGoingAway)
+		if d := time.Since(start); d < 200*time.Millisecond {
+			t.Errorf("closed too early: %v", d)
+		}
+
+		waitForCounter(t, m, "websocket.idle.closed.idletimeout", 1)
+		waitForCounter(t, m, "websocket.idle.client.messages", 3)
+	})
+
+	t.Run("max duration", func(t *testing.T) {
+		start := time.Now()
+		c := dialTestWS(t, ps.URL, "/duration")
+		defer c.conn.Close()
+
+		c.expectClose(t, wsCloseGoingAway)
+		if d := time.Since(start); d < 200*time.Millisecond {
+			t.Errorf("closed too early: %v", d)
+		}
+
+		waitForCounter(t, m, "websocket.duration.closed.maxduration", 1)
+		waitForCounter(t, m, "websocket.duration.connections", 1)
+	})
+}
@@ -0,0 +1,317 @@
+package proxyprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	// the longest v1 header, including the CRLF
+	maxV1HeaderLength = 107
+
+	v2HeaderLength = 16
+	v2CommandLocal = 0x0
+	v2CommandProxy = 0x1
+
+	v2FamilyTCP4 = 0x11
+	v2FamilyUDP4 = 0x12
+	v2FamilyTCP6 = 0x21
+	v2FamilyUDP6 = 0x22
+
+	v2FamilyUnspec   = 0x00
+	v2FamilyUnix     = 0x31
+	v2FamilyUnixgram = 0x32
+
+	v2AddressLengthIPv4 = 12
+	v2AddressLengthIPv6 = 36
+	v2AddressLengthUnix = 216
+)
+
+// TLV types defined by the PROXY protocol specification and by AWS.
+const (
+	TLVTypeALPN      = 0x01
+	TLVTypeAuthority = 0x02
+	TLVTypeCRC32C    = 0x03
+	TLVTypeNoop      = 0x04
+	TLVTypeUniqueID  = 0x05
+	TLVTypeSSL       = 0x20
+	TLVTypeNetNS     = 0x30
+
+	// TLVTypeAWS is the type of the AWS specific TLVs, where the first
+	// byte of the value is the subtype.
+	TLVTypeAWS = 0xea
+
+	// TLVSubtypeAWSVPCEndpointID is the subtype of the AWS TLV
+	// containing the id of the VPC endpoint, that the connection was
+	// received on.
+	TLVSubtypeAWSVPCEndpointID = 0x01
+)
+
+var (
+	v1Signature = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	errInvalidV1Header = errors.New("invalid PROXY protocol v1 header")
+	errInvalidV2Header = errors.New("invalid PROXY protocol v2 header")
+)
+
+// TLV is a type-length-value field of a PROXY protocol v2 header.
+type TLV struct {
+	Type  byte
+	Value []byte
+}
+
+// Header contains the connection information received in a PROXY
+// protocol header.
+type Header struct {
+
+	// Version is 1 for the text format and 2 for the binary format.
+	Version int
+
+	// Local is true when the header doesn't contain the address of the
+	// client: for the v2 LOCAL command, for the v1 UNKNOWN protocol, and
+	// for the unsupported address families. In this case, the addresses
+	// are not set, and the original address of the connection is used.
+	Local bool
+
+	// SourceAddr is the address of the client.
+	SourceAddr net.Addr
+
+	// DestinationAddr is the address that the client connected to.
+	DestinationAddr net.Addr
+
+	// TLVs contains the additional fields of the v2 header.
+	TLVs []TLV
+}
+
+// TLV returns the value of the first TLV with the type, or nil.
+func (h *Header) TLV(t byte) []byte {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == t {
+			return tlv.Value
+		}
+	}
+
+	return nil
+}
+
+// AWSVPCEndpointID returns the id of the AWS VPC endpoint, that the
+// connection was received on, or an empty string.
+func (h *Header) AWSVPCEndpointID() string {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == TLVTypeAWS && len(tlv.Value) > 0 && tlv.Value[0] == TLVSubtypeAWSVPCEndpointID {
+			return string(tlv.Value[1:])
+		}
+	}
+
+	return ""
+}
+
+// readHeader reads the PROXY protocol header, when the connection starts
+// with one of the signatures. It returns nil without an error when the
+// connection doesn't start with a header, and in this case, it doesn't
+// consume any bytes.
+func readHeader(r *bufio.Reader) (*Header, error) {
+	// peeking only the necessary bytes, to not block on short requests
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch b[0] {
+	case v1Signature[0]:
+		if b, err = r.Peek(len(v1Signature)); err != nil || !bytes.Equal(b, v1Signature) {
+			return nil, ignoreEOF(err)
+		}
+
+		return readV1(r)
+	case v2Signature[0]:
+		if b, err = r.Peek(len(v2Signature)); err != nil || !bytes.Equal(b, v2Signature) {
+			return nil, ignoreEOF(err)
+		}
+
+		return readV2(r)
+	default:
+		return nil, nil
+	}
+}
+
+// when the connection was closed before the signature could be checked,
+// the connection is passed on, and the error surfaces when it is read
+func ignoreEOF(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+
+	return err
+}
+
+func readV1(r *bufio.Reader) (*Header, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+
+		if len(line) >= maxV1HeaderLength {
+			return nil, errInvalidV1Header
+		}
+	}
+
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errInvalidV1Header
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) < 2 {
+		return nil, errInvalidV1Header
+	}
+
+	h := &Header{Version: 1}
+	switch fields[1] {
+	case "UNKNOWN":
+		h.Local = true
+		return h, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, errInvalidV1Header
+	}
+
+	if len(fields) != 6 {
+		return nil, errInvalidV1Header
+	}
+
+	src, err := parseV1Address(fields[1], fields[2], fields[4])
+	if err != nil {
+		return nil, err
+	}
+
+	dst, err := parseV1Address(fields[1], fields[3], fields[5])
+	if err != nil {
+		return nil, err
+	}
+
+	h.SourceAddr, h.DestinationAddr = src, dst
+	return h, nil
+}
+
+func parseV1Address(protocol, ip, port string) (*net.TCPAddr, error) {
+	a := net.ParseIP(ip)
+	if a == nil || (protocol == "TCP4") != (a.To4() != nil) {
+		return nil, errInvalidV1Header
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || (len(port) > 1 && port[0] == '0') {
+		return nil, errInvalidV1Header
+	}
+
+	return &net.TCPAddr{IP: a, Port: int(p)}, nil
+}
+
+func readV2(r *bufio.Reader) (*Header, error) {
+	var fixed [v2HeaderLength]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return nil, err
+	}
+
+	if fixed[12]>>4 != 2 {
+		return nil, fmt.Errorf("%w: unsupported version", errInvalidV2Header)
+	}
+
+	command, family := fixed[12]&0xf, fixed[13]
+	payload := make([]byte, binary.BigEndian.Uint16(fixed[14:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	h := &Header{Version: 2}
+	switch command {
+	case v2CommandLocal:
+		h.Local = true
+	case v2CommandProxy:
+	default:
+		return nil, fmt.Errorf("%w: unsupported command", errInvalidV2Header)
+	}
+
+	var addressLength int
+	switch family {
+	case v2FamilyTCP4, v2FamilyUDP4:
+		addressLength = v2AddressLengthIPv4
+	case v2FamilyTCP6, v2FamilyUDP6:
+		addressLength = v2AddressLengthIPv6
+	case v2FamilyUnix, v2FamilyUnixgram:
+		// unix socket addresses are not used, the original address of
+		// the connection is kept
+		addressLength = v2AddressLengthUnix
+		h.Local = true
+	case v2FamilyUnspec:
+		h.Local = true
+	default:
+		// the layout of the payload is unknown, it is skipped
+		h.Local = true
+		return h, nil
+	}
+
+	if len(payload) < addressLength {
+		return nil, fmt.Errorf("%w: short address", errInvalidV2Header)
+	}
+
+	if addressLength > 0 && !h.Local {
+		ipLength := (addressLength - 4) / 2
+		a := payload[:addressLength]
+		h.SourceAddr = v2Address(family, a[:ipLength], a[2*ipLength:])
+		h.DestinationAddr = v2Address(family, a[ipLength:2*ipLength], a[2*ipLength+2:])
+	}
+
+	tlvs, err := parseTLVs(payload[addressLength:])
+	if err != nil {
+		return nil, err
+	}
+
+	h.TLVs = tlvs
+	return h, nil
+}
+
+func v2Address(family byte, ip, port []byte) net.Addr {
+	a := make(net.IP, len(ip))
+	copy(a, ip)
+	p := int(binary.BigEndian.Uint16(port))
+	if family == v2FamilyUDP4 || family == v2FamilyUDP6 {
+		return &net.UDPAddr{IP: a, Port: p}
+	}
+
+	return &net.TCPAddr{IP: a, Port: p}
+}
+
+func parseTLVs(b []byte) ([]TLV, error) {
+	var tlvs []TLV
+	for len(b) > 0 {
+		if len(b) < 3 {
+			return nil, fmt.Errorf("%w: short TLV", errInvalidV2Header)
+		}
+
+		l := int(binary.BigEndian.Uint16(b[1:3]))
+		if len(b) < 3+l {
+			return nil, fmt.Errorf("%w: short TLV", errInvalidV2Header)
+		}
+
+		tlvs = append(tlvs, TLV{Type: b[0], Value: b[3 : 3+l]})
+		b = b[3+l:]
+	}
+
+	return tlvs, nil
+}
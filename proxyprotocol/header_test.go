@@ -0,0 +1,272 @@
+package proxyprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// v2Header creates a binary header for the tests.
+func v2Header(command, family byte, addresses []byte, tlvs ...TLV) []byte {
+	payload := append([]byte(nil), addresses...)
+	for _, tlv := range tlvs {
+		payload = append(payload, tlv.Type, 0, 0)
+		binary.BigEndian.PutUint16(payload[len(payload)-2:], uint16(len(tlv.Value)))
+		payload = append(payload, tlv.Value...)
+	}
+
+	h := append([]byte(nil), v2Signature...)
+	h = append(h, 0x20|command, family, 0, 0)
+	binary.BigEndian.PutUint16(h[14:], uint16(len(payload)))
+	return append(h, payload...)
+}
+
+func v2IPv4Addresses(src, dst string, sport, dport uint16) []byte {
+	b := append(net.ParseIP(src).To4(), net.ParseIP(dst).To4()...)
+	b = append(b, 0, 0, 0, 0)
+	binary.BigEndian.PutUint16(b[8:], sport)
+	binary.BigEndian.PutUint16(b[10:], dport)
+	return b
+}
+
+func v2IPv6Addresses(src, dst string, sport, dport uint16) []byte {
+	b := append(net.ParseIP(src).To16(), net.ParseIP(dst).To16()...)
+	b = append(b, 0, 0, 0, 0)
+	binary.BigEndian.PutUint16(b[32:], sport)
+	binary.BigEndian.PutUint16(b[34:], dport)
+	return b
+}
+
+func TestReadHeader(t *testing.T) {
+	vpce := TLV{Type: TLVTypeAWS, Value: append([]byte{TLVSubtypeAWSVPCEndpointID}, "vpce-0123456789abcdef"...)}
+	authority := TLV{Type: TLVTypeAuthority, Value: []byte("www.example.org")}
+
+	for _, tt := range []struct {
+		title     string
+		input     []byte
+		version   int
+		local     bool
+		source    string
+		dest      string
+		tlvs      []TLV
+		noHeader  bool
+		fail      bool
+		remaining string
+	}{{
+		title:     "no header",
+		input:     []byte("GET / HTTP/1.1\r\n\r\n"),
+		noHeader:  true,
+		remaining: "GET / HTTP/1.1\r\n\r\n",
+	}, {
+		title:     "starts like v1, but no header",
+		input:     []byte("POST / HTTP/1.1\r\n\r\n"),
+		noHeader:  true,
+		remaining: "POST / HTTP/1.1\r\n\r\n",
+	}, {
+		title:     "short input without header",
+		input:     []byte("P"),
+		noHeader:  true,
+		remaining: "P",
+	}, {
+		title:     "v1 TCP4",
+		input:     []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nGET / HTTP/1.1\r\n\r\n"),
+		version:   1,
+		source:    "192.0.2.1:56324",
+		dest:      "198.51.100.1:443",
+		remaining: "GET / HTTP/1.1\r\n\r\n",
+	}, {
+		title:     "v1 TCP6",
+		input:     []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"),
+		version:   1,
+		source:    "[2001:db8::1]:56324",
+		dest:      "[2001:db8::2]:443",
+		remaining: "",
+	}, {
+		title:     "v1 UNKNOWN",
+		input:     []byte("PROXY UNKNOWN ffff::1 ffff::2 1 2\r\nGET"),
+		version:   1,
+		local:     true,
+		remaining: "GET",
+	}, {
+		title: "v1 family mismatch",
+		input: []byte("PROXY TCP4 2001:db8::1 2001:db8::2 56324 443\r\n"),
+		fail:  true,
+	}, {
+		title: "v1 invalid port",
+		input: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 65536 443\r\n"),
+		fail:  true,
+	}, {
+		title: "v1 missing CR",
+		input: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\n"),
+		fail:  true,
+	}, {
+		title: "v1 too long",
+		input: []byte("PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n"),
+		fail:  true,
+	}, {
+		title: "v1 missing fields",
+		input: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324\r\n"),
+		fail:  true,
+	}, {
+		title:     "v2 TCP4",
+		input:     append(v2Header(v2CommandProxy, v2FamilyTCP4, v2IPv4Addresses("192.0.2.1", "198.51.100.1", 56324, 443)), "GET"...),
+		version:   2,
+		source:    "192.0.2.1:56324",
+		dest:      "198.51.100.1:443",
+		remaining: "GET",
+	}, {
+		title:     "v2 TCP6 with TLVs",
+		input:     append(v2Header(v2CommandProxy, v2FamilyTCP6, v2IPv6Addresses("2001:db8::1", "2001:db8::2", 56324, 443), authority, vpce), "GET"...),
+		version:   2,
+		source:    "[2001:db8::1]:56324",
+		dest:      "[2001:db8::2]:443",
+		tlvs:      []TLV{authority, vpce},
+		remaining: "GET",
+	}, {
+		title:     "v2 LOCAL",
+		input:     append(v2Header(v2CommandLocal, v2FamilyUnspec, nil), "GET"...),
+		version:   2,
+		local:     true,
+		remaining: "GET",
+	}, {
+		title:     "v2 LOCAL with addresses and TLVs",
+		input:     append(v2Header(v2CommandLocal, v2FamilyTCP4, v2IPv4Addresses("192.0.2.1", "198.51.100.1", 56324, 443), vpce), "GET"...),
+		version:   2,
+		local:     true,
+		tlvs:      []TLV{vpce},
+		remaining: "GET",
+	}, {
+		title:     "v2 unix socket",
+		input:     append(v2Header(v2CommandProxy, v2FamilyUnix, make([]byte, v2AddressLengthUnix), vpce), "GET"...),
+		version:   2,
+		local:     true,
+		tlvs:      []TLV{vpce},
+		remaining: "GET",
+	}, {
+		title: "v2 unsupported version",
+		input: func() []byte {
+			h := v2Header(v2CommandProxy, v2FamilyTCP4, v2IPv4Addresses("192.0.2.1", "198.51.100.1", 56324, 443))
+			h[12] = 0x11
+			return h
+		}(),
+		fail: true,
+	}, {
+		title: "v2 unsupported command",
+		input: v2Header(0x2, v2FamilyTCP4, v2IPv4Addresses("192.0.2.1", "198.51.100.1", 56324, 443)),
+		fail:  true,
+	}, {
+		title: "v2 short address",
+		input: v2Header(v2CommandProxy, v2FamilyTCP6, v2IPv4Addresses("192.0.2.1", "198.51.100.1", 56324, 443)),
+		fail:  true,
+	}, {
+		title: "v2 short TLV",
+		input: v2Header(v2CommandProxy, v2FamilyTCP4, append(v2IPv4Addresses("192.0.2.1", "198.51.100.1", 56324, 443), TLVTypeAuthority, 0, 8, 'x')),
+		fail:  true,
+	}, {
+		title: "v2 truncated",
+		input: v2Header(v2CommandProxy, v2FamilyTCP4, v2IPv4Addresses("192.0.2.1", "198.51.100.1", 56324, 443))[:20],
+		fail:  true,
+	}} {
+		t.Run(tt.title, func(t *testing.T) {
+			r := bufio.NewReaderSize(bytes.NewReader(tt.input), readerBufferSize)
+			h, err := readHeader(r)
+			if tt.fail {
+				if err == nil {
+					t.Fatal("failed to fail")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.noHeader {
+				if h != nil {
+					t.Fatalf("unexpected header: %+v", h)
+				}
+			} else {
+				if h == nil {
+					t.Fatal("header not found")
+				}
+
+				if h.Version != tt.version || h.Local != tt.local {
+					t.Errorf("unexpected version or command: %d, %t", h.Version, h.Local)
+				}
+
+				if tt.source != "" && (h.SourceAddr == nil || h.SourceAddr.String() != tt.source) {
+					t.Errorf("unexpected source address: %v", h.SourceAddr)
+				}
+
+				if tt.dest != "" && (h.DestinationAddr == nil || h.DestinationAddr.String() != tt.dest) {
+					t.Errorf("unexpected destination address: %v", h.DestinationAddr)
+				}
+
+				if tt.local && (h.SourceAddr != nil || h.DestinationAddr != nil) {
+					t.Errorf("unexpected addresses in local header: %v, %v", h.SourceAddr, h.DestinationAddr)
+				}
+
+				if len(h.TLVs) != len(tt.tlvs) {
+					t.Fatalf("unexpected TLVs: %v", h.TLVs)
+				}
+
+				for i := range tt.tlvs {
+					if h.TLVs[i].Type != tt.tlvs[i].Type || !bytes.Equal(h.TLVs[i].Value, tt.tlvs[i].Value) {
+						t.Errorf("unexpected TLV: %v", h.TLVs[i])
+					}
+				}
+			}
+
+			remaining, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(remaining) != tt.remaining {
+				t.Errorf("unexpected remaining input: %q", remaining)
+			}
+		})
+	}
+}
+
+func TestHeaderTLVs(t *testing.T) {
+	h := &Header{TLVs: []TLV{
+		{Type: TLVTypeAuthority, Value: []byte("www.example.org")},
+		{Type: TLVTypeAWS, Value: []byte{0x02, 'x'}},
+		{Type: TLVTypeAWS, Value: append([]byte{TLVSubtypeAWSVPCEndpointID}, "vpce-0123"...)},
+	}}
+
+	if v := h.TLV(TLVTypeAuthority); string(v) != "www.example.org" {
+		t.Errorf("unexpected authority: %q", v)
+	}
+
+	if v := h.TLV(TLVTypeUniqueID); v != nil {
+		t.Errorf("unexpected unique id: %q", v)
+	}
+
+	if id := h.AWSVPCEndpointID(); id != "vpce-0123" {
+		t.Errorf("unexpected VPC endpoint id: %s", id)
+	}
+
+	if id := (&Header{}).AWSVPCEndpointID(); id != "" {
+		t.Errorf("unexpected VPC endpoint id: %s", id)
+	}
+}
+
+func TestInvalidHeaderError(t *testing.T) {
+	_, err := readHeader(bufio.NewReader(bytes.NewReader([]byte("PROXY TCP5 a b c d\r\n"))))
+	if !errors.Is(err, errInvalidV1Header) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = readHeader(bufio.NewReader(bytes.NewReader(v2Header(0x3, v2FamilyTCP4, nil))))
+	if !errors.Is(err, errInvalidV2Header) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
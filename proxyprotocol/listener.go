@@ -0,0 +1,177 @@
+/*
+Package proxyprotocol implements a listener, that accepts the PROXY
+protocol v1 and v2 headers sent by the TCP load balancers, as defined in
+https://www.haproxy.org/download/2.5/doc/proxy-protocol.txt.
+
+The headers are accepted only from the trusted networks. The address of
+the client received in the header is used as the remote address of the
+connection, and the header, including the TLV fields of the v2 format, is
+available in the context of the requests, when the ConnContext function
+is set for the http.Server.
+*/
+package proxyprotocol
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/zalando/skipper/logging"
+	snet "github.com/zalando/skipper/net"
+)
+
+const (
+	// DefaultHeaderTimeout is used when Options.HeaderTimeout is not set.
+	DefaultHeaderTimeout = 10 * time.Second
+
+	readerBufferSize = 512
+)
+
+type contextKey struct{}
+
+// Options are used to initialize the PROXY protocol listener.
+type Options struct {
+
+	// TrustedNetworks contains the networks of the load balancers, that
+	// are allowed to send the PROXY protocol header. The connections from
+	// other addresses are used unchanged.
+	TrustedNetworks snet.IPNets
+
+	// HeaderTimeout sets the time limit for receiving the header.
+	// Defaults to DefaultHeaderTimeout.
+	HeaderTimeout time.Duration
+
+	// Log is used to log the invalid headers as warnings. It defaults to
+	// logging.DefaultLog.
+	Log logging.Logger
+}
+
+type listener struct {
+	net.Listener
+	options Options
+}
+
+// Conn is a connection from a trusted network, that may start with a
+// PROXY protocol header. The header is read on the first call to Read,
+// RemoteAddr or Header.
+type Conn struct {
+	net.Conn
+	options *Options
+	once    sync.Once
+	reader  *bufio.Reader
+	header  *Header
+	err     error
+}
+
+// NewListener wraps a listener, e.g. a TCP listener or a queue listener,
+// to accept the PROXY protocol header from the trusted networks.
+func NewListener(l net.Listener, o Options) net.Listener {
+	if o.HeaderTimeout <= 0 {
+		o.HeaderTimeout = DefaultHeaderTimeout
+	}
+
+	if o.Log == nil {
+		o.Log = &logging.DefaultLog{}
+	}
+
+	return &listener{Listener: l, options: o}
+}
+
+// Accept returns the next connection. The header is not read here, so
+// that a slow client doesn't block accepting the other connections.
+func (l *listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	if !l.trusted(c.RemoteAddr()) {
+		return c, nil
+	}
+
+	return &Conn{Conn: c, options: &l.options}, nil
+}
+
+func (l *listener) trusted(a net.Addr) bool {
+	ta, ok := a.(*net.TCPAddr)
+	return ok && l.options.TrustedNetworks.Contain(ta.IP)
+}
+
+func (c *Conn) init() {
+	c.once.Do(func() {
+		c.reader = bufio.NewReaderSize(c.Conn, readerBufferSize)
+		c.Conn.SetReadDeadline(time.Now().Add(c.options.HeaderTimeout))
+		c.header, c.err = readHeader(c.reader)
+		c.Conn.SetReadDeadline(time.Time{})
+
+		// the TCP health checks of the load balancers close the
+		// connection without sending anything
+		if c.err != nil && !errors.Is(c.err, io.EOF) {
+			c.options.Log.Warnf(
+				"Failed to read the PROXY protocol header from %v: %v",
+				c.Conn.RemoteAddr(),
+				c.err,
+			)
+		}
+	})
+}
+
+// Read reads from the connection after the header. When the header is
+// invalid, it returns the error of the header.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the address of the client received in the header,
+// or the address of the connection, when there was no header, or it
+// didn't contain the address of the client.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.init()
+	if c.header == nil || c.header.Local || c.header.SourceAddr == nil {
+		return c.Conn.RemoteAddr()
+	}
+
+	return c.header.SourceAddr
+}
+
+// Header returns the PROXY protocol header of the connection, or nil,
+// when the connection didn't start with a valid header.
+func (c *Conn) Header() *Header {
+	c.init()
+	return c.header
+}
+
+// ConnContext can be used as the ConnContext function of http.Server, to
+// make the header available in the context of the requests. It is
+// called before the header is read, and it doesn't read it.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+
+	if pc, ok := c.(*Conn); ok {
+		return context.WithValue(ctx, contextKey{}, pc)
+	}
+
+	return ctx
+}
+
+// HeaderFromContext returns the PROXY protocol header of the connection
+// of a request, or nil, when there is no header.
+func HeaderFromContext(ctx context.Context) *Header {
+	if c, ok := ctx.Value(contextKey{}).(*Conn); ok {
+		return c.Header()
+	}
+
+	return nil
+}
@@ -0,0 +1,319 @@
+package proxyprotocol_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/logging"
+	snet "github.com/zalando/skipper/net"
+	"github.com/zalando/skipper/proxyprotocol"
+	"github.com/zalando/skipper/queuelistener"
+)
+
+func v2Header(src string, sport uint16, vpce string) []byte {
+	payload := append(net.ParseIP(src).To4(), 127, 0, 0, 1, 0, 0, 0, 80)
+	binary.BigEndian.PutUint16(payload[8:], sport)
+	if vpce != "" {
+		payload = append(payload, proxyprotocol.TLVTypeAWS, 0, byte(len(vpce)+1), proxyprotocol.TLVSubtypeAWSVPCEndpointID)
+		payload = append(payload, vpce...)
+	}
+
+	h := []byte("\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x00")
+	binary.BigEndian.PutUint16(h[14:], uint16(len(payload)))
+	return append(h, payload...)
+}
+
+func startServer(t *testing.T, l net.Listener, tlsConfig *tls.Config) {
+	s := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var vpce string
+			if h := proxyprotocol.HeaderFromContext(r.Context()); h != nil {
+				vpce = h.AWSVPCEndpointID()
+			}
+
+			fmt.Fprintf(w, "%s %s", r.RemoteAddr, vpce)
+		}),
+		TLSConfig:   tlsConfig,
+		ConnContext: proxyprotocol.ConnContext,
+	}
+
+	go func() {
+		if tlsConfig != nil {
+			s.ServeTLS(l, "", "")
+		} else {
+			s.Serve(l)
+		}
+	}()
+
+	t.Cleanup(func() { s.Close() })
+}
+
+func trusted(t *testing.T, cidrs ...string) snet.IPNets {
+	nets, err := snet.ParseCIDRs(cidrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return nets
+}
+
+// request sends the header and an HTTP request on a new connection, and
+// returns the response body.
+func request(t *testing.T, addr string, header []byte, tlsConfig *tls.Config) (string, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	if _, err := conn.Write(header); err != nil {
+		return "", err
+	}
+
+	var c net.Conn = conn
+	if tlsConfig != nil {
+		c = tls.Client(conn, tlsConfig)
+	}
+
+	if _, err := c.Write([]byte("GET / HTTP/1.1\r\nHost: www.example.org\r\nConnection: close\r\n\r\n")); err != nil {
+		return "", err
+	}
+
+	rsp, err := http.ReadResponse(bufio.NewReader(c), nil)
+	if err != nil {
+		return "", err
+	}
+
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status: %d", rsp.StatusCode)
+	}
+
+	b, err := io.ReadAll(rsp.Body)
+	return string(b), err
+}
+
+func TestListener(t *testing.T) {
+	for _, tt := range []struct {
+		title    string
+		trusted  []string
+		header   []byte
+		expected string
+		fail     bool
+	}{{
+		title:    "v1 header",
+		trusted:  []string{"127.0.0.0/8"},
+		header:   []byte("PROXY TCP4 192.0.2.1 127.0.0.1 56324 80\r\n"),
+		expected: "192.0.2.1:56324 ",
+	}, {
+		title:    "v2 header with VPC endpoint id",
+		trusted:  []string{"127.0.0.0/8"},
+		header:   v2Header("192.0.2.2", 56325, "vpce-0123456789abcdef"),
+		expected: "192.0.2.2:56325 vpce-0123456789abcdef",
+	}, {
+		title:   "no header from a trusted network",
+		trusted: []string{"127.0.0.0/8"},
+		header:  nil,
+	}, {
+		title:   "header from an untrusted network",
+		trusted: []string{"10.0.0.0/8"},
+		header:  []byte("PROXY TCP4 192.0.2.1 127.0.0.1 56324 80\r\n"),
+		fail:    true,
+	}, {
+		title:   "no header from an untrusted network",
+		trusted: []string{"10.0.0.0/8"},
+		header:  nil,
+	}, {
+		title:   "invalid header",
+		trusted: []string{"127.0.0.0/8"},
+		header:  []byte("PROXY TCP4 192.0.2.1\r\n"),
+		fail:    true,
+	}} {
+		for _, withQueue := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s, queue listener: %t", tt.title, withQueue), func(t *testing.T) {
+				var (
+					l   net.Listener
+					err error
+				)
+
+				if withQueue {
+					l, err = queuelistener.Listen(queuelistener.Options{
+						Network:        "tcp",
+						Address:        "127.0.0.1:0",
+						MaxConcurrency: 10,
+					})
+				} else {
+					l, err = net.Listen("tcp", "127.0.0.1:0")
+				}
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				addr := l.Addr().String()
+				l = proxyprotocol.NewListener(l, proxyprotocol.Options{TrustedNetworks: trusted(t, tt.trusted...)})
+				startServer(t, l, nil)
+
+				body, err := request(t, addr, tt.header, nil)
+				if tt.fail {
+					if err == nil {
+						t.Fatalf("failed to fail: %s", body)
+					}
+
+					return
+				}
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				expected := tt.expected
+				if expected == "" {
+					// the original address of the connection
+					expected = "127.0.0.1:"
+				}
+
+				if len(body) < len(expected) || body[:len(expected)] != expected {
+					t.Errorf("unexpected response, expected: %s, got: %s", expected, body)
+				}
+			})
+		}
+	}
+}
+
+func TestListenerTLS(t *testing.T) {
+	cert, err := tls.LoadX509KeyPair("../fixtures/test.crt", "../fixtures/test.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := l.Addr().String()
+	l = proxyprotocol.NewListener(l, proxyprotocol.Options{TrustedNetworks: trusted(t, "127.0.0.1")})
+	startServer(t, l, &tls.Config{Certificates: []tls.Certificate{cert}})
+
+	body, err := request(t, addr, v2Header("192.0.2.3", 56326, "vpce-abc"), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body != "192.0.2.3:56326 vpce-abc" {
+		t.Errorf("unexpected response: %s", body)
+	}
+}
+
+func TestListenerHeaderTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := l.Addr().String()
+	l = proxyprotocol.NewListener(l, proxyprotocol.Options{
+		TrustedNetworks: trusted(t, "127.0.0.1"),
+		HeaderTimeout:   30 * time.Millisecond,
+	})
+
+	startServer(t, l, nil)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+	if _, err := conn.Write([]byte("PROXY TCP4 ")); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("failed to close the connection: %v", err)
+	}
+}
+
+type levelLogger struct {
+	logging.Logger
+	mu       sync.Mutex
+	errors   []string
+	warnings []string
+}
+
+func (l *levelLogger) Errorf(f string, a ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors = append(l.errors, fmt.Sprintf(f, a...))
+}
+
+func (l *levelLogger) Warnf(f string, a ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warnings = append(l.warnings, fmt.Sprintf(f, a...))
+}
+
+func TestListenerLogging(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tcp.Close()
+	log := &levelLogger{Logger: &logging.DefaultLog{}}
+	l := proxyprotocol.NewListener(tcp, proxyprotocol.Options{
+		TrustedNetworks: trusted(t, "127.0.0.1"),
+		Log:             log,
+	})
+
+	readAccepted := func(send []byte) error {
+		conn, err := net.Dial("tcp", tcp.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := conn.Write(send); err != nil {
+			t.Fatal(err)
+		}
+
+		conn.Close()
+		c, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer c.Close()
+		_, err = c.Read(make([]byte, 1))
+		return err
+	}
+
+	// health check closing the connection without sending anything
+	if err := readAccepted(nil); err != io.EOF {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err := readAccepted([]byte("PROXY FOO\r\n")); err == nil || err == io.EOF {
+		t.Errorf("failed to fail on the malformed header: %v", err)
+	}
+
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	if len(log.errors) != 0 {
+		t.Errorf("unexpected errors logged: %v", log.errors)
+	}
+
+	if len(log.warnings) != 1 {
+		t.Errorf("unexpected warnings logged: %v", log.warnings)
+	}
+}
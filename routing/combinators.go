@@ -0,0 +1,276 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/dimfeld/httppath"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/pathmux"
+	"github.com/zalando/skipper/predicates"
+)
+
+var (
+	errInvalidPredicateGroup = errors.New("invalid predicate group, expected predicates combined by '&&'")
+	errWeightInGroup         = errors.New("the Weight predicate is not allowed in the Or and Not predicates")
+	errPredicateNotFound     = errors.New("predicate not found")
+)
+
+// andPredicate matches when all the predicates of a group match.
+type andPredicate []Predicate
+
+// orPredicate matches when any of the predicate groups match.
+type orPredicate []Predicate
+
+// notPredicate matches when the predicate group doesn't match.
+type notPredicate struct {
+	group Predicate
+}
+
+type pathPredicate struct {
+	tree    *pathmux.Tree
+	options MatchingOptions
+}
+
+type pathRegexpPredicate struct {
+	rx *regexp.Regexp
+}
+
+type hostPredicate struct {
+	rx *regexp.Regexp
+}
+
+type methodPredicate struct {
+	method string
+}
+
+type headerPredicate struct {
+	key   string
+	check func(string) bool
+}
+
+func (p andPredicate) Match(r *http.Request) bool {
+	return matchPredicates(p, r)
+}
+
+func (p orPredicate) Match(r *http.Request) bool {
+	for _, g := range p {
+		if g.Match(r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *notPredicate) Match(r *http.Request) bool {
+	return !p.group.Match(r)
+}
+
+func (p *pathPredicate) Match(r *http.Request) bool {
+	// in case ignoring trailing slashes, match without the trailing slash,
+	// the same way as the routing table
+	path := httppath.Clean(r.URL.Path)
+	if p.options.ignoreTrailingSlash() {
+		path = trimTrailingSlash(path)
+	}
+
+	v, _ := p.tree.Lookup(path)
+	return v != nil
+}
+
+func (p *pathRegexpPredicate) Match(r *http.Request) bool {
+	return p.rx.MatchString(httppath.Clean(r.URL.Path))
+}
+
+func (p *hostPredicate) Match(r *http.Request) bool {
+	return p.rx.MatchString(r.Host)
+}
+
+func (p *methodPredicate) Match(r *http.Request) bool {
+	return r.Method == p.method
+}
+
+func (p *headerPredicate) Match(r *http.Request) bool {
+	return matchHeader(r.Header, p.key, p.check)
+}
+
+// the nested Path and PathSubtree predicates are evaluated with a
+// dedicated path tree, the same way as in the routing table, and with
+// the same matching options
+func newPathPredicate(def *eskip.Predicate, o MatchingOptions) (Predicate, error) {
+	path, err := processPathOrSubTree(def)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	switch {
+	case def.Name == predicates.PathSubtreeName:
+		paths = subtreePaths(path, o)
+	case o.ignoreTrailingSlash():
+		paths = []string{trimTrailingSlash(path)}
+	default:
+		paths = []string{path}
+	}
+
+	tree := &pathmux.Tree{}
+	for _, p := range paths {
+		if err := tree.Add(p, &pathMatcher{}); err != nil {
+			return nil, err
+		}
+	}
+
+	return &pathPredicate{tree: tree, options: o}, nil
+}
+
+func newRegexpPredicate(def *eskip.Predicate, argCount int) ([]string, *regexp.Regexp, error) {
+	args, err := getFreeStringArgs(argCount, def)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rx, err := regexp.Compile(args[argCount-1])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return args, rx, nil
+}
+
+// creates the instances of the builtin predicates, that are otherwise
+// handled by the routing table, when they are nested in a group
+func newBuiltinPredicate(def *eskip.Predicate, o MatchingOptions) (Predicate, bool, error) {
+	switch def.Name {
+	case predicates.PathName, predicates.PathSubtreeName:
+		p, err := newPathPredicate(def, o)
+		return p, true, err
+	case predicates.PathRegexpName:
+		_, rx, err := newRegexpPredicate(def, 1)
+		return &pathRegexpPredicate{rx: rx}, true, err
+	case predicates.HostName:
+		_, rx, err := newRegexpPredicate(def, 1)
+		return &hostPredicate{rx: rx}, true, err
+	case predicates.MethodName:
+		args, err := getFreeStringArgs(1, def)
+		if err != nil {
+			return nil, true, err
+		}
+
+		return &methodPredicate{method: args[0]}, true, nil
+	case predicates.HeaderName:
+		args, err := getFreeStringArgs(2, def)
+		if err != nil {
+			return nil, true, err
+		}
+
+		value := args[1]
+		return &headerPredicate{
+			key:   http.CanonicalHeaderKey(args[0]),
+			check: func(v string) bool { return v == value },
+		}, true, nil
+	case predicates.HeaderRegexpName:
+		args, rx, err := newRegexpPredicate(def, 2)
+		if err != nil {
+			return nil, true, err
+		}
+
+		return &headerPredicate{key: http.CanonicalHeaderKey(args[0]), check: rx.MatchString}, true, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+// creates a predicate from a group of predicates combined by '&&'
+func createPredicateGroup(cpm map[string]PredicateSpec, o MatchingOptions, arg interface{}) (Predicate, error) {
+	defs, ok := arg.([]*eskip.Predicate)
+	if !ok {
+		return nil, errInvalidPredicateGroup
+	}
+
+	group := make(andPredicate, 0, len(defs))
+	for _, def := range defs {
+		if def.Name == predicates.WeightName {
+			return nil, errWeightInGroup
+		}
+
+		p, builtin, err := newBuiltinPredicate(def, o)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create predicate %q: %w", def.Name, err)
+		}
+
+		if !builtin {
+			if p, err = createPredicate(cpm, o, def); err != nil {
+				return nil, err
+			}
+		}
+
+		group = append(group, p)
+	}
+
+	return group, nil
+}
+
+func createOrPredicate(cpm map[string]PredicateSpec, o MatchingOptions, args []interface{}) (Predicate, error) {
+	if len(args) == 0 {
+		return nil, predicates.ErrInvalidPredicateParameters
+	}
+
+	p := make(orPredicate, len(args))
+	for i, a := range args {
+		g, err := createPredicateGroup(cpm, o, a)
+		if err != nil {
+			return nil, err
+		}
+
+		p[i] = g
+	}
+
+	return p, nil
+}
+
+func createNotPredicate(cpm map[string]PredicateSpec, o MatchingOptions, args []interface{}) (Predicate, error) {
+	if len(args) != 1 {
+		return nil, predicates.ErrInvalidPredicateParameters
+	}
+
+	g, err := createPredicateGroup(cpm, o, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return &notPredicate{group: g}, nil
+}
+
+// createPredicate initializes a predicate instance from its definition.
+// The Or and Not predicates are created by the routing, because their
+// arguments are nested predicates, including the builtin ones, that are
+// created with the matching options of the routing.
+func createPredicate(cpm map[string]PredicateSpec, o MatchingOptions, def *eskip.Predicate) (Predicate, error) {
+	create := func(args []interface{}) (Predicate, error) {
+		spec, ok := cpm[def.Name]
+		if !ok {
+			return nil, errPredicateNotFound
+		}
+
+		return spec.Create(args)
+	}
+
+	switch def.Name {
+	case predicates.OrName:
+		create = func(args []interface{}) (Predicate, error) { return createOrPredicate(cpm, o, args) }
+	case predicates.NotName:
+		create = func(args []interface{}) (Predicate, error) { return createNotPredicate(cpm, o, args) }
+	}
+
+	p, err := create(def.Args)
+	if err == errPredicateNotFound {
+		return nil, fmt.Errorf("predicate %q not found", def.Name)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to create predicate %q: %w", def.Name, err)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,229 @@
+package routing_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/logging/loggingtest"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+)
+
+func TestPredicateCombinators(t *testing.T) {
+	dc, err := testdataclient.NewDoc(`
+		hosts: Or(Host("^www[.]example[.]org$"), Host("^api[.]example[.]org$")) -> "https://hosts.example.org";
+		notBeta: Path("/app") && Not(Header("X-Beta", "true")) -> "https://stable.example.org";
+		beta: Path("/app") -> "https://beta.example.org";
+		paths: Or(Path("/foo/:id"), PathSubtree("/bar"), PathRegexp("^/baz")) -> "https://paths.example.org";
+		groups: Or(Method("POST") && HeaderRegexp("Content-Type", "json"), (Method("PUT") && CustomPredicate("custom")))
+			-> "https://groups.example.org";
+		nested: Not(Or(Path("/"), Path("/app"), Method("PATCH"))) && Header("X-Nested", "true") -> "https://nested.example.org";
+		catchAll: * -> "https://catchall.example.org";
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := newTestRoutingWithPredicates([]routing.PredicateSpec{&predicate{}}, dc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tr.close()
+
+	for _, tt := range []struct {
+		title    string
+		method   string
+		url      string
+		headers  map[string]string
+		expected string
+	}{{
+		title:    "or, first",
+		url:      "https://www.example.org/",
+		expected: "hosts",
+	}, {
+		title:    "or, second",
+		url:      "https://api.example.org/",
+		expected: "hosts",
+	}, {
+		title:    "or, none",
+		url:      "https://other.example.org/",
+		expected: "catchAll",
+	}, {
+		title:    "not, matching",
+		url:      "https://other.example.org/app",
+		expected: "notBeta",
+	}, {
+		title:    "not, not matching",
+		url:      "https://other.example.org/app",
+		headers:  map[string]string{"X-Beta": "true"},
+		expected: "beta",
+	}, {
+		title:    "nested path",
+		url:      "https://other.example.org/foo/42",
+		expected: "paths",
+	}, {
+		title:    "nested path subtree",
+		url:      "https://other.example.org/bar/baz",
+		expected: "paths",
+	}, {
+		title:    "nested path regexp",
+		url:      "https://other.example.org/baz/qux",
+		expected: "paths",
+	}, {
+		title:    "group, first",
+		method:   "POST",
+		url:      "https://other.example.org/",
+		headers:  map[string]string{"Content-Type": "application/json"},
+		expected: "groups",
+	}, {
+		title:    "group, second with custom predicate",
+		method:   "PUT",
+		url:      "https://other.example.org/",
+		headers:  map[string]string{predicateHeader: "custom"},
+		expected: "groups",
+	}, {
+		title:    "group, partial",
+		method:   "PUT",
+		url:      "https://other.example.org/",
+		expected: "catchAll",
+	}, {
+		title:    "nested not and or",
+		url:      "https://other.example.org/qux",
+		headers:  map[string]string{"X-Nested": "true"},
+		expected: "nested",
+	}, {
+		title:    "nested not and or, excluded",
+		method:   "PATCH",
+		url:      "https://other.example.org/qux",
+		headers:  map[string]string{"X-Nested": "true"},
+		expected: "catchAll",
+	}} {
+		t.Run(tt.title, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = "GET"
+			}
+
+			req, err := http.NewRequest(method, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			r, err := tr.checkRequest(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r.Id != tt.expected {
+				t.Errorf("unexpected route: %s, expected: %s", r.Id, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPredicateCombinatorsIgnoreTrailingSlash(t *testing.T) {
+	dc, err := testdataclient.NewDoc(`
+		paths: Or(Path("/foo"), Path("/bar/"), PathSubtree("/baz/")) -> "https://paths.example.org";
+		notPath: Not(Path("/qux")) && Header("X-Not", "true") -> "https://notpath.example.org";
+		catchAll: * -> "https://catchall.example.org";
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tl := loggingtest.New()
+	rt := routing.New(routing.Options{
+		FilterRegistry:  builtin.MakeRegistry(),
+		MatchingOptions: routing.IgnoreTrailingSlash,
+		DataClients:     []routing.DataClient{dc},
+		PollTimeout:     pollTimeout,
+		Log:             tl,
+	})
+
+	tr := &testRouting{tl, rt}
+	defer tr.close()
+
+	if err := tr.waitForRouteSetting(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		url      string
+		headers  map[string]string
+		expected string
+	}{
+		{url: "https://www.example.org/foo", expected: "paths"},
+		{url: "https://www.example.org/foo/", expected: "paths"},
+		{url: "https://www.example.org/bar", expected: "paths"},
+		{url: "https://www.example.org/bar/", expected: "paths"},
+		{url: "https://www.example.org/baz", expected: "paths"},
+		{url: "https://www.example.org/baz/", expected: "paths"},
+		{url: "https://www.example.org/baz/quux", expected: "paths"},
+		{url: "https://www.example.org/quux", headers: map[string]string{"X-Not": "true"}, expected: "notPath"},
+		{url: "https://www.example.org/qux", headers: map[string]string{"X-Not": "true"}, expected: "catchAll"},
+		{url: "https://www.example.org/qux/", headers: map[string]string{"X-Not": "true"}, expected: "catchAll"},
+	} {
+		t.Run(tt.url, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			r, err := tr.checkRequest(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r.Id != tt.expected {
+				t.Errorf("unexpected route: %s, expected: %s", r.Id, tt.expected)
+			}
+		})
+	}
+}
+
+func TestInvalidPredicateCombinators(t *testing.T) {
+	dc, err := testdataclient.NewDoc(`
+		weight: Or(Weight(10)) -> "https://weight.example.org";
+		noArgs: Or() -> "https://noargs.example.org";
+		notTwoArgs: Not(Method("GET"), Method("POST")) -> "https://nottwoargs.example.org";
+		unknown: Not(Unknown()) -> "https://unknown.example.org";
+		invalidNested: Or(Host("[")) -> "https://invalidnested.example.org";
+		valid: * -> "https://valid.example.org";
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notGroup := testdataclient.New([]*eskip.Route{{
+		Id:         "notGroup",
+		Predicates: []*eskip.Predicate{{Name: "Or", Args: []interface{}{"Host"}}},
+		Backend:    "https://notgroup.example.org",
+	}})
+
+	tr, err := newTestRouting(dc, notGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tr.close()
+
+	r, err := tr.checkGetRequest("https://www.example.org/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Id != "valid" {
+		t.Errorf("unexpected route: %s", r.Id)
+	}
+}
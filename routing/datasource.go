@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/url"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/zalando/skipper/eskip"
@@ -35,6 +36,13 @@ func (it incomingType) String() string {
 
 type routeDefs map[string]*eskip.Route
 
+// merged route definitions, and the name of the data client, whose data
+// caused the update
+type routeDefsUpdate struct {
+	defs   []*eskip.Route
+	source string
+}
+
 type incomingData struct {
 	typ            incomingType
 	client         DataClient
@@ -151,15 +159,20 @@ func mergeDefs(defsByClient map[DataClient]routeDefs) []*eskip.Route {
 	return all
 }
 
+// returns the name of the data client type, e.g. kubernetes.Client
+func dataClientName(c DataClient) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", c), "*")
+}
+
 // receives the initial set of the route definitiosn and their
 // updates from multiple data clients, merges them by route id
 // and sends the merged route definitions to the output channel.
 //
 // The active set of routes from last successful update are used until the
 // next successful update.
-func receiveRouteDefs(o Options, quit <-chan struct{}) <-chan []*eskip.Route {
+func receiveRouteDefs(o Options, quit <-chan struct{}) <-chan *routeDefsUpdate {
 	in := make(chan *incomingData)
-	out := make(chan []*eskip.Route)
+	out := make(chan *routeDefsUpdate)
 	defsByClient := make(map[DataClient]routeDefs)
 
 	for _, c := range o.DataClients {
@@ -180,7 +193,7 @@ func receiveRouteDefs(o Options, quit <-chan struct{}) <-chan []*eskip.Route {
 			defsByClient[c] = applyIncoming(defsByClient[c], incoming)
 
 			select {
-			case out <- mergeDefs(defsByClient):
+			case out <- &routeDefsUpdate{defs: mergeDefs(defsByClient), source: dataClientName(c)}:
 			case <-quit:
 				return
 			}
@@ -359,7 +372,7 @@ func parseWeightPredicateArgs(args []interface{}) (int, error) {
 }
 
 // initialize predicate instances from their spec with the concrete arguments
-func processPredicates(cpm map[string]PredicateSpec, defs []*eskip.Predicate) ([]Predicate, int, error) {
+func processPredicates(cpm map[string]PredicateSpec, o MatchingOptions, defs []*eskip.Predicate) ([]Predicate, int, error) {
 	cps := make([]Predicate, 0, len(defs))
 	var weight int
 	for _, def := range defs {
@@ -376,14 +389,9 @@ func processPredicates(cpm map[string]PredicateSpec, defs []*eskip.Predicate) ([
 			continue
 		}
 
-		spec, ok := cpm[def.Name]
-		if !ok {
-			return nil, 0, fmt.Errorf("predicate %q not found", def.Name)
-		}
-
-		cp, err := spec.Create(def.Args)
+		cp, err := createPredicate(cpm, o, def)
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to create predicate %q: %w", spec.Name(), err)
+			return nil, 0, err
 		}
 
 		cps = append(cps, cp)
@@ -451,7 +459,7 @@ func processTreePredicates(r *Route, predicateList []*eskip.Predicate) error {
 }
 
 // processes a route definition for the routing table
-func processRouteDef(cpm map[string]PredicateSpec, fr filters.Registry, def *eskip.Route) (*Route, error) {
+func processRouteDef(cpm map[string]PredicateSpec, o MatchingOptions, fr filters.Registry, def *eskip.Route) (*Route, error) {
 	scheme, host, err := splitBackend(def)
 	if err != nil {
 		return nil, err
@@ -467,7 +475,7 @@ func processRouteDef(cpm map[string]PredicateSpec, fr filters.Registry, def *esk
 		return nil, err
 	}
 
-	cps, weight, err := processPredicates(cpm, def.Predicates)
+	cps, weight, err := processPredicates(cpm, o, def.Predicates)
 	if err != nil {
 		return nil, err
 	}
@@ -494,7 +502,7 @@ func mapPredicates(cps []PredicateSpec) map[string]PredicateSpec {
 func processRouteDefs(o Options, fr filters.Registry, defs []*eskip.Route) (routes []*Route, invalidDefs []*eskip.Route) {
 	cpm := mapPredicates(o.Predicates)
 	for _, def := range defs {
-		route, err := processRouteDef(cpm, fr, def)
+		route, err := processRouteDef(cpm, o.MatchingOptions, fr, def)
 		if err == nil {
 			routes = append(routes, route)
 		} else {
@@ -510,66 +518,154 @@ type routeTable struct {
 	validRoutes   []*eskip.Route
 	invalidRoutes []*eskip.Route
 	created       time.Time
+
+	// the version of the routing table, the data client that it was
+	// received from, and the received route definitions, used by the
+	// routing history
+	version int
+	source  string
+	defs    []*eskip.Route
+
+	// set when the routing table is pinned, and no updates are applied
+	// until unpinned
+	pinned bool
+
+	// set only for the routing tables created by the history commands,
+	// and closed when the routing table was applied
+	applied chan struct{}
+}
+
+// historyCommand pins the current routing table, or rolls back to the
+// table of a previous version, when set, or applies the latest received
+// routing table, when unpinning.
+type historyCommand struct {
+	pin     bool
+	table   *routeTable
+	applied chan struct{}
 }
 
 // receives the next version of the routing table on the output channel,
-// when an update is received on one of the data clients.
-func receiveRouteMatcher(o Options, out chan<- *routeTable, quit <-chan struct{}) {
+// when an update is received on one of the data clients, or when the
+// routing is pinned, rolled back or unpinned.
+func receiveRouteMatcher(o Options, out chan<- *routeTable, commands <-chan *historyCommand, quit <-chan struct{}) {
 	updates := receiveRouteDefs(o, quit)
-	var (
-		rt           *routeTable
-		outRelay     chan<- *routeTable
-		updatesRelay <-chan []*eskip.Route
-	)
-	updatesRelay = updates
-	for {
-		select {
-		case defs := <-updatesRelay:
-			o.Log.Info("route settings received")
+	builder := newRouteBuilder(o)
+	build := func(u *routeDefsUpdate) *routeTable {
+		// preprocessors may modify the received slice
+		defs := make([]*eskip.Route, len(u.defs))
+		copy(defs, u.defs)
+		for i := range o.PreProcessors {
+			defs = o.PreProcessors[i].Do(defs)
+		}
 
-			for i := range o.PreProcessors {
-				defs = o.PreProcessors[i].Do(defs)
-			}
+		routes, invalidRoutes := builder.processRouteDefs(o.FilterRegistry, defs)
 
-			routes, invalidRoutes := processRouteDefs(o, o.FilterRegistry, defs)
+		for i := range o.PostProcessors {
+			routes = o.PostProcessors[i].Do(routes)
+		}
 
-			for i := range o.PostProcessors {
-				routes = o.PostProcessors[i].Do(routes)
-			}
+		builder.keepInUse(routes)
+		m, errs := builder.newMatcher(routes)
 
-			m, errs := newMatcher(routes, o.MatchingOptions)
+		invalidRouteIds := make(map[string]struct{})
+		validRoutes := []*eskip.Route{}
 
-			invalidRouteIds := make(map[string]struct{})
-			validRoutes := []*eskip.Route{}
+		for _, err := range errs {
+			o.Log.Error(err)
+			invalidRouteIds[err.ID] = struct{}{}
+		}
 
-			for _, err := range errs {
-				o.Log.Error(err)
-				invalidRouteIds[err.ID] = struct{}{}
+		for _, r := range routes {
+			if _, found := invalidRouteIds[r.Id]; found {
+				invalidRoutes = append(invalidRoutes, &r.Route)
+			} else {
+				validRoutes = append(validRoutes, &r.Route)
 			}
+		}
 
-			for _, r := range routes {
-				if _, found := invalidRouteIds[r.Id]; found {
-					invalidRoutes = append(invalidRoutes, &r.Route)
-				} else {
-					validRoutes = append(validRoutes, &r.Route)
-				}
-			}
+		sort.SliceStable(validRoutes, func(i, j int) bool {
+			return validRoutes[i].Id < validRoutes[j].Id
+		})
+
+		return &routeTable{
+			m:             m,
+			validRoutes:   validRoutes,
+			invalidRoutes: invalidRoutes,
+			created:       time.Now().UTC(),
+			source:        u.source,
+			defs:          u.defs,
+		}
+	}
+
+	var (
+		rt            *routeTable
+		active        *routeTable
+		latest        *routeDefsUpdate
+		version       int
+		pinned        bool
+		latestApplied bool
+		outRelay      chan<- *routeTable
+		updatesRelay  <-chan *routeDefsUpdate
+		commandsRelay <-chan *historyCommand
+	)
 
-			sort.SliceStable(validRoutes, func(i, j int) bool {
-				return validRoutes[i].Id < validRoutes[j].Id
-			})
+	// returns a copy of the active routing table with the pinned flag set
+	copyActive := func() *routeTable {
+		c := *active
+		c.pinned = pinned
+		return &c
+	}
+
+	updatesRelay = updates
+	commandsRelay = commands
+	for {
+		select {
+		case u := <-updatesRelay:
+			o.Log.Info("route settings received")
+			latest = u
+			if pinned {
+				latestApplied = false
+				o.Log.Info("routing is pinned, route settings not applied")
+				continue
+			}
 
-			rt = &routeTable{
-				m:             m,
-				validRoutes:   validRoutes,
-				invalidRoutes: invalidRoutes,
-				created:       time.Now().UTC(),
+			version++
+			rt = build(u)
+			rt.version = version
+			latestApplied = true
+			updatesRelay = nil
+			commandsRelay = nil
+			outRelay = out
+		case c := <-commandsRelay:
+			pinned = c.pin
+			switch {
+			case c.pin && c.table != nil:
+				o.Log.Infof("rolling back the routing to version %d", c.table.version)
+				rt = build(&routeDefsUpdate{defs: c.table.defs, source: c.table.source})
+				rt.version = c.table.version
+				rt.pinned = true
+				latestApplied = false
+			case !c.pin && !latestApplied && latest != nil:
+				version++
+				rt = build(latest)
+				rt.version = version
+				latestApplied = true
+			case active != nil:
+				rt = copyActive()
+			default:
+				close(c.applied)
+				continue
 			}
+
+			rt.applied = c.applied
 			updatesRelay = nil
+			commandsRelay = nil
 			outRelay = out
 		case outRelay <- rt:
+			active = rt
 			rt = nil
 			updatesRelay = updates
+			commandsRelay = commands
 			outRelay = nil
 		case <-quit:
 			return
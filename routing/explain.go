@@ -0,0 +1,362 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/dimfeld/httppath"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/predicates"
+)
+
+const defaultExplainLimit = 10
+
+// ExplainRequest describes a request, whose routing is explained.
+type ExplainRequest struct {
+
+	// Method of the request. Defaults to GET.
+	Method string `json:"method,omitempty"`
+
+	// Host of the request, as received in the Host header.
+	Host string `json:"host,omitempty"`
+
+	// Path of the request, optionally with the query. It can be an
+	// absolute URL, too, in which case the host is taken from it, when
+	// not set.
+	Path string `json:"path,omitempty"`
+
+	// Headers of the request.
+	Headers map[string][]string `json:"headers,omitempty"`
+
+	// Cookies of the request.
+	Cookies map[string]string `json:"cookies,omitempty"`
+
+	// SourceIP is the remote address of the request.
+	SourceIP string `json:"sourceIP,omitempty"`
+}
+
+// ExplainCandidate is a route considered during the routing of an
+// explained request.
+type ExplainCandidate struct {
+
+	// RouteID is the id of the route.
+	RouteID string `json:"routeId"`
+
+	// Route is the definition of the route.
+	Route string `json:"route"`
+
+	// Params contains the wildcard parameters of the matching route.
+	Params map[string]string `json:"params,omitempty"`
+
+	// FailedPredicate is the first predicate of the route, that didn't
+	// match the request. It is empty for the matching route, and for the
+	// routes, that match, but have lower priority than the matching one.
+	FailedPredicate string `json:"failedPredicate,omitempty"`
+
+	// Reason explains why the route was not selected.
+	Reason string `json:"reason,omitempty"`
+
+	// Failures is the number of the predicates of the route, that didn't
+	// match the request. The candidates are ranked by this number.
+	Failures int `json:"failures"`
+}
+
+// Explanation is the result of explaining the routing of a request.
+type Explanation struct {
+
+	// Match is the route matching the request, or nil, when no route
+	// matches.
+	Match *ExplainCandidate `json:"match"`
+
+	// Candidates are the other routes, that match the path of the
+	// request, or have no path predicate, ranked by how close they are
+	// to matching the request.
+	Candidates []*ExplainCandidate `json:"candidates"`
+}
+
+// recordingMatcher collects the leaves of all the path tree positions,
+// that match the path, in the matching order, without accepting any.
+type recordingMatcher struct {
+	leaves leafMatchers
+	seen   map[*leafMatcher]bool
+}
+
+func (m *recordingMatcher) Match(value interface{}) (bool, interface{}) {
+	if v, ok := value.(*pathMatcher); ok {
+		m.add(v.leaves)
+	}
+
+	return false, nil
+}
+
+func (m *recordingMatcher) add(leaves leafMatchers) {
+	for _, l := range leaves {
+		if !m.seen[l] {
+			m.seen[l] = true
+			m.leaves = append(m.leaves, l)
+		}
+	}
+}
+
+// Request creates the HTTP request from the description.
+func (er *ExplainRequest) Request() (*http.Request, error) {
+	p := er.Path
+	if p == "" {
+		p = "/"
+	}
+
+	u, err := url.Parse(p)
+	if err != nil {
+		return nil, err
+	}
+
+	method := strings.ToUpper(er.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	host := er.Host
+	if host == "" {
+		host = u.Host
+	}
+
+	r := &http.Request{
+		Method:     method,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Host:       host,
+		Header:     make(http.Header),
+	}
+
+	for name, values := range er.Headers {
+		for _, v := range values {
+			r.Header.Add(name, v)
+		}
+	}
+
+	names := make([]string, 0, len(er.Cookies))
+	for name := range er.Cookies {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		r.AddCookie(&http.Cookie{Name: name, Value: er.Cookies[name]})
+	}
+
+	if er.SourceIP != "" {
+		if net.ParseIP(er.SourceIP) == nil {
+			return nil, fmt.Errorf("invalid source IP: %s", er.SourceIP)
+		}
+
+		r.RemoteAddr = net.JoinHostPort(er.SourceIP, "0")
+	}
+
+	return r, nil
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// explainLeaf checks all the conditions of a leaf in the order of the
+// matching, and returns the first failing one with the reason, and the
+// number of the failing conditions.
+func explainLeaf(l *leafMatcher, req *http.Request, path, exactPath string) (failed, reason string, failures int) {
+	fail := func(predicate, why string) {
+		if failures == 0 {
+			failed, reason = predicate, why
+		}
+
+		failures++
+	}
+
+	if l.exactPath != "" && l.exactPath != path {
+		fail(predicateString(predicates.PathName, l.exactPath), fmt.Sprintf("path %s does not match", path))
+	}
+
+	if l.method != "" && l.method != req.Method {
+		fail(predicateString(predicates.MethodName, l.method), fmt.Sprintf("method is %s", req.Method))
+	}
+
+	for _, rx := range l.hostRxs {
+		if !rx.MatchString(req.Host) {
+			fail(predicateString(predicates.HostName, rx.String()), fmt.Sprintf("host %s does not match", req.Host))
+		}
+	}
+
+	for _, rx := range l.pathRxs {
+		if !rx.MatchString(exactPath) {
+			fail(predicateString(predicates.PathRegexpName, rx.String()), fmt.Sprintf("path %s does not match", exactPath))
+		}
+	}
+
+	for _, k := range sortedKeys(l.headersExact) {
+		v := l.headersExact[k]
+		if !matchHeader(req.Header, k, func(val string) bool { return val == v }) {
+			fail(predicateString(predicates.HeaderName, k, v), headerReason(req.Header, k))
+		}
+	}
+
+	for _, k := range sortedKeys(l.headersRegexp) {
+		for _, rx := range l.headersRegexp[k] {
+			if !matchHeader(req.Header, k, rx.MatchString) {
+				fail(predicateString(predicates.HeaderRegexpName, k, rx.String()), headerReason(req.Header, k))
+			}
+		}
+	}
+
+	defs := customPredicateDefs(l.route)
+	for i, p := range l.predicates {
+		if !p.Match(req) {
+			name := "custom predicate"
+			if i < len(defs) {
+				name = defs[i].String()
+			}
+
+			fail(name, "predicate does not match")
+		}
+	}
+
+	return
+}
+
+func predicateString(name string, args ...interface{}) string {
+	return (&eskip.Predicate{Name: name, Args: args}).String()
+}
+
+func headerReason(h http.Header, key string) string {
+	if _, ok := h[key]; !ok {
+		return fmt.Sprintf("header %s is missing", key)
+	}
+
+	return fmt.Sprintf("header %s has a different value", key)
+}
+
+// customPredicateDefs returns the definitions of the custom predicates of
+// the route, in the same order as the predicate instances.
+func customPredicateDefs(r *Route) []*eskip.Predicate {
+	var defs []*eskip.Predicate
+	for _, p := range r.Route.Predicates {
+		if p.Name == predicates.WeightName || isTreePredicate(p.Name) {
+			continue
+		}
+
+		defs = append(defs, p)
+	}
+
+	return defs
+}
+
+func (m *matcher) explain(r *http.Request, limit int) *Explanation {
+	path := httppath.Clean(r.URL.Path)
+	exact := path
+	if m.matchingOptions.ignoreTrailingSlash() {
+		path = trimTrailingSlash(path)
+	}
+
+	rm := &recordingMatcher{seen: make(map[*leafMatcher]bool)}
+	m.paths.LookupMatcher(path, rm)
+	rm.add(m.rootLeaves)
+
+	e := &Explanation{Candidates: []*ExplainCandidate{}}
+	route, params := m.match(r)
+	if route != nil {
+		e.Match = &ExplainCandidate{RouteID: route.Id, Route: route.Route.String(), Params: params}
+	}
+
+	for _, l := range rm.leaves {
+		if l.route == route {
+			continue
+		}
+
+		c := &ExplainCandidate{RouteID: l.route.Id, Route: l.route.Route.String()}
+		c.FailedPredicate, c.Reason, c.Failures = explainLeaf(l, r, path, exact)
+		if c.Failures == 0 && route != nil {
+			c.Reason = fmt.Sprintf("matches, but route %s has a higher priority", route.Id)
+		}
+
+		e.Candidates = append(e.Candidates, c)
+	}
+
+	sort.SliceStable(e.Candidates, func(i, j int) bool {
+		return e.Candidates[i].Failures < e.Candidates[j].Failures
+	})
+
+	if limit >= 0 && len(e.Candidates) > limit {
+		e.Candidates = e.Candidates[:limit]
+	}
+
+	return e
+}
+
+// Explain matches the request against the current routing table, and
+// returns the matching route, and the other candidate routes ranked by
+// how close they are to matching the request, with the first predicate
+// that failed. The filters of the routes are not executed. When limit
+// is negative, all the candidates are returned.
+func (r *Routing) Explain(req *http.Request, limit int) *Explanation {
+	rt := r.routeTable.Load().(*routeTable)
+	return rt.m.explain(req, limit)
+}
+
+type explainHandler struct {
+	routing *Routing
+}
+
+// ExplainHandler returns an HTTP handler, that explains the routing of
+// the requests described by the JSON representation of ExplainRequest,
+// received with the POST method. The number of the returned candidates
+// can be set with the limit query parameter, defaults to 10.
+func (r *Routing) ExplainHandler() http.Handler {
+	return &explainHandler{routing: r}
+}
+
+func (h *explainHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// only the query is parsed, the body contains the request description
+	req.Form = req.URL.Query()
+	limit, err := extractParam(req, "limit", defaultExplainLimit)
+	if err != nil {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	var er ExplainRequest
+	if err := json.NewDecoder(req.Body).Decode(&er); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request description: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	r, err := er.Request()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid request description: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.routing.Explain(r, limit)); err != nil {
+		http.Error(
+			w,
+			http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError,
+		)
+	}
+}
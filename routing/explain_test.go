@@ -0,0 +1,230 @@
+package routing_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+)
+
+const explainRoutes = `
+	api: Path("/api/:resource") && Method("GET") && Host("^api[.]example[.]org$")
+		-> "https://api.example.org";
+	apiPost: Path("/api/:resource") && Method("POST")
+		-> "https://api.example.org";
+	apiShadowed: Path("/api/:resource")
+		-> "https://shadowed.example.org";
+	beta: Path("/api/:resource") && Header("X-Beta", "true") && CustomPredicate("beta")
+		-> "https://beta.example.org";
+	other: Path("/other") -> "https://other.example.org";
+`
+
+func newExplainRouting(t *testing.T) *testRouting {
+	dc, err := testdataclient.NewDoc(explainRoutes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := newTestRoutingWithPredicates([]routing.PredicateSpec{&predicate{}}, dc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tr
+}
+
+func findCandidate(e *routing.Explanation, id string) *routing.ExplainCandidate {
+	for _, c := range e.Candidates {
+		if c.RouteID == id {
+			return c
+		}
+	}
+
+	return nil
+}
+
+func TestExplain(t *testing.T) {
+	tr := newExplainRouting(t)
+	defer tr.close()
+
+	t.Run("matching route and shadowed routes", func(t *testing.T) {
+		req, err := (&routing.ExplainRequest{Host: "api.example.org", Path: "/api/users"}).Request()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		e := tr.routing.Explain(req, -1)
+		if e.Match == nil || e.Match.RouteID != "api" || e.Match.Params["resource"] != "users" {
+			t.Fatalf("unexpected match: %+v", e.Match)
+		}
+
+		if len(e.Candidates) != 3 {
+			t.Fatalf("unexpected number of candidates: %d", len(e.Candidates))
+		}
+
+		shadowed := findCandidate(e, "apiShadowed")
+		if shadowed == nil || shadowed.Failures != 0 || !strings.Contains(shadowed.Reason, "route api has a higher priority") {
+			t.Errorf("unexpected shadowed candidate: %+v", shadowed)
+		}
+
+		if e.Candidates[0] != shadowed {
+			t.Error("the shadowed route should be ranked first")
+		}
+
+		if findCandidate(e, "other") != nil {
+			t.Error("unexpected candidate with a different path")
+		}
+	})
+
+	t.Run("failing predicates", func(t *testing.T) {
+		req, err := (&routing.ExplainRequest{
+			Method:  "DELETE",
+			Host:    "www.example.org",
+			Path:    "/api/users",
+			Headers: map[string][]string{"X-Beta": {"false"}},
+		}).Request()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		e := tr.routing.Explain(req, -1)
+		if e.Match == nil || e.Match.RouteID != "apiShadowed" {
+			t.Fatalf("unexpected match: %+v", e.Match)
+		}
+
+		for id, expected := range map[string]struct {
+			failed   string
+			failures int
+		}{
+			"api":     {`Method("GET")`, 2},
+			"apiPost": {`Method("POST")`, 1},
+			"beta":    {`Header("X-Beta", "true")`, 2},
+		} {
+			c := findCandidate(e, id)
+			if c == nil {
+				t.Errorf("candidate not found: %s", id)
+				continue
+			}
+
+			if c.FailedPredicate != expected.failed || c.Failures != expected.failures || c.Reason == "" {
+				t.Errorf("unexpected candidate %s: %+v", id, c)
+			}
+		}
+
+		if e.Candidates[0].RouteID != "apiPost" {
+			t.Errorf("unexpected ranking, first: %s", e.Candidates[0].RouteID)
+		}
+	})
+
+	t.Run("custom predicate", func(t *testing.T) {
+		req, err := (&routing.ExplainRequest{
+			Method:  "DELETE",
+			Path:    "/api/users",
+			Headers: map[string][]string{"X-Beta": {"true"}},
+		}).Request()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := findCandidate(tr.routing.Explain(req, -1), "beta")
+		if c == nil || c.FailedPredicate != `CustomPredicate("beta")` || c.Failures != 1 {
+			t.Errorf("unexpected candidate: %+v", c)
+		}
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		req, err := (&routing.ExplainRequest{Path: "/unknown"}).Request()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		e := tr.routing.Explain(req, -1)
+		if e.Match != nil || len(e.Candidates) != 0 {
+			t.Errorf("unexpected explanation: %+v", e)
+		}
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		req, err := (&routing.ExplainRequest{Path: "/api/users"}).Request()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if e := tr.routing.Explain(req, 1); len(e.Candidates) != 1 {
+			t.Errorf("unexpected number of candidates: %d", len(e.Candidates))
+		}
+	})
+}
+
+func TestExplainHandler(t *testing.T) {
+	tr := newExplainRouting(t)
+	defer tr.close()
+
+	server := httptest.NewServer(tr.routing.ExplainHandler())
+	defer server.Close()
+
+	rsp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected status: %d", rsp.StatusCode)
+	}
+
+	for _, tt := range []struct {
+		title string
+		query string
+		body  string
+	}{{
+		title: "invalid json",
+		body:  "{",
+	}, {
+		title: "invalid limit",
+		query: "?limit=foo",
+		body:  "{}",
+	}, {
+		title: "invalid source IP",
+		body:  `{"sourceIP": "foo"}`,
+	}} {
+		t.Run(tt.title, func(t *testing.T) {
+			rsp, err := http.Post(server.URL+tt.query, "application/json", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rsp.Body.Close()
+			if rsp.StatusCode != http.StatusBadRequest {
+				t.Errorf("unexpected status: %d", rsp.StatusCode)
+			}
+		})
+	}
+
+	rsp, err = http.Post(
+		server.URL+"?limit=2",
+		"application/json",
+		strings.NewReader(`{"method": "post", "path": "/api/users"}`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK || rsp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response: %d, %s", rsp.StatusCode, rsp.Header.Get("Content-Type"))
+	}
+
+	var e routing.Explanation
+	if err := json.NewDecoder(rsp.Body).Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Match == nil || e.Match.RouteID != "apiPost" || len(e.Candidates) != 2 {
+		t.Errorf("unexpected explanation: %+v", e)
+	}
+}
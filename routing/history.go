@@ -0,0 +1,444 @@
+package routing
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zalando/skipper/eskip"
+)
+
+const (
+	tableVersionKey   = "routing.table.version"
+	tablePinnedKey    = "routing.table.pinned"
+	tableRollbacksKey = "routing.table.rollbacks"
+)
+
+var (
+	errHistoryDisabled = errors.New("routing history disabled")
+	errVersionNotFound = errors.New("routing table version not found")
+)
+
+// DiffSummary contains the number of the changed routes of a routing table
+// version compared to the previous one.
+type DiffSummary struct {
+	Added   int `json:"added"`
+	Updated int `json:"updated"`
+	Deleted int `json:"deleted"`
+}
+
+// TableVersion describes a routing table kept in the routing history.
+type TableVersion struct {
+
+	// Version of the routing table. It is increased by every applied
+	// update.
+	Version int `json:"version"`
+
+	// Created is the time when the routing table was created.
+	Created time.Time `json:"created"`
+
+	// Source is the data client, whose update resulted in the routing
+	// table.
+	Source string `json:"source"`
+
+	// Routes is the number of the valid routes.
+	Routes int `json:"routes"`
+
+	// InvalidRoutes is the number of the routes, that failed to be
+	// processed.
+	InvalidRoutes int `json:"invalidRoutes"`
+
+	// Diff summarizes the changes compared to the previous version.
+	Diff DiffSummary `json:"diff"`
+
+	// Active is set for the routing table currently used.
+	Active bool `json:"active"`
+
+	// Pinned is set for the active routing table, when the routing is
+	// pinned, and the updates from the data clients are not applied.
+	Pinned bool `json:"pinned"`
+}
+
+// TableDiff contains the differences between two routing table versions.
+type TableDiff struct {
+	From    int            `json:"from"`
+	To      int            `json:"to"`
+	Added   []*eskip.Route `json:"added"`
+	Updated []*eskip.Route `json:"updated"`
+	Deleted []string       `json:"deleted"`
+}
+
+type historyEntry struct {
+	table *routeTable
+	diff  DiffSummary
+}
+
+// history keeps the last applied routing tables, and the active one.
+type history struct {
+	mu      sync.Mutex
+	size    int
+	entries []historyEntry
+	active  *routeTable
+}
+
+// returns the routes of the second list, that are not in the first one,
+// or differ, and the IDs of the routes of the first list, that are not
+// in the second one. The routes of the unchanged routes are typically the
+// same instances.
+func diffRoutes(from, to []*eskip.Route) (added, updated []*eskip.Route, deleted []string) {
+	fromByID := make(map[string]*eskip.Route, len(from))
+	for _, r := range from {
+		fromByID[r.Id] = r
+	}
+
+	toIDs := make(map[string]bool, len(to))
+	for _, r := range to {
+		toIDs[r.Id] = true
+		prev, ok := fromByID[r.Id]
+		switch {
+		case !ok:
+			added = append(added, r)
+		case prev != r && !eskip.Eq(prev, r):
+			updated = append(updated, r)
+		}
+	}
+
+	for _, r := range from {
+		if !toIDs[r.Id] {
+			deleted = append(deleted, r.Id)
+		}
+	}
+
+	return
+}
+
+// apply records the applied routing table. The tables of the rolled back
+// versions are not recorded again.
+func (h *history) apply(rt *routeTable) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.active = rt
+	if h.size <= 0 {
+		return
+	}
+
+	n := len(h.entries)
+	if n > 0 && h.entries[n-1].table.version >= rt.version {
+		return
+	}
+
+	e := historyEntry{table: rt}
+	if n == 0 {
+		e.diff = DiffSummary{Added: len(rt.validRoutes)}
+	} else {
+		added, updated, deleted := diffRoutes(h.entries[n-1].table.validRoutes, rt.validRoutes)
+		e.diff = DiffSummary{Added: len(added), Updated: len(updated), Deleted: len(deleted)}
+	}
+
+	if n == h.size {
+		copy(h.entries, h.entries[1:])
+		h.entries[n-1] = historyEntry{}
+		h.entries = h.entries[:n-1]
+	}
+
+	h.entries = append(h.entries, e)
+}
+
+func (h *history) find(version int) *routeTable {
+	for _, e := range h.entries {
+		if e.table.version == version {
+			return e.table
+		}
+	}
+
+	return nil
+}
+
+func (h *history) versions() []*TableVersion {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	v := make([]*TableVersion, 0, len(h.entries))
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		t := h.entries[i].table
+		active := h.active != nil && h.active.version == t.version
+		v = append(v, &TableVersion{
+			Version:       t.version,
+			Created:       t.created,
+			Source:        t.source,
+			Routes:        len(t.validRoutes),
+			InvalidRoutes: len(t.invalidRoutes),
+			Diff:          h.entries[i].diff,
+			Active:        active,
+			Pinned:        active && h.active.pinned,
+		})
+	}
+
+	return v
+}
+
+func (r *Routing) updateTableMetrics(rt *routeTable) {
+	if r.metrics == nil {
+		return
+	}
+
+	var pinned float64
+	if rt.pinned {
+		pinned = 1
+	}
+
+	r.metrics.UpdateGauge(tableVersionKey, float64(rt.version))
+	r.metrics.UpdateGauge(tablePinnedKey, pinned)
+}
+
+// History returns the versions of the routing tables kept in the routing
+// history, starting with the latest one.
+func (r *Routing) History() ([]*TableVersion, error) {
+	if r.history.size <= 0 {
+		return nil, errHistoryDisabled
+	}
+
+	return r.history.versions(), nil
+}
+
+// Diff returns the differences between two routing table versions kept in
+// the routing history.
+func (r *Routing) Diff(from, to int) (*TableDiff, error) {
+	if r.history.size <= 0 {
+		return nil, errHistoryDisabled
+	}
+
+	r.history.mu.Lock()
+	f, t := r.history.find(from), r.history.find(to)
+	r.history.mu.Unlock()
+	if f == nil || t == nil {
+		return nil, errVersionNotFound
+	}
+
+	d := &TableDiff{From: from, To: to}
+	d.Added, d.Updated, d.Deleted = diffRoutes(f.validRoutes, t.validRoutes)
+	return d, nil
+}
+
+func (r *Routing) sendHistoryCommand(c *historyCommand) {
+	c.applied = make(chan struct{})
+	select {
+	case r.commands <- c:
+	case <-r.quit:
+		return
+	}
+
+	select {
+	case <-c.applied:
+	case <-r.quit:
+	}
+}
+
+// Pin pins the routing to the active routing table. The updates received
+// from the data clients are not applied until Unpin is called.
+func (r *Routing) Pin() error {
+	if r.history.size <= 0 {
+		return errHistoryDisabled
+	}
+
+	r.history.mu.Lock()
+	active := r.history.active
+	r.history.mu.Unlock()
+	if active == nil {
+		return errVersionNotFound
+	}
+
+	r.sendHistoryCommand(&historyCommand{pin: true})
+	return nil
+}
+
+// Rollback applies the routing table of a previous version kept in the
+// routing history, and pins the routing to it, until Unpin is called.
+// The routes of the previous version are processed again, the same way
+// as when receiving them from the data clients.
+func (r *Routing) Rollback(version int) error {
+	if r.history.size <= 0 {
+		return errHistoryDisabled
+	}
+
+	r.history.mu.Lock()
+	t := r.history.find(version)
+	active := r.history.active
+	r.history.mu.Unlock()
+	if t == nil {
+		return errVersionNotFound
+	}
+
+	if active != nil && active.version == version {
+		r.sendHistoryCommand(&historyCommand{pin: true})
+		return nil
+	}
+
+	r.sendHistoryCommand(&historyCommand{pin: true, table: t})
+	if r.metrics != nil {
+		r.metrics.IncCounter(tableRollbacksKey)
+	}
+
+	return nil
+}
+
+// Unpin applies the latest routing table received from the data clients,
+// and continues applying the updates.
+func (r *Routing) Unpin() error {
+	if r.history.size <= 0 {
+		return errHistoryDisabled
+	}
+
+	r.sendHistoryCommand(&historyCommand{})
+	return nil
+}
+
+type historyHandler struct {
+	routing *Routing
+}
+
+// HistoryHandler returns an HTTP handler serving the routing history. It
+// lists the routing table versions with GET on its root path, and
+// serves the following sub-paths:
+//
+//	GET  diff?from=<version>&to=<version>: the differences between two versions
+//	POST pin: pins the routing to the active routing table
+//	POST rollback?version=<version>: applies and pins a previous version
+//	POST unpin: applies the latest routing table, and continues updating
+//
+// The to parameter of the diff defaults to the active version, and from
+// defaults to the version preceding to.
+func (r *Routing) HistoryHandler() http.Handler {
+	return &historyHandler{routing: r}
+}
+
+func historyStatus(err error) int {
+	switch err {
+	case errHistoryDisabled, errVersionNotFound:
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func versionParam(req *http.Request, key string, defaultValue int) (int, error) {
+	v := req.URL.Query().Get(key)
+	if v == "" {
+		return defaultValue, nil
+	}
+
+	return strconv.Atoi(v)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(
+			w,
+			http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError,
+		)
+	}
+}
+
+func (h *historyHandler) diff(w http.ResponseWriter, req *http.Request) {
+	var active int
+	h.routing.history.mu.Lock()
+	if h.routing.history.active != nil {
+		active = h.routing.history.active.version
+	}
+
+	h.routing.history.mu.Unlock()
+
+	to, err := versionParam(req, "to", active)
+	if err != nil {
+		http.Error(w, "invalid to version", http.StatusBadRequest)
+		return
+	}
+
+	from, err := versionParam(req, "from", to-1)
+	if err != nil {
+		http.Error(w, "invalid from version", http.StatusBadRequest)
+		return
+	}
+
+	d, err := h.routing.Diff(from, to)
+	if err != nil {
+		http.Error(w, err.Error(), historyStatus(err))
+		return
+	}
+
+	writeJSON(w, d)
+}
+
+func (h *historyHandler) command(w http.ResponseWriter, req *http.Request, action string) {
+	var err error
+	switch action {
+	case "pin":
+		err = h.routing.Pin()
+	case "unpin":
+		err = h.routing.Unpin()
+	case "rollback":
+		var version int
+		version, err = versionParam(req, "version", -1)
+		if err != nil || version < 0 {
+			http.Error(w, "invalid or missing version", http.StatusBadRequest)
+			return
+		}
+
+		err = h.routing.Rollback(version)
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), historyStatus(err))
+		return
+	}
+
+	v, err := h.routing.History()
+	if err != nil {
+		http.Error(w, err.Error(), historyStatus(err))
+		return
+	}
+
+	writeJSON(w, v)
+}
+
+func (h *historyHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	action := path.Base(req.URL.Path)
+	method := http.MethodPost
+	if action == "history" || action == "diff" {
+		method = http.MethodGet
+	}
+
+	switch action {
+	case "history", "diff", "pin", "unpin", "rollback":
+	default:
+		http.NotFound(w, req)
+		return
+	}
+
+	if req.Method != method {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch action {
+	case "history":
+		v, err := h.routing.History()
+		if err != nil {
+			http.Error(w, err.Error(), historyStatus(err))
+			return
+		}
+
+		writeJSON(w, v)
+	case "diff":
+		h.diff(w, req)
+	default:
+		h.command(w, req, action)
+	}
+}
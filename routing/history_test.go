@@ -0,0 +1,323 @@
+package routing_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/logging/loggingtest"
+	"github.com/zalando/skipper/metrics/metricstest"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+)
+
+func newHistoryRouting(t *testing.T, size int, m *metricstest.MockMetrics) (*testRouting, *testdataclient.Client) {
+	dc, err := testdataclient.NewDoc(`
+		foo: Path("/foo") -> "https://foo.example.org";
+		bar: Path("/bar") -> "https://bar.example.org";
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := routing.Options{
+		DataClients: []routing.DataClient{dc},
+		PollTimeout: pollTimeout,
+		HistorySize: size,
+	}
+
+	if m != nil {
+		o.Metrics = m
+	}
+
+	tl := loggingtest.New()
+	o.Log = tl
+	rt := routing.New(o)
+
+	tr := &testRouting{tl, rt}
+	if err := tr.waitForRouteSetting(); err != nil {
+		tr.close()
+		t.Fatal(err)
+	}
+
+	return tr, dc
+}
+
+func updateHistoryRouting(t *testing.T, tr *testRouting, dc *testdataclient.Client, doc string, deletedIDs []string) {
+	tr.log.Reset()
+	if err := dc.UpdateDoc(doc, deletedIDs); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tr.waitForRouteSetting(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func serveHistory(t *testing.T, tr *testRouting, method, url string, expectedStatus int, v interface{}) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, nil)
+	w := httptest.NewRecorder()
+	tr.routing.HistoryHandler().ServeHTTP(w, req)
+	if w.Code != expectedStatus {
+		t.Fatalf("unexpected status code for %s %s: %d, expected: %d", method, url, w.Code, expectedStatus)
+	}
+
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return w
+}
+
+func routesCount(tr *testRouting) (string, string) {
+	w := httptest.NewRecorder()
+	tr.routing.ServeHTTP(w, httptest.NewRequest("HEAD", "/routes", nil))
+	return w.Header().Get("X-Count"), w.Header().Get("X-Pinned-Version")
+}
+
+func checkGauge(t *testing.T, m *metricstest.MockMetrics, key string, expected float64) {
+	t.Helper()
+	if v, ok := m.Gauge(key); !ok || v != expected {
+		t.Errorf("unexpected gauge %s: %v, expected: %v", key, v, expected)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	m := &metricstest.MockMetrics{}
+	tr, dc := newHistoryRouting(t, 3, m)
+	defer tr.close()
+
+	updateHistoryRouting(t, tr, dc, `baz: Path("/baz") -> "https://baz.example.org"`, nil)
+	updateHistoryRouting(t, tr, dc, `foo: Path("/foo") -> "https://foo2.example.org"`, []string{"bar"})
+
+	var versions []*routing.TableVersion
+	serveHistory(t, tr, "GET", "/routes/history", http.StatusOK, &versions)
+	if len(versions) != 3 {
+		t.Fatalf("unexpected number of versions: %d", len(versions))
+	}
+
+	latest := versions[0]
+	if latest.Version != 3 || !latest.Active || latest.Pinned || latest.Routes != 2 {
+		t.Errorf("unexpected latest version: %+v", latest)
+	}
+
+	if latest.Diff != (routing.DiffSummary{Updated: 1, Deleted: 1}) {
+		t.Errorf("unexpected diff summary: %+v", latest.Diff)
+	}
+
+	if latest.Source != "testdataclient.Client" {
+		t.Errorf("unexpected source: %s", latest.Source)
+	}
+
+	if versions[2].Version != 1 || versions[2].Diff.Added != 2 {
+		t.Errorf("unexpected first version: %+v", versions[2])
+	}
+
+	var d routing.TableDiff
+	serveHistory(t, tr, "GET", "/routes/history/diff", http.StatusOK, &d)
+	if d.From != 2 || d.To != 3 || len(d.Added) != 0 || len(d.Updated) != 1 || len(d.Deleted) != 1 {
+		t.Errorf("unexpected diff: %+v", d)
+	}
+
+	serveHistory(t, tr, "GET", "/routes/history/diff?from=1&to=2", http.StatusOK, &d)
+	if d.From != 1 || d.To != 2 || len(d.Added) != 1 || d.Added[0].Id != "baz" || len(d.Updated) != 0 || len(d.Deleted) != 0 {
+		t.Errorf("unexpected diff: %+v", d)
+	}
+
+	updateHistoryRouting(t, tr, dc, `qux: Path("/qux") -> "https://qux.example.org"`, nil)
+	serveHistory(t, tr, "GET", "/routes/history", http.StatusOK, &versions)
+	if len(versions) != 3 || versions[0].Version != 4 || versions[2].Version != 2 {
+		t.Errorf("failed to limit the history size: %+v", versions)
+	}
+
+	checkGauge(t, m, "routing.table.version", 4)
+	checkGauge(t, m, "routing.table.pinned", 0)
+}
+
+func TestHistoryPinRollback(t *testing.T) {
+	m := &metricstest.MockMetrics{}
+	tr, dc := newHistoryRouting(t, 5, m)
+	defer tr.close()
+
+	updateHistoryRouting(t, tr, dc, `baz: Path("/baz") -> "https://baz.example.org"`, nil)
+	if count, _ := routesCount(tr); count != "3" {
+		t.Fatalf("unexpected route count: %s", count)
+	}
+
+	t.Run("rollback", func(t *testing.T) {
+		var versions []*routing.TableVersion
+		serveHistory(t, tr, "POST", "/routes/history/rollback?version=1", http.StatusOK, &versions)
+		if len(versions) != 2 || !versions[1].Active || !versions[1].Pinned || versions[0].Active {
+			t.Errorf("unexpected versions after rollback: %+v", versions)
+		}
+
+		if _, err := tr.checkGetRequest("https://www.example.org/baz"); err == nil {
+			t.Error("failed to roll back the routing")
+		}
+
+		if count, pinned := routesCount(tr); count != "2" || pinned != "1" {
+			t.Errorf("unexpected routes headers: %s, %s", count, pinned)
+		}
+
+		checkGauge(t, m, "routing.table.version", 1)
+		checkGauge(t, m, "routing.table.pinned", 1)
+		m.WithCounters(func(c map[string]int64) {
+			if c["routing.table.rollbacks"] != 1 {
+				t.Errorf("unexpected rollback counter: %d", c["routing.table.rollbacks"])
+			}
+		})
+	})
+
+	t.Run("updates not applied while pinned", func(t *testing.T) {
+		tr.log.Reset()
+		if err := dc.UpdateDoc(`qux: Path("/qux") -> "https://qux.example.org"`, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := tr.log.WaitFor("routing is pinned", 12*pollTimeout); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tr.checkGetRequest("https://www.example.org/qux"); err == nil {
+			t.Error("unexpected update while pinned")
+		}
+	})
+
+	t.Run("unpin", func(t *testing.T) {
+		var versions []*routing.TableVersion
+		serveHistory(t, tr, "POST", "/routes/history/unpin", http.StatusOK, &versions)
+		if len(versions) != 3 || versions[0].Version != 3 || !versions[0].Active || versions[0].Pinned {
+			t.Errorf("unexpected versions after unpin: %+v", versions)
+		}
+
+		for _, path := range []string{"/foo", "/bar", "/baz", "/qux"} {
+			if _, err := tr.checkGetRequest("https://www.example.org" + path); err != nil {
+				t.Errorf("failed to apply the latest routes: %s", path)
+			}
+		}
+
+		if count, pinned := routesCount(tr); count != "4" || pinned != "" {
+			t.Errorf("unexpected routes headers: %s, %s", count, pinned)
+		}
+
+		checkGauge(t, m, "routing.table.version", 3)
+		checkGauge(t, m, "routing.table.pinned", 0)
+	})
+
+	t.Run("pin", func(t *testing.T) {
+		serveHistory(t, tr, "POST", "/routes/history/pin", http.StatusOK, nil)
+		if count, pinned := routesCount(tr); count != "4" || pinned != "3" {
+			t.Errorf("unexpected routes headers: %s, %s", count, pinned)
+		}
+
+		tr.log.Reset()
+		if err := dc.UpdateDoc(`quz: Path("/quz") -> "https://quz.example.org"`, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := tr.log.WaitFor("routing is pinned", 12*pollTimeout); err != nil {
+			t.Fatal(err)
+		}
+
+		serveHistory(t, tr, "POST", "/routes/history/unpin", http.StatusOK, nil)
+		if _, err := tr.checkGetRequest("https://www.example.org/quz"); err != nil {
+			t.Error("failed to apply the update received while pinned")
+		}
+	})
+}
+
+func TestHistoryHandlerErrors(t *testing.T) {
+	tr, _ := newHistoryRouting(t, 2, nil)
+	defer tr.close()
+
+	for _, test := range []struct {
+		method, url string
+		status      int
+	}{
+		{"POST", "/routes/history", http.StatusMethodNotAllowed},
+		{"GET", "/routes/history/pin", http.StatusMethodNotAllowed},
+		{"GET", "/routes/history/unknown", http.StatusNotFound},
+		{"GET", "/routes/history/diff?from=foo", http.StatusBadRequest},
+		{"GET", "/routes/history/diff?from=1&to=42", http.StatusNotFound},
+		{"POST", "/routes/history/rollback", http.StatusBadRequest},
+		{"POST", "/routes/history/rollback?version=42", http.StatusNotFound},
+	} {
+		serveHistory(t, tr, test.method, test.url, test.status, nil)
+	}
+}
+
+func TestHistoryDisabled(t *testing.T) {
+	tr, _ := newHistoryRouting(t, 0, nil)
+	defer tr.close()
+
+	serveHistory(t, tr, "GET", "/routes/history", http.StatusNotFound, nil)
+	serveHistory(t, tr, "POST", "/routes/history/pin", http.StatusNotFound, nil)
+	if err := tr.routing.Rollback(1); err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+// blocks the initial load until released
+type blockingDataClient struct {
+	release chan struct{}
+}
+
+func (c blockingDataClient) LoadAll() ([]*eskip.Route, error) {
+	<-c.release
+	return nil, nil
+}
+
+func (c blockingDataClient) LoadUpdate() ([]*eskip.Route, []string, error) {
+	return nil, nil, nil
+}
+
+func TestHistoryFirstLoad(t *testing.T) {
+	dc, err := testdataclient.NewDoc(`foo: Path("/foo") -> "https://foo.example.org"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocking := blockingDataClient{release: make(chan struct{})}
+	tl := loggingtest.New()
+	defer tl.Close()
+
+	rt := routing.New(routing.Options{
+		SignalFirstLoad: true,
+		DataClients:     []routing.DataClient{dc, blocking},
+		PollTimeout:     pollTimeout,
+		HistorySize:     2,
+		Log:             tl,
+	})
+	defer rt.Close()
+
+	if err := tl.WaitFor("route settings applied", 12*pollTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	// the table created by pinning doesn't count as a data client load
+	if err := rt.Pin(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rt.Unpin(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-rt.FirstLoad():
+		t.Fatal("the first load was signaled before all the data clients were loaded")
+	default:
+	}
+
+	close(blocking.release)
+	select {
+	case <-rt.FirstLoad():
+	case <-time.After(12 * pollTimeout):
+		t.Error("failed to signal the first load")
+	}
+}
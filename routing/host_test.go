@@ -60,7 +60,7 @@ func benchmarkPredicateHost(b *testing.B, predicateFmt string) {
 		if err != nil {
 			b.Fatal(err)
 		}
-		route, err := routing.ExportProcessRouteDef(pr, fr, def[0])
+		route, err := routing.ExportProcessRouteDef(pr, routing.MatchingOptionsNone, fr, def[0])
 		if err != nil {
 			b.Fatal(err)
 		}
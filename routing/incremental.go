@@ -0,0 +1,349 @@
+package routing
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+)
+
+// above this ratio of changed routes, the matcher is rebuilt instead of
+// being patched
+const maxPatchRatio = 4
+
+// indexedRoute stores the leaf of a route, and the keys of the path tree
+// containing the leaf, or the error, when the route is invalid.
+type indexedRoute struct {
+	route *Route
+	leaf  *leafMatcher
+	paths []string
+	err   error
+}
+
+// matcherIndex contains the state required to patch a matcher with the
+// changed routes, without rebuilding it. It is owned by the routing
+// updates, and no part of it, that can be modified, is reachable from the
+// matchers used by the proxy.
+type matcherIndex struct {
+	options      MatchingOptions
+	routes       map[string]*indexedRoute
+	pathMatchers map[string]*pathMatcher
+	compiledRxs  map[string]*regexp.Regexp
+
+	// the number of the routes changed since the last full rebuild, used
+	// to compact the regular expression cache
+	patched int
+}
+
+// cachedRoute is a processed route, and the definition that it was
+// created from, after applying the pre-processors.
+type cachedRoute struct {
+	def   *eskip.Route
+	route *Route
+}
+
+// routeBuilder creates the routes and the matcher from the route
+// definitions on every update. It reuses the processed routes, whose
+// definitions didn't change, together with their filter and predicate
+// instances, and it patches the previous matcher with the changed routes,
+// when their number is small enough.
+type routeBuilder struct {
+	options Options
+	cpm     map[string]PredicateSpec
+	cache   map[string]cachedRoute
+	matcher *matcher
+	index   *matcherIndex
+}
+
+func newMatcherIndex(o MatchingOptions) *matcherIndex {
+	return &matcherIndex{
+		options:      o,
+		routes:       make(map[string]*indexedRoute),
+		pathMatchers: make(map[string]*pathMatcher),
+		compiledRxs:  make(map[string]*regexp.Regexp),
+	}
+}
+
+func hasDuplicateIDs(rs []*Route) bool {
+	ids := make(map[string]struct{}, len(rs))
+	for _, r := range rs {
+		if _, ok := ids[r.Id]; ok {
+			return true
+		}
+
+		ids[r.Id] = struct{}{}
+	}
+
+	return false
+}
+
+func removeLeaf(ls leafMatchers, l *leafMatcher) leafMatchers {
+	for i := range ls {
+		if ls[i] == l {
+			return append(ls[:i], ls[i+1:]...)
+		}
+	}
+
+	return ls
+}
+
+// patch creates a new matcher from the previous one, applying only the
+// changes between the routes used for the previous one and the current
+// ones. Unchanged routes are identified by their instance. It returns
+// false, when the matcher needs to be rebuilt instead. The previous
+// matcher is not modified, because it can be still in use.
+func (idx *matcherIndex) patch(prev *matcher, rs []*Route) (*matcher, []*definitionError, bool) {
+	if hasDuplicateIDs(rs) {
+		return nil, nil, false
+	}
+
+	var (
+		added   []*Route
+		removed []*indexedRoute
+	)
+
+	current := make(map[string]bool, len(rs))
+	for _, r := range rs {
+		current[r.Id] = true
+		ir, ok := idx.routes[r.Id]
+		if ok && ir.route == r {
+			continue
+		}
+
+		if ok {
+			removed = append(removed, ir)
+		}
+
+		added = append(added, r)
+	}
+
+	for id, ir := range idx.routes {
+		if !current[id] {
+			removed = append(removed, ir)
+		}
+	}
+
+	changes := len(added) + len(removed)
+	if changes > len(rs)/maxPatchRatio || idx.patched+changes > len(rs) {
+		return nil, nil, false
+	}
+
+	m := prev
+	if changes > 0 {
+		var ok bool
+		if m, ok = idx.apply(prev, added, removed); !ok {
+			return nil, nil, false
+		}
+	}
+
+	idx.patched += changes
+
+	var errs []*definitionError
+	for i, r := range rs {
+		if err := idx.routes[r.Id].err; err != nil {
+			errs = append(errs, &definitionError{r.Id, i, err})
+		}
+	}
+
+	return m, errs, true
+}
+
+func (idx *matcherIndex) apply(prev *matcher, added []*Route, removed []*indexedRoute) (*matcher, bool) {
+	routesByID := make(map[string]*Route, len(prev.routesByID))
+	for id, r := range prev.routesByID {
+		routesByID[id] = r
+	}
+
+	// the path matchers and the root leaves are copied before changing
+	// them, because they are shared with the previous matcher
+	changed := make(map[string]*pathMatcher)
+	pathMatcher := func(p string) *pathMatcher {
+		if pm, ok := changed[p]; ok {
+			return pm
+		}
+
+		pm := &pathMatcher{}
+		if prevPM, ok := idx.pathMatchers[p]; ok {
+			pm.leaves = append(pm.leaves, prevPM.leaves...)
+		}
+
+		changed[p] = pm
+		return pm
+	}
+
+	rootLeaves := prev.rootLeaves
+	var rootChanged bool
+	changeRoot := func() {
+		if !rootChanged {
+			rootLeaves = append(leafMatchers(nil), rootLeaves...)
+			rootChanged = true
+		}
+	}
+
+	for _, ir := range removed {
+		delete(idx.routes, ir.route.Id)
+		if ir.leaf == nil {
+			continue
+		}
+
+		delete(routesByID, ir.route.Id)
+		if ir.paths == nil {
+			changeRoot()
+			rootLeaves = removeLeaf(rootLeaves, ir.leaf)
+			continue
+		}
+
+		for _, p := range ir.paths {
+			pm := pathMatcher(p)
+			pm.leaves = removeLeaf(pm.leaves, ir.leaf)
+		}
+	}
+
+	for _, r := range added {
+		ir := &indexedRoute{route: r}
+		idx.routes[r.Id] = ir
+
+		l, err := newLeaf(r, idx.compiledRxs)
+		if err != nil {
+			ir.err = err
+			continue
+		}
+
+		path, err := normalizePath(r)
+		if err != nil {
+			ir.err = err
+			continue
+		}
+
+		routesByID[r.Id] = r
+
+		ir.leaf = l
+		ir.paths = leafPaths(r, path, idx.options)
+		if ir.paths == nil {
+			changeRoot()
+			rootLeaves = append(rootLeaves, l)
+			continue
+		}
+
+		for _, p := range ir.paths {
+			pm := pathMatcher(p)
+			pm.leaves = append(pm.leaves, l)
+		}
+	}
+
+	tree := prev.paths
+	for p, pm := range changed {
+		if len(pm.leaves) == 0 {
+			tree = tree.Delete(p)
+			delete(idx.pathMatchers, p)
+			continue
+		}
+
+		sort.Stable(pm.leaves)
+
+		var err error
+		if tree, err = tree.Set(p, pm); err != nil {
+			// the same error would be reported by a full rebuild
+			return nil, false
+		}
+
+		idx.pathMatchers[p] = pm
+	}
+
+	if rootChanged {
+		sort.Stable(rootLeaves)
+	}
+
+	return &matcher{tree, rootLeaves, idx.options, routesByID}, true
+}
+
+func newRouteBuilder(o Options) *routeBuilder {
+	return &routeBuilder{
+		options: o,
+		cpm:     mapPredicates(o.Predicates),
+		cache:   make(map[string]cachedRoute),
+	}
+}
+
+// equal definitions of the same route create the same route
+func eqRouteDef(left, right *eskip.Route) bool {
+	return left.Name == right.Name &&
+		left.Namespace == right.Namespace &&
+		eskip.Eq(left, right)
+}
+
+// processRouteDefs processes the route definitions for the routing table,
+// and it reuses the previously processed routes, whose definition didn't
+// change, and marks them as reused. The definitions with duplicate IDs are
+// always processed.
+func (b *routeBuilder) processRouteDefs(fr filters.Registry, defs []*eskip.Route) (routes []*Route, invalidDefs []*eskip.Route) {
+	counts := make(map[string]int, len(defs))
+	for _, def := range defs {
+		counts[def.Id]++
+	}
+
+	var reused int
+	cache := make(map[string]cachedRoute, len(defs))
+	for _, def := range defs {
+		unique := counts[def.Id] == 1
+		if c, ok := b.cache[def.Id]; ok && unique && eqRouteDef(c.def, def) {
+			// only the routing updates access the field, it doesn't
+			// race with the proxy
+			c.route.Reused = true
+
+			cache[def.Id] = c
+			routes = append(routes, c.route)
+			reused++
+			continue
+		}
+
+		route, err := processRouteDef(b.cpm, b.options.MatchingOptions, fr, def)
+		if err != nil {
+			invalidDefs = append(invalidDefs, def)
+			b.options.Log.Errorf("failed to process route %s: %v", def.Id, err)
+			continue
+		}
+
+		if unique {
+			cache[def.Id] = cachedRoute{def: def.Copy(), route: route}
+		}
+
+		routes = append(routes, route)
+	}
+
+	b.cache = cache
+	b.options.Log.Infof("route settings processed, reused: %d, created: %d", reused, len(routes)-reused)
+	return
+}
+
+// keepInUse drops the cached routes, that were not returned by the
+// post-processors, e.g. because they were rejected or replaced, so that
+// only the routes in use are reused by the next update.
+func (b *routeBuilder) keepInUse(routes []*Route) {
+	inUse := make(map[*Route]bool, len(routes))
+	for _, r := range routes {
+		inUse[r] = true
+	}
+
+	for id, c := range b.cache {
+		if !inUse[c.route] {
+			delete(b.cache, id)
+		}
+	}
+}
+
+// newMatcher patches the previous matcher with the changed routes, or
+// when it's not possible, or the changes are too many, it builds a new one.
+func (b *routeBuilder) newMatcher(routes []*Route) (*matcher, []*definitionError) {
+	if b.matcher != nil && b.index != nil {
+		if m, errs, ok := b.index.patch(b.matcher, routes); ok {
+			b.matcher = m
+			return m, errs
+		}
+	}
+
+	m, idx, errs := newIndexedMatcher(routes, b.options.MatchingOptions)
+	b.matcher, b.index = m, idx
+	return m, errs
+}
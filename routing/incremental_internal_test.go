@@ -0,0 +1,312 @@
+package routing
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"testing"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/logging/loggingtest"
+)
+
+type incrementalTestRoute struct {
+	def *eskip.Route
+	req *http.Request
+}
+
+// generates a route definition with a unique path or host, and a request
+// matching it
+func generateIncrementalRoute(rnd *rand.Rand, id string, n int) incrementalTestRoute {
+	var (
+		doc    string
+		method = "GET"
+		host   = "www.example.org"
+		path   string
+		header = make(http.Header)
+	)
+
+	switch rnd.Intn(6) {
+	case 0:
+		doc = fmt.Sprintf(`Path("/path%d/:id") -> "https://www.example.org"`, n)
+		path = fmt.Sprintf("/path%d/foo", n)
+	case 1:
+		doc = fmt.Sprintf(`PathSubtree("/subtree%d") -> "https://www.example.org"`, n)
+		path = fmt.Sprintf("/subtree%d/foo/bar", n)
+	case 2:
+		doc = fmt.Sprintf(`Path("/path%d") && Method("POST") -> "https://www.example.org"`, n)
+		method = "POST"
+		path = fmt.Sprintf("/path%d", n)
+	case 3:
+		doc = fmt.Sprintf(`Host("^host%d[.]example[.]org$") -> "https://www.example.org"`, n)
+		host = fmt.Sprintf("host%d.example.org", n)
+		path = fmt.Sprintf("/root%d", n)
+	case 4:
+		doc = fmt.Sprintf(`Path("/header/%d") && Header("X-Test", "foo") -> "https://www.example.org"`, n)
+		header.Set("X-Test", "foo")
+		path = fmt.Sprintf("/header/%d", n)
+	default:
+		doc = fmt.Sprintf(`Path("/invalid%d") && Host("[") -> "https://www.example.org"`, n)
+		path = fmt.Sprintf("/invalid%d", n)
+	}
+
+	def, err := eskip.Parse(doc)
+	if err != nil {
+		panic(err)
+	}
+
+	def[0].Id = id
+	u, err := url.Parse(path)
+	if err != nil {
+		panic(err)
+	}
+
+	return incrementalTestRoute{
+		def: def[0],
+		req: &http.Request{Method: method, Host: host, URL: u, Header: header},
+	}
+}
+
+func processIncrementalRoute(t testing.TB, r incrementalTestRoute) *Route {
+	route, err := processRouteDef(nil, MatchingOptionsNone, nil, r.def)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return route
+}
+
+func definitionErrorIDs(errs []*definitionError) []string {
+	var ids []string
+	for _, err := range errs {
+		ids = append(ids, err.ID)
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+func matchedRouteID(m *matcher, req *http.Request) string {
+	r, _ := m.match(req)
+	if r == nil {
+		return ""
+	}
+
+	return r.Id
+}
+
+func testIncrementalMatcher(t *testing.T, o MatchingOptions) {
+	const (
+		initialCount = 400
+		updates      = 120
+	)
+
+	rnd := rand.New(rand.NewSource(42))
+
+	var (
+		next     int
+		routes   []*Route
+		requests []*http.Request
+	)
+
+	generate := func(id string) *Route {
+		next++
+		if id == "" {
+			id = fmt.Sprintf("route%d", next)
+		}
+
+		r := generateIncrementalRoute(rnd, id, next)
+		requests = append(requests, r.req)
+		return processIncrementalRoute(t, r)
+	}
+
+	for i := 0; i < initialCount; i++ {
+		routes = append(routes, generate(""))
+	}
+
+	b := newRouteBuilder(Options{MatchingOptions: o})
+	initial, _ := b.newMatcher(routes)
+	initialMatches := make([]string, len(requests))
+	for i, req := range requests {
+		initialMatches[i] = matchedRouteID(initial, req)
+	}
+
+	initialRequests := requests
+	var patchedUpdates int
+	for i := 0; i < updates; i++ {
+		for j := rnd.Intn(12); j > 0; j-- {
+			switch k := rnd.Intn(len(routes)); rnd.Intn(3) {
+			case 0:
+				routes = append(routes[:k], routes[k+1:]...)
+			case 1:
+				routes[k] = generate(routes[k].Id)
+			default:
+				routes = append(routes, generate(""))
+			}
+		}
+
+		m, errs := b.newMatcher(routes)
+		if b.index != nil && b.index.patched > 0 {
+			patchedUpdates++
+		}
+
+		expected, expectedErrs := newMatcher(routes, o)
+		if fmt.Sprint(definitionErrorIDs(errs)) != fmt.Sprint(definitionErrorIDs(expectedErrs)) {
+			t.Fatalf("unexpected errors: %v, expected: %v", definitionErrorIDs(errs), definitionErrorIDs(expectedErrs))
+		}
+
+		if len(m.routesByID) != len(expected.routesByID) {
+			t.Fatalf("unexpected number of routes: %d, expected: %d", len(m.routesByID), len(expected.routesByID))
+		}
+
+		for id, r := range expected.routesByID {
+			if m.routesByID[id] != r {
+				t.Fatalf("unexpected route by id: %s", id)
+			}
+		}
+
+		for _, req := range requests {
+			if id, expectedID := matchedRouteID(m, req), matchedRouteID(expected, req); id != expectedID {
+				t.Fatalf("unexpected match for %s %s %s: %q, expected: %q", req.Method, req.Host, req.URL.Path, id, expectedID)
+			}
+		}
+	}
+
+	if patchedUpdates == 0 {
+		t.Error("failed to patch the matcher")
+	}
+
+	for i, req := range initialRequests {
+		if matchedRouteID(initial, req) != initialMatches[i] {
+			t.Fatalf("the initial matcher was modified: %s", req.URL.Path)
+		}
+	}
+}
+
+func TestIncrementalMatcher(t *testing.T) {
+	t.Run("default", func(t *testing.T) { testIncrementalMatcher(t, MatchingOptionsNone) })
+	t.Run("ignore trailing slash", func(t *testing.T) { testIncrementalMatcher(t, IgnoreTrailingSlash) })
+}
+
+func TestIncrementalMatcherRebuild(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	var routes []*Route
+	for i := 0; i < 40; i++ {
+		routes = append(routes, processIncrementalRoute(t, generateIncrementalRoute(rnd, fmt.Sprintf("route%d", i), i)))
+	}
+
+	b := newRouteBuilder(Options{})
+	m, _ := b.newMatcher(routes)
+
+	if patched, _ := b.newMatcher(routes); patched != m {
+		t.Error("failed to keep the matcher without changes")
+	}
+
+	routes[0] = processIncrementalRoute(t, generateIncrementalRoute(rnd, "route0", 100))
+	if b.newMatcher(routes); b.index.patched != 2 {
+		t.Error("failed to patch the matcher")
+	}
+
+	for i := 0; i < 20; i++ {
+		routes[i] = processIncrementalRoute(t, generateIncrementalRoute(rnd, fmt.Sprintf("route%d", i), 200+i))
+	}
+
+	if b.newMatcher(routes); b.index.patched != 0 {
+		t.Error("failed to rebuild the matcher on too many changes")
+	}
+
+	routes = append(routes, routes[1])
+	if b.newMatcher(routes); b.index != nil {
+		t.Error("failed to disable patching with duplicate IDs")
+	}
+}
+
+func TestIncrementalRouteDefs(t *testing.T) {
+	defs, err := eskip.Parse(`
+		foo: Path("/foo") -> "https://foo.example.org";
+		bar: Path("/bar") -> "https://bar.example.org";
+		baz: Path("/baz") -> "https://baz.example.org";
+		dup: Path("/dup1") -> "https://dup.example.org";
+		dup: Path("/dup2") -> "https://dup.example.org";
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tl := loggingtest.New()
+	defer tl.Close()
+
+	b := newRouteBuilder(Options{Log: tl})
+	routes, _ := b.processRouteDefs(nil, defs)
+
+	updated, err := eskip.Parse(`
+		foo: Path("/foo") -> "https://foo.example.org";
+		bar: Path("/bar") -> "https://bar2.example.org";
+		baz: Path("/baz") -> "https://baz.example.org";
+		dup: Path("/dup1") -> "https://dup.example.org";
+		dup: Path("/dup2") -> "https://dup.example.org";
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated[2].Name = "baz"
+	updatedRoutes, _ := b.processRouteDefs(nil, updated)
+	for i, reused := range []bool{true, false, false, false, false} {
+		if (routes[i] == updatedRoutes[i]) != reused {
+			t.Errorf("unexpected reuse of route %s: %t", routes[i].Id, !reused)
+		}
+	}
+}
+
+func generateIncrementalDefs(rnd *rand.Rand, count, offset int) []*eskip.Route {
+	defs := make([]*eskip.Route, count)
+	for i := range defs {
+		defs[i] = generateIncrementalRoute(rnd, fmt.Sprintf("route%d", i), offset+i).def
+	}
+
+	return defs
+}
+
+func benchmarkUpdate(b *testing.B, changes int, full bool) {
+	const count = 10000
+
+	tl := loggingtest.New()
+	tl.Mute()
+	defer tl.Close()
+
+	rnd := rand.New(rand.NewSource(42))
+	defs := generateIncrementalDefs(rnd, count, 0)
+	o := Options{Log: tl}
+	builder := newRouteBuilder(o)
+	routes, _ := builder.processRouteDefs(nil, defs)
+	builder.newMatcher(routes)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		updated := make([]*eskip.Route, count)
+		copy(updated, defs)
+		for j := 0; j < changes; j++ {
+			k := rnd.Intn(count)
+			updated[k] = generateIncrementalRoute(rnd, updated[k].Id, count*(i+1)+j).def
+		}
+
+		b.StartTimer()
+		if full {
+			routes, _ := processRouteDefs(o, nil, updated)
+			newMatcher(routes, MatchingOptionsNone)
+		} else {
+			routes, _ := builder.processRouteDefs(nil, updated)
+			builder.newMatcher(routes)
+		}
+	}
+}
+
+func BenchmarkUpdateIncremental1(b *testing.B)   { benchmarkUpdate(b, 1, false) }
+func BenchmarkUpdateIncremental10(b *testing.B)  { benchmarkUpdate(b, 10, false) }
+func BenchmarkUpdateIncremental100(b *testing.B) { benchmarkUpdate(b, 100, false) }
+func BenchmarkUpdateFull1(b *testing.B)          { benchmarkUpdate(b, 1, true) }
+func BenchmarkUpdateFull100(b *testing.B)        { benchmarkUpdate(b, 100, true) }
@@ -0,0 +1,180 @@
+package routing_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/filters/filtertest"
+	"github.com/zalando/skipper/logging/loggingtest"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+)
+
+// records the reused flags of the routes, and drops the route with the id
+// dropped
+type reuseRecorder struct {
+	mu     sync.Mutex
+	reused map[string]bool
+}
+
+func (r *reuseRecorder) Do(routes []*routing.Route) []*routing.Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reused = make(map[string]bool)
+	var kept []*routing.Route
+	for _, ri := range routes {
+		r.reused[ri.Id] = ri.Reused
+		if ri.Id != "dropped" {
+			kept = append(kept, ri)
+		}
+	}
+
+	return kept
+}
+
+func (r *reuseRecorder) check(t *testing.T, expected map[string]bool) {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.reused) != len(expected) {
+		t.Fatalf("unexpected routes: %v, expected: %v", r.reused, expected)
+	}
+
+	for id, reused := range expected {
+		if r.reused[id] != reused {
+			t.Errorf("unexpected reused flag of %s: %t, expected: %t", id, r.reused[id], reused)
+		}
+	}
+}
+
+func TestIncrementalUpdateKeepsUnchangedRoutes(t *testing.T) {
+	fr := make(filters.Registry)
+	fr.Register(&filtertest.Filter{FilterName: "testFilter"})
+
+	dc, err := testdataclient.NewDoc(`
+		foo: Path("/foo") -> testFilter("foo") -> "https://foo.example.org";
+		bar: Path("/bar") -> testFilter("bar") -> "https://bar.example.org";
+		baz: * -> testFilter("baz") -> "https://baz.example.org";
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := newTestRoutingWithFilters(fr, dc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tr.close()
+
+	foo, err := tr.checkGetRequest("https://www.example.org/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bar, err := tr.checkGetRequest("https://www.example.org/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr.log.Reset()
+	if err := dc.UpdateDoc(`
+		bar: Path("/bar") -> testFilter("bar") -> "https://bar2.example.org";
+		qux: Path("/qux") -> testFilter("qux") -> "https://qux.example.org";
+	`, []string{"baz"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tr.waitForRouteSetting(); err != nil {
+		t.Fatal(err)
+	}
+
+	fooUpdated, err := tr.checkGetRequest("https://www.example.org/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fooUpdated != foo || fooUpdated.Filters[0].Filter != foo.Filters[0].Filter {
+		t.Error("failed to keep the unchanged route")
+	}
+
+	barUpdated, err := tr.checkGetRequest("https://www.example.org/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if barUpdated == bar || barUpdated.Backend != "https://bar2.example.org" {
+		t.Error("failed to update the changed route")
+	}
+
+	if _, err := tr.checkGetRequest("https://www.example.org/qux"); err != nil {
+		t.Error("failed to add the new route")
+	}
+
+	if _, err := tr.checkGetRequest("https://www.example.org/other"); err == nil {
+		t.Error("failed to delete the route")
+	}
+
+	tr.log.Reset()
+	if err := dc.UpdateDoc(`foo: Path("/foo") -> testFilter("foo2") -> "https://foo.example.org"`, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tr.waitForRouteSetting(); err != nil {
+		t.Fatal(err)
+	}
+
+	fooUpdated, err = tr.checkGetRequest("https://www.example.org/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fooUpdated == foo || fooUpdated.Filters[0].Filter.(*filtertest.Filter).Args[0] != "foo2" {
+		t.Error("failed to update the filters of the route")
+	}
+}
+
+func TestIncrementalUpdateFlagsReusedRoutes(t *testing.T) {
+	dc, err := testdataclient.NewDoc(`
+		foo: Path("/foo") -> "https://foo.example.org";
+		bar: Path("/bar") -> "https://bar.example.org";
+		dropped: Path("/dropped") -> "https://dropped.example.org";
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pp := &reuseRecorder{}
+	tl := loggingtest.New()
+	tr := &testRouting{tl, routing.New(routing.Options{
+		FilterRegistry: builtin.MakeRegistry(),
+		DataClients:    []routing.DataClient{dc},
+		PostProcessors: []routing.PostProcessor{pp},
+		PollTimeout:    pollTimeout,
+		Log:            tl,
+	})}
+	defer tr.close()
+
+	if err := tr.waitForRouteSetting(); err != nil {
+		t.Fatal(err)
+	}
+
+	pp.check(t, map[string]bool{"foo": false, "bar": false, "dropped": false})
+
+	tr.log.Reset()
+	if err := dc.UpdateDoc(`
+		bar: Path("/bar") -> "https://bar2.example.org";
+		baz: Path("/baz") -> "https://baz.example.org";
+	`, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tr.waitForRouteSetting(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the routes dropped by the post-processors are not reused
+	pp.check(t, map[string]bool{"foo": true, "bar": false, "baz": false, "dropped": false})
+}
@@ -74,6 +74,7 @@ type matcher struct {
 	paths           *pathmux.Tree
 	rootLeaves      leafMatchers
 	matchingOptions MatchingOptions
+	routesByID      map[string]*Route
 }
 
 // An error created if a route definition cannot be processed.
@@ -283,19 +284,38 @@ func addLeafToPath(pms map[string]*pathMatcher, path string, l *leafMatcher) {
 	pm.leaves = append(pm.leaves, l)
 }
 
-func addSubtreeLeafsToPath(pms map[string]*pathMatcher, path string, l *leafMatcher, o MatchingOptions) {
+// returns the keys of the path tree, that the leaf of a PathSubtree route is
+// added to
+func subtreePaths(path string, o MatchingOptions) []string {
 	basePath := freeWildcardRx.ReplaceAllLiteralString(path, "")
 	basePath = strings.TrimSuffix(basePath, "/")
 	if basePath == "" {
-		addLeafToPath(pms, "/", l)
-		addLeafToPath(pms, "/**", l)
-	} else {
-		addLeafToPath(pms, basePath, l)
-		addLeafToPath(pms, basePath+"/**", l)
-		if !o.ignoreTrailingSlash() {
-			addLeafToPath(pms, basePath+"/", l)
-		}
+		return []string{"/", "/**"}
+	}
+
+	if o.ignoreTrailingSlash() {
+		return []string{basePath, basePath + "/**"}
+	}
+
+	return []string{basePath, basePath + "/**", basePath + "/"}
+}
+
+// returns the keys of the path tree, that the leaf of a route is added to, or
+// nil, when the route has no path condition, and its leaf is a root leaf
+func leafPaths(r *Route, path string, o MatchingOptions) []string {
+	if r.pathSubtree != "" {
+		return subtreePaths(path, o)
+	}
+
+	if r.path == "" {
+		return nil
+	}
+
+	if o.ignoreTrailingSlash() {
+		path = trimTrailingSlash(path)
 	}
+
+	return []string{path}
 }
 
 // constructs a matcher based on the provided definitions.
@@ -310,50 +330,70 @@ func addSubtreeLeafsToPath(pms map[string]*pathMatcher, path string, l *leafMatc
 // on the rest of the conditions so that most strict route
 // definition matches first.
 func newMatcher(rs []*Route, o MatchingOptions) (*matcher, []*definitionError) {
+	m, _, errors := newIndexedMatcher(rs, o)
+	return m, errors
+}
+
+// constructs a matcher, and the index required to patch it with the
+// changed routes. The index is nil, when the routes contain duplicate
+// IDs.
+func newIndexedMatcher(rs []*Route, o MatchingOptions) (*matcher, *matcherIndex, []*definitionError) {
 	var (
 		errors     []*definitionError
 		rootLeaves leafMatchers
 	)
 
-	pathMatchers := make(map[string]*pathMatcher)
-	compiledRxs := make(map[string]*regexp.Regexp)
+	var duplicateIDs bool
+	idx := newMatcherIndex(o)
+	routesByID := make(map[string]*Route)
 
 	for i, r := range rs {
-		l, err := newLeaf(r, compiledRxs)
+		if _, ok := idx.routes[r.Id]; ok {
+			duplicateIDs = true
+		}
+
+		ir := &indexedRoute{route: r}
+		idx.routes[r.Id] = ir
+
+		l, err := newLeaf(r, idx.compiledRxs)
 		if err != nil {
 			errors = append(errors, &definitionError{r.Id, i, err})
+			ir.err = err
 			continue
 		}
 
 		path, err := normalizePath(r)
 		if err != nil {
 			errors = append(errors, &definitionError{r.Id, i, err})
+			ir.err = err
 			continue
 		}
 
-		if r.pathSubtree != "" {
-			addSubtreeLeafsToPath(pathMatchers, path, l, o)
-			continue
-		}
+		routesByID[r.Id] = r
 
-		if r.path == "" {
+		ir.leaf = l
+		ir.paths = leafPaths(r, path, o)
+		if ir.paths == nil {
 			rootLeaves = append(rootLeaves, l)
 			continue
 		}
 
-		if o.ignoreTrailingSlash() {
-			path = trimTrailingSlash(path)
+		for _, p := range ir.paths {
+			addLeafToPath(idx.pathMatchers, p, l)
 		}
-		addLeafToPath(pathMatchers, path, l)
 	}
 
 	pathTree := &pathmux.Tree{}
-	errors = append(errors, addTreeMatchers(pathTree, pathMatchers)...)
+	errors = append(errors, addTreeMatchers(pathTree, idx.pathMatchers)...)
 
 	// sort root leaves during construction time, based on their priority
 	sort.Stable(rootLeaves)
 
-	return &matcher{pathTree, rootLeaves, o}, errors
+	if duplicateIDs {
+		idx = nil
+	}
+
+	return &matcher{pathTree, rootLeaves, o, routesByID}, idx, errors
 }
 
 // matches a path in the path trie structure.
@@ -12,6 +12,7 @@ import (
 	"github.com/zalando/skipper/eskip"
 	"github.com/zalando/skipper/filters"
 	"github.com/zalando/skipper/logging"
+	"github.com/zalando/skipper/metrics"
 	"github.com/zalando/skipper/predicates"
 )
 
@@ -27,6 +28,7 @@ const (
 
 	routesTimestampName      = "X-Timestamp"
 	routesCountName          = "X-Count"
+	routesPinnedName         = "X-Pinned-Version"
 	defaultRouteListingLimit = 1024
 )
 
@@ -125,6 +127,16 @@ type Options struct {
 	// SignalFirstLoad enables signaling on the first load
 	// of the routing configuration during the startup.
 	SignalFirstLoad bool
+
+	// HistorySize sets the number of the last applied routing
+	// tables kept in the routing history, that can be listed,
+	// compared, pinned or rolled back to. When zero, the
+	// routing history is disabled.
+	HistorySize int
+
+	// Metrics is used to report the version of the active
+	// routing table, and whether it is pinned.
+	Metrics metrics.Metrics
 }
 
 // RouteFilter contains extensions to generic filter
@@ -141,6 +153,7 @@ type RouteFilter struct {
 // LBMetrics contains metrics used by LB algorithms
 type LBMetrics struct {
 	inflightRequests int64
+	ejectedUntil     int64
 }
 
 // IncInflightRequest increments the number of outstanding requests from the proxy to a given backend.
@@ -158,6 +171,32 @@ func (m *LBMetrics) GetInflightRequests() int {
 	return int(atomic.LoadInt64(&m.inflightRequests))
 }
 
+// SetEjectedUntil ejects the endpoint from the load balancing until the given time. The zero time resets the ejection.
+func (m *LBMetrics) SetEjectedUntil(t time.Time) {
+	var u int64
+	if !t.IsZero() {
+		u = t.UnixNano()
+	}
+
+	atomic.StoreInt64(&m.ejectedUntil, u)
+}
+
+// EjectedUntil returns the time until the endpoint is ejected from the load balancing, or the zero time.
+func (m *LBMetrics) EjectedUntil() time.Time {
+	u := atomic.LoadInt64(&m.ejectedUntil)
+	if u == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, u)
+}
+
+// IsEjected tells whether the endpoint is currently ejected from the load balancing, e.g. by the outlier detection.
+func (m *LBMetrics) IsEjected() bool {
+	u := atomic.LoadInt64(&m.ejectedUntil)
+	return u != 0 && time.Now().UnixNano() < u
+}
+
 // LBEndpoint represents the scheme and the host of load balanced
 // backends.
 type LBEndpoint struct {
@@ -237,12 +276,28 @@ type Route struct {
 	// configured by the post-processor found in the filters/fadein
 	// package.
 	LBFadeInExponent float64
+
+	// Reused is set, when the route is passed to the post-processors
+	// as the same instance, that was returned by the post-processors on
+	// the previous update, because its definition didn't change. These
+	// routes are already in use by the proxy, and the post-processors
+	// must not modify them, or their filters.
+	Reused bool
 }
 
 // PostProcessor is an interface for custom post-processors applying changes
 // to the routes after they were created from their data representation and
 // before they were passed to the proxy.
 //
+// The post-processors receive all the routes on every update, so that they
+// can track the state of the active routes. The routes, whose definition
+// didn't change since the previous update, are passed in again as the same
+// instances, that are already in use by the proxy, with the Reused field
+// set. The post-processors must not modify the reused routes, or their
+// filters, because it would be a data race with the proxy. Only the routes
+// returned by the post-processors are reused, so the post-processors,
+// that replace the route instances, receive new routes on every update.
+//
 // This feature is experimental.
 type PostProcessor interface {
 	Do([]*Route) []*Route
@@ -260,7 +315,11 @@ type PreProcessor interface {
 // updatable request matching.
 type Routing struct {
 	routeTable        atomic.Value // of struct routeTable
+	options           Options
 	log               logging.Logger
+	metrics           metrics.Metrics
+	history           *history
+	commands          chan *historyCommand
 	firstLoad         chan struct{}
 	firstLoadSignaled bool
 	quit              chan struct{}
@@ -273,7 +332,16 @@ func New(o Options) *Routing {
 		o.Log = &logging.DefaultLog{}
 	}
 
-	r := &Routing{log: o.Log, firstLoad: make(chan struct{}), quit: make(chan struct{})}
+	r := &Routing{
+		options:   o,
+		log:       o.Log,
+		metrics:   o.Metrics,
+		history:   &history{size: o.HistorySize},
+		commands:  make(chan *historyCommand),
+		firstLoad: make(chan struct{}),
+		quit:      make(chan struct{}),
+	}
+
 	if !o.SignalFirstLoad {
 		close(r.firstLoad)
 		r.firstLoadSignaled = true
@@ -289,6 +357,16 @@ func New(o Options) *Routing {
 	return r
 }
 
+// sets the headers describing the current routing table. When the routing
+// is pinned, the pinned version is set, too.
+func setRoutesHeaders(w http.ResponseWriter, rt *routeTable) {
+	w.Header().Set(routesTimestampName, strconv.FormatInt(rt.created.Unix(), 10))
+	w.Header().Set(routesCountName, strconv.Itoa(len(rt.validRoutes)))
+	if rt.pinned {
+		w.Header().Set(routesPinnedName, strconv.Itoa(rt.version))
+	}
+}
+
 // ServeHTTP renders the list of current routes.
 func (r *Routing) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	if req.Method != "GET" && req.Method != "HEAD" {
@@ -298,16 +376,14 @@ func (r *Routing) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	rt := r.routeTable.Load().(*routeTable)
 	req.ParseForm()
-	createdUnix := strconv.FormatInt(rt.created.Unix(), 10)
 	ts := req.Form.Get("timestamp")
-	if ts != "" && createdUnix != ts {
+	if ts != "" && strconv.FormatInt(rt.created.Unix(), 10) != ts {
 		http.Error(w, "invalid timestamp", http.StatusBadRequest)
 		return
 	}
 
 	if req.Method == "HEAD" {
-		w.Header().Set(routesTimestampName, createdUnix)
-		w.Header().Set(routesCountName, strconv.Itoa(len(rt.validRoutes)))
+		setRoutesHeaders(w, rt)
 
 		if strings.Contains(req.Header.Get("Accept"), "application/json") {
 			w.Header().Set("Content-Type", "application/json")
@@ -330,8 +406,7 @@ func (r *Routing) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	w.Header().Set(routesTimestampName, createdUnix)
-	w.Header().Set(routesCountName, strconv.Itoa(len(rt.validRoutes)))
+	setRoutesHeaders(w, rt)
 
 	routes := slice(rt.validRoutes, offset, limit)
 	if strings.Contains(req.Header.Get("Accept"), "application/json") {
@@ -353,13 +428,22 @@ func (r *Routing) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 func (r *Routing) startReceivingUpdates(o Options) {
 	dc := len(o.DataClients)
 	c := make(chan *routeTable)
-	go receiveRouteMatcher(o, c, r.quit)
+	go receiveRouteMatcher(o, c, r.commands, r.quit)
 	go func() {
 		for {
 			select {
 			case rt := <-c:
+				r.history.apply(rt)
 				r.routeTable.Store(rt)
-				if !r.firstLoadSignaled {
+				r.updateTableMetrics(rt)
+				if rt.applied != nil {
+					close(rt.applied)
+				}
+
+				// only the tables received from the data clients count
+				// for the first load, not the ones created by the history
+				// commands
+				if !r.firstLoadSignaled && rt.applied == nil {
 					dc--
 					if dc == 0 {
 						close(r.firstLoad)
@@ -410,6 +494,23 @@ func (rl *RouteLookup) Do(req *http.Request) (*Route, map[string]string) {
 	return rl.matcher.match(req)
 }
 
+// ByID returns the route with the given id from the captured routing
+// table, or nil if there is no such route.
+func (rl *RouteLookup) ByID(id string) *Route {
+	return rl.matcher.routesByID[id]
+}
+
+// Routes returns the routes of the captured routing table, in no
+// particular order.
+func (rl *RouteLookup) Routes() []*Route {
+	routes := make([]*Route, 0, len(rl.matcher.routesByID))
+	for _, r := range rl.matcher.routesByID {
+		routes = append(routes, r)
+	}
+
+	return routes
+}
+
 // Get returns a captured generation of the lookup table. This feature is
 // experimental. See the description of the RouteLookup type.
 func (r *Routing) Get() *RouteLookup {
@@ -0,0 +1,366 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/zalando/skipper/eskip"
+)
+
+const (
+	conflictDuplicateID         = "duplicate id"
+	conflictIdenticalPredicates = "identical predicates"
+
+	// the size limit of the routes posted to the validation handler
+	maxValidationBodySize = 16 << 20
+)
+
+// RouteValidator is an optional interface of the post-processors. The
+// post-processors are not executed when validating routes, because they
+// may keep state about the active routes, but the ones implementing this
+// interface can validate each route processed during the validation.
+//
+// This feature is experimental.
+type RouteValidator interface {
+	ValidateRoute(*Route) error
+}
+
+// RouteValidationError is an error of a validated route.
+type RouteValidationError struct {
+
+	// RouteID is the id of the invalid route. It is empty when the
+	// validated document could not be parsed.
+	RouteID string `json:"routeId,omitempty"`
+
+	// Index is the index of the route in the validated routes, or -1,
+	// when the error is not specific to a route, or the route was created
+	// by a pre-processor.
+	Index int `json:"index"`
+
+	// Position is the position of the route, or of the syntax error, in
+	// the validated document, when known.
+	Position *eskip.Position `json:"position,omitempty"`
+
+	// Message describes the error.
+	Message string `json:"error"`
+}
+
+// RouteConflict is a validated route conflicting with another validated
+// route, or with an active route.
+type RouteConflict struct {
+
+	// RouteID is the id of the validated route.
+	RouteID string `json:"routeId"`
+
+	// Index is the index of the route in the validated routes, or -1,
+	// when the route was created by a pre-processor.
+	Index int `json:"index"`
+
+	// Position is the position of the route in the validated document,
+	// when known.
+	Position *eskip.Position `json:"position,omitempty"`
+
+	// ConflictingRouteID is the id of the route, that the validated route
+	// conflicts with.
+	ConflictingRouteID string `json:"conflictingRouteId"`
+
+	// Active is set, when the conflicting route is one of the active
+	// routes, otherwise it is one of the validated routes.
+	Active bool `json:"active"`
+
+	// Reason is either "duplicate id" or "identical predicates".
+	Reason string `json:"reason"`
+}
+
+// ValidationResult is the result of validating routes.
+type ValidationResult struct {
+
+	// Valid is set, when none of the validated routes has an error. The
+	// conflicts don't make the routes invalid.
+	Valid bool `json:"valid"`
+
+	// Routes is the number of the valid routes.
+	Routes int `json:"routes"`
+
+	// Errors contains the errors of the invalid routes.
+	Errors []*RouteValidationError `json:"errors"`
+
+	// Conflicts contains the conflicts of the validated routes.
+	Conflicts []*RouteConflict `json:"conflicts"`
+}
+
+// tracks the index and the position of the validated routes, also when
+// they were replaced by the pre-processors
+type validatedRoutes struct {
+	positions []eskip.Position
+	byDef     map[*eskip.Route]int
+	byID      map[string]int
+}
+
+func newValidatedRoutes(defs []*eskip.Route, positions []eskip.Position) *validatedRoutes {
+	v := &validatedRoutes{
+		positions: positions,
+		byDef:     make(map[*eskip.Route]int),
+		byID:      make(map[string]int),
+	}
+
+	for i, d := range defs {
+		v.byDef[d] = i
+		if _, ok := v.byID[d.Id]; !ok {
+			v.byID[d.Id] = i
+		}
+	}
+
+	return v
+}
+
+func (v *validatedRoutes) index(def *eskip.Route) int {
+	if i, ok := v.byDef[def]; ok {
+		return i
+	}
+
+	if i, ok := v.byID[def.Id]; ok {
+		return i
+	}
+
+	return -1
+}
+
+func (v *validatedRoutes) position(index int) *eskip.Position {
+	if index < 0 || index >= len(v.positions) {
+		return nil
+	}
+
+	p := v.positions[index]
+	return &p
+}
+
+// returns a string identifying the set of the predicates of a route,
+// independent of their order and of the legacy representation
+func predicateSetKey(r *eskip.Route) string {
+	c := eskip.Canonical(r)
+	ps := make([]string, len(c.Predicates))
+	for i, p := range c.Predicates {
+		ps[i] = p.String()
+	}
+
+	sort.Strings(ps)
+	return strings.Join(ps, " && ")
+}
+
+func (v *validatedRoutes) conflicts(defs, active []*eskip.Route) []*RouteConflict {
+	var conflicts []*RouteConflict
+	conflict := func(def *eskip.Route, with string, isActive bool, reason string) {
+		i := v.index(def)
+		conflicts = append(conflicts, &RouteConflict{
+			RouteID:            def.Id,
+			Index:              i,
+			Position:           v.position(i),
+			ConflictingRouteID: with,
+			Active:             isActive,
+			Reason:             reason,
+		})
+	}
+
+	activeIDs := make(map[string]bool)
+	activeKeys := make(map[string][]string)
+	for _, r := range active {
+		activeIDs[r.Id] = true
+		k := predicateSetKey(r)
+		activeKeys[k] = append(activeKeys[k], r.Id)
+	}
+
+	ids := make(map[string]bool)
+	keys := make(map[string][]string)
+	for _, d := range defs {
+		if d.Id != "" && activeIDs[d.Id] {
+			conflict(d, d.Id, true, conflictDuplicateID)
+		}
+
+		if d.Id != "" && ids[d.Id] {
+			conflict(d, d.Id, false, conflictDuplicateID)
+		}
+
+		ids[d.Id] = true
+		k := predicateSetKey(d)
+		for _, id := range activeKeys[k] {
+			if id != d.Id {
+				conflict(d, id, true, conflictIdenticalPredicates)
+			}
+		}
+
+		for _, id := range keys[k] {
+			if id != d.Id {
+				conflict(d, id, false, conflictIdenticalPredicates)
+			}
+		}
+
+		keys[k] = append(keys[k], d.Id)
+	}
+
+	return conflicts
+}
+
+// ValidateRoutes validates route definitions with the filter registry,
+// the custom predicates, the pre-processors and the matching options of
+// the routing options, without applying them. The filters of the routes
+// are created, the same way as when the routes are received from the data
+// clients. This means that validating routes is not free from side
+// effects: CreateFilter is called for every valid filter of the validated
+// routes, and the stateful filters may allocate resources, e.g. the
+// tokeninfo filters create shared HTTP clients, the tee filters create
+// their own HTTP clients, and the filter plugins may start goroutines.
+// These resources are never released after the validation, since the
+// filters cannot be closed. The post-processors are skipped, only those
+// are used, that implement the RouteValidator interface, e.g. the load
+// balancer. The routes are checked for conflicts with each other, and
+// with the active routes: duplicate ids and identical sets of predicates.
+// The positions are optional, and when set, they need to be in the same
+// order as the route definitions.
+func ValidateRoutes(o Options, defs []*eskip.Route, positions []eskip.Position, active []*eskip.Route) *ValidationResult {
+	v := newValidatedRoutes(defs, positions)
+	result := &ValidationResult{
+		Errors:    []*RouteValidationError{},
+		Conflicts: []*RouteConflict{},
+	}
+
+	addError := func(def *eskip.Route, err error) {
+		i := v.index(def)
+		result.Errors = append(result.Errors, &RouteValidationError{
+			RouteID:  def.Id,
+			Index:    i,
+			Position: v.position(i),
+			Message:  err.Error(),
+		})
+	}
+
+	// preprocessors may modify the received slice
+	processed := make([]*eskip.Route, len(defs))
+	copy(processed, defs)
+	for _, p := range o.PreProcessors {
+		processed = p.Do(processed)
+	}
+
+	cpm := mapPredicates(o.Predicates)
+	var routes []*Route
+	defsByID := make(map[string]*eskip.Route)
+	for _, def := range processed {
+		r, err := processRouteDef(cpm, o.MatchingOptions, o.FilterRegistry, def)
+		if err == nil {
+			for _, p := range o.PostProcessors {
+				if rv, ok := p.(RouteValidator); ok {
+					if err = rv.ValidateRoute(r); err != nil {
+						break
+					}
+				}
+			}
+		}
+
+		if err != nil {
+			addError(def, err)
+			continue
+		}
+
+		routes = append(routes, r)
+		defsByID[def.Id] = def
+	}
+
+	_, errs := newMatcher(routes, o.MatchingOptions)
+	invalid := make(map[string]bool)
+	for _, err := range errs {
+		if err.Index < 0 {
+			result.Errors = append(result.Errors, &RouteValidationError{Index: -1, Message: err.Error()})
+			continue
+		}
+
+		invalid[err.ID] = true
+		addError(defsByID[err.ID], err.Original)
+	}
+
+	for _, r := range routes {
+		if !invalid[r.Id] {
+			result.Routes++
+		}
+	}
+
+	result.Conflicts = append(result.Conflicts, v.conflicts(processed, active)...)
+	result.Valid = len(result.Errors) == 0
+	return result
+}
+
+// Validate validates route definitions with the options of the routing,
+// and checks their conflicts with the currently active routes, without
+// applying them. See ValidateRoutes.
+func (r *Routing) Validate(defs []*eskip.Route, positions []eskip.Position) *ValidationResult {
+	rt := r.routeTable.Load().(*routeTable)
+	return ValidateRoutes(r.options, defs, positions, rt.validRoutes)
+}
+
+type validationHandler struct {
+	routing *Routing
+}
+
+// ValidationHandler returns an HTTP handler, that validates the routes
+// received with the POST method, without applying them. The routes are
+// expected in eskip format, or, when the content type of the request is
+// application/json, as a JSON array. The response contains the JSON
+// representation of ValidationResult. When the routes cannot be parsed,
+// the result contains the parsing error with its position. The size of
+// the request body is limited to 16MB. See ValidateRoutes about the side
+// effects of the validation: the handler should not be exposed to
+// untrusted clients.
+func (r *Routing) ValidationHandler() http.Handler {
+	return &validationHandler{routing: r}
+}
+
+func (h *validationHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxValidationBodySize))
+	if err != nil {
+		status := http.StatusBadRequest
+		var merr *http.MaxBytesError
+		if errors.As(err, &merr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+
+		http.Error(w, fmt.Sprintf("failed to read the routes: %v", err), status)
+		return
+	}
+
+	var (
+		defs      []*eskip.Route
+		positions []eskip.Position
+	)
+
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		defs, positions, err = eskip.ParseJSONWithPositions(b)
+	} else {
+		defs, positions, err = eskip.ParseWithPositions(string(b))
+	}
+
+	var result *ValidationResult
+	if err != nil {
+		verr := &RouteValidationError{Index: -1, Message: err.Error()}
+		var perr *eskip.PositionError
+		if errors.As(err, &perr) {
+			verr.Position = &perr.Position
+		}
+
+		result = &ValidationResult{
+			Errors:    []*RouteValidationError{verr},
+			Conflicts: []*RouteConflict{},
+		}
+	} else {
+		result = h.routing.Validate(defs, positions)
+	}
+
+	writeJSON(w, result)
+}
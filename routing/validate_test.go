@@ -0,0 +1,255 @@
+package routing_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/logging/loggingtest"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+)
+
+type prependFilter struct{ name string }
+
+func (p prependFilter) Do(routes []*eskip.Route) []*eskip.Route {
+	for i, r := range routes {
+		if strings.HasPrefix(r.Id, "prepend") {
+			c := r.Copy()
+			c.Filters = append([]*eskip.Filter{{Name: p.name}}, c.Filters...)
+			routes[i] = c
+		}
+	}
+
+	return routes
+}
+
+// fails on the routes with the id bad, and the routes must not be post
+// processed otherwise during validation
+type validatingPostProcessor struct{}
+
+func (validatingPostProcessor) Do([]*routing.Route) []*routing.Route {
+	panic("unexpected post-processing")
+}
+
+func (validatingPostProcessor) ValidateRoute(r *routing.Route) error {
+	if r.Id == "bad" {
+		return errors.New("bad route")
+	}
+
+	return nil
+}
+
+type statefulPostProcessor struct{}
+
+func (statefulPostProcessor) Do([]*routing.Route) []*routing.Route {
+	panic("unexpected post-processing")
+}
+
+func newValidationRouting(t *testing.T) *testRouting {
+	dc, err := testdataclient.NewDoc(`
+		foo: Path("/foo") -> "https://foo.example.org";
+		bar: Path("/bar") && Method("POST") -> "https://bar.example.org";
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := routing.Options{
+		FilterRegistry: builtin.MakeRegistry(),
+		DataClients:    []routing.DataClient{dc},
+		PollTimeout:    pollTimeout,
+		PreProcessors:  []routing.PreProcessor{prependFilter{"unknownFilter"}},
+	}
+
+	tl := loggingtest.New()
+	o.Log = tl
+	tr := &testRouting{tl, routing.New(o)}
+	if err := tr.waitForRouteSetting(); err != nil {
+		tr.close()
+		t.Fatal(err)
+	}
+
+	return tr
+}
+
+func findValidationError(r *routing.ValidationResult, id string) *routing.RouteValidationError {
+	for _, err := range r.Errors {
+		if err.RouteID == id {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestValidateRoutes(t *testing.T) {
+	doc := `
+		valid: Path("/valid") -> setPath("/") -> "https://valid.example.org";
+		unknownFilter: Path("/unknown-filter") -> fooBar() -> "https://foo.example.org";
+		unknownPredicate: FooBar() -> "https://foo.example.org";
+		invalidRegexp: Path("/invalid-regexp") && Host("[") -> "https://foo.example.org";
+		prependInvalid: Path("/prepend") -> "https://foo.example.org";
+		bad: Path("/bad") -> "https://foo.example.org";
+		lb: Path("/lb") -> <roundRobin, "https://lb1.example.org", "https://lb2.example.org">;
+	`
+
+	defs, positions, err := eskip.ParseWithPositions(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := routing.Options{
+		FilterRegistry: builtin.MakeRegistry(),
+		PreProcessors:  []routing.PreProcessor{prependFilter{"unknownFilter"}},
+		PostProcessors: []routing.PostProcessor{statefulPostProcessor{}, validatingPostProcessor{}},
+	}
+
+	result := routing.ValidateRoutes(o, defs, positions, nil)
+	if result.Valid {
+		t.Error("failed to fail")
+	}
+
+	if result.Routes != 2 {
+		t.Errorf("unexpected number of valid routes: %d", result.Routes)
+	}
+
+	for i, id := range []string{"unknownFilter", "unknownPredicate", "invalidRegexp", "prependInvalid", "bad"} {
+		err := findValidationError(result, id)
+		if err == nil {
+			t.Errorf("failed to report the invalid route: %s", id)
+			continue
+		}
+
+		if err.Index != i+1 || err.Position == nil || *err.Position != positions[i+1] || err.Message == "" {
+			t.Errorf("unexpected error for %s: %+v", id, err)
+		}
+	}
+
+	if len(result.Errors) != 5 {
+		t.Errorf("unexpected number of errors: %d", len(result.Errors))
+	}
+}
+
+func TestValidateConflicts(t *testing.T) {
+	tr := newValidationRouting(t)
+	defer tr.close()
+
+	defs, positions, err := eskip.ParseWithPositions(`
+		foo: Path("/foo") -> "https://foo2.example.org";
+		baz: Method("POST") && Path("/bar") -> "https://baz.example.org";
+		qux: Path("/qux") -> "https://qux.example.org";
+		qux: Path("/qux2") -> "https://qux.example.org";
+		quz: Path("/qux") -> "https://quz.example.org";
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := tr.routing.Validate(defs, positions)
+	if !result.Valid || result.Routes != 5 {
+		t.Errorf("unexpected validation result: %+v", result)
+	}
+
+	expected := []routing.RouteConflict{
+		{RouteID: "foo", Index: 0, ConflictingRouteID: "foo", Active: true, Reason: "duplicate id"},
+		{RouteID: "baz", Index: 1, ConflictingRouteID: "bar", Active: true, Reason: "identical predicates"},
+		{RouteID: "qux", Index: 3, ConflictingRouteID: "qux", Reason: "duplicate id"},
+		{RouteID: "quz", Index: 4, ConflictingRouteID: "qux", Reason: "identical predicates"},
+	}
+
+	if len(result.Conflicts) != len(expected) {
+		t.Fatalf("unexpected conflicts: %d, expected: %d", len(result.Conflicts), len(expected))
+	}
+
+	for i, c := range result.Conflicts {
+		e := expected[i]
+		if c.Position == nil || *c.Position != positions[e.Index] {
+			t.Errorf("unexpected position of conflict %d: %v", i, c.Position)
+		}
+
+		c.Position = nil
+		if *c != e {
+			t.Errorf("unexpected conflict: %+v, expected: %+v", *c, e)
+		}
+	}
+}
+
+func TestValidationHandler(t *testing.T) {
+	tr := newValidationRouting(t)
+	defer tr.close()
+
+	serve := func(t *testing.T, method, contentType, body string, expectedStatus int) *routing.ValidationResult {
+		req := httptest.NewRequest(method, "/routes/validate", strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		w := httptest.NewRecorder()
+		tr.routing.ValidationHandler().ServeHTTP(w, req)
+		if w.Code != expectedStatus {
+			t.Fatalf("unexpected status code: %d, expected: %d", w.Code, expectedStatus)
+		}
+
+		if expectedStatus != http.StatusOK {
+			return nil
+		}
+
+		var result routing.ValidationResult
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+
+		return &result
+	}
+
+	t.Run("method not allowed", func(t *testing.T) {
+		serve(t, "GET", "", "", http.StatusMethodNotAllowed)
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		serve(t, "POST", "", strings.Repeat(" ", 16<<20+1), http.StatusRequestEntityTooLarge)
+	})
+
+	t.Run("eskip", func(t *testing.T) {
+		result := serve(t, "POST", "text/plain", `
+			valid: Path("/valid") -> "https://valid.example.org";
+			prependInvalid: Path("/prepend") -> "https://valid.example.org";
+		`, http.StatusOK)
+
+		if result.Valid || result.Routes != 1 || len(result.Errors) != 1 {
+			t.Fatalf("unexpected validation result: %+v", result)
+		}
+
+		err := result.Errors[0]
+		if err.RouteID != "prependInvalid" || err.Index != 1 || err.Position == nil || err.Position.Line != 3 || err.Position.Column != 4 {
+			t.Errorf("unexpected error: %+v", err)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		result := serve(t, "POST", "application/json", `[
+			{"id": "foo", "predicates": [{"name": "Path", "args": ["/foo"]}], "backend": {"type": "shunt"}}
+		]`, http.StatusOK)
+
+		if !result.Valid || result.Routes != 1 || len(result.Conflicts) != 1 || result.Conflicts[0].Reason != "duplicate id" {
+			t.Errorf("unexpected validation result: %+v", result)
+		}
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		result := serve(t, "POST", "", "foo: Path(\"/foo\") -> <shunt>;\nbar: Path(\"/bar\") ->", http.StatusOK)
+		if result.Valid || len(result.Errors) != 1 {
+			t.Fatalf("unexpected validation result: %+v", result)
+		}
+
+		if p := result.Errors[0].Position; p == nil || p.Line != 2 || result.Errors[0].Index != -1 {
+			t.Errorf("unexpected error: %+v", result.Errors[0])
+		}
+	})
+}
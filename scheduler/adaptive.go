@@ -0,0 +1,244 @@
+package scheduler
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// AdaptiveAlgorithm selects how the adaptive concurrency limit is
+// calculated from the observed round trip times.
+type AdaptiveAlgorithm string
+
+const (
+	// Gradient compares the short term and the long term average of
+	// the round trip times, and decreases the limit when the short term
+	// average grows, and increases it otherwise.
+	Gradient AdaptiveAlgorithm = "gradient"
+
+	// Vegas estimates the number of the queued requests in the backend
+	// from the minimum and the current round trip time, and adjusts the
+	// limit to keep it in a small range, like TCP Vegas.
+	Vegas AdaptiveAlgorithm = "vegas"
+)
+
+const (
+	// weight of the samples in the short and long term moving averages
+	// of the gradient algorithm
+	gradientShortWindow = 10
+	gradientLongWindow  = 600
+
+	// the tolerated ratio of the short and the long term round trip times
+	gradientTolerance = 1.5
+
+	// weight of the new limit, smoothing the changes
+	gradientSmoothing = 0.2
+
+	// ratio of the limit applied on failed requests
+	adaptiveBackoff = 0.9
+
+	// number of samples after which the vegas algorithm resets the
+	// minimum round trip time, to follow the changes of the backend
+	vegasProbeInterval = 1000
+)
+
+// AdaptiveConfig contains the settings of the adaptive concurrency limit.
+//
+// note: AdaptiveConfig must stay comparable, because it is used to
+// detect the changes in the configuration of the routes
+type AdaptiveConfig struct {
+
+	// MinConcurrency is the lower bound of the concurrency limit.
+	// Defaults to 1.
+	MinConcurrency int
+
+	// MaxConcurrency is the upper bound of the concurrency limit.
+	MaxConcurrency int
+
+	// Algorithm is used to calculate the limit. Defaults to Gradient.
+	Algorithm AdaptiveAlgorithm
+}
+
+// AdaptiveLimiter adjusts the concurrency limit of a LIFO queue, based
+// on the round trip times of the backend requests. The limiter of a
+// queue is preserved across the routing updates.
+type AdaptiveLimiter struct {
+	mu      sync.Mutex
+	config  AdaptiveConfig
+	queue   *Queue
+	limit   float64
+	applied int
+
+	// round trip time estimates in nanoseconds
+	shortRTT float64
+	longRTT  float64
+	minRTT   float64
+	samples  int
+
+	limitMetricsKey    string
+	shortRTTMetricsKey string
+	longRTTMetricsKey  string
+	minRTTMetricsKey   string
+}
+
+// AdaptiveFilter is the interface that needs to be implemented by the
+// filters adjusting the concurrency limit of the LIFO queue of the same
+// route, or of the group of the route.
+type AdaptiveFilter interface {
+
+	// AdaptiveConfig will be called by the registry once during
+	// processing the routing to get the settings of the limiter.
+	AdaptiveConfig() AdaptiveConfig
+
+	// SetLimiter will be used by the registry to pass in the limiter
+	// of the queue.
+	SetLimiter(*AdaptiveLimiter)
+}
+
+func newAdaptiveLimiter(name string, q *Queue, c AdaptiveConfig, withMetrics bool) *AdaptiveLimiter {
+	l := &AdaptiveLimiter{}
+	if withMetrics {
+		if name == "" {
+			name = "unknown"
+		}
+
+		l.limitMetricsKey = fmt.Sprintf("adaptiveconcurrency.%s.limit", name)
+		l.shortRTTMetricsKey = fmt.Sprintf("adaptiveconcurrency.%s.rtt.short", name)
+		l.longRTTMetricsKey = fmt.Sprintf("adaptiveconcurrency.%s.rtt.long", name)
+		l.minRTTMetricsKey = fmt.Sprintf("adaptiveconcurrency.%s.rtt.min", name)
+	}
+
+	l.limit = float64(q.Config().MaxConcurrency)
+	l.reset(q, c)
+	return l
+}
+
+// reset sets the queue and the configuration of the limiter, and applies
+// the limit within the configured bounds.
+func (l *AdaptiveLimiter) reset(q *Queue, c AdaptiveConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if c.MinConcurrency < 1 {
+		c.MinConcurrency = 1
+	}
+
+	if c.MaxConcurrency < c.MinConcurrency {
+		c.MaxConcurrency = c.MinConcurrency
+	}
+
+	if c.Algorithm == "" {
+		c.Algorithm = Gradient
+	}
+
+	l.config = c
+	if q != l.queue {
+		l.queue = q
+		l.applied = 0
+	}
+
+	l.apply()
+}
+
+// apply clamps the limit, and sets it for the queue, when changed. It
+// expects the lock to be held.
+func (l *AdaptiveLimiter) apply() {
+	l.limit = math.Max(float64(l.config.MinConcurrency), math.Min(float64(l.config.MaxConcurrency), l.limit))
+	n := int(math.Round(l.limit))
+	if n != l.applied {
+		l.applied = n
+		l.queue.setConcurrencyLimit(n)
+	}
+}
+
+// Limit returns the current concurrency limit.
+func (l *AdaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.applied
+}
+
+// Sample updates the concurrency limit with the round trip time of a
+// backend request. Failed requests, e.g. timeouts or overload errors of
+// the backend, decrease the limit.
+func (l *AdaptiveLimiter) Sample(rtt time.Duration, failed bool) {
+	if rtt <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// the active requests are counted including the current one
+	active := l.queue.Status().ActiveRequests
+
+	l.samples++
+	sample := float64(rtt)
+	if l.shortRTT == 0 {
+		l.shortRTT, l.longRTT = sample, sample
+	} else {
+		l.shortRTT += (sample - l.shortRTT) / gradientShortWindow
+		l.longRTT += (sample - l.longRTT) / gradientLongWindow
+	}
+
+	if l.minRTT == 0 || sample < l.minRTT || l.samples%vegasProbeInterval == 0 {
+		l.minRTT = sample
+	}
+
+	switch {
+	case failed:
+		l.limit *= adaptiveBackoff
+	case float64(active) < l.limit/2:
+		// the limit is not reached, no information about the capacity
+		return
+	case l.config.Algorithm == Vegas:
+		l.limit = l.vegas(sample)
+	default:
+		l.limit = l.gradient()
+	}
+
+	l.apply()
+}
+
+func (l *AdaptiveLimiter) gradient() float64 {
+	// when the load drops, the long term average follows faster
+	if l.longRTT/l.shortRTT > 2 {
+		l.longRTT *= 0.95
+	}
+
+	gradient := math.Max(0.5, math.Min(1, gradientTolerance*l.longRTT/l.shortRTT))
+	limit := l.limit*gradient + math.Sqrt(l.limit)
+	return l.limit*(1-gradientSmoothing) + limit*gradientSmoothing
+}
+
+func (l *AdaptiveLimiter) vegas(rtt float64) float64 {
+	step := math.Max(1, math.Log10(l.limit))
+	alpha, beta := 3*step, 6*step
+	queued := l.limit * (1 - l.minRTT/rtt)
+	switch {
+	case queued <= step:
+		return l.limit + beta
+	case queued < alpha:
+		return l.limit + step
+	case queued > beta:
+		return l.limit - step
+	default:
+		return l.limit
+	}
+}
+
+func (l *AdaptiveLimiter) updateMetrics(r *Registry) {
+	if l.limitMetricsKey == "" {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	m := r.options.Metrics
+	m.UpdateGauge(l.limitMetricsKey, float64(l.applied))
+	m.UpdateGauge(l.shortRTTMetricsKey, l.shortRTT/float64(time.Millisecond))
+	m.UpdateGauge(l.longRTTMetricsKey, l.longRTT/float64(time.Millisecond))
+	m.UpdateGauge(l.minRTTMetricsKey, l.minRTT/float64(time.Millisecond))
+}
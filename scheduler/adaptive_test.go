@@ -0,0 +1,205 @@
+package scheduler_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/metrics/metricstest"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"github.com/zalando/skipper/scheduler"
+)
+
+type testAdaptiveFilter interface {
+	GetLimiter() *scheduler.AdaptiveLimiter
+}
+
+func TestAdaptiveConcurrency(t *testing.T) {
+	initTest := func(t *testing.T, doc string) (*routing.Routing, *testdataclient.Client, *metricstest.MockMetrics, *scheduler.Registry, func()) {
+		cli, err := testdataclient.NewDoc(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m := &metricstest.MockMetrics{}
+		reg := scheduler.RegistryWith(scheduler.Options{
+			EnableRouteLIFOMetrics: true,
+			Metrics:                m,
+			MetricsUpdateTimeout:   time.Hour,
+		})
+
+		rt := routing.New(routing.Options{
+			SignalFirstLoad: true,
+			FilterRegistry:  builtin.MakeRegistry(),
+			DataClients:     []routing.DataClient{cli},
+			PostProcessors:  []routing.PostProcessor{reg},
+		})
+
+		<-rt.FirstLoad()
+		return rt, cli, m, reg, func() {
+			rt.Close()
+			reg.Close()
+		}
+	}
+
+	getRoute := func(t *testing.T, rt *routing.Routing, path string) *routing.Route {
+		r, _ := rt.Route(&http.Request{URL: &url.URL{Path: path}})
+		if r == nil {
+			t.Fatalf("route not found: %s", path)
+		}
+
+		return r
+	}
+
+	getQueue := func(r *routing.Route) *scheduler.Queue {
+		return r.Filters[0].Filter.(scheduler.LIFOFilter).GetQueue()
+	}
+
+	getLimiter := func(r *routing.Route) *scheduler.AdaptiveLimiter {
+		return r.Filters[1].Filter.(testAdaptiveFilter).GetLimiter()
+	}
+
+	// occupy keeps the queue at the current limit, so that the samples
+	// are not considered application limited
+	occupy := func(t *testing.T, q *scheduler.Queue, n int) func() {
+		var dones []func()
+		for i := 0; i < n; i++ {
+			done, err := q.Wait()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dones = append(dones, done)
+		}
+
+		return func() {
+			for _, d := range dones {
+				d()
+			}
+		}
+	}
+
+	for _, algorithm := range []string{"gradient", "vegas"} {
+		t.Run(algorithm, func(t *testing.T) {
+			rt, _, m, reg, close := initTest(t, `
+				r: * -> lifo(10, 100, "1s") -> adaptiveConcurrency(2, 20, "`+algorithm+`") -> <shunt>;
+			`)
+			defer close()
+
+			r := getRoute(t, rt, "/")
+			q, l := getQueue(r), getLimiter(r)
+			if l == nil {
+				t.Fatal("limiter not set")
+			}
+
+			if l.Limit() != 10 || q.ConcurrencyLimit() != 10 {
+				t.Fatalf("unexpected initial limit: %d, %d", l.Limit(), q.ConcurrencyLimit())
+			}
+
+			// no load, the limit does not change
+			for i := 0; i < 100; i++ {
+				l.Sample(10*time.Millisecond, false)
+			}
+
+			if l.Limit() != 10 {
+				t.Fatalf("unexpected limit without load: %d", l.Limit())
+			}
+
+			release := occupy(t, q, 10)
+			for i := 0; i < 100; i++ {
+				l.Sample(10*time.Millisecond, false)
+			}
+
+			release()
+			if l.Limit() != 20 || q.ConcurrencyLimit() != 20 {
+				t.Fatalf("failed to increase the limit to the maximum: %d, %d", l.Limit(), q.ConcurrencyLimit())
+			}
+
+			release = occupy(t, q, 20)
+			for i := 0; i < 100; i++ {
+				l.Sample(200*time.Millisecond, false)
+			}
+
+			release()
+			if l.Limit() >= 20 {
+				t.Fatalf("failed to decrease the limit on growing latency: %d", l.Limit())
+			}
+
+			for i := 0; i < 100; i++ {
+				l.Sample(10*time.Millisecond, true)
+			}
+
+			if l.Limit() != 2 || q.ConcurrencyLimit() != 2 {
+				t.Fatalf("failed to decrease the limit to the minimum on failures: %d, %d", l.Limit(), q.ConcurrencyLimit())
+			}
+
+			reg.UpdateMetrics()
+			if v, ok := m.Gauge("adaptiveconcurrency.r.limit"); !ok || v != 2 {
+				t.Errorf("unexpected limit gauge: %v, %v", v, ok)
+			}
+
+			if v, ok := m.Gauge("adaptiveconcurrency.r.rtt.min"); !ok || v != 10 {
+				t.Errorf("unexpected min rtt gauge: %v, %v", v, ok)
+			}
+		})
+	}
+
+	t.Run("group", func(t *testing.T) {
+		rt, _, _, _, close := initTest(t, `
+			g1: Path("/one") -> lifoGroup("g", 4, 10) -> adaptiveConcurrency(1, 8) -> <shunt>;
+			g2: Path("/two") -> lifoGroup("g") -> adaptiveConcurrency(1, 8) -> <shunt>;
+		`)
+		defer close()
+
+		r1, r2 := getRoute(t, rt, "/one"), getRoute(t, rt, "/two")
+		if getQueue(r1) != getQueue(r2) || getLimiter(r1) != getLimiter(r2) {
+			t.Fatal("failed to share the queue and the limiter in the group")
+		}
+
+		q, l := getQueue(r1), getLimiter(r1)
+		release := occupy(t, q, 4)
+		for i := 0; i < 100; i++ {
+			l.Sample(10*time.Millisecond, false)
+		}
+
+		release()
+		if q.ConcurrencyLimit() != 8 {
+			t.Errorf("failed to adjust the group limit: %d", q.ConcurrencyLimit())
+		}
+	})
+
+	t.Run("preserved and removed on update", func(t *testing.T) {
+		rt, dc, _, _, close := initTest(t, `
+			r: * -> lifo(10, 100, "1s") -> adaptiveConcurrency(2, 20) -> <shunt>;
+		`)
+		defer close()
+
+		r := getRoute(t, rt, "/")
+		q, l := getQueue(r), getLimiter(r)
+		for i := 0; i < 100; i++ {
+			l.Sample(10*time.Millisecond, true)
+		}
+
+		if err := dc.UpdateDoc(`r: * -> lifo(10, 100, "1s") -> adaptiveConcurrency(2, 30) -> setPath("/") -> <shunt>;`, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(120 * time.Millisecond)
+		r = getRoute(t, rt, "/")
+		if getQueue(r) != q || getLimiter(r) != l || q.ConcurrencyLimit() != 2 {
+			t.Fatalf("failed to preserve the limit: %d", q.ConcurrencyLimit())
+		}
+
+		if err := dc.UpdateDoc(`r: * -> lifo(10, 100, "1s") -> <shunt>;`, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(120 * time.Millisecond)
+		if q.ConcurrencyLimit() != 10 {
+			t.Errorf("failed to restore the configured limit: %d", q.ConcurrencyLimit())
+		}
+	})
+}
@@ -61,6 +61,8 @@ type QueueStatus struct {
 type Queue struct {
 	queue                    *jobqueue.Stack
 	config                   Config
+	mu                       sync.Mutex
+	concurrencyLimit         int
 	metrics                  metrics.Metrics
 	activeRequestsMetricsKey string
 	errorFullMetricsKey      string
@@ -98,9 +100,10 @@ type Registry struct {
 	measuring bool
 	quit      chan struct{}
 
-	mu      sync.Mutex
-	queues  map[queueId]*Queue
-	deleted map[*Queue]time.Time
+	mu       sync.Mutex
+	queues   map[queueId]*Queue
+	deleted  map[*Queue]time.Time
+	limiters map[queueId]*AdaptiveLimiter
 }
 
 type queueId struct {
@@ -171,18 +174,41 @@ func (q *Queue) Status() QueueStatus {
 }
 
 // Config returns the configuration that the queue was created with.
+// The MaxConcurrency may be overridden by an adaptive limit, see
+// ConcurrencyLimit.
 func (q *Queue) Config() Config {
 	return q.config
 }
 
+// ConcurrencyLimit returns the current maximum concurrency of the queue,
+// which is the adaptive limit, when set, or the configured one.
+func (q *Queue) ConcurrencyLimit() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.concurrencyLimit > 0 {
+		return q.concurrencyLimit
+	}
+
+	return q.config.MaxConcurrency
+}
+
 func (q *Queue) reconfigure() {
 	q.queue.Reconfigure(jobqueue.Options{
-		MaxConcurrency: q.config.MaxConcurrency,
+		MaxConcurrency: q.ConcurrencyLimit(),
 		MaxStackSize:   q.config.MaxQueueSize,
 		Timeout:        q.config.Timeout,
 	})
 }
 
+// setConcurrencyLimit overrides the configured maximum concurrency, 0
+// restores it.
+func (q *Queue) setConcurrencyLimit(n int) {
+	q.mu.Lock()
+	q.concurrencyLimit = n
+	q.mu.Unlock()
+	q.reconfigure()
+}
+
 func (q *Queue) close() {
 	q.queue.Close()
 }
@@ -194,10 +220,11 @@ func RegistryWith(o Options) *Registry {
 	}
 
 	return &Registry{
-		options: o,
-		quit:    make(chan struct{}),
-		queues:  make(map[queueId]*Queue),
-		deleted: make(map[*Queue]time.Time),
+		options:  o,
+		quit:     make(chan struct{}),
+		queues:   make(map[queueId]*Queue),
+		deleted:  make(map[*Queue]time.Time),
+		limiters: make(map[queueId]*AdaptiveLimiter),
 	}
 }
 
@@ -251,10 +278,42 @@ func (r *Registry) newQueue(name string, c Config) *Queue {
 	return q
 }
 
-func (r *Registry) deleteUnused(inUse map[queueId]struct{}) {
+func (r *Registry) getLimiter(id queueId, c AdaptiveConfig) *AdaptiveLimiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	q := r.queues[id]
+	l, ok := r.limiters[id]
+	if ok {
+		l.reset(q, c)
+	} else {
+		withMetrics := r.options.EnableRouteLIFOMetrics && r.options.Metrics != nil
+		l = newAdaptiveLimiter(id.name, q, c, withMetrics)
+		r.limiters[id] = l
+		if withMetrics {
+			r.measure()
+		}
+	}
+
+	return l
+}
+
+func (r *Registry) deleteUnused(inUse, adaptiveInUse map[queueId]struct{}) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	for id := range r.limiters {
+		if _, ok := adaptiveInUse[id]; !ok {
+			delete(r.limiters, id)
+
+			// restoring the configured concurrency, when the queue is
+			// still in use
+			if q, ok := r.queues[id]; ok {
+				q.setConcurrencyLimit(0)
+			}
+		}
+	}
+
 	now := time.Now()
 	closeCutoff := now.Add(-queueCloseDelay)
 
@@ -309,19 +368,42 @@ func (registryPreProcessor) Do(routes []*eskip.Route) []*eskip.Route {
 
 // Do implements routing.PostProcessor and sets the queue for the scheduler filters.
 //
-// It preserves the existing queue when available.
+// It preserves the existing queue when available. The filters of the
+// reused routes already use the preserved queues, and they are only
+// considered to track the queues in use, but not modified.
 func (r *Registry) Do(routes []*routing.Route) []*routing.Route {
 	rr := make([]*routing.Route, len(routes))
 	inUse := make(map[queueId]struct{})
 	groups := make(map[string][]GroupedLIFOFilter)
+	adaptive := make(map[queueId][]AdaptiveFilter)
+
+	// the filters of the new and changed routes, that need the queue or
+	// the limiter to be set
+	setGroups := make(map[string][]GroupedLIFOFilter)
+	setAdaptive := make(map[queueId][]AdaptiveFilter)
 
 	for i, ri := range routes {
 		rr[i] = ri
-		var lifoCount int
+		var (
+			lifoCount       int
+			queue           *queueId
+			adaptiveFilters []AdaptiveFilter
+		)
+
 		for _, fi := range ri.Filters {
+			if af, ok := fi.Filter.(AdaptiveFilter); ok {
+				adaptiveFilters = append(adaptiveFilters, af)
+				continue
+			}
+
 			if glf, ok := fi.Filter.(GroupedLIFOFilter); ok {
 				groupName := glf.Group()
 				groups[groupName] = append(groups[groupName], glf)
+				if !ri.Reused {
+					setGroups[groupName] = append(setGroups[groupName], glf)
+				}
+
+				queue = &queueId{groupName, true}
 				continue
 			}
 
@@ -334,15 +416,29 @@ func (r *Registry) Do(routes []*routing.Route) []*routing.Route {
 
 			id := queueId{ri.Id, false}
 			inUse[id] = struct{}{}
+			queue = &id
 
 			q := r.getQueue(id, lf.Config())
 
-			lf.SetQueue(q)
+			if !ri.Reused {
+				lf.SetQueue(q)
+			}
 		}
 
 		if lifoCount > 1 {
 			log.Warnf("Found multiple lifo filters on route: %q", ri.Id)
 		}
+
+		if len(adaptiveFilters) > 0 {
+			if queue == nil {
+				log.Warnf("Found adaptive concurrency filter without a lifo filter on route: %q", ri.Id)
+			} else {
+				adaptive[*queue] = append(adaptive[*queue], adaptiveFilters...)
+				if !ri.Reused {
+					setAdaptive[*queue] = append(setAdaptive[*queue], adaptiveFilters...)
+				}
+			}
+		}
 	}
 
 	for name, group := range groups {
@@ -370,12 +466,29 @@ func (r *Registry) Do(routes []*routing.Route) []*routing.Route {
 
 		q := r.getQueue(id, c)
 
-		for _, glf := range group {
+		for _, glf := range setGroups[name] {
 			glf.SetQueue(q)
 		}
 	}
 
-	r.deleteUnused(inUse)
+	adaptiveInUse := make(map[queueId]struct{})
+	for id, afs := range adaptive {
+		c := afs[0].AdaptiveConfig()
+		for _, af := range afs[1:] {
+			if af.AdaptiveConfig() != c {
+				log.Warnf("Found mismatching adaptive concurrency configuration for the LIFO queue: %s", id.name)
+				break
+			}
+		}
+
+		adaptiveInUse[id] = struct{}{}
+		l := r.getLimiter(id, c)
+		for _, af := range setAdaptive[id] {
+			af.SetLimiter(l)
+		}
+	}
+
+	r.deleteUnused(inUse, adaptiveInUse)
 
 	return rr
 }
@@ -407,6 +520,10 @@ func (r *Registry) updateMetrics() {
 		r.options.Metrics.UpdateGauge(q.activeRequestsMetricsKey, float64(s.ActiveRequests))
 		r.options.Metrics.UpdateGauge(q.queuedRequestsMetricsKey, float64(s.QueuedRequests))
 	}
+
+	for _, l := range r.limiters {
+		l.updateMetrics(r)
+	}
 }
 
 func (r *Registry) UpdateMetrics() {
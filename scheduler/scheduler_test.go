@@ -9,6 +9,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
 	"github.com/zalando/skipper/filters/builtin"
 	"github.com/zalando/skipper/filters/filtertest"
 	"github.com/zalando/skipper/routing"
@@ -426,3 +428,32 @@ func TestRegistryPreProcessor(t *testing.T) {
 		})
 	}
 }
+
+func TestRegistryReusedRoutes(t *testing.T) {
+	f, err := builtin.MakeRegistry()[filters.LifoName].CreateFilter([]interface{}{10, 12, "10s"})
+	require.NoError(t, err)
+
+	lf := f.(scheduler.LIFOFilter)
+	r := &routing.Route{
+		Route:   eskip.Route{Id: "foo"},
+		Filters: []*routing.RouteFilter{{Filter: f, Name: filters.LifoName}},
+	}
+
+	reg := scheduler.NewRegistry()
+	defer reg.Close()
+
+	reg.Do([]*routing.Route{r})
+	q := lf.GetQueue()
+	require.NotNil(t, q)
+
+	// the filters of the reused routes are not modified
+	lf.SetQueue(nil)
+	r.Reused = true
+	reg.Do([]*routing.Route{r})
+	assert.Nil(t, lf.GetQueue())
+
+	// the queue of the reused route was kept
+	r.Reused = false
+	reg.Do([]*routing.Route{r})
+	assert.Same(t, q, lf.GetQueue())
+}
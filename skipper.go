@@ -3,6 +3,7 @@ package skipper
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -20,6 +21,8 @@ import (
 
 	ot "github.com/opentracing/opentracing-go"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/zalando/skipper/circuit"
@@ -31,7 +34,10 @@ import (
 	"github.com/zalando/skipper/filters"
 	"github.com/zalando/skipper/filters/apiusagemonitoring"
 	"github.com/zalando/skipper/filters/auth"
+	"github.com/zalando/skipper/filters/backendtls"
 	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/filters/cache"
+	"github.com/zalando/skipper/filters/errorpage"
 	"github.com/zalando/skipper/filters/fadein"
 	logfilter "github.com/zalando/skipper/filters/log"
 	ratelimitfilters "github.com/zalando/skipper/filters/ratelimit"
@@ -49,16 +55,19 @@ import (
 	"github.com/zalando/skipper/predicates/methods"
 	"github.com/zalando/skipper/predicates/primitive"
 	"github.com/zalando/skipper/predicates/query"
+	"github.com/zalando/skipper/predicates/sni"
 	"github.com/zalando/skipper/predicates/source"
 	"github.com/zalando/skipper/predicates/tee"
 	"github.com/zalando/skipper/predicates/traffic"
 	"github.com/zalando/skipper/proxy"
+	"github.com/zalando/skipper/proxyprotocol"
 	"github.com/zalando/skipper/queuelistener"
 	"github.com/zalando/skipper/ratelimit"
 	"github.com/zalando/skipper/routing"
 	"github.com/zalando/skipper/scheduler"
 	"github.com/zalando/skipper/secrets"
 	"github.com/zalando/skipper/swarm"
+	"github.com/zalando/skipper/tlspassthrough"
 	"github.com/zalando/skipper/tracing"
 )
 
@@ -309,6 +318,28 @@ type Options struct {
 	// Enable connection state metrics for server http connections.
 	EnableConnMetricsServer bool
 
+	// EnableHTTP3 starts an HTTP/3 (QUIC) listener in addition to the TCP
+	// listener, serving the same routes. It requires TLS, and uses the
+	// same certificates. The responses on the TCP listener advertise the
+	// HTTP/3 listener in the Alt-Svc header.
+	EnableHTTP3 bool
+
+	// HTTP3Address is the UDP address of the HTTP/3 listener. Defaults
+	// to the Address of the TCP listener.
+	HTTP3Address string
+
+	// ProxyProtocolTrustedCIDRs enables the PROXY protocol (v1 and v2) on
+	// the TCP listener, for the connections from these networks, e.g. the
+	// TCP load balancers. The client address received in the PROXY
+	// protocol header is used as the remote address of the requests.
+	ProxyProtocolTrustedCIDRs skpnet.IPNets
+
+	// TLSPassthroughAddress starts a TCP listener, that forwards the TLS
+	// connections without terminating them, to the backends of the
+	// routes matching the server name (SNI) of the connections. The
+	// routes use the SNI predicate, and tcp:// backends.
+	TLSPassthroughAddress string
+
 	// TimeoutBackend sets the TCP client connection timeout for
 	// proxy http connections to the backend.
 	TimeoutBackend time.Duration
@@ -343,6 +374,11 @@ type Options struct {
 	// a backend to always create a new connection.
 	DisableHTTPKeepalives bool
 
+	// RetryBudget limits the ratio of the retries to the requests
+	// of the routes using the retry filter. When 0, the default
+	// (0.2) is used, when negative, the budget is disabled.
+	RetryBudget float64
+
 	// Flag indicating to ignore trailing slashes in paths during route
 	// lookup.
 	IgnoreTrailingSlash bool
@@ -377,6 +413,18 @@ type Options struct {
 	// instead of full details of the updated/deleted routes.
 	SuppressRouteUpdateLogs bool
 
+	// RoutingHistorySize sets the number of the applied routing tables kept
+	// in the routing history. When set, the history can be listed, and the
+	// routing can be pinned or rolled back, via the support listener.
+	RoutingHistorySize int
+
+	// EnableRouteValidation enables validating routes without applying
+	// them, via the support listener. The validation creates the filters
+	// of the posted routes, and the resources allocated by the stateful
+	// filters are not released, so it should be enabled only when the
+	// support listener is not exposed to untrusted clients.
+	EnableRouteValidation bool
+
 	// Dev mode. Currently this flag disables prioritization of the
 	// consumer side over the feeding side during the routing updates to
 	// populate the updated routes faster.
@@ -546,6 +594,17 @@ type Options struct {
 
 	DebugListener string
 
+	// RoutingTraceSecret, when set, enables the routing trace for the
+	// requests with the X-Skipper-Routing-Trace header matching the
+	// secret. The response of these requests contains the routing
+	// decisions of the proxy in the same header.
+	RoutingTraceSecret string
+
+	// RoutingTraceAllowCIDRs enables the routing trace for the requests
+	// with the X-Skipper-Routing-Trace header, coming from one of the
+	// networks, regardless of the header value.
+	RoutingTraceAllowCIDRs skpnet.IPNets
+
 	// Path of certificate(s) when using TLS, mutiple may be given comma separated
 	CertPathTLS string
 	// Path of key(s) when using TLS, multiple may be given comma separated. For
@@ -571,6 +630,14 @@ type Options struct {
 	// and the response messages during web socket upgrades.
 	ExperimentalUpgradeAudit bool
 
+	// EnableConnect enables the forward proxy mode for the CONNECT
+	// requests, routed by the requested host:port.
+	EnableConnect bool
+
+	// ConnectAllowlist contains the allowed host:port destinations of
+	// the CONNECT tunnels. When empty, all the tunnels are rejected.
+	ConnectAllowlist []string
+
 	// MaxLoopbacks defines the maximum number of loops that the proxy can execute when the routing table
 	// contains loop backends (<loopback>).
 	MaxLoopbacks int
@@ -650,6 +717,19 @@ type Options struct {
 	// for a request.
 	DefaultHTTPStatus int
 
+	// MaxRequestBodySize, when greater than 0, limits the size of the
+	// request bodies. Larger requests are rejected with 413 Request
+	// Entity Too Large.
+	MaxRequestBodySize int64
+
+	// ErrorPageTemplateDir, when set, contains the error page templates.
+	// The errorPage filters can reference them by name, and the proxy
+	// uses them for its own errors, by the status code (503.html), the
+	// status class (5xx.html), or the default (default.html). HTML
+	// templates need the .html extension, JSON templates the .json
+	// extension.
+	ErrorPageTemplateDir string
+
 	// EnablePrometheusMetrics enables Prometheus format metrics.
 	//
 	// This option is *deprecated*. The recommended way to enable prometheus metrics is to
@@ -744,6 +824,35 @@ type Options struct {
 	// CompressEncodings, if not empty replace default compression encodings
 	CompressEncodings []string
 
+	// ResponseCacheMaxSize, if greater than 0, replaces the default size
+	// limit of the response cache shared by the cache filters
+	ResponseCacheMaxSize int64
+
+	// OutlierDetection enables the passive outlier detection, that
+	// ejects the failing endpoints of the load balanced routes for a
+	// limited time. The ejected endpoints are listed on the support
+	// listener at /outliers.
+	OutlierDetection bool
+
+	// OutlierConsecutiveFailures sets the number of the consecutive
+	// failed requests, after which an endpoint is ejected.
+	OutlierConsecutiveFailures int
+
+	// OutlierLatencyThreshold, when greater than 0, makes the backend
+	// requests taking longer count as failures.
+	OutlierLatencyThreshold time.Duration
+
+	// OutlierBaseEjectionTime sets the duration of the first ejection
+	// of an endpoint, doubled on every subsequent ejection.
+	OutlierBaseEjectionTime time.Duration
+
+	// OutlierMaxEjectionTime limits the duration of the ejections.
+	OutlierMaxEjectionTime time.Duration
+
+	// OutlierMaxEjectionPercent limits the ratio of the ejected
+	// endpoints of a route.
+	OutlierMaxEjectionPercent int
+
 	// OIDCSecretsFile path to the file containing key to encrypt OpenID token
 	OIDCSecretsFile string
 
@@ -1019,7 +1128,55 @@ func (o *Options) tlsConfig() (*tls.Config, error) {
 	return config, nil
 }
 
+// proxyProtocol wraps the listener to accept the PROXY protocol header
+// from the trusted networks, when configured.
+func proxyProtocol(l net.Listener, o *Options) net.Listener {
+	if len(o.ProxyProtocolTrustedCIDRs) == 0 {
+		return l
+	}
+
+	return proxyprotocol.NewListener(l, proxyprotocol.Options{
+		TrustedNetworks: o.ProxyProtocolTrustedCIDRs,
+		HeaderTimeout:   o.ReadHeaderTimeoutServer,
+	})
+}
+
+// listenTLSPassthrough starts the TLS passthrough listener, forwarding
+// the connections by SNI.
+func listenTLSPassthrough(o *Options, rt *routing.Routing, mtr metrics.Metrics) (*tlspassthrough.Proxy, error) {
+	l, err := net.Listen("tcp", o.TLSPassthroughAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	tp := tlspassthrough.New(tlspassthrough.Options{
+		Routing:           rt,
+		Metrics:           mtr,
+		HelloTimeout:      o.ReadHeaderTimeoutServer,
+		DialTimeout:       o.TimeoutBackend,
+		AccessLogDisabled: o.AccessLogDisabled,
+	})
+
+	log.Infof("TLS passthrough listener on %v", l.Addr())
+	go func() {
+		if err := tp.Serve(proxyProtocol(l, o)); err != nil {
+			log.Errorf("TLS passthrough listener failed: %v", err)
+		}
+	}()
+
+	return tp, nil
+}
+
 func listen(o *Options, mtr metrics.Metrics) (net.Listener, error) {
+	l, err := listenTCP(o, mtr)
+	if err != nil {
+		return nil, err
+	}
+
+	return proxyProtocol(l, o), nil
+}
+
+func listenTCP(o *Options, mtr metrics.Metrics) (net.Listener, error) {
 	if o.Address == "" {
 		o.Address = ":http"
 	}
@@ -1069,6 +1226,68 @@ func listen(o *Options, mtr metrics.Metrics) (net.Listener, error) {
 	})
 }
 
+var errHTTP3WithoutTLS = errors.New("HTTP/3 requires TLS")
+
+// http3Listener serves HTTP/3 on a UDP socket.
+type http3Listener struct {
+	server *http3.Server
+	conn   net.PacketConn
+}
+
+// listenAndServeHTTP3 starts the HTTP/3 listener, serving the same
+// handler as the TCP listener.
+func listenAndServeHTTP3(proxy http.Handler, o *Options, tlsConfig *tls.Config) (*http3Listener, error) {
+	address := o.HTTP3Address
+	if address == "" {
+		address = o.Address
+	}
+
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &http3Listener{
+		server: &http3.Server{
+			Addr:           address,
+			TLSConfig:      http3.ConfigureTLSConfig(tlsConfig.Clone()),
+			Handler:        proxy,
+			MaxHeaderBytes: o.MaxHeaderBytes,
+			QuicConfig:     &quic.Config{MaxIdleTimeout: o.IdleTimeoutServer},
+		},
+		conn: conn,
+	}
+
+	log.Infof("HTTP/3 listener on %v", conn.LocalAddr())
+	go func() {
+		if err := l.server.Serve(conn); err != http.ErrServerClosed {
+			log.Errorf("HTTP/3 listener failed: %v", err)
+		}
+	}()
+
+	return l, nil
+}
+
+// altSvcHandler advertises the HTTP/3 listener in the responses of the
+// TCP listener. The header is available only after the HTTP/3 listener
+// started serving, until then it is omitted.
+func (l *http3Listener) altSvcHandler(proxy http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.server.SetQuicHeaders(w.Header())
+		proxy.ServeHTTP(w, r)
+	})
+}
+
+// close stops the HTTP/3 listener. The server does not close the socket
+// that it was started with.
+func (l *http3Listener) close() {
+	if err := l.server.Close(); err != nil {
+		log.Errorf("Failed to close the HTTP/3 listener: %v", err)
+	}
+
+	l.conn.Close()
+}
+
 func listenAndServeQuit(
 	proxy http.Handler,
 	o *Options,
@@ -1100,6 +1319,24 @@ func listenAndServeQuit(
 		}
 	}
 
+	if len(o.ProxyProtocolTrustedCIDRs) > 0 {
+		srv.ConnContext = proxyprotocol.ConnContext
+	}
+
+	var h3 *http3Listener
+	if o.EnableHTTP3 {
+		if tlsConfig == nil {
+			return errHTTP3WithoutTLS
+		}
+
+		h3, err = listenAndServeHTTP3(proxy, o, tlsConfig)
+		if err != nil {
+			return err
+		}
+
+		srv.Handler = h3.altSvcHandler(proxy)
+	}
+
 	// making idleConnsCH and sigs optional parameters is required to be able to tear down a server
 	// from the tests
 	if idleConnsCH == nil {
@@ -1119,6 +1356,10 @@ func listenAndServeQuit(
 		time.Sleep(o.WaitForHealthcheckInterval)
 
 		log.Info("Start shutdown")
+		if h3 != nil {
+			h3.close()
+		}
+
 		if err := srv.Shutdown(context.Background()); err != nil {
 			log.Errorf("Failed to graceful shutdown: %v", err)
 		}
@@ -1127,7 +1368,22 @@ func listenAndServeQuit(
 
 	log.Infof("proxy listener on %v", o.Address)
 
-	if srv.TLSConfig != nil {
+	if srv.TLSConfig != nil && len(o.ProxyProtocolTrustedCIDRs) > 0 {
+		address := o.Address
+		if address == "" {
+			address = ":https"
+		}
+
+		l, err := net.Listen("tcp", address)
+		if err != nil {
+			return err
+		}
+
+		if err := srv.ServeTLS(proxyProtocol(l, o), "", ""); err != http.ErrServerClosed {
+			log.Errorf("ServeTLS failed: %v", err)
+			return err
+		}
+	} else if srv.TLSConfig != nil {
 		if err := srv.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
 			log.Errorf("ListenAndServeTLS failed: %v", err)
 			return err
@@ -1308,6 +1564,7 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 	o.CustomFilters = append(o.CustomFilters,
 		logfilter.NewAuditLog(o.MaxAuditBody),
 		auth.NewBearerInjector(sp),
+		backendtls.New(sp),
 		auth.NewJwtValidationWithOptions(tio),
 		auth.TokenintrospectionWithOptions(auth.NewOAuthTokenintrospectionAnyClaims, tio),
 		auth.TokenintrospectionWithOptions(auth.NewOAuthTokenintrospectionAllClaims, tio),
@@ -1472,6 +1729,21 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 		o.CustomFilters = append(o.CustomFilters, compress)
 	}
 
+	if o.ResponseCacheMaxSize > 0 {
+		o.CustomFilters = append(o.CustomFilters, cache.NewCacheWithOptions(cache.Options{MaxSize: o.ResponseCacheMaxSize}))
+	}
+
+	var errorPages *errorpage.Templates
+	if o.ErrorPageTemplateDir != "" {
+		errorPages, err = errorpage.LoadTemplates(o.ErrorPageTemplateDir)
+		if err != nil {
+			log.Errorf("Failed to load error page templates: %v.", err)
+			return err
+		}
+
+		o.CustomFilters = append(o.CustomFilters, errorpage.NewWithOptions(errorpage.Options{Templates: errorPages}))
+	}
+
 	// create a filter registry with the available filter specs registered,
 	// and register the custom filters
 	registry := builtin.MakeRegistry()
@@ -1521,6 +1793,7 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 		forwarded.NewForwardedHost(),
 		forwarded.NewForwardedProto(),
 		host.NewAny(),
+		sni.New(),
 	)
 
 	// provide default value for wrapper if not defined
@@ -1553,6 +1826,22 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 			fadein.NewPostProcessor(),
 		},
 		SignalFirstLoad: o.WaitFirstRouteLoad,
+		HistorySize:     o.RoutingHistorySize,
+		Metrics:         mtr,
+	}
+
+	var outlierDetector *loadbalancer.OutlierDetector
+	if o.OutlierDetection {
+		outlierDetector = loadbalancer.NewOutlierDetector(loadbalancer.OutlierOptions{
+			ConsecutiveFailures: o.OutlierConsecutiveFailures,
+			LatencyThreshold:    o.OutlierLatencyThreshold,
+			BaseEjectionTime:    o.OutlierBaseEjectionTime,
+			MaxEjectionTime:     o.OutlierMaxEjectionTime,
+			MaxEjectionPercent:  o.OutlierMaxEjectionPercent,
+			Metrics:             mtr,
+		})
+
+		ro.PostProcessors = append(ro.PostProcessors, outlierDetector)
 	}
 
 	if o.DefaultFilters != nil {
@@ -1586,8 +1875,12 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 		FlushInterval:              o.BackendFlushInterval,
 		ExperimentalUpgrade:        o.ExperimentalUpgrade,
 		ExperimentalUpgradeAudit:   o.ExperimentalUpgradeAudit,
+		EnableConnect:              o.EnableConnect,
+		ConnectAllowlist:           o.ConnectAllowlist,
 		MaxLoopbacks:               o.MaxLoopbacks,
 		DefaultHTTPStatus:          o.DefaultHTTPStatus,
+		MaxRequestBodySize:         o.MaxRequestBodySize,
+		ErrorPages:                 errorPages,
 		LoadBalancer:               lbInstance,
 		Timeout:                    o.TimeoutBackend,
 		ResponseHeaderTimeout:      o.ResponseHeaderTimeoutBackend,
@@ -1597,10 +1890,14 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 		TLSHandshakeTimeout:        o.TLSHandshakeTimeoutBackend,
 		MaxIdleConns:               o.MaxIdleConnsBackend,
 		DisableHTTPKeepalives:      o.DisableHTTPKeepalives,
+		RetryBudget:                o.RetryBudget,
 		AccessLogDisabled:          o.AccessLogDisabled,
 		ClientTLS:                  o.ClientTLS,
 		CustomHttpRoundTripperWrap: o.CustomHttpRoundTripperWrap,
 		RateLimiters:               ratelimitRegistry,
+		OutlierDetector:            outlierDetector,
+		RoutingTraceSecret:         o.RoutingTraceSecret,
+		RoutingTraceAllowCIDRs:     o.RoutingTraceAllowCIDRs,
 	}
 
 	if o.EnableBreakers || len(o.BreakerSettings) > 0 {
@@ -1627,6 +1924,16 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 		mux := http.NewServeMux()
 		mux.Handle("/routes", routing)
 		mux.Handle("/routes/", routing)
+		mux.Handle("/routes/explain", routing.ExplainHandler())
+		mux.Handle("/routes/history", routing.HistoryHandler())
+		mux.Handle("/routes/history/", routing.HistoryHandler())
+		if o.EnableRouteValidation {
+			mux.Handle("/routes/validate", routing.ValidationHandler())
+		}
+
+		if outlierDetector != nil {
+			mux.Handle("/outliers", outlierDetector)
+		}
 
 		metricsHandler := metrics.NewHandler(mtrOpts, mtr)
 		mux.Handle("/metrics", metricsHandler)
@@ -1679,6 +1986,15 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 	// wait for the first route configuration to be loaded if enabled:
 	<-routing.FirstLoad()
 
+	if o.TLSPassthroughAddress != "" {
+		tp, err := listenTLSPassthrough(&o, routing, mtr)
+		if err != nil {
+			return err
+		}
+
+		defer tp.Close()
+	}
+
 	return listenAndServeQuit(o.CustomHttpHandlerWrap(proxy), &o, sig, idleConnsCH, mtr)
 }
 
@@ -1,24 +1,31 @@
 package skipper
 
 import (
+	"bytes"
 	"crypto/tls"
+	"errors"
 	"io"
 	"net"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/quic-go/quic-go/http3"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/zalando/skipper/dataclients/routestring"
 	"github.com/zalando/skipper/filters"
 	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/logging"
 	"github.com/zalando/skipper/proxy"
 	"github.com/zalando/skipper/ratelimit"
 	"github.com/zalando/skipper/routing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -279,6 +286,121 @@ func testServerShutdown(t *testing.T, o *Options, scheme string) {
 	require.Error(t, err)
 }
 
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestHTTP3Server(t *testing.T) {
+	address, err := findAddress()
+	require.NoError(t, err)
+
+	_, port, err := net.SplitHostPort(address)
+	require.NoError(t, err)
+
+	accessLog := &syncBuffer{}
+	logging.Init(logging.Options{AccessLogOutput: accessLog})
+	defer logging.Init(logging.Options{})
+
+	dc, err := routestring.New(`
+		hello: Path("/hello") -> setResponseHeader("X-Route", "hello") -> inlineContent("Hello") -> <shunt>;
+		loop: Path("/loop") -> setPath("/hello") -> <loopback>;
+	`)
+	require.NoError(t, err)
+
+	rt := routing.New(routing.Options{
+		FilterRegistry:  builtin.MakeRegistry(),
+		DataClients:     []routing.DataClient{dc},
+		SignalFirstLoad: true,
+	})
+	defer rt.Close()
+	<-rt.FirstLoad()
+
+	proxy := proxy.New(rt, proxy.OptionsNone)
+	defer proxy.Close()
+
+	o := &Options{
+		Address:     address,
+		CertPathTLS: "fixtures/test.crt",
+		KeyPathTLS:  "fixtures/test.key",
+		EnableHTTP3: true,
+	}
+
+	sigs := make(chan os.Signal, 1)
+	idleConns := make(chan struct{})
+	done := make(chan error, 1)
+	go func() { done <- listenAndServeQuit(proxy, o, sigs, idleConns, nil) }()
+	defer func() {
+		sigs <- syscall.SIGTERM
+		<-idleConns
+		require.NoError(t, <-done)
+	}()
+
+	t.Run("alt-svc on the TCP listener", func(t *testing.T) {
+		rsp, err := waitConn(func() (*http.Response, error) {
+			rsp, err := waitConnGet("https://" + address + "/hello")
+			if err == nil && rsp.Header.Get("Alt-Svc") == "" {
+				// the HTTP/3 listener is not started yet
+				rsp.Body.Close()
+				err = errors.New("missing Alt-Svc header")
+			}
+
+			return rsp, err
+		})
+		require.NoError(t, err)
+		defer rsp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, rsp.StatusCode)
+		assert.Contains(t, rsp.Header.Get("Alt-Svc"), `h3=":`+port+`"`)
+	})
+
+	client := &http.Client{Transport: &http3.RoundTripper{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	defer client.Transport.(*http3.RoundTripper).Close()
+
+	for _, path := range []string{"/hello", "/loop"} {
+		t.Run("HTTP/3 "+path, func(t *testing.T) {
+			rsp, err := waitConn(func() (*http.Response, error) {
+				return client.Get("https://127.0.0.1:" + port + path)
+			})
+			require.NoError(t, err)
+			defer rsp.Body.Close()
+
+			body, err := io.ReadAll(rsp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, http.StatusOK, rsp.StatusCode)
+			assert.Equal(t, 3, rsp.ProtoMajor)
+			assert.Equal(t, "hello", rsp.Header.Get("X-Route"))
+			assert.Equal(t, "Hello", string(body))
+
+			// the access log is written after the response was sent
+			entry := `"GET ` + path + ` HTTP/3.0" 200 5`
+			assert.Eventually(t, func() bool {
+				return strings.Contains(accessLog.String(), entry)
+			}, time.Second, listenDelay, "missing access log entry: %s", entry)
+		})
+	}
+}
+
+func TestHTTP3RequiresTLS(t *testing.T) {
+	err := listenAndServeQuit(nil, &Options{Address: ":0", EnableHTTP3: true}, nil, nil, nil)
+	require.ErrorIs(t, err, errHTTP3WithoutTLS)
+}
+
 type (
 	customRatelimitSpec   struct{ registry *ratelimit.Registry }
 	customRatelimitFilter struct{}
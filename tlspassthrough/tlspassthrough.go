@@ -0,0 +1,370 @@
+/*
+Package tlspassthrough implements a listener, that forwards the TLS
+connections to the backends without terminating them, based on the
+server name (SNI) received in the TLS ClientHello.
+
+The connections are routed with the same routing table as the HTTP
+requests, using the SNI predicate, to routes with a tcp:// network
+backend or with load balanced tcp:// endpoints:
+
+	db: SNI("db.example.org") -> "tcp://10.0.0.5:5432";
+	mtls: SNI("mtls.example.org") -> <roundRobin, "tcp://10.0.1.1:443", "tcp://10.0.1.2:443">;
+
+The filters of the routes are not executed, because the connections are
+not handled as HTTP. Each connection is logged in the access log, when
+it is closed.
+*/
+package tlspassthrough
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/logging"
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/predicates/sni"
+	"github.com/zalando/skipper/routing"
+)
+
+const (
+	// DefaultHelloTimeout is used when Options.HelloTimeout is not set.
+	DefaultHelloTimeout = 10 * time.Second
+
+	// DefaultDialTimeout is used when Options.DialTimeout is not set.
+	DefaultDialTimeout = 10 * time.Second
+
+	backendScheme = "tcp"
+	protocol      = "TLS"
+
+	statusOK           = "ok"
+	statusInvalidHello = "invalidhello"
+	statusNoRoute      = "noroute"
+	statusBackendError = "backenderror"
+
+	connectionsKey       = "tlspassthrough.connections"
+	activeConnectionsKey = "tlspassthrough.active.connections"
+	invalidHelloKey      = "tlspassthrough.invalidhello"
+	noRouteKey           = "tlspassthrough.noroute"
+	routeKeyPrefix       = "tlspassthrough.route."
+)
+
+var errHelloRead = errors.New("client hello read")
+
+// Options are used to initialize the TLS passthrough proxy.
+type Options struct {
+
+	// Routing is used to look up the routes of the connections.
+	Routing *routing.Routing
+
+	// Metrics collects the number of connections, the transferred bytes
+	// and the duration of the connections. Defaults to metrics.Default.
+	Metrics metrics.Metrics
+
+	// HelloTimeout sets the time limit for receiving the TLS ClientHello.
+	// Defaults to DefaultHelloTimeout.
+	HelloTimeout time.Duration
+
+	// DialTimeout sets the time limit for connecting to the backend.
+	// Defaults to DefaultDialTimeout.
+	DialTimeout time.Duration
+
+	// AccessLogDisabled disables the access log of the connections.
+	AccessLogDisabled bool
+
+	// Log is used to log the errors. It defaults to logging.DefaultLog.
+	Log logging.Logger
+}
+
+// Proxy forwards the TLS connections to the backends.
+type Proxy struct {
+	options Options
+	active  int64
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{}
+	quit    chan struct{}
+	once    sync.Once
+}
+
+// readOnlyConn is used to parse the ClientHello with the crypto/tls
+// package, without responding to the client.
+type readOnlyConn struct {
+	reader io.Reader
+}
+
+func (c readOnlyConn) Read(p []byte) (int, error)     { return c.reader.Read(p) }
+func (readOnlyConn) Write([]byte) (int, error)        { return 0, io.ErrClosedPipe }
+func (readOnlyConn) Close() error                     { return nil }
+func (readOnlyConn) LocalAddr() net.Addr              { return nil }
+func (readOnlyConn) RemoteAddr() net.Addr             { return nil }
+func (readOnlyConn) SetDeadline(time.Time) error      { return nil }
+func (readOnlyConn) SetReadDeadline(time.Time) error  { return nil }
+func (readOnlyConn) SetWriteDeadline(time.Time) error { return nil }
+
+// countingReader counts the bytes read, while forwarding them.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	atomic.AddInt64(&r.count, int64(n))
+	return n, err
+}
+
+// New creates a TLS passthrough proxy.
+func New(o Options) *Proxy {
+	if o.Metrics == nil {
+		o.Metrics = metrics.Default
+	}
+
+	if o.HelloTimeout <= 0 {
+		o.HelloTimeout = DefaultHelloTimeout
+	}
+
+	if o.DialTimeout <= 0 {
+		o.DialTimeout = DefaultDialTimeout
+	}
+
+	if o.Log == nil {
+		o.Log = &logging.DefaultLog{}
+	}
+
+	return &Proxy{
+		options: o,
+		conns:   make(map[net.Conn]struct{}),
+		quit:    make(chan struct{}),
+	}
+}
+
+// readClientHello reads the TLS ClientHello from the reader, and returns
+// it without completing the handshake.
+func readClientHello(r io.Reader) (*tls.ClientHelloInfo, error) {
+	var hello *tls.ClientHelloInfo
+	err := tls.Server(readOnlyConn{reader: r}, &tls.Config{
+		GetConfigForClient: func(h *tls.ClientHelloInfo) (*tls.Config, error) {
+			hello = new(tls.ClientHelloInfo)
+			*hello = *h
+			return nil, errHelloRead
+		},
+	}).Handshake()
+
+	if hello == nil {
+		return nil, err
+	}
+
+	return hello, nil
+}
+
+// isTCPRoute checks whether the route forwards the connections, with a
+// tcp:// network backend, or with load balanced tcp:// endpoints.
+func isTCPRoute(r *routing.Route) bool {
+	switch r.BackendType {
+	case eskip.NetworkBackend:
+		return r.Scheme == backendScheme
+	case eskip.LBBackend:
+		for _, ep := range r.LBEndpoints {
+			if ep.Scheme != backendScheme {
+				return false
+			}
+		}
+
+		return len(r.LBEndpoints) > 0
+	default:
+		return false
+	}
+}
+
+func (p *Proxy) track(c net.Conn, add bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !add {
+		delete(p.conns, c)
+		return true
+	}
+
+	select {
+	case <-p.quit:
+		return false
+	default:
+		p.conns[c] = struct{}{}
+		return true
+	}
+}
+
+func (p *Proxy) routeKey(routeID, key string) string {
+	return routeKeyPrefix + routeID + "." + key
+}
+
+// Serve accepts the connections from the listener, and forwards them to
+// the backends, until the proxy is closed.
+func (p *Proxy) Serve(l net.Listener) error {
+	go func() {
+		<-p.quit
+		l.Close()
+	}()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			select {
+			case <-p.quit:
+				return nil
+			default:
+			}
+
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+
+			return err
+		}
+
+		go p.handle(c)
+	}
+}
+
+func (p *Proxy) handle(c net.Conn) {
+	if !p.track(c, true) {
+		c.Close()
+		return
+	}
+
+	defer p.track(c, false)
+	defer c.Close()
+
+	m := p.options.Metrics
+	m.IncCounter(connectionsKey)
+	m.UpdateGauge(activeConnectionsKey, float64(atomic.AddInt64(&p.active, 1)))
+	defer func() { m.UpdateGauge(activeConnectionsKey, float64(atomic.AddInt64(&p.active, -1))) }()
+
+	entry := &logging.ConnectionEntry{
+		RemoteAddr: c.RemoteAddr().String(),
+		Protocol:   protocol,
+		StartTime:  time.Now(),
+	}
+
+	if !p.options.AccessLogDisabled {
+		defer func() {
+			entry.Duration = time.Since(entry.StartTime)
+			logging.LogConnection(entry)
+		}()
+	}
+
+	// the ClientHello is replayed to the backend
+	var hello bytes.Buffer
+	c.SetReadDeadline(time.Now().Add(p.options.HelloTimeout))
+	info, err := readClientHello(io.TeeReader(c, &hello))
+	c.SetReadDeadline(time.Time{})
+	if err != nil {
+		entry.Status = statusInvalidHello
+		m.IncCounter(invalidHelloKey)
+		p.options.Log.Debugf("Failed to read the TLS ClientHello from %v: %v", c.RemoteAddr(), err)
+		return
+	}
+
+	entry.ServerName = info.ServerName
+	req := sni.NewRequest(info.ServerName, entry.RemoteAddr)
+	route, _ := p.options.Routing.Route(req)
+	if route == nil || !isTCPRoute(route) {
+		entry.Status = statusNoRoute
+		m.IncCounter(noRouteKey)
+		return
+	}
+
+	entry.RouteID = route.Id
+	m.IncCounter(p.routeKey(route.Id, "connections"))
+	defer m.MeasureSince(p.routeKey(route.Id, "duration"), entry.StartTime)
+
+	address := route.Host
+	if route.BackendType == eskip.LBBackend {
+		ep := route.LBAlgorithm.Apply(&routing.LBContext{Request: req, Route: route})
+		address = ep.Host
+		if ep.Metrics != nil {
+			ep.Metrics.IncInflightRequest()
+			defer ep.Metrics.DecInflightRequest()
+		}
+	}
+
+	entry.Backend = address
+	backend, err := net.DialTimeout("tcp", address, p.options.DialTimeout)
+	if err != nil {
+		entry.Status = statusBackendError
+		m.IncCounter(p.routeKey(route.Id, "backend.errors"))
+		p.options.Log.Errorf("Failed to connect to the backend %s of route %s: %v", address, route.Id, err)
+		return
+	}
+
+	defer backend.Close()
+	if _, err := backend.Write(hello.Bytes()); err != nil {
+		entry.Status = statusBackendError
+		m.IncCounter(p.routeKey(route.Id, "backend.errors"))
+		p.options.Log.Errorf("Failed to forward the TLS ClientHello to %s of route %s: %v", address, route.Id, err)
+		return
+	}
+
+	received := &countingReader{reader: c, count: int64(hello.Len())}
+	sent := &countingReader{reader: backend}
+	p.splice(c, backend, received, sent)
+
+	entry.Status = statusOK
+	entry.BytesReceived = atomic.LoadInt64(&received.count)
+	entry.BytesSent = atomic.LoadInt64(&sent.count)
+	m.IncCounterBy(p.routeKey(route.Id, "bytes.received"), entry.BytesReceived)
+	m.IncCounterBy(p.routeKey(route.Id, "bytes.sent"), entry.BytesSent)
+}
+
+// closeWrite closes the write side of the connection, when supported,
+// otherwise the whole connection.
+func closeWrite(c net.Conn) {
+	if cw, ok := c.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+		return
+	}
+
+	c.Close()
+}
+
+// splice copies the data in both directions, until both directions are
+// finished. When one of the directions is finished, its write side is
+// closed, so that the peer receives the EOF. On errors, e.g. when the
+// proxy is closed, both connections are closed.
+func (p *Proxy) splice(client, backend net.Conn, fromClient, fromBackend io.Reader) {
+	done := make(chan struct{}, 2)
+	copyConn := func(dst net.Conn, src io.Reader) {
+		if _, err := io.Copy(dst, src); err != nil {
+			client.Close()
+			backend.Close()
+		} else {
+			closeWrite(dst)
+		}
+
+		done <- struct{}{}
+	}
+
+	go copyConn(backend, fromClient)
+	go copyConn(client, fromBackend)
+	<-done
+	<-done
+}
+
+// Close stops accepting the connections, and closes the open
+// connections.
+func (p *Proxy) Close() {
+	p.once.Do(func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		close(p.quit)
+		for c := range p.conns {
+			c.Close()
+		}
+	})
+}
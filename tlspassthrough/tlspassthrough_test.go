@@ -0,0 +1,285 @@
+package tlspassthrough
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/loadbalancer"
+	"github.com/zalando/skipper/logging"
+	"github.com/zalando/skipper/logging/loggingtest"
+	"github.com/zalando/skipper/metrics/metricstest"
+	"github.com/zalando/skipper/predicates/sni"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// startBackend starts a TLS server, that responds to each line with its
+// name and the line.
+func startBackend(t *testing.T, name string) string {
+	cert, err := tls.LoadX509KeyPair("../fixtures/test.crt", "../fixtures/test.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer c.Close()
+				line, err := bufio.NewReader(c).ReadString('\n')
+				if err != nil {
+					return
+				}
+
+				fmt.Fprintf(c, "%s %s", name, line)
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func startProxy(t *testing.T, doc string) (string, *metricstest.MockMetrics) {
+	dc, err := testdataclient.NewDoc(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tl := loggingtest.New()
+	t.Cleanup(tl.Close)
+	rt := routing.New(routing.Options{
+		DataClients:    []routing.DataClient{dc},
+		PostProcessors: []routing.PostProcessor{loadbalancer.NewAlgorithmProvider()},
+		Predicates:     []routing.PredicateSpec{sni.New()},
+		Log:            tl,
+	})
+
+	t.Cleanup(rt.Close)
+	if err := tl.WaitFor("route settings applied", time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &metricstest.MockMetrics{}
+	p := New(Options{Routing: rt, Metrics: m, HelloTimeout: time.Second, Log: tl})
+	go p.Serve(l)
+	t.Cleanup(p.Close)
+	return l.Addr().String(), m
+}
+
+func request(address, serverName string) (string, error) {
+	c, err := tls.DialWithDialer(
+		&net.Dialer{Timeout: time.Second},
+		"tcp",
+		address,
+		&tls.Config{ServerName: serverName, InsecureSkipVerify: true},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(3 * time.Second))
+	if _, err := c.Write([]byte("hello\n")); err != nil {
+		return "", err
+	}
+
+	b, err := io.ReadAll(c)
+	return string(b), err
+}
+
+func waitFor(t *testing.T, f func() bool) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if f() {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("timeout")
+}
+
+func counter(m *metricstest.MockMetrics, key string) (v int64) {
+	m.WithCounters(func(c map[string]int64) { v = c[key] })
+	return
+}
+
+func TestPassthrough(t *testing.T) {
+	db := startBackend(t, "db")
+	lb1 := startBackend(t, "lb1")
+	lb2 := startBackend(t, "lb2")
+	address, m := startProxy(t, fmt.Sprintf(`
+		db: SNI("db.example.org") -> "tcp://%s";
+		lb: SNI("*.lb.example.org") -> <roundRobin, "tcp://%s", "tcp://%s">;
+		http: SNI("http.example.org") -> "https://%s";
+		catchAll: * -> "https://%s";
+	`, db, lb1, lb2, db, db))
+
+	rsp, err := request(address, "db.example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rsp != "db hello\n" {
+		t.Errorf("unexpected response: %q", rsp)
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		rsp, err := request(address, "www.lb.example.org")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		seen[strings.Fields(rsp)[0]] = true
+	}
+
+	if !seen["lb1"] || !seen["lb2"] {
+		t.Errorf("failed to load balance: %v", seen)
+	}
+
+	// the matching routes don't have a tcp:// backend
+	for _, name := range []string{"http.example.org", "unknown.example.org"} {
+		if rsp, err := request(address, name); err == nil {
+			t.Errorf("failed to fail for %s: %q", name, rsp)
+		}
+	}
+
+	waitFor(t, func() bool { return counter(m, "tlspassthrough.route.db.bytes.sent") > 0 })
+	for key, expected := range map[string]int64{
+		"tlspassthrough.connections":          7,
+		"tlspassthrough.noroute":              2,
+		"tlspassthrough.route.db.connections": 1,
+		"tlspassthrough.route.lb.connections": 4,
+	} {
+		if v := counter(m, key); v != expected {
+			t.Errorf("unexpected counter %s: %d, expected: %d", key, v, expected)
+		}
+	}
+
+	if v := counter(m, "tlspassthrough.route.db.bytes.received"); v <= int64(len("hello\n")) {
+		t.Errorf("unexpected received bytes: %d", v)
+	}
+
+	waitFor(t, func() bool {
+		v, ok := m.Gauge("tlspassthrough.active.connections")
+		return ok && v == 0
+	})
+}
+
+func TestInvalidHello(t *testing.T) {
+	address, m := startProxy(t, `* -> "tcp://127.0.0.1:1"`)
+	c, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(3 * time.Second))
+	if _, err := c.Write([]byte("GET / HTTP/1.1\r\nHost: www.example.org\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("failed to close the connection: %v", err)
+	}
+
+	waitFor(t, func() bool { return counter(m, "tlspassthrough.invalidhello") == 1 })
+}
+
+func TestBackendError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closed := l.Addr().String()
+	l.Close()
+
+	address, m := startProxy(t, fmt.Sprintf(`db: SNI("db.example.org") -> "tcp://%s"`, closed))
+	if rsp, err := request(address, "db.example.org"); err == nil {
+		t.Errorf("failed to fail: %q", rsp)
+	}
+
+	waitFor(t, func() bool { return counter(m, "tlspassthrough.route.db.backend.errors") == 1 })
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf syncBuffer
+	logging.Init(logging.Options{AccessLogOutput: &buf})
+	defer logging.Init(logging.Options{})
+
+	db := startBackend(t, "db")
+	address, _ := startProxy(t, fmt.Sprintf(`db: SNI("db.example.org") -> "tcp://%s"`, db))
+	if _, err := request(address, "db.example.org"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := request(address, "unknown.example.org"); err == nil {
+		t.Fatal("failed to fail")
+	}
+
+	waitFor(t, func() bool { return strings.Count(buf.String(), "\n") == 2 })
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expected := map[string]string{
+		"db.example.org":      fmt.Sprintf(`"TLS db.example.org %s" ok `, db),
+		"unknown.example.org": `"TLS unknown.example.org -" noroute 0 0 `,
+	}
+
+	for _, line := range lines {
+		for name, e := range expected {
+			if strings.Contains(line, " "+name+" ") {
+				if !strings.Contains(line, e) || !strings.HasPrefix(line, "127.0.0.1 - - [") {
+					t.Errorf("unexpected access log entry: %s", line)
+				}
+
+				delete(expected, name)
+			}
+		}
+	}
+
+	if len(expected) > 0 {
+		t.Errorf("missing access log entries: %v, got: %s", expected, lines)
+	}
+}